@@ -0,0 +1,191 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	"github.com/naval-group/butane-operator/api/v1beta1"
+	"github.com/naval-group/butane-operator/internal/schema"
+)
+
+// AnnotationSpec keeps the v1beta1 fields v1alpha1 cannot express, so that a
+// v1beta1 object read and written back through v1alpha1 does not lose them.
+const AnnotationSpec = "butane.operators.naval-group.com/v1beta1-spec"
+
+// AnnotationStatus keeps the v1beta1 status fields v1alpha1 cannot express.
+const AnnotationStatus = "butane.operators.naval-group.com/v1beta1-status"
+
+// ConvertTo converts this ButaneConfig to the hub version.
+func (src *ButaneConfig) ConvertTo(dstRaw conversion.Hub) error {
+	dst, ok := dstRaw.(*v1beta1.ButaneConfig)
+	if !ok {
+		return fmt.Errorf("unsupported conversion to %T", dstRaw)
+	}
+
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	dst.Spec = v1beta1.ButaneConfigSpec{}
+	if stashed, ok := src.Annotations[AnnotationSpec]; ok {
+		if err := json.Unmarshal([]byte(stashed), &dst.Spec); err != nil {
+			return fmt.Errorf("invalid %s annotation: %w", AnnotationSpec, err)
+		}
+		delete(dst.Annotations, AnnotationSpec)
+	}
+	dst.Status = v1beta1.ButaneConfigStatus{}
+	if stashed, ok := src.Annotations[AnnotationStatus]; ok {
+		if err := json.Unmarshal([]byte(stashed), &dst.Status); err != nil {
+			return fmt.Errorf("invalid %s annotation: %w", AnnotationStatus, err)
+		}
+		delete(dst.Annotations, AnnotationStatus)
+	}
+	if len(dst.Annotations) == 0 {
+		dst.Annotations = nil
+	}
+
+	// Configs the typed schema of v1beta1 does not describe would be pruned
+	// there, so they go to rawConfig.
+	dst.Spec.Config = nil
+	dst.Spec.RawConfig = nil
+	if src.Spec.Config.Raw != nil {
+		if coveredBySchema(src.Spec.Config.Raw) {
+			dst.Spec.Config = src.Spec.Config.DeepCopy()
+		} else {
+			dst.Spec.RawConfig = src.Spec.Config.DeepCopy()
+		}
+	}
+	dst.Spec.Output.Encryption = nil
+	dst.Spec.Output.Signing = nil
+	if out := src.Spec.Output; out != nil {
+		if out.Encryption != nil {
+			dst.Spec.Output.Encryption = &v1beta1.EncryptionSpec{
+				Mode:          v1beta1.EncryptionMode(out.Encryption.Mode),
+				RecipientsRef: out.Encryption.RecipientsRef.DeepCopy(),
+			}
+			if remote := out.Encryption.Remote; remote != nil {
+				dst.Spec.Output.Encryption.Remote = &v1beta1.RemoteSourceSpec{
+					URL:              remote.URL,
+					Paths:            append([]string(nil), remote.Paths...),
+					HeadersSecretRef: remote.HeadersSecretRef.DeepCopy(),
+				}
+			}
+		}
+		if out.Signing != nil {
+			dst.Spec.Output.Signing = &v1beta1.SigningSpec{KeySecretRef: *out.Signing.KeySecretRef.DeepCopy()}
+		}
+	}
+
+	dst.Status.SecretName = src.Status.SecretName
+	dst.Status.FilesSecretName = src.Status.FilesSecretName
+	dst.Status.Conditions = nil
+	for _, c := range src.Status.Conditions {
+		dst.Status.Conditions = append(dst.Status.Conditions, *c.DeepCopy())
+	}
+	return nil
+}
+
+// ConvertFrom converts from the hub version to this version.
+func (dst *ButaneConfig) ConvertFrom(srcRaw conversion.Hub) error {
+	src, ok := srcRaw.(*v1beta1.ButaneConfig)
+	if !ok {
+		return fmt.Errorf("unsupported conversion from %T", srcRaw)
+	}
+
+	src.ObjectMeta.DeepCopyInto(&dst.ObjectMeta)
+	stash := src.Spec.DeepCopy()
+	stash.Config = nil
+	stash.RawConfig = nil
+	stash.Output.Encryption = nil
+	stash.Output.Signing = nil
+	if !reflect.DeepEqual(*stash, v1beta1.ButaneConfigSpec{}) {
+		data, err := json.Marshal(stash)
+		if err != nil {
+			return err
+		}
+		if dst.Annotations == nil {
+			dst.Annotations = map[string]string{}
+		}
+		dst.Annotations[AnnotationSpec] = string(data)
+	}
+	status := src.Status.DeepCopy()
+	status.SecretName = ""
+	status.FilesSecretName = ""
+	status.Conditions = nil
+	if !reflect.DeepEqual(*status, v1beta1.ButaneConfigStatus{}) {
+		data, err := json.Marshal(status)
+		if err != nil {
+			return err
+		}
+		if dst.Annotations == nil {
+			dst.Annotations = map[string]string{}
+		}
+		dst.Annotations[AnnotationStatus] = string(data)
+	}
+
+	// Butane text and ConfigMap sources only live in the annotation
+	dst.Spec = ButaneConfigSpec{}
+	if src.Spec.Config != nil {
+		dst.Spec.Config = *src.Spec.Config.DeepCopy()
+	} else if src.Spec.RawConfig != nil {
+		dst.Spec.Config = *src.Spec.RawConfig.DeepCopy()
+	}
+	out := src.Spec.Output
+	if out.Encryption != nil || out.Signing != nil {
+		dst.Spec.Output = &OutputSpec{}
+	}
+	if out.Encryption != nil {
+		dst.Spec.Output.Encryption = &EncryptionSpec{
+			Mode:          EncryptionMode(out.Encryption.Mode),
+			RecipientsRef: out.Encryption.RecipientsRef.DeepCopy(),
+		}
+		if remote := out.Encryption.Remote; remote != nil {
+			dst.Spec.Output.Encryption.Remote = &RemoteSourceSpec{
+				URL:              remote.URL,
+				Paths:            append([]string(nil), remote.Paths...),
+				HeadersSecretRef: remote.HeadersSecretRef.DeepCopy(),
+			}
+		}
+	}
+	if out.Signing != nil {
+		dst.Spec.Output.Signing = &SigningSpec{KeySecretRef: *out.Signing.KeySecretRef.DeepCopy()}
+	}
+
+	dst.Status = ButaneConfigStatus{
+		SecretName:      src.Status.SecretName,
+		FilesSecretName: src.Status.FilesSecretName,
+	}
+	for _, c := range src.Status.Conditions {
+		dst.Status.Conditions = append(dst.Status.Conditions, *c.DeepCopy())
+	}
+	return nil
+}
+
+// coveredBySchema reports whether the typed schema of v1beta1 spec.config
+// describes the variant and version of a Butane config.
+func coveredBySchema(raw []byte) bool {
+	var header struct {
+		Variant string `json:"variant"`
+		Version string `json:"version"`
+	}
+	if err := json.Unmarshal(raw, &header); err != nil {
+		return false
+	}
+	return schema.Covers(header.Variant, header.Version)
+}
@@ -0,0 +1,200 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1alpha1
+
+import (
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/utils/ptr"
+
+	"github.com/naval-group/butane-operator/api/v1beta1"
+)
+
+var config = runtime.RawExtension{Raw: []byte(`{"variant":"fcos","version":"1.5.0"}`)}
+
+var conditions = []metav1.Condition{{
+	Type:               "Ready",
+	Status:             metav1.ConditionTrue,
+	Reason:             "Rendered",
+	LastTransitionTime: metav1.Unix(1714564800, 0),
+}}
+
+func TestConvertAlphaRoundTrip(t *testing.T) {
+	for name, spec := range map[string]ButaneConfigSpec{
+		"config only": {Config: config},
+		"age": {Config: config, Output: &OutputSpec{
+			Encryption: &EncryptionSpec{
+				Mode:          EncryptionModeAge,
+				RecipientsRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "recipients"}, Key: "age"},
+			},
+		}},
+		"remote and signing": {Config: config, Output: &OutputSpec{
+			Encryption: &EncryptionSpec{
+				Mode: EncryptionModeRemote,
+				Remote: &RemoteSourceSpec{
+					URL:              "https://files.example.com",
+					Paths:            []string{"/etc/secret"},
+					HeadersSecretRef: &corev1.LocalObjectReference{Name: "headers"},
+				},
+			},
+			Signing: &SigningSpec{KeySecretRef: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "key"}, Key: "key.pem"}},
+		}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			src := &ButaneConfig{
+				ObjectMeta: metav1.ObjectMeta{Name: "motd", Namespace: "default", Labels: map[string]string{"app": "motd"}},
+				Spec:       spec,
+				Status:     ButaneConfigStatus{SecretName: "motd-ignition", Conditions: conditions},
+			}
+			hub := &v1beta1.ButaneConfig{}
+			if err := src.ConvertTo(hub); err != nil {
+				t.Fatal(err)
+			}
+			if hub.Status.SecretName != "motd-ignition" || len(hub.Status.Conditions) != 1 {
+				t.Errorf("status not converted: %+v", hub.Status)
+			}
+			dst := &ButaneConfig{}
+			if err := dst.ConvertFrom(hub); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(src, dst) {
+				t.Errorf("round trip changed the object:\n got %+v\nwant %+v", dst, src)
+			}
+		})
+	}
+}
+
+func TestConvertHubRoundTrip(t *testing.T) {
+	src := &v1beta1.ButaneConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "motd", Namespace: "default", Annotations: map[string]string{"team": "infra"}},
+		Spec: v1beta1.ButaneConfigSpec{
+			Config: config.DeepCopy(),
+			Translation: v1beta1.TranslationSpec{
+				Strict:                    ptr.To(false),
+				Pretty:                    true,
+				NoResourceAutoCompression: true,
+			},
+			Output: v1beta1.OutputSpec{
+				Signing: &v1beta1.SigningSpec{KeySecretRef: corev1.SecretKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "key"}, Key: "key.pem"}},
+			},
+		},
+		Status: v1beta1.ButaneConfigStatus{
+			SecretName:         "motd-ignition",
+			FilesSecretName:    "motd-ignition-files",
+			SpilledSecretNames: []string{"motd-ignition-spill-0"},
+			AppliedPolicies:    []string{"chrony"},
+			PinnedImages:       []v1beta1.PinnedImage{{Image: "nginx:alpine", Digest: "sha256:0123"}},
+			LintFindings:       []v1beta1.LintFinding{{Rule: "PathConflict", Location: "file /etc/hosts", Message: "written twice"}},
+			OCIArtifact:        &v1beta1.OCIArtifact{Repository: "registry.example.com/motd", Digest: "sha256:4567", Tags: []string{"latest"}},
+			S3Object:           &v1beta1.S3Object{Endpoint: "https://s3.example.com", Bucket: "ignition", Key: "motd.ign"},
+			PointerSecretName:  "motd-ignition-pointer",
+			Variant:            "fcos",
+			IgnitionVersion:    "3.4.0",
+			Conditions:         conditions,
+		},
+	}
+
+	alpha := &ButaneConfig{}
+	if err := alpha.ConvertFrom(src); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := alpha.Annotations[AnnotationSpec]; !ok {
+		t.Errorf("v1beta1 only fields should be kept in the %s annotation", AnnotationSpec)
+	}
+	if _, ok := alpha.Annotations[AnnotationStatus]; !ok {
+		t.Errorf("v1beta1 only status fields should be kept in the %s annotation", AnnotationStatus)
+	}
+	if alpha.Status.SecretName != "motd-ignition" || alpha.Status.FilesSecretName != "motd-ignition-files" || len(alpha.Status.Conditions) != 1 {
+		t.Errorf("status not converted: %+v", alpha.Status)
+	}
+	if _, ok := src.Annotations[AnnotationSpec]; ok {
+		t.Error("conversion should not modify the source object")
+	}
+	if alpha.Spec.Output == nil || alpha.Spec.Output.Signing == nil || alpha.Spec.Output.Encryption != nil {
+		t.Errorf("unexpected output %+v", alpha.Spec.Output)
+	}
+
+	dst := &v1beta1.ButaneConfig{}
+	if err := alpha.ConvertTo(dst); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(src, dst) {
+		t.Errorf("round trip changed the object:\n got %+v\nwant %+v", dst, src)
+	}
+}
+
+func TestConvertFromHubWithoutExtraFields(t *testing.T) {
+	alpha := &ButaneConfig{}
+	if err := alpha.ConvertFrom(&v1beta1.ButaneConfig{Spec: v1beta1.ButaneConfigSpec{Config: config.DeepCopy()}}); err != nil {
+		t.Fatal(err)
+	}
+	if alpha.Annotations != nil || alpha.Spec.Output != nil {
+		t.Errorf("unexpected conversion %+v", alpha)
+	}
+}
+
+func TestConvertUncoveredVersionToRawConfig(t *testing.T) {
+	experimental := runtime.RawExtension{Raw: []byte(`{"variant":"fcos","version":"1.8.0-experimental"}`)}
+	src := &ButaneConfig{Spec: ButaneConfigSpec{Config: experimental}}
+
+	hub := &v1beta1.ButaneConfig{}
+	if err := src.ConvertTo(hub); err != nil {
+		t.Fatal(err)
+	}
+	if hub.Spec.Config != nil || hub.Spec.RawConfig == nil || string(hub.Spec.RawConfig.Raw) != string(experimental.Raw) {
+		t.Errorf("a version the schema does not cover should go to rawConfig, got %+v", hub.Spec)
+	}
+
+	dst := &ButaneConfig{}
+	if err := dst.ConvertFrom(hub); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(src, dst) {
+		t.Errorf("round trip changed the object:\n got %+v\nwant %+v", dst, src)
+	}
+}
+
+func TestConvertButaneTextRoundTrip(t *testing.T) {
+	src := &v1beta1.ButaneConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "motd", Namespace: "default"},
+		Spec: v1beta1.ButaneConfigSpec{
+			Butane: "variant: fcos\nversion: 1.5.0\n# keep me\n",
+			Output: v1beta1.OutputSpec{
+				IgnitionVersion: "3.2.0",
+				Size:            &v1beta1.SizeSpec{Spill: &v1beta1.SpillSpec{URL: "https://files.example.com"}},
+			},
+		},
+	}
+	alpha := &ButaneConfig{}
+	if err := alpha.ConvertFrom(src); err != nil {
+		t.Fatal(err)
+	}
+	if alpha.Spec.Config.Raw != nil {
+		t.Errorf("Butane text should not be copied to spec.config, got %s", alpha.Spec.Config.Raw)
+	}
+	dst := &v1beta1.ButaneConfig{}
+	if err := alpha.ConvertTo(dst); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(src, dst) {
+		t.Errorf("round trip changed the object:\n got %+v\nwant %+v", dst, src)
+	}
+}
@@ -17,6 +17,7 @@ limitations under the License.
 package v1alpha1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 )
@@ -26,6 +27,84 @@ type ButaneConfigSpec struct {
 	// An object that follows Butane specifications.
 	// More info: https://coreos.github.io/butane/specs/
 	Config runtime.RawExtension `json:"config,omitempty"`
+
+	// Output configures how the generated Ignition is stored.
+	// +optional
+	Output *OutputSpec `json:"output,omitempty"`
+}
+
+// OutputSpec configures the generated Ignition Secret.
+type OutputSpec struct {
+	// Encryption protects sensitive content of the generated Ignition,
+	// which is otherwise only base64 encoded in the Secret.
+	// +optional
+	Encryption *EncryptionSpec `json:"encryption,omitempty"`
+
+	// Signing adds a detached signature and a signed provenance document
+	// next to userdata in the generated Secret.
+	// +optional
+	Signing *SigningSpec `json:"signing,omitempty"`
+}
+
+// SigningSpec configures the signing of the generated Ignition.
+type SigningSpec struct {
+	// KeySecretRef selects a Secret key holding the PEM encoded Ed25519 or
+	// ECDSA private key used to sign. PKCS#8 and, for ECDSA, SEC 1 keys are accepted.
+	KeySecretRef corev1.SecretKeySelector `json:"keySecretRef"`
+}
+
+// EncryptionMode selects how the generated Ignition is protected.
+// +kubebuilder:validation:Enum=age;remote
+type EncryptionMode string
+
+const (
+	// EncryptionModeAge encrypts the whole Ignition config to age recipients.
+	// Consumers decrypt it with one of the matching identities before use.
+	EncryptionModeAge EncryptionMode = "age"
+	// EncryptionModeRemote keeps the Ignition config usable as is, but moves the
+	// contents of sensitive files to a separate Secret. Ignition fetches them from
+	// an authenticated endpoint and verifies them against the hash in the config.
+	EncryptionModeRemote EncryptionMode = "remote"
+)
+
+// EncryptionSpec configures the protection of the generated Ignition.
+type EncryptionSpec struct {
+	// Mode is either age or remote.
+	// +kubebuilder:default=age
+	// +optional
+	Mode EncryptionMode `json:"mode,omitempty"`
+
+	// RecipientsRef selects a ConfigMap key listing the age recipients, one per
+	// line. Native age (age1...) and SSH (ssh-ed25519, ssh-rsa) public keys are
+	// accepted; empty lines and lines starting with # are ignored.
+	// Required when mode is age.
+	// +optional
+	RecipientsRef *corev1.ConfigMapKeySelector `json:"recipientsRef,omitempty"`
+
+	// Remote configures where Ignition fetches sensitive files from.
+	// Required when mode is remote.
+	// +optional
+	Remote *RemoteSourceSpec `json:"remote,omitempty"`
+}
+
+// RemoteSourceSpec describes the endpoint that serves the contents of the
+// files moved out of the Ignition config. The contents are stored in the
+// Secret named in status.filesSecretName, one key per file, and must be served
+// at URL/<key>.
+type RemoteSourceSpec struct {
+	// URL is the base URL the files are served from.
+	// +kubebuilder:validation:MinLength=1
+	URL string `json:"url"`
+
+	// Paths lists the files to move out of the Ignition config. When empty,
+	// every file with inline contents is moved.
+	// +optional
+	Paths []string `json:"paths,omitempty"`
+
+	// HeadersSecretRef references a Secret whose keys and values are sent as
+	// HTTP headers when fetching the files, e.g. an Authorization header.
+	// +optional
+	HeadersSecretRef *corev1.LocalObjectReference `json:"headersSecretRef,omitempty"`
 }
 
 // ButaneConfigStatus defines the observed state of ButaneConfig
@@ -33,10 +112,25 @@ type ButaneConfigStatus struct {
 	// The name of the generated secret containing the ignition content in userdata key
 	// More info: https://coreos.github.io/ignition/specs/
 	SecretName string `json:"secretName,omitempty"`
+
+	// FilesSecretName is the name of the Secret holding the contents of the
+	// files moved out of the Ignition config by the remote encryption mode.
+	// +optional
+	FilesSecretName string `json:"filesSecretName,omitempty"`
+
+	// Conditions represent the latest available observations of the ButaneConfig state.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
+//+kubebuilder:deprecatedversion:warning="butane.operators.naval-group.com/v1alpha1 ButaneConfig is deprecated; use butane.operators.naval-group.com/v1beta1"
+//+kubebuilder:printcolumn:name="Secret",type=string,JSONPath=`.status.secretName`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
 
 // ButaneConfig is a resource that transplane Butane config
 // into an Ignition formatted secret.
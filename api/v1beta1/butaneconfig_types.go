@@ -0,0 +1,740 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/naval-group/butane-operator/internal/render"
+)
+
+// ButaneConfigSpec defines the desired state of ButaneConfig
+type ButaneConfigSpec struct {
+	// Config is the Butane config to translate. Its schema is generated from
+	// the Butane specifications by hack/butane-schema.
+	// More info: https://coreos.github.io/butane/specs/
+	// +optional
+	Config *runtime.RawExtension `json:"config,omitempty"`
+
+	// RawConfig is a Butane config the API server does not validate, for
+	// versions the schema of config does not cover, e.g. experimental ones.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +optional
+	RawConfig *runtime.RawExtension `json:"rawConfig,omitempty"`
+
+	// Butane is a Butane config in YAML. It is translated as written, so
+	// comments, formatting and octal modes are kept, and errors report the
+	// line and column of this text.
+	// +optional
+	Butane string `json:"butane,omitempty"`
+
+	// ButaneFrom selects a ConfigMap key holding a Butane config in YAML.
+	// Exactly one of config, rawConfig, butane and butaneFrom must be set.
+	// +optional
+	ButaneFrom *corev1.ConfigMapKeySelector `json:"butaneFrom,omitempty"`
+
+	// MergeFrom lists ClusterButaneConfigs the translated config is merged
+	// over, in order, the way Ignition merges configs: later entries, and
+	// this config last, override files, units and other entries with the
+	// same key of earlier ones.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	MergeFrom []ClusterButaneConfigReference `json:"mergeFrom,omitempty"`
+
+	// Users adds SSH authorized keys read from Secrets, ConfigMaps or the
+	// user directory of the operator to passwd.users, so that rotating or
+	// revoking a key re-renders every config granting it, and sets password
+	// hashes from plaintext passwords kept in Secrets. The keys are added to
+	// those the config sets for the same user.
+	// +listType=map
+	// +listMapKey=name
+	// +optional
+	Users []UserSpec `json:"users,omitempty"`
+
+	// Images pins the container images the config runs to the digests their
+	// registries serve, so that every boot runs the same images.
+	// +optional
+	Images ImagesSpec `json:"images,omitempty"`
+
+	// Translation configures the Butane to Ignition translation.
+	// +optional
+	Translation TranslationSpec `json:"translation,omitempty"`
+
+	// Output configures how the generated Ignition is stored.
+	// +optional
+	Output OutputSpec `json:"output,omitempty"`
+}
+
+// Source returns the Butane config to translate, from config, rawConfig or
+// butane. It returns nil for butaneFrom, which the caller has to resolve.
+func (s *ButaneConfigSpec) Source() []byte {
+	if s.Butane != "" {
+		return []byte(s.Butane)
+	}
+	if s.RawConfig != nil {
+		return s.RawConfig.Raw
+	}
+	if s.Config != nil {
+		return s.Config.Raw
+	}
+	return nil
+}
+
+// UserSpec names a user and where its SSH authorized keys come from.
+type UserSpec struct {
+	// Name is the name of the user in passwd.users.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+
+	// SSHAuthorizedKeysFrom lists the sources of the SSH authorized keys of
+	// the user. The keys of every source are added.
+	// +optional
+	SSHAuthorizedKeysFrom []SSHAuthorizedKeysSource `json:"sshAuthorizedKeysFrom,omitempty"`
+
+	// PasswordFrom selects the Secret key holding the plaintext password of
+	// the user. It is hashed with SHA-512 crypt into the password hash of the
+	// user when the config is rendered; the plaintext is never stored in the
+	// output. At least one of sshAuthorizedKeysFrom and passwordFrom must be
+	// set.
+	// +optional
+	PasswordFrom *corev1.SecretKeySelector `json:"passwordFrom,omitempty"`
+}
+
+// SSHAuthorizedKeysSource selects SSH authorized keys. Exactly one field must
+// be set.
+type SSHAuthorizedKeysSource struct {
+	// SecretSelector selects the Secrets of the namespace holding keys. Every
+	// value of a selected Secret is read as an authorized_keys file.
+	// +optional
+	SecretSelector *metav1.LabelSelector `json:"secretSelector,omitempty"`
+
+	// ConfigMapSelector selects the ConfigMaps of the namespace holding keys.
+	// Every value of a selected ConfigMap is read as an authorized_keys file.
+	// +optional
+	ConfigMapSelector *metav1.LabelSelector `json:"configMapSelector,omitempty"`
+
+	// Directory reads the keys of the user from the user directory file the
+	// operator is configured with, see users.directoryFile of the operator
+	// config. A user the directory does not list gets no keys from it.
+	// +optional
+	Directory bool `json:"directory,omitempty"`
+}
+
+// ImagesSpec configures the pinning of the container images of the config.
+type ImagesSpec struct {
+	// Pin rewrites the image references of podman and docker run, create and
+	// pull commands in systemd units, of Podman quadlet files and of compose
+	// files to their digest, e.g. nginx:alpine to nginx:alpine@sha256:...
+	// The digests are recorded in status.pinnedImages and kept until the
+	// reference changes; turn pinning off and on again to resolve every tag
+	// anew.
+	// +optional
+	Pin bool `json:"pin,omitempty"`
+
+	// PullSecretRef references a kubernetes.io/dockerconfigjson Secret
+	// holding the credentials of the registries of private images.
+	// +optional
+	PullSecretRef *corev1.LocalObjectReference `json:"pullSecretRef,omitempty"`
+}
+
+// TranslationSpec configures the Butane to Ignition translation.
+type TranslationSpec struct {
+	// Strict fails the translation when Butane reports any warning, so that a
+	// config never silently loses content on its way to Ignition. Defaults to true.
+	// +kubebuilder:default=true
+	// +optional
+	Strict *bool `json:"strict,omitempty"`
+
+	// Pretty indents the generated Ignition JSON.
+	// +optional
+	Pretty bool `json:"pretty,omitempty"`
+
+	// NoResourceAutoCompression stops Butane, and the operator for data URLs
+	// written as is, from compressing inline file contents to keep the
+	// Ignition config small.
+	// +optional
+	NoResourceAutoCompression bool `json:"noResourceAutoCompression,omitempty"`
+}
+
+// IsStrict reports whether warnings fail the translation.
+func (t TranslationSpec) IsStrict() bool {
+	return t.Strict == nil || *t.Strict
+}
+
+// RenderOptions returns the options to translate the config with.
+func (t TranslationSpec) RenderOptions() render.Options {
+	return render.Options{
+		AllowWarnings:             !t.IsStrict(),
+		Pretty:                    t.Pretty,
+		NoResourceAutoCompression: t.NoResourceAutoCompression,
+	}
+}
+
+// OutputSpec configures the generated Ignition Secret.
+type OutputSpec struct {
+	// IgnitionVersion pins the Ignition specification version of the output,
+	// for hosts whose Ignition does not accept the version Butane emits. The
+	// config is translated up or down to it; the translation fails when the
+	// config uses features the version cannot represent. Defaults to the
+	// version the Butane specification emits.
+	// +kubebuilder:validation:Enum="3.0.0";"3.1.0";"3.2.0";"3.3.0";"3.4.0";"3.5.0";"3.6.0"
+	// +optional
+	IgnitionVersion string `json:"ignitionVersion,omitempty"`
+
+	// Encryption protects sensitive content of the generated Ignition,
+	// which is otherwise only base64 encoded in the Secret.
+	// +optional
+	Encryption *EncryptionSpec `json:"encryption,omitempty"`
+
+	// Signing adds a detached signature and a signed provenance document
+	// next to userdata in the generated Secret.
+	// +optional
+	Signing *SigningSpec `json:"signing,omitempty"`
+
+	// Size keeps the generated Ignition within the limits of the Secret it is
+	// stored in and of the consumers it is passed to.
+	// +optional
+	Size *SizeSpec `json:"size,omitempty"`
+
+	// OCI also pushes the generated Ignition to an OCI registry, as an
+	// artifact annotated with its signature and provenance.
+	// +optional
+	OCI *OCISpec `json:"oci,omitempty"`
+
+	// S3 also uploads the generated Ignition to an S3 compatible object
+	// storage, for hosts fetching their config from a URL. The object is
+	// deleted along with the ButaneConfig.
+	// +optional
+	S3 *S3Spec `json:"s3,omitempty"`
+
+	// RevisionHistoryLimit is the number of earlier revisions of the
+	// generated Ignition kept in <secret>-rev-<revision> Secrets, for
+	// "kubectl butane diff" to compare. Defaults to 3; 0 keeps none.
+	// +kubebuilder:validation:Minimum=0
+	// +optional
+	RevisionHistoryLimit *int32 `json:"revisionHistoryLimit,omitempty"`
+}
+
+// OCISpec describes the OCI repository the generated Ignition is pushed to.
+// The artifact is tagged generation-<generation> and sha256-<hex digest of the
+// Ignition>, and its digest recorded in status.ociArtifact.
+type OCISpec struct {
+	// Repository is the repository the artifact is pushed to, without tag or
+	// digest, e.g. registry.example.com/boot/web.
+	// +kubebuilder:validation:MinLength=1
+	Repository string `json:"repository"`
+
+	// PushSecretRef references a kubernetes.io/dockerconfigjson Secret with
+	// the credentials of the registry.
+	// +optional
+	PushSecretRef *corev1.LocalObjectReference `json:"pushSecretRef,omitempty"`
+}
+
+// S3Spec describes the S3 object the generated Ignition is uploaded to. The
+// location and digest of the object are recorded in status.s3Object; an object
+// left behind by a change of the location is deleted.
+type S3Spec struct {
+	// Endpoint is the URL of the S3 API, e.g. https://s3.eu-west-3.amazonaws.com
+	// or the URL of a MinIO server. Buckets are addressed by path.
+	// +kubebuilder:validation:Pattern=`^https?://`
+	Endpoint string `json:"endpoint"`
+
+	// Region signs the requests. Defaults to us-east-1, which S3 compatible
+	// storages without regions accept.
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// Bucket is the bucket the object is uploaded to.
+	// +kubebuilder:validation:MinLength=1
+	Bucket string `json:"bucket"`
+
+	// Key is the key of the object, in which {namespace}, {name} and
+	// {generation} are replaced with those of the ButaneConfig. Defaults to
+	// {namespace}/{name}.ign.
+	// +optional
+	Key string `json:"key,omitempty"`
+
+	// CredentialsSecretRef references a Secret with the AWS_ACCESS_KEY_ID and
+	// AWS_SECRET_ACCESS_KEY keys of the storage account, and AWS_SESSION_TOKEN
+	// for temporary credentials.
+	CredentialsSecretRef corev1.LocalObjectReference `json:"credentialsSecretRef"`
+
+	// PresignedURL writes a pointer Ignition config, replacing itself with the
+	// object fetched from a pre-signed URL, to the <name>-ignition-pointer
+	// Secret, so that hosts fetch their config without storage credentials.
+	// +optional
+	PresignedURL *PresignedURLSpec `json:"presignedURL,omitempty"`
+}
+
+// PresignedURLSpec configures the pre-signed URL of the pointer Ignition config.
+type PresignedURLSpec struct {
+	// Expiry is how long the URL is valid, from a second to 168h. The URL and
+	// the pointer config are renewed once half of it has passed, so hosts
+	// must fetch the pointer config again by then. Defaults to 24h.
+	// +optional
+	Expiry *metav1.Duration `json:"expiry,omitempty"`
+}
+
+// DefaultS3Key is the key template of S3 objects when spec.output.s3.key is
+// not set.
+const DefaultS3Key = "{namespace}/{name}.ign"
+
+// DefaultPresignedURLExpiry is the validity of pre-signed URLs when
+// spec.output.s3.presignedURL.expiry is not set.
+const DefaultPresignedURLExpiry = 24 * time.Hour
+
+// ObjectKey returns the key of the object of the ButaneConfig namespace/name
+// at generation.
+func (s S3Spec) ObjectKey(namespace, name string, generation int64) string {
+	key := s.Key
+	if key == "" {
+		key = DefaultS3Key
+	}
+	return strings.NewReplacer(
+		"{namespace}", namespace,
+		"{name}", name,
+		"{generation}", strconv.FormatInt(generation, 10),
+	).Replace(key)
+}
+
+// ExpiryDuration returns how long the pre-signed URL is valid.
+func (p PresignedURLSpec) ExpiryDuration() time.Duration {
+	if p.Expiry == nil {
+		return DefaultPresignedURLExpiry
+	}
+	return p.Expiry.Duration
+}
+
+// DefaultSizeLimit is the largest data of the generated Secret when
+// spec.output.size.limit is not set: the 1 MiB the API server accepts.
+var DefaultSizeLimit = resource.MustParse("1Mi")
+
+// DefaultSpillThreshold is the inline contents size above which files are
+// spilled when spec.output.size.spill.threshold is not set.
+var DefaultSpillThreshold = resource.MustParse("64Ki")
+
+// SizeLimit returns the largest data of the generated Secret, in bytes.
+func (o OutputSpec) SizeLimit() int64 {
+	if o.Size != nil && o.Size.Limit != nil {
+		return o.Size.Limit.Value()
+	}
+	return DefaultSizeLimit.Value()
+}
+
+// DefaultRevisionHistoryLimit is the number of earlier revisions kept when
+// spec.output.revisionHistoryLimit is not set.
+const DefaultRevisionHistoryLimit = 3
+
+// RevisionLimit returns the number of earlier revisions of the generated
+// Ignition to keep.
+func (o OutputSpec) RevisionLimit() int {
+	if o.RevisionHistoryLimit != nil {
+		return int(*o.RevisionHistoryLimit)
+	}
+	return DefaultRevisionHistoryLimit
+}
+
+// SizeSpec limits the size of the generated Ignition.
+type SizeSpec struct {
+	// Limit is the largest total size of the data of the generated Ignition
+	// Secret. Use a lower limit for consumers with smaller limits, e.g.
+	// KubeVirt config drives. Defaults to 1Mi, the largest Secret the API
+	// server accepts.
+	// +optional
+	Limit *resource.Quantity `json:"limit,omitempty"`
+
+	// Spill moves files with large inline contents out of the Ignition
+	// config, to keep it under the limit.
+	// +optional
+	Spill *SpillSpec `json:"spill,omitempty"`
+}
+
+// SpillSpec describes the endpoint that serves the contents of the files
+// spilled out of the Ignition config. Each file is stored in its own Secret,
+// listed in status.spilledSecretNames and labelled with the name of the
+// ButaneConfig, under the key it must be served at: URL/<key>.
+type SpillSpec struct {
+	// URL is the base URL the spilled files are served from.
+	// +kubebuilder:validation:MinLength=1
+	URL string `json:"url"`
+
+	// Threshold is the size of inline contents, as stored in the config,
+	// above which a file is spilled. Defaults to 64Ki.
+	// +optional
+	Threshold *resource.Quantity `json:"threshold,omitempty"`
+
+	// HeadersSecretRef references a Secret whose keys and values are sent as
+	// HTTP headers when fetching the files, e.g. an Authorization header.
+	// +optional
+	HeadersSecretRef *corev1.LocalObjectReference `json:"headersSecretRef,omitempty"`
+}
+
+// ThresholdBytes returns the size above which files are spilled, in bytes.
+func (s SpillSpec) ThresholdBytes() int64 {
+	if s.Threshold != nil {
+		return s.Threshold.Value()
+	}
+	return DefaultSpillThreshold.Value()
+}
+
+// SigningSpec configures the signing of the generated Ignition.
+type SigningSpec struct {
+	// KeySecretRef selects a Secret key holding the PEM encoded Ed25519 or
+	// ECDSA private key used to sign. PKCS#8 and, for ECDSA, SEC 1 keys are accepted.
+	KeySecretRef corev1.SecretKeySelector `json:"keySecretRef"`
+}
+
+// EncryptionMode selects how the generated Ignition is protected.
+// +kubebuilder:validation:Enum=age;remote
+type EncryptionMode string
+
+const (
+	// EncryptionModeAge encrypts the whole Ignition config to age recipients.
+	// Consumers decrypt it with one of the matching identities before use.
+	EncryptionModeAge EncryptionMode = "age"
+	// EncryptionModeRemote keeps the Ignition config usable as is, but moves the
+	// contents of sensitive files to a separate Secret. Ignition fetches them from
+	// an authenticated endpoint and verifies them against the hash in the config.
+	EncryptionModeRemote EncryptionMode = "remote"
+)
+
+// EncryptionSpec configures the protection of the generated Ignition.
+type EncryptionSpec struct {
+	// Mode is either age or remote.
+	// +kubebuilder:default=age
+	// +optional
+	Mode EncryptionMode `json:"mode,omitempty"`
+
+	// RecipientsRef selects a ConfigMap key listing the age recipients, one per
+	// line. Native age (age1...) and SSH (ssh-ed25519, ssh-rsa) public keys are
+	// accepted; empty lines and lines starting with # are ignored.
+	// Required when mode is age.
+	// +optional
+	RecipientsRef *corev1.ConfigMapKeySelector `json:"recipientsRef,omitempty"`
+
+	// Remote configures where Ignition fetches sensitive files from.
+	// Required when mode is remote.
+	// +optional
+	Remote *RemoteSourceSpec `json:"remote,omitempty"`
+}
+
+// RemoteSourceSpec describes the endpoint that serves the contents of the
+// files moved out of the Ignition config. The contents are stored in the
+// Secret named in status.filesSecretName, one key per file, and must be served
+// at URL/<key>.
+type RemoteSourceSpec struct {
+	// URL is the base URL the files are served from.
+	// +kubebuilder:validation:MinLength=1
+	URL string `json:"url"`
+
+	// Paths lists the files to move out of the Ignition config. When empty,
+	// every file with inline contents is moved.
+	// +optional
+	Paths []string `json:"paths,omitempty"`
+
+	// HeadersSecretRef references a Secret whose keys and values are sent as
+	// HTTP headers when fetching the files, e.g. an Authorization header.
+	// +optional
+	HeadersSecretRef *corev1.LocalObjectReference `json:"headersSecretRef,omitempty"`
+}
+
+// ButaneConfigStatus defines the observed state of ButaneConfig
+type ButaneConfigStatus struct {
+	// The name of the generated secret containing the ignition content in userdata key
+	// More info: https://coreos.github.io/ignition/specs/
+	SecretName string `json:"secretName,omitempty"`
+
+	// FilesSecretName is the name of the Secret holding the contents of the
+	// files moved out of the Ignition config by the remote encryption mode.
+	// +optional
+	FilesSecretName string `json:"filesSecretName,omitempty"`
+
+	// SpilledSecretNames lists the Secrets holding the contents of the files
+	// spilled out of the Ignition config by spec.output.size.spill.
+	// +optional
+	SpilledSecretNames []string `json:"spilledSecretNames,omitempty"`
+
+	// AppliedPolicies lists the ButaneInjectionPolicies whose snippets were
+	// merged into the config, sorted by name.
+	// +optional
+	AppliedPolicies []string `json:"appliedPolicies,omitempty"`
+
+	// PinnedImages lists the digests the container images of the config were
+	// pinned to by spec.images.pin, sorted by image.
+	// +listType=map
+	// +listMapKey=image
+	// +optional
+	PinnedImages []PinnedImage `json:"pinnedImages,omitempty"`
+
+	// LintFindings lists the problems the linters found in the systemd units
+	// and the storage of the generated config, unless the operator policy
+	// ignores them.
+	// +optional
+	LintFindings []LintFinding `json:"lintFindings,omitempty"`
+
+	// OCIArtifact is the artifact the generated Ignition was last pushed as
+	// to spec.output.oci.
+	// +optional
+	OCIArtifact *OCIArtifact `json:"ociArtifact,omitempty"`
+
+	// S3Object is the object the generated Ignition was last uploaded to by
+	// spec.output.s3.
+	// +optional
+	S3Object *S3Object `json:"s3Object,omitempty"`
+
+	// PointerSecretName is the name of the Secret holding the pointer
+	// Ignition config of spec.output.s3.presignedURL.
+	// +optional
+	PointerSecretName string `json:"pointerSecretName,omitempty"`
+
+	// Variant is the Butane variant of the translated config.
+	// +optional
+	Variant string `json:"variant,omitempty"`
+
+	// IgnitionVersion is the version of the Ignition specification the
+	// generated config conforms to.
+	// +optional
+	IgnitionVersion string `json:"ignitionVersion,omitempty"`
+
+	// Conditions represent the latest available observations of the ButaneConfig state.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+// PinnedImage is a container image reference and the digest it was pinned to.
+type PinnedImage struct {
+	// Image is the reference as written in the config, e.g. nginx:alpine.
+	Image string `json:"image"`
+
+	// Digest is the digest the registry served for the reference.
+	Digest string `json:"digest"`
+}
+
+// LintFinding is a problem a linter found in the generated config.
+type LintFinding struct {
+	// Rule names the check that found the problem, e.g. PathConflict.
+	Rule string `json:"rule"`
+
+	// Location is where the problem is, e.g. file /etc/hosts.
+	Location string `json:"location"`
+
+	// Message describes the problem.
+	Message string `json:"message"`
+}
+
+// OCIArtifact is an artifact pushed to an OCI registry.
+type OCIArtifact struct {
+	// Repository is the repository the artifact was pushed to.
+	Repository string `json:"repository"`
+
+	// Digest is the digest of the manifest of the artifact.
+	Digest string `json:"digest"`
+
+	// Tags lists the tags of the artifact.
+	// +optional
+	Tags []string `json:"tags,omitempty"`
+}
+
+// S3Object is an object uploaded to an S3 compatible object storage.
+type S3Object struct {
+	// Endpoint is the URL of the S3 API.
+	Endpoint string `json:"endpoint"`
+
+	// Region signed the requests.
+	// +optional
+	Region string `json:"region,omitempty"`
+
+	// Bucket is the bucket of the object.
+	Bucket string `json:"bucket"`
+
+	// Key is the key of the object.
+	Key string `json:"key"`
+
+	// Digest is the SHA-256 digest of the content of the object.
+	Digest string `json:"digest"`
+
+	// CredentialsSecretName is the Secret holding the credentials the object
+	// was uploaded with, which delete it once spec.output.s3 is removed.
+	// +optional
+	CredentialsSecretName string `json:"credentialsSecretName,omitempty"`
+
+	// URLExpiresAt is when the pre-signed URL of the pointer Ignition config
+	// expires.
+	// +optional
+	URLExpiresAt *metav1.Time `json:"urlExpiresAt,omitempty"`
+}
+
+const (
+	// ConditionReady indicates whether the Ignition secret is up to date with the spec.
+	ConditionReady = "Ready"
+	// ConditionSizeWithinLimit indicates whether the generated Ignition fits spec.output.size.limit.
+	ConditionSizeWithinLimit = "SizeWithinLimit"
+	// ConditionSecretsOwned indicates whether the generated Secrets were applied without taking over fields from other field managers.
+	ConditionSecretsOwned = "SecretsOwned"
+
+	// ReasonReconciled is set on the Ready condition when the secret was written successfully.
+	ReasonReconciled = "Reconciled"
+	// ReasonMissingConfig is set on the Ready condition when the spec has no Butane config.
+	ReasonMissingConfig = "MissingConfig"
+	// ReasonTranslationFailed is set on the Ready condition when Butane could not be translated.
+	ReasonTranslationFailed = "TranslationFailed"
+	// ReasonSecretWriteFailed is set on the Ready condition when the secret could not be written.
+	ReasonSecretWriteFailed = "SecretWriteFailed"
+	// ReasonEncryptionFailed is set on the Ready condition when the output could not be encrypted.
+	ReasonEncryptionFailed = "EncryptionFailed"
+	// ReasonSigningFailed is set on the Ready condition when the output could not be signed.
+	ReasonSigningFailed = "SigningFailed"
+	// ReasonIgnitionVersionFailed is set on the Ready condition when the output could not be converted to spec.output.ignitionVersion.
+	ReasonIgnitionVersionFailed = "IgnitionVersionFailed"
+	// ReasonOutputTooLarge is set on the Ready and SizeWithinLimit conditions when the output exceeds the size limit.
+	ReasonOutputTooLarge = "OutputTooLarge"
+	// ReasonWithinLimit is set on the SizeWithinLimit condition when the output fits the size limit.
+	ReasonWithinLimit = "WithinLimit"
+	// ReasonSourceUnavailable is set on the Ready condition when the ConfigMap key of spec.butaneFrom could not be read.
+	ReasonSourceUnavailable = "SourceUnavailable"
+	// ReasonPolicyViolation is set on the Ready condition when the config is not allowed by the operator policy.
+	ReasonPolicyViolation = "PolicyViolation"
+	// ReasonMergeFailed is set on the Ready condition when a ClusterButaneConfig of spec.mergeFrom or of an injection policy is missing or could not be merged.
+	ReasonMergeFailed = "MergeFailed"
+	// ReasonUserKeysUnavailable is set on the Ready condition when the SSH authorized keys or passwords of spec.users could not be read.
+	ReasonUserKeysUnavailable = "UserKeysUnavailable"
+	// ReasonImagePinningFailed is set on the Ready condition when the container images of the config could not be resolved to digests.
+	ReasonImagePinningFailed = "ImagePinningFailed"
+	// ReasonOCIPushFailed is set on the Ready condition when the Ignition could not be pushed to spec.output.oci.
+	ReasonOCIPushFailed = "OCIPushFailed"
+	// ReasonS3UploadFailed is set on the Ready condition when the Ignition could not be uploaded to spec.output.s3.
+	ReasonS3UploadFailed = "S3UploadFailed"
+	// ReasonNoConflict is set on the SecretsOwned condition when no other field manager changed the fields of the operator.
+	ReasonNoConflict = "NoConflict"
+	// ReasonFieldConflict is set on the SecretsOwned condition when fields changed by other field managers were overwritten.
+	ReasonFieldConflict = "FieldConflict"
+
+	// KeyUserdata holds the Ignition config in the generated Secret. For
+	// openshift configs it holds the MachineConfig manifest wrapping the
+	// Ignition config instead, ready to apply to an OpenShift cluster, unless
+	// the output is encrypted, since a MachineConfig carries the Ignition
+	// config in clear.
+	KeyUserdata = "userdata"
+	// KeyIgnitionFile also holds the Ignition config of flatcar and openshift
+	// configs, under the file name their provisioning tools expect.
+	KeyIgnitionFile = "config.ign"
+
+	// KeyAccessKeyID, KeySecretAccessKey and KeySessionToken hold the
+	// credentials of the Secret of spec.output.s3.credentialsSecretRef.
+	KeyAccessKeyID     = "AWS_ACCESS_KEY_ID"
+	KeySecretAccessKey = "AWS_SECRET_ACCESS_KEY"
+	KeySessionToken    = "AWS_SESSION_TOKEN"
+
+	// FinalizerS3Object is set on ButaneConfigs with an S3 object, so that the
+	// object is deleted along with them.
+	FinalizerS3Object = "butane.operators.naval-group.com/s3-object"
+
+	// LabelSpilledFrom is set on the Secrets holding spilled files to the name
+	// of their ButaneConfig, so that a file server can find them.
+	LabelSpilledFrom = "butane.operators.naval-group.com/spilled-from"
+
+	// LabelRevisionOf is set on the Secrets holding earlier revisions of the
+	// Ignition to the name of their ButaneConfig.
+	LabelRevisionOf = "butane.operators.naval-group.com/revision-of"
+
+	// AnnotationRevision is set on the Ignition Secret, and on the Secrets
+	// holding its earlier revisions, to the revision of the Ignition, which
+	// increases each time the Ignition changes.
+	AnnotationRevision = "butane.operators.naval-group.com/revision"
+
+	// AnnotationInjectionPolicies is set on the Ignition Secret to the
+	// comma-separated names of the ButaneInjectionPolicies applied to the config.
+	AnnotationInjectionPolicies = "butane.operators.naval-group.com/injection-policies"
+
+	// AnnotationEncryption is set on the Ignition Secret and the OCI artifact
+	// to the encryption mode of its content, so that consumers know how to
+	// handle it.
+	AnnotationEncryption = "butane.operators.naval-group.com/encryption"
+
+	// AnnotationPlaintextDigest is set on the age-encrypted Ignition Secret to
+	// the SHA-256 digest of the recipients and the plaintext Ignition, so that
+	// the ciphertext is kept while they do not change.
+	AnnotationPlaintextDigest = "butane.operators.naval-group.com/plaintext-digest"
+
+	// AnnotationSignature is set on the OCI artifact to the detached signature
+	// of the Ignition, as stored in the userdata.sig key of the Secret.
+	AnnotationSignature = "butane.operators.naval-group.com/signature"
+	// AnnotationProvenance is set on the OCI artifact to the provenance
+	// document of the Ignition.
+	AnnotationProvenance = "butane.operators.naval-group.com/provenance"
+	// AnnotationProvenanceSignature is set on the OCI artifact to the detached
+	// signature of the provenance document.
+	AnnotationProvenanceSignature = "butane.operators.naval-group.com/provenance-signature"
+
+	// MediaTypeIgnition is the media type of the Ignition config in the OCI
+	// artifact, and the type of the artifact.
+	MediaTypeIgnition = "application/vnd.coreos.ignition+json"
+)
+
+// IgnitionData returns the Ignition config held by the data of a generated
+// Secret: the KeyIgnitionFile key when set, since the userdata of openshift
+// configs holds a MachineConfig, or else the KeyUserdata key.
+func IgnitionData(data map[string][]byte) []byte {
+	if ignition, ok := data[KeyIgnitionFile]; ok {
+		return ignition
+	}
+	return data[KeyUserdata]
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:printcolumn:name="Secret",type=string,JSONPath=`.status.secretName`
+//+kubebuilder:printcolumn:name="Variant",type=string,JSONPath=`.status.variant`
+//+kubebuilder:printcolumn:name="Ignition",type=string,JSONPath=`.status.ignitionVersion`,priority=1
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ButaneConfig is a resource that transplane Butane config
+// into an Ignition formatted secret.
+type ButaneConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ButaneConfigSpec   `json:"spec,omitempty"`
+	Status ButaneConfigStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ButaneConfigList contains a list of ButaneConfig
+type ButaneConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ButaneConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ButaneConfig{}, &ButaneConfigList{})
+}
@@ -0,0 +1,420 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package v1beta1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/naval-group/butane-operator/internal/images"
+	"github.com/naval-group/butane-operator/internal/lint"
+	"github.com/naval-group/butane-operator/internal/operatorconfig"
+	"github.com/naval-group/butane-operator/internal/render"
+	"github.com/naval-group/butane-operator/internal/s3"
+	"github.com/naval-group/butane-operator/internal/schema"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+// log is for logging in this package.
+var butaneconfiglog = logf.Log.WithName("butaneconfig-resource")
+
+// SetupWebhookWithManager will setup the manager to manage the webhooks. The
+// validator enforces the policy of cfg, which may be nil.
+func (r *ButaneConfig) SetupWebhookWithManager(mgr ctrl.Manager, cfg *operatorconfig.Store) error {
+	return ctrl.NewWebhookManagedBy(mgr, &ButaneConfig{}).
+		WithDefaulter(&ButaneConfigCustomDefaulter{}).
+		WithValidator(&ButaneConfigCustomValidator{Config: cfg}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-butane-operators-naval-group-com-v1beta1-butaneconfig,mutating=true,failurePolicy=fail,sideEffects=None,groups=butane.operators.naval-group.com,resources=butaneconfigs,verbs=create;update,versions=v1beta1,name=mutating.butaneconfigs.operators.naval-group.com,admissionReviewVersions=v1
+
+// +kubebuilder:object:generate=false
+
+// ButaneConfigCustomDefaulter implements admission.Defaulter[*ButaneConfig]
+type ButaneConfigCustomDefaulter struct{}
+
+// Default sets the version of a config that only names its variant to the
+// newest stable version of that variant. Butane text is left as written, so
+// that errors keep pointing at the lines the user wrote.
+func (d *ButaneConfigCustomDefaulter) Default(ctx context.Context, obj *ButaneConfig) error {
+	butaneconfiglog.Info("default", "name", obj.Name)
+
+	if err := defaultVersion(obj.Spec.Config); err != nil {
+		return err
+	}
+	return defaultVersion(obj.Spec.RawConfig)
+}
+
+// defaultVersion fills in the version of the Butane config in ext. Configs
+// that cannot be decoded are left to the validating webhook to report.
+func defaultVersion(ext *runtime.RawExtension) error {
+	if ext == nil || len(ext.Raw) == 0 {
+		return nil
+	}
+	var config map[string]interface{}
+	if err := json.Unmarshal(ext.Raw, &config); err != nil {
+		return nil
+	}
+	if _, ok := config["version"]; ok {
+		return nil
+	}
+	variant, _ := config["variant"].(string)
+	latest := schema.Latest(variant)
+	if latest == "" {
+		return nil
+	}
+	config["version"] = latest
+	raw, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("failed to default the Butane version: %w", err)
+	}
+	ext.Raw = raw
+	ext.Object = nil
+	return nil
+}
+
+//+kubebuilder:webhook:path=/validate-butane-operators-naval-group-com-v1beta1-butaneconfig,mutating=false,failurePolicy=fail,sideEffects=None,groups=butane.operators.naval-group.com,resources=butaneconfigs,verbs=create;update,versions=v1beta1,name=validating.butaneconfigs.operators.naval-group.com,admissionReviewVersions=v1
+
+// +kubebuilder:object:generate=false
+
+// ButaneConfigCustomValidator implements admission.Validator[*ButaneConfig]
+type ButaneConfigCustomValidator struct {
+	// Config holds the operator policy. Nil allows everything.
+	Config *operatorconfig.Store
+	// FilesDir is the directory local contents and trees are read from, as
+	// with butane --files-dir. Empty, as in the cluster, rejects them.
+	FilesDir string
+}
+
+// ValidateCreate implements validation logic for ButaneConfig creation
+func (v *ButaneConfigCustomValidator) ValidateCreate(ctx context.Context, obj *ButaneConfig) (admission.Warnings, error) {
+	butaneconfiglog.Info("validate create", "name", obj.Name)
+
+	// Validate the Butane configuration on creation
+	return validateButaneConfig(obj, v.Config.Get().Policy, v.FilesDir)
+}
+
+// ValidateUpdate implements validation logic for ButaneConfig updates
+func (v *ButaneConfigCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj *ButaneConfig) (admission.Warnings, error) {
+	butaneconfiglog.Info("validate update", "name", newObj.Name)
+
+	// Validate the Butane configuration on update
+	return validateButaneConfig(newObj, v.Config.Get().Policy, v.FilesDir)
+}
+
+// ValidateDelete implements validation logic for ButaneConfig deletion
+func (v *ButaneConfigCustomValidator) ValidateDelete(ctx context.Context, obj *ButaneConfig) (admission.Warnings, error) {
+	butaneconfiglog.Info("validate delete", "name", obj.Name)
+	// Optionally implement validation on delete, if necessary
+	return nil, nil
+}
+
+// validateButaneConfig checks if the Butane configuration is valid by attempting to translate it to Ignition,
+// and that it complies with the operator policy
+func validateButaneConfig(r *ButaneConfig, policy operatorconfig.PolicyConfig, filesDir string) (admission.Warnings, error) {
+	if err := validateSource(&r.Spec); err != nil {
+		return nil, err
+	}
+	if err := policy.CheckEncryption(r.Spec.Output.Encryption != nil); err != nil {
+		return nil, err
+	}
+
+	// The ConfigMap of butaneFrom is resolved by the controller, since it may be created later
+	var warnings admission.Warnings
+	if r.Spec.ButaneFrom == nil {
+		if r.Spec.Butane == "" {
+			var butane interface{}
+			if err := json.Unmarshal(r.Spec.Source(), &butane); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal Butane config: %v", err)
+			}
+		}
+
+		// Attempt to translate Butane config to Ignition
+		opts := r.Spec.Translation.RenderOptions()
+		opts.FilesDir = filesDir
+		ignition, _, err := render.Translate(r.Spec.Source(), opts)
+		if err != nil {
+			if r.Spec.Butane != "" {
+				return nil, fmt.Errorf("failed to translate spec.butane to Ignition: %w", err)
+			}
+			return nil, fmt.Errorf("failed to translate Butane to Ignition: %w", err)
+		}
+		if version := r.Spec.Output.IgnitionVersion; version != "" {
+			if _, err := render.ConvertVersion(ignition, version, opts); err != nil {
+				return nil, fmt.Errorf("spec.output.ignitionVersion: %w", err)
+			}
+		}
+
+		if err := render.CheckPasswordHashes(ignition); err != nil {
+			return nil, err
+		}
+
+		// Units of the ClusterButaneConfigs merged under this one are only known to the controller
+		findings, err := lint.Units(ignition)
+		if err != nil {
+			return nil, err
+		}
+		if len(r.Spec.MergeFrom) > 0 {
+			findings = slices.DeleteFunc(findings, lint.Finding.CrossConfig)
+		}
+		if warnings, err = policy.UnitLint.Apply("systemd units", findings); err != nil {
+			return nil, err
+		}
+		if findings, err = lint.Ignition(ignition); err != nil {
+			return nil, err
+		}
+		storageWarnings, err := policy.IgnitionLint.Apply("Ignition storage", findings)
+		if err != nil {
+			return nil, err
+		}
+		warnings = append(warnings, storageWarnings...)
+
+		header, err := render.ReadHeader(r.Spec.Source())
+		if err != nil {
+			return nil, err
+		}
+		if err := policy.CheckVariant(header.Variant); err != nil {
+			return nil, err
+		}
+		warnings = append(warnings, variantWarnings(header, &r.Spec)...)
+	}
+
+	if err := validateOutput(&r.Spec.Output); err != nil {
+		return nil, err
+	}
+	if err := validateUsers(r.Spec.Users); err != nil {
+		return nil, err
+	}
+	if err := validateImages(&r.Spec.Images); err != nil {
+		return nil, err
+	}
+	return append(warnings, outputWarnings(&r.Spec.Output)...), nil
+}
+
+// variantWarnings flags settings that do not behave for the variant of the
+// config as they do for fcos.
+func variantWarnings(header render.Header, spec *ButaneConfigSpec) admission.Warnings {
+	if header.Variant == render.VariantOpenShift && spec.Output.Encryption != nil {
+		return admission.Warnings{fmt.Sprintf("spec.output.encryption is set, so %s of this %s config holds the encrypted Ignition config instead of a MachineConfig",
+			KeyUserdata, header.Variant)}
+	}
+	return nil
+}
+
+// outputWarnings flags output settings that weaken each other.
+func outputWarnings(output *OutputSpec) admission.Warnings {
+	if output.Size != nil && output.Size.Spill != nil && output.Encryption != nil && output.Encryption.Mode != EncryptionModeRemote {
+		return admission.Warnings{"spec.output.size.spill is set, so spilled files are stored and served without spec.output.encryption"}
+	}
+	return nil
+}
+
+// validateSource checks that the spec has exactly one Butane config source.
+func validateSource(spec *ButaneConfigSpec) error {
+	var sources []string
+	if spec.Config != nil {
+		sources = append(sources, "spec.config")
+	}
+	if spec.RawConfig != nil {
+		sources = append(sources, "spec.rawConfig")
+	}
+	if spec.Butane != "" {
+		sources = append(sources, "spec.butane")
+	}
+	if spec.ButaneFrom != nil {
+		sources = append(sources, "spec.butaneFrom")
+		if spec.ButaneFrom.Name == "" || spec.ButaneFrom.Key == "" {
+			return fmt.Errorf("spec.butaneFrom name and key are required")
+		}
+	}
+	switch len(sources) {
+	case 1:
+		return nil
+	case 0:
+		return fmt.Errorf("one of spec.config, spec.rawConfig, spec.butane and spec.butaneFrom must be set")
+	default:
+		return fmt.Errorf("only one of spec.config, spec.rawConfig, spec.butane and spec.butaneFrom may be set, got %s", strings.Join(sources, ", "))
+	}
+}
+
+// validateOutput checks the settings the CRD schema cannot express. References
+// are resolved by the controller, since the objects may be created later.
+func validateOutput(output *OutputSpec) error {
+	if output == nil {
+		return nil
+	}
+	if err := validateSize(output.Size); err != nil {
+		return err
+	}
+	if err := validateOCI(output.OCI); err != nil {
+		return err
+	}
+	if err := validateS3(output); err != nil {
+		return err
+	}
+	if output.Encryption == nil {
+		return nil
+	}
+	enc := output.Encryption
+
+	switch enc.Mode {
+	case EncryptionModeRemote:
+		if enc.Remote == nil {
+			return fmt.Errorf("spec.output.encryption.remote is required when mode is %s", enc.Mode)
+		}
+		if err := validateURL("spec.output.encryption.remote.url", enc.Remote.URL); err != nil {
+			return err
+		}
+	case EncryptionModeAge, "":
+		if enc.RecipientsRef == nil || enc.RecipientsRef.Name == "" || enc.RecipientsRef.Key == "" {
+			return fmt.Errorf("spec.output.encryption.recipientsRef name and key are required when mode is %s", EncryptionModeAge)
+		}
+	default:
+		return fmt.Errorf("unsupported spec.output.encryption.mode %q", enc.Mode)
+	}
+	return nil
+}
+
+// validateSize checks spec.output.size.
+func validateSize(size *SizeSpec) error {
+	if size == nil {
+		return nil
+	}
+	if size.Limit != nil && size.Limit.Sign() <= 0 {
+		return fmt.Errorf("spec.output.size.limit must be positive, got %s", size.Limit)
+	}
+	if spill := size.Spill; spill != nil {
+		if spill.Threshold != nil && spill.Threshold.Sign() < 0 {
+			return fmt.Errorf("spec.output.size.spill.threshold must not be negative, got %s", spill.Threshold)
+		}
+		return validateURL("spec.output.size.spill.url", spill.URL)
+	}
+	return nil
+}
+
+// validateOCI checks spec.output.oci.
+func validateOCI(oci *OCISpec) error {
+	if oci == nil {
+		return nil
+	}
+	if _, err := images.ParseRepository(oci.Repository); err != nil {
+		return fmt.Errorf("spec.output.oci.repository: %w", err)
+	}
+	if ref := oci.PushSecretRef; ref != nil && ref.Name == "" {
+		return fmt.Errorf("spec.output.oci.pushSecretRef name is required")
+	}
+	return nil
+}
+
+// validateS3 checks spec.output.s3: its object key must be a relative path
+// once expanded, and the pointer config must be readable by Ignition, which
+// age encryption prevents.
+func validateS3(output *OutputSpec) error {
+	s3Spec := output.S3
+	if s3Spec == nil {
+		return nil
+	}
+	if err := validateURL("spec.output.s3.endpoint", s3Spec.Endpoint); err != nil {
+		return err
+	}
+	if s3Spec.CredentialsSecretRef.Name == "" {
+		return fmt.Errorf("spec.output.s3.credentialsSecretRef name is required")
+	}
+	key := s3Spec.ObjectKey("namespace", "name", 1)
+	if strings.HasPrefix(key, "/") || strings.Contains(key, "//") {
+		return fmt.Errorf("spec.output.s3.key must not start with or contain an empty path segment, got %q", s3Spec.Key)
+	}
+	if strings.Contains(key, "{") {
+		return fmt.Errorf("spec.output.s3.key supports only {namespace}, {name} and {generation}, got %q", s3Spec.Key)
+	}
+	if p := s3Spec.PresignedURL; p != nil {
+		if expiry := p.ExpiryDuration(); expiry < time.Second || expiry > s3.MaxPresignExpiry {
+			return fmt.Errorf("spec.output.s3.presignedURL.expiry must be from 1s to %s, got %s", s3.MaxPresignExpiry, expiry)
+		}
+		if enc := output.Encryption; enc != nil && enc.Mode != EncryptionModeRemote {
+			return fmt.Errorf("spec.output.s3.presignedURL cannot point Ignition to a config encrypted with %s", EncryptionModeAge)
+		}
+	}
+	return nil
+}
+
+// validateUsers checks that every user of spec.users sets keys or a password,
+// that every key source sets exactly one field and that its selector is valid.
+func validateUsers(users []UserSpec) error {
+	for i, user := range users {
+		if len(user.SSHAuthorizedKeysFrom) == 0 && user.PasswordFrom == nil {
+			return fmt.Errorf("spec.users[%d] must set sshAuthorizedKeysFrom or passwordFrom", i)
+		}
+		if ref := user.PasswordFrom; ref != nil && (ref.Name == "" || ref.Key == "") {
+			return fmt.Errorf("spec.users[%d].passwordFrom name and key are required", i)
+		}
+		for j, source := range user.SSHAuthorizedKeysFrom {
+			field := fmt.Sprintf("spec.users[%d].sshAuthorizedKeysFrom[%d]", i, j)
+			var set []string
+			if source.SecretSelector != nil {
+				set = append(set, "secretSelector")
+				if _, err := metav1.LabelSelectorAsSelector(source.SecretSelector); err != nil {
+					return fmt.Errorf("%s.secretSelector: %w", field, err)
+				}
+			}
+			if source.ConfigMapSelector != nil {
+				set = append(set, "configMapSelector")
+				if _, err := metav1.LabelSelectorAsSelector(source.ConfigMapSelector); err != nil {
+					return fmt.Errorf("%s.configMapSelector: %w", field, err)
+				}
+			}
+			if source.Directory {
+				set = append(set, "directory")
+			}
+			if len(set) != 1 {
+				return fmt.Errorf("%s must set exactly one of secretSelector, configMapSelector and directory", field)
+			}
+		}
+	}
+	return nil
+}
+
+// validateImages checks spec.images.
+func validateImages(images *ImagesSpec) error {
+	if ref := images.PullSecretRef; ref != nil {
+		if !images.Pin {
+			return fmt.Errorf("spec.images.pullSecretRef requires spec.images.pin")
+		}
+		if ref.Name == "" {
+			return fmt.Errorf("spec.images.pullSecretRef name is required")
+		}
+	}
+	return nil
+}
+
+// validateURL checks that field holds an absolute http or https URL.
+func validateURL(field, value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%s must be an absolute http or https URL, got %q", field, value)
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/naval-group/butane-operator/internal/operatorconfig"
+)
+
+var _ = Describe("ButaneConfig Webhook", func() {
+
+	Context("When creating ButaneConfig under Defaulting Webhook", func() {
+		defaulter := &ButaneConfigCustomDefaulter{}
+
+		It("Should fill in the latest version of the variant", func() {
+			for variant, version := range map[string]string{"fcos": "1.7.0", "flatcar": "1.1.0", "openshift": "4.21.0", "r4e": "1.1.0", "fiot": "1.0.0"} {
+				bc := &ButaneConfig{Spec: ButaneConfigSpec{Config: &runtime.RawExtension{Raw: []byte(`{"variant":"` + variant + `"}`)}}}
+				Expect(defaulter.Default(ctx, bc)).To(Succeed())
+				Expect(string(bc.Spec.Config.Raw)).To(MatchJSON(`{"variant":"` + variant + `","version":"` + version + `"}`))
+			}
+		})
+
+		It("Should keep an explicit version and Butane text", func() {
+			bc := &ButaneConfig{Spec: ButaneConfigSpec{
+				RawConfig: &runtime.RawExtension{Raw: []byte(`{"variant":"flatcar","version":"1.2.0-experimental"}`)},
+				Butane:    "variant: fcos\n",
+			}}
+			Expect(defaulter.Default(ctx, bc)).To(Succeed())
+			Expect(string(bc.Spec.RawConfig.Raw)).To(MatchJSON(`{"variant":"flatcar","version":"1.2.0-experimental"}`))
+			Expect(bc.Spec.Butane).To(Equal("variant: fcos\n"))
+		})
+	})
+
+	Context("When creating ButaneConfig under Validating Webhook", func() {
+		validator := &ButaneConfigCustomValidator{}
+		butane := "variant: fcos\nversion: 1.5.0\nstorage:\n  files:\n    - path: /etc/motd\n      mode: 0644\n"
+
+		It("Should deny if no Butane config is provided", func() {
+			_, err := validator.ValidateCreate(ctx, &ButaneConfig{})
+			Expect(err).To(MatchError(ContainSubstring("one of spec.config, spec.rawConfig, spec.butane and spec.butaneFrom must be set")))
+		})
+
+		It("Should deny if several Butane configs are provided", func() {
+			bc := &ButaneConfig{Spec: ButaneConfigSpec{
+				Butane:     butane,
+				ButaneFrom: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "motd"}, Key: "config.bu"},
+			}}
+			_, err := validator.ValidateCreate(ctx, bc)
+			Expect(err).To(MatchError(ContainSubstring("got spec.butane, spec.butaneFrom")))
+		})
+
+		It("Should report positions in the Butane text", func() {
+			bc := &ButaneConfig{Spec: ButaneConfigSpec{Butane: strings.Replace(butane, "/etc/motd", "etc/motd", 1)}}
+			_, err := validator.ValidateCreate(ctx, bc)
+			Expect(err).To(MatchError(ContainSubstring("line 5 col 13: path not absolute")))
+		})
+
+		It("Should admit if all required fields are provided", func() {
+			_, err := validator.ValidateCreate(ctx, &ButaneConfig{Spec: ButaneConfigSpec{Butane: butane}})
+			Expect(err).NotTo(HaveOccurred())
+			bc := &ButaneConfig{Spec: ButaneConfigSpec{
+				ButaneFrom: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "motd"}, Key: "config.bu"},
+			}}
+			_, err = validator.ValidateCreate(ctx, bc)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should deny configs the pinned Ignition version cannot represent", func() {
+			bc := &ButaneConfig{Spec: ButaneConfigSpec{
+				Butane: "variant: fcos\nversion: 1.5.0\nkernel_arguments:\n  should_exist:\n    - quiet\n",
+				Output: OutputSpec{IgnitionVersion: "3.3.0"},
+			}}
+			_, err := validator.ValidateCreate(ctx, bc)
+			Expect(err).NotTo(HaveOccurred())
+			bc.Spec.Output.IgnitionVersion = "3.2.0"
+			_, err = validator.ValidateCreate(ctx, bc)
+			Expect(err).To(MatchError(ContainSubstring("spec.output.ignitionVersion: the config cannot be represented in Ignition spec 3.2.0")))
+		})
+
+		It("Should validate the size settings", func() {
+			bc := &ButaneConfig{Spec: ButaneConfigSpec{
+				Butane: butane,
+				Output: OutputSpec{Size: &SizeSpec{Spill: &SpillSpec{URL: "files.example.com"}}},
+			}}
+			_, err := validator.ValidateCreate(ctx, bc)
+			Expect(err).To(MatchError(ContainSubstring("spec.output.size.spill.url must be an absolute http or https URL")))
+
+			bc.Spec.Output.Size.Spill.URL = "https://files.example.com"
+			bc.Spec.Output.Encryption = &EncryptionSpec{
+				RecipientsRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "recipients"}, Key: "age"},
+			}
+			warnings, err := validator.ValidateCreate(ctx, bc)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ConsistOf(ContainSubstring("spilled files are stored and served without spec.output.encryption")))
+		})
+
+		It("Should require exactly one source of SSH authorized keys", func() {
+			bc := &ButaneConfig{Spec: ButaneConfigSpec{
+				Butane: butane,
+				Users: []UserSpec{{Name: "core", SSHAuthorizedKeysFrom: []SSHAuthorizedKeysSource{{
+					SecretSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"ssh-keys/core": "true"}},
+					Directory:      true,
+				}}}},
+			}}
+			_, err := validator.ValidateCreate(ctx, bc)
+			Expect(err).To(MatchError(ContainSubstring("spec.users[0].sshAuthorizedKeysFrom[0] must set exactly one of")))
+
+			bc.Spec.Users[0].SSHAuthorizedKeysFrom[0].Directory = false
+			_, err = validator.ValidateCreate(ctx, bc)
+			Expect(err).NotTo(HaveOccurred())
+
+			bc.Spec.Users[0].SSHAuthorizedKeysFrom[0].SecretSelector.MatchLabels["ssh-keys/core"] = "not valid!"
+			_, err = validator.ValidateCreate(ctx, bc)
+			Expect(err).To(MatchError(ContainSubstring("spec.users[0].sshAuthorizedKeysFrom[0].secretSelector")))
+		})
+
+		It("Should deny plaintext passwords", func() {
+			bc := &ButaneConfig{Spec: ButaneConfigSpec{
+				Butane: "variant: fcos\nversion: 1.5.0\npasswd:\n  users:\n    - name: admin\n      password_hash: hunter2\n",
+			}}
+			_, err := validator.ValidateCreate(ctx, bc)
+			Expect(err).To(MatchError(ContainSubstring("password_hash of user admin is not a crypt(3) hash")))
+
+			bc.Spec.Butane = "variant: fcos\nversion: 1.5.0\n"
+			bc.Spec.Users = []UserSpec{{Name: "admin", PasswordFrom: &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "admin-password"}, Key: "password",
+			}}}
+			_, err = validator.ValidateCreate(ctx, bc)
+			Expect(err).NotTo(HaveOccurred())
+
+			bc.Spec.Users[0].PasswordFrom = nil
+			_, err = validator.ValidateCreate(ctx, bc)
+			Expect(err).To(MatchError(ContainSubstring("spec.users[0] must set sshAuthorizedKeysFrom or passwordFrom")))
+		})
+
+		It("Should require spec.images.pin for a pull Secret", func() {
+			bc := &ButaneConfig{Spec: ButaneConfigSpec{
+				Butane: "variant: fcos\nversion: 1.5.0\n",
+				Images: ImagesSpec{PullSecretRef: &corev1.LocalObjectReference{Name: "registry"}},
+			}}
+			_, err := validator.ValidateCreate(ctx, bc)
+			Expect(err).To(MatchError(ContainSubstring("spec.images.pullSecretRef requires spec.images.pin")))
+
+			bc.Spec.Images.Pin = true
+			_, err = validator.ValidateCreate(ctx, bc)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should require an OCI repository without tag", func() {
+			bc := &ButaneConfig{Spec: ButaneConfigSpec{
+				Butane: "variant: fcos\nversion: 1.5.0\n",
+				Output: OutputSpec{OCI: &OCISpec{Repository: "registry.example.com/boot/web:v1"}},
+			}}
+			_, err := validator.ValidateCreate(ctx, bc)
+			Expect(err).To(MatchError(ContainSubstring("spec.output.oci.repository: invalid repository")))
+
+			bc.Spec.Output.OCI.Repository = "registry.example.com/boot/web"
+			_, err = validator.ValidateCreate(ctx, bc)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should check the S3 object key and pointer config", func() {
+			bc := &ButaneConfig{Spec: ButaneConfigSpec{
+				Butane: "variant: fcos\nversion: 1.5.0\n",
+				Output: OutputSpec{S3: &S3Spec{
+					Endpoint:             "https://s3.example.com",
+					Bucket:               "ignition",
+					Key:                  "/{namespace}/{host}.ign",
+					CredentialsSecretRef: corev1.LocalObjectReference{Name: "s3"},
+				}},
+			}}
+			_, err := validator.ValidateCreate(ctx, bc)
+			Expect(err).To(MatchError(ContainSubstring("spec.output.s3.key must not start with")))
+
+			bc.Spec.Output.S3.Key = "{namespace}/{host}.ign"
+			_, err = validator.ValidateCreate(ctx, bc)
+			Expect(err).To(MatchError(ContainSubstring("supports only {namespace}, {name} and {generation}")))
+
+			bc.Spec.Output.S3.Key = "{namespace}/{name}-{generation}.ign"
+			bc.Spec.Output.S3.PresignedURL = &PresignedURLSpec{Expiry: &metav1.Duration{Duration: 30 * 24 * time.Hour}}
+			_, err = validator.ValidateCreate(ctx, bc)
+			Expect(err).To(MatchError(ContainSubstring("spec.output.s3.presignedURL.expiry must be from 1s to 168h0m0s")))
+
+			bc.Spec.Output.S3.PresignedURL.Expiry = nil
+			bc.Spec.Output.Encryption = &EncryptionSpec{
+				RecipientsRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "recipients"}, Key: "age"},
+			}
+			_, err = validator.ValidateCreate(ctx, bc)
+			Expect(err).To(MatchError(ContainSubstring("cannot point Ignition to a config encrypted with age")))
+
+			bc.Spec.Output.Encryption = nil
+			_, err = validator.ValidateCreate(ctx, bc)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should warn about the problems of the Ignition storage", func() {
+			bc := &ButaneConfig{Spec: ButaneConfigSpec{
+				Butane: "variant: fcos\nversion: 1.5.0\nstorage:\n  files:\n    - path: /etc/hosts\n      contents:\n        inline: 127.0.0.1 localhost\n" +
+					"  directories:\n    - path: /var/lib/app\n      mode: 0644\n",
+			}}
+			warnings, err := validator.ValidateCreate(ctx, bc)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ConsistOf(
+				ContainSubstring("file /etc/hosts: the file ships with the distributions"),
+				ContainSubstring("directory /var/lib/app: the directory mode 0644 has no execute bit"),
+			))
+		})
+
+		It("Should warn that encrypted openshift configs have no MachineConfig", func() {
+			bc := &ButaneConfig{Spec: ButaneConfigSpec{
+				Butane: "variant: openshift\nversion: 4.21.0\nmetadata:\n  name: 99-worker\n  labels:\n    machineconfiguration.openshift.io/role: worker\n",
+				Output: OutputSpec{Encryption: &EncryptionSpec{
+					RecipientsRef: &corev1.ConfigMapKeySelector{LocalObjectReference: corev1.LocalObjectReference{Name: "recipients"}, Key: "age"},
+				}},
+			}}
+			warnings, err := validator.ValidateCreate(ctx, bc)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ConsistOf(ContainSubstring("instead of a MachineConfig")))
+		})
+
+		It("Should enforce the operator policy", func() {
+			cfg := operatorconfig.Default()
+			cfg.Policy = operatorconfig.PolicyConfig{AllowedVariants: []string{"flatcar"}}
+			restricted := &ButaneConfigCustomValidator{Config: operatorconfig.NewStore(cfg)}
+
+			_, err := restricted.ValidateCreate(ctx, &ButaneConfig{Spec: ButaneConfigSpec{Butane: butane}})
+			Expect(err).To(MatchError(ContainSubstring(`variant "fcos" is not allowed by the operator policy`)))
+			_, err = restricted.ValidateCreate(ctx, &ButaneConfig{Spec: ButaneConfigSpec{Butane: "variant: flatcar\nversion: 1.1.0\n"}})
+			Expect(err).NotTo(HaveOccurred())
+
+			cfg.Policy = operatorconfig.PolicyConfig{RequireEncryption: true}
+			restricted = &ButaneConfigCustomValidator{Config: operatorconfig.NewStore(cfg)}
+			_, err = restricted.ValidateCreate(ctx, &ButaneConfig{Spec: ButaneConfigSpec{Butane: butane}})
+			Expect(err).To(MatchError(ContainSubstring("requires spec.output.encryption")))
+		})
+
+		It("Should lint the systemd units per the operator policy", func() {
+			units := "variant: fcos\nversion: 1.5.0\nsystemd:\n  units:\n    - name: app.service\n" +
+				"      contents: |\n        [Unit]\n        Requires=db.service\n        [Service]\n        ExecStart=/usr/bin/app\n        RestartSecs=5\n"
+			warnings, err := validator.ValidateCreate(ctx, &ButaneConfig{Spec: ButaneConfigSpec{Butane: units}})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ConsistOf(
+				ContainSubstring("unit app.service: unknown directive RestartSecs in [Service]"),
+				ContainSubstring("unit app.service: requires db.service, which the config does not define"),
+			))
+
+			By("Leaving missing units to the controller when merging ClusterButaneConfigs")
+			merged := &ButaneConfig{Spec: ButaneConfigSpec{Butane: units, MergeFrom: []ClusterButaneConfigReference{{Name: "db"}}}}
+			warnings, err = validator.ValidateCreate(ctx, merged)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ConsistOf(ContainSubstring("RestartSecs")))
+
+			cfg := operatorconfig.Default()
+			cfg.Policy = operatorconfig.PolicyConfig{UnitLint: operatorconfig.LintReject}
+			restricted := &ButaneConfigCustomValidator{Config: operatorconfig.NewStore(cfg)}
+			_, err = restricted.ValidateCreate(ctx, merged)
+			Expect(err).To(MatchError(ContainSubstring("the operator policy rejects the problems found in systemd units")))
+		})
+	})
+
+})
@@ -0,0 +1,92 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// ButaneInjectionPolicySpec defines the desired state of ButaneInjectionPolicy
+type ButaneInjectionPolicySpec struct {
+	// NamespaceSelector selects the namespaces whose ButaneConfigs the
+	// snippets are injected into. Unset selects every namespace.
+	// +optional
+	NamespaceSelector *metav1.LabelSelector `json:"namespaceSelector,omitempty"`
+
+	// Selector selects the ButaneConfigs the snippets are injected into by
+	// their labels. Unset selects every ButaneConfig of the selected namespaces.
+	// +optional
+	Selector *metav1.LabelSelector `json:"selector,omitempty"`
+
+	// MergeFrom lists the ClusterButaneConfigs holding the snippets. They are
+	// merged over the selected ButaneConfigs, in order, so that their entries
+	// take precedence over the entries of the ButaneConfigs.
+	// +kubebuilder:validation:MinItems=1
+	// +listType=map
+	// +listMapKey=name
+	MergeFrom []ClusterButaneConfigReference `json:"mergeFrom"`
+}
+
+// Selects reports whether the policy applies to a ButaneConfig with objLabels
+// in a namespace with nsLabels.
+func (s *ButaneInjectionPolicySpec) Selects(nsLabels, objLabels map[string]string) (bool, error) {
+	for _, sel := range []struct {
+		selector *metav1.LabelSelector
+		labels   map[string]string
+	}{{s.NamespaceSelector, nsLabels}, {s.Selector, objLabels}} {
+		if sel.selector == nil {
+			continue
+		}
+		selector, err := metav1.LabelSelectorAsSelector(sel.selector)
+		if err != nil {
+			return false, err
+		}
+		if !selector.Matches(labels.Set(sel.labels)) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ButaneInjectionPolicy merges ClusterButaneConfigs, e.g. a hardening config,
+// into every ButaneConfig it selects when they are rendered. The policies
+// applied to a ButaneConfig are listed in status.appliedPolicies and in an
+// annotation of its Secret.
+type ButaneInjectionPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec ButaneInjectionPolicySpec `json:"spec,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ButaneInjectionPolicyList contains a list of ButaneInjectionPolicy
+type ButaneInjectionPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ButaneInjectionPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ButaneInjectionPolicy{}, &ButaneInjectionPolicyList{})
+}
@@ -0,0 +1,79 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"fmt"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var butaneinjectionpolicylog = logf.Log.WithName("butaneinjectionpolicy-resource")
+
+// SetupWebhookWithManager will setup the manager to manage the webhooks.
+func (r *ButaneInjectionPolicy) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr, &ButaneInjectionPolicy{}).
+		WithValidator(&ButaneInjectionPolicyCustomValidator{}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-butane-operators-naval-group-com-v1beta1-butaneinjectionpolicy,mutating=false,failurePolicy=fail,sideEffects=None,groups=butane.operators.naval-group.com,resources=butaneinjectionpolicies,verbs=create;update,versions=v1beta1,name=validating.butaneinjectionpolicies.operators.naval-group.com,admissionReviewVersions=v1
+
+// +kubebuilder:object:generate=false
+
+// ButaneInjectionPolicyCustomValidator implements admission.Validator[*ButaneInjectionPolicy]
+type ButaneInjectionPolicyCustomValidator struct{}
+
+// ValidateCreate implements validation logic for ButaneInjectionPolicy creation
+func (v *ButaneInjectionPolicyCustomValidator) ValidateCreate(ctx context.Context, obj *ButaneInjectionPolicy) (admission.Warnings, error) {
+	butaneinjectionpolicylog.Info("validate create", "name", obj.Name)
+	return validateInjectionPolicy(obj)
+}
+
+// ValidateUpdate implements validation logic for ButaneInjectionPolicy updates
+func (v *ButaneInjectionPolicyCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj *ButaneInjectionPolicy) (admission.Warnings, error) {
+	butaneinjectionpolicylog.Info("validate update", "name", newObj.Name)
+	return validateInjectionPolicy(newObj)
+}
+
+// ValidateDelete implements validation logic for ButaneInjectionPolicy deletion
+func (v *ButaneInjectionPolicyCustomValidator) ValidateDelete(ctx context.Context, obj *ButaneInjectionPolicy) (admission.Warnings, error) {
+	return nil, nil
+}
+
+// validateInjectionPolicy checks the selectors, which the CRD schema cannot
+// express. The ClusterButaneConfigs are resolved by the controller, since they
+// may be created later.
+func validateInjectionPolicy(r *ButaneInjectionPolicy) (admission.Warnings, error) {
+	if _, err := metav1.LabelSelectorAsSelector(r.Spec.NamespaceSelector); err != nil {
+		return nil, fmt.Errorf("spec.namespaceSelector: %w", err)
+	}
+	if _, err := metav1.LabelSelectorAsSelector(r.Spec.Selector); err != nil {
+		return nil, fmt.Errorf("spec.selector: %w", err)
+	}
+	if len(r.Spec.MergeFrom) == 0 {
+		return nil, fmt.Errorf("spec.mergeFrom must list at least one ClusterButaneConfig")
+	}
+	if r.Spec.NamespaceSelector == nil && r.Spec.Selector == nil {
+		return admission.Warnings{"neither spec.namespaceSelector nor spec.selector is set, so the policy applies to every ButaneConfig"}, nil
+	}
+	return nil, nil
+}
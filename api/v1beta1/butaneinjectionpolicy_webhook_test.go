@@ -0,0 +1,54 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+var _ = Describe("ButaneInjectionPolicy Webhook", func() {
+	validator := &ButaneInjectionPolicyCustomValidator{}
+	hardening := []ClusterButaneConfigReference{{Name: "hardening"}}
+
+	It("Should deny invalid selectors", func() {
+		policy := &ButaneInjectionPolicy{Spec: ButaneInjectionPolicySpec{
+			NamespaceSelector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{{Key: "security-tier", Operator: "Equals"}}},
+			MergeFrom:         hardening,
+		}}
+		_, err := validator.ValidateCreate(ctx, policy)
+		Expect(err).To(MatchError(ContainSubstring("spec.namespaceSelector")))
+	})
+
+	It("Should warn when the policy selects every ButaneConfig", func() {
+		warnings, err := validator.ValidateCreate(ctx, &ButaneInjectionPolicy{Spec: ButaneInjectionPolicySpec{MergeFrom: hardening}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(ConsistOf(ContainSubstring("applies to every ButaneConfig")))
+	})
+
+	It("Should select by namespace and object labels", func() {
+		spec := ButaneInjectionPolicySpec{
+			NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"security-tier": "high"}},
+			Selector:          &metav1.LabelSelector{MatchLabels: map[string]string{"role": "worker"}},
+			MergeFrom:         hardening,
+		}
+		Expect(spec.Selects(map[string]string{"security-tier": "high"}, map[string]string{"role": "worker"})).To(BeTrue())
+		Expect(spec.Selects(map[string]string{"security-tier": "low"}, map[string]string{"role": "worker"})).To(BeFalse())
+		Expect(spec.Selects(map[string]string{"security-tier": "high"}, nil)).To(BeFalse())
+	})
+})
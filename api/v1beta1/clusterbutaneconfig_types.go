@@ -0,0 +1,131 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ClusterButaneConfigSpec defines the desired state of ClusterButaneConfig
+type ClusterButaneConfigSpec struct {
+	// Config is the Butane config to translate. Its schema is generated from
+	// the Butane specifications by hack/butane-schema.
+	// More info: https://coreos.github.io/butane/specs/
+	// +optional
+	Config *runtime.RawExtension `json:"config,omitempty"`
+
+	// RawConfig is a Butane config the API server does not validate, for
+	// versions the schema of config does not cover, e.g. experimental ones.
+	// +kubebuilder:pruning:PreserveUnknownFields
+	// +kubebuilder:validation:Schemaless
+	// +kubebuilder:validation:Type=object
+	// +optional
+	RawConfig *runtime.RawExtension `json:"rawConfig,omitempty"`
+
+	// Butane is a Butane config in YAML, translated as written.
+	// Exactly one of config, rawConfig and butane must be set.
+	// +optional
+	Butane string `json:"butane,omitempty"`
+
+	// Translation configures the Butane to Ignition translation.
+	// +optional
+	Translation TranslationSpec `json:"translation,omitempty"`
+}
+
+// Source returns the Butane config to translate, from config, rawConfig or
+// butane.
+func (s *ClusterButaneConfigSpec) Source() []byte {
+	if s.Butane != "" {
+		return []byte(s.Butane)
+	}
+	if s.RawConfig != nil {
+		return s.RawConfig.Raw
+	}
+	if s.Config != nil {
+		return s.Config.Raw
+	}
+	return nil
+}
+
+// ClusterButaneConfigReference names a ClusterButaneConfig.
+type ClusterButaneConfigReference struct {
+	// Name of the ClusterButaneConfig.
+	// +kubebuilder:validation:MinLength=1
+	Name string `json:"name"`
+}
+
+// ConsumerReference names a ButaneConfig merging a ClusterButaneConfig.
+type ConsumerReference struct {
+	Namespace string `json:"namespace"`
+	Name      string `json:"name"`
+}
+
+// ClusterButaneConfigStatus defines the observed state of ClusterButaneConfig
+type ClusterButaneConfigStatus struct {
+	// Variant is the Butane variant of the translated config.
+	// +optional
+	Variant string `json:"variant,omitempty"`
+
+	// IgnitionVersion is the version of the Ignition specification the
+	// translated config conforms to.
+	// +optional
+	IgnitionVersion string `json:"ignitionVersion,omitempty"`
+
+	// Consumers lists the ButaneConfigs that merge this config, sorted by
+	// namespace and name.
+	// +optional
+	Consumers []ConsumerReference `json:"consumers,omitempty"`
+
+	// Conditions represent the latest available observations of the ClusterButaneConfig state.
+	// +optional
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:resource:scope=Cluster
+//+kubebuilder:printcolumn:name="Variant",type=string,JSONPath=`.status.variant`
+//+kubebuilder:printcolumn:name="Ignition",type=string,JSONPath=`.status.ignitionVersion`,priority=1
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+//+kubebuilder:printcolumn:name="Age",type=date,JSONPath=`.metadata.creationTimestamp`
+
+// ClusterButaneConfig is a Butane config shared by the whole cluster, e.g. a
+// platform baseline, that ButaneConfigs of every namespace merge with
+// spec.mergeFrom. It is translated once and does not produce a Secret itself.
+type ClusterButaneConfig struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ClusterButaneConfigSpec   `json:"spec,omitempty"`
+	Status ClusterButaneConfigStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// ClusterButaneConfigList contains a list of ClusterButaneConfig
+type ClusterButaneConfigList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []ClusterButaneConfig `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&ClusterButaneConfig{}, &ClusterButaneConfigList{})
+}
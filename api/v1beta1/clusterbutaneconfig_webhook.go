@@ -0,0 +1,127 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/naval-group/butane-operator/internal/render"
+	ctrl "sigs.k8s.io/controller-runtime"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/webhook/admission"
+)
+
+var clusterbutaneconfiglog = logf.Log.WithName("clusterbutaneconfig-resource")
+
+// SetupWebhookWithManager will setup the manager to manage the webhooks.
+func (r *ClusterButaneConfig) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr, &ClusterButaneConfig{}).
+		WithDefaulter(&ClusterButaneConfigCustomDefaulter{}).
+		WithValidator(&ClusterButaneConfigCustomValidator{}).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/mutate-butane-operators-naval-group-com-v1beta1-clusterbutaneconfig,mutating=true,failurePolicy=fail,sideEffects=None,groups=butane.operators.naval-group.com,resources=clusterbutaneconfigs,verbs=create;update,versions=v1beta1,name=mutating.clusterbutaneconfigs.operators.naval-group.com,admissionReviewVersions=v1
+
+// +kubebuilder:object:generate=false
+
+// ClusterButaneConfigCustomDefaulter implements admission.Defaulter[*ClusterButaneConfig]
+type ClusterButaneConfigCustomDefaulter struct{}
+
+// Default sets the version of a config that only names its variant, as for
+// ButaneConfigs.
+func (d *ClusterButaneConfigCustomDefaulter) Default(ctx context.Context, obj *ClusterButaneConfig) error {
+	clusterbutaneconfiglog.Info("default", "name", obj.Name)
+
+	if err := defaultVersion(obj.Spec.Config); err != nil {
+		return err
+	}
+	return defaultVersion(obj.Spec.RawConfig)
+}
+
+//+kubebuilder:webhook:path=/validate-butane-operators-naval-group-com-v1beta1-clusterbutaneconfig,mutating=false,failurePolicy=fail,sideEffects=None,groups=butane.operators.naval-group.com,resources=clusterbutaneconfigs,verbs=create;update;delete,versions=v1beta1,name=validating.clusterbutaneconfigs.operators.naval-group.com,admissionReviewVersions=v1
+
+// +kubebuilder:object:generate=false
+
+// ClusterButaneConfigCustomValidator implements admission.Validator[*ClusterButaneConfig]
+type ClusterButaneConfigCustomValidator struct {
+	// FilesDir is the directory local contents and trees are read from, as
+	// with butane --files-dir. Empty, as in the cluster, rejects them.
+	FilesDir string
+}
+
+// ValidateCreate implements validation logic for ClusterButaneConfig creation
+func (v *ClusterButaneConfigCustomValidator) ValidateCreate(ctx context.Context, obj *ClusterButaneConfig) (admission.Warnings, error) {
+	clusterbutaneconfiglog.Info("validate create", "name", obj.Name)
+	return nil, validateClusterButaneConfig(obj, v.FilesDir)
+}
+
+// ValidateUpdate implements validation logic for ClusterButaneConfig updates
+func (v *ClusterButaneConfigCustomValidator) ValidateUpdate(ctx context.Context, oldObj, newObj *ClusterButaneConfig) (admission.Warnings, error) {
+	clusterbutaneconfiglog.Info("validate update", "name", newObj.Name)
+	return nil, validateClusterButaneConfig(newObj, v.FilesDir)
+}
+
+// ValidateDelete implements validation logic for ClusterButaneConfig deletion.
+// ButaneConfigs still merging a deleted config fail with MergeFailed until it
+// is recreated or they stop merging it.
+func (v *ClusterButaneConfigCustomValidator) ValidateDelete(ctx context.Context, obj *ClusterButaneConfig) (admission.Warnings, error) {
+	clusterbutaneconfiglog.Info("validate delete", "name", obj.Name)
+	if n := len(obj.Status.Consumers); n > 0 {
+		return admission.Warnings{fmt.Sprintf("%d ButaneConfigs merge this ClusterButaneConfig and will fail to reconcile", n)}, nil
+	}
+	return nil, nil
+}
+
+// validateClusterButaneConfig checks that the spec has exactly one source, that
+// it translates to Ignition and that it sets no plaintext password.
+func validateClusterButaneConfig(r *ClusterButaneConfig, filesDir string) error {
+	var sources []string
+	if r.Spec.Config != nil {
+		sources = append(sources, "spec.config")
+	}
+	if r.Spec.RawConfig != nil {
+		sources = append(sources, "spec.rawConfig")
+	}
+	if r.Spec.Butane != "" {
+		sources = append(sources, "spec.butane")
+	}
+	switch len(sources) {
+	case 1:
+	case 0:
+		return fmt.Errorf("one of spec.config, spec.rawConfig and spec.butane must be set")
+	default:
+		return fmt.Errorf("only one of spec.config, spec.rawConfig and spec.butane may be set, got %s", strings.Join(sources, ", "))
+	}
+
+	if r.Spec.Butane == "" {
+		var butane interface{}
+		if err := json.Unmarshal(r.Spec.Source(), &butane); err != nil {
+			return fmt.Errorf("failed to unmarshal Butane config: %v", err)
+		}
+	}
+	opts := r.Spec.Translation.RenderOptions()
+	opts.FilesDir = filesDir
+	ignition, _, err := render.Translate(r.Spec.Source(), opts)
+	if err != nil {
+		return fmt.Errorf("failed to translate Butane to Ignition: %w", err)
+	}
+	return render.CheckPasswordHashes(ignition)
+}
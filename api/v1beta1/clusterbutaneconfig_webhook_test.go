@@ -0,0 +1,62 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v1beta1
+
+import (
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+var _ = Describe("ClusterButaneConfig Webhook", func() {
+
+	Context("When creating ClusterButaneConfig under Defaulting Webhook", func() {
+		It("Should fill in the latest version of the variant", func() {
+			cbc := &ClusterButaneConfig{Spec: ClusterButaneConfigSpec{Config: &runtime.RawExtension{Raw: []byte(`{"variant":"fcos"}`)}}}
+			Expect((&ClusterButaneConfigCustomDefaulter{}).Default(ctx, cbc)).To(Succeed())
+			Expect(string(cbc.Spec.Config.Raw)).To(MatchJSON(`{"variant":"fcos","version":"1.7.0"}`))
+		})
+	})
+
+	Context("When creating ClusterButaneConfig under Validating Webhook", func() {
+		validator := &ClusterButaneConfigCustomValidator{}
+
+		It("Should deny if no Butane config is provided", func() {
+			_, err := validator.ValidateCreate(ctx, &ClusterButaneConfig{})
+			Expect(err).To(MatchError(ContainSubstring("one of spec.config, spec.rawConfig and spec.butane must be set")))
+		})
+
+		It("Should deny configs that do not translate", func() {
+			cbc := &ClusterButaneConfig{Spec: ClusterButaneConfigSpec{Butane: "variant: fcos\nversion: 1.5.0\nstorage:\n  files:\n    - path: etc/chrony.conf\n"}}
+			_, err := validator.ValidateCreate(ctx, cbc)
+			Expect(err).To(MatchError(ContainSubstring("path not absolute")))
+		})
+
+		It("Should admit a valid config", func() {
+			cbc := &ClusterButaneConfig{Spec: ClusterButaneConfigSpec{Butane: "variant: fcos\nversion: 1.5.0\nstorage:\n  files:\n    - path: /etc/chrony.conf\n"}}
+			_, err := validator.ValidateCreate(ctx, cbc)
+			Expect(err).NotTo(HaveOccurred())
+		})
+
+		It("Should warn when deleting a config that is still merged", func() {
+			cbc := &ClusterButaneConfig{Status: ClusterButaneConfigStatus{Consumers: []ConsumerReference{{Namespace: "tenant-a", Name: "worker"}}}}
+			warnings, err := validator.ValidateDelete(ctx, cbc)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(warnings).To(ConsistOf(ContainSubstring("1 ButaneConfigs merge this ClusterButaneConfig")))
+		})
+	})
+})
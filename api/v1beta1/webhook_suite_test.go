@@ -14,7 +14,7 @@ See the License for the specific language governing permissions and
 limitations under the License.
 */
 
-package v1alpha1
+package v1beta1
 
 import (
 	"context"
@@ -109,7 +109,13 @@ var _ = BeforeSuite(func() {
 	})
 	Expect(err).NotTo(HaveOccurred())
 
-	err = (&ButaneConfig{}).SetupWebhookWithManager(mgr)
+	err = (&ButaneConfig{}).SetupWebhookWithManager(mgr, nil)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = (&ClusterButaneConfig{}).SetupWebhookWithManager(mgr)
+	Expect(err).NotTo(HaveOccurred())
+
+	err = (&ButaneInjectionPolicy{}).SetupWebhookWithManager(mgr)
 	Expect(err).NotTo(HaveOccurred())
 
 	//+kubebuilder:scaffold:webhook
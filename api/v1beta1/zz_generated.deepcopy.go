@@ -0,0 +1,796 @@
+//go:build !ignore_autogenerated
+
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by controller-gen. DO NOT EDIT.
+
+package v1beta1
+
+import (
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ButaneConfig) DeepCopyInto(out *ButaneConfig) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ButaneConfig.
+func (in *ButaneConfig) DeepCopy() *ButaneConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ButaneConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ButaneConfig) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ButaneConfigList) DeepCopyInto(out *ButaneConfigList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ButaneConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ButaneConfigList.
+func (in *ButaneConfigList) DeepCopy() *ButaneConfigList {
+	if in == nil {
+		return nil
+	}
+	out := new(ButaneConfigList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ButaneConfigList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ButaneConfigSpec) DeepCopyInto(out *ButaneConfigSpec) {
+	*out = *in
+	if in.Config != nil {
+		in, out := &in.Config, &out.Config
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RawConfig != nil {
+		in, out := &in.RawConfig, &out.RawConfig
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ButaneFrom != nil {
+		in, out := &in.ButaneFrom, &out.ButaneFrom
+		*out = new(v1.ConfigMapKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MergeFrom != nil {
+		in, out := &in.MergeFrom, &out.MergeFrom
+		*out = make([]ClusterButaneConfigReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.Users != nil {
+		in, out := &in.Users, &out.Users
+		*out = make([]UserSpec, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	in.Images.DeepCopyInto(&out.Images)
+	in.Translation.DeepCopyInto(&out.Translation)
+	in.Output.DeepCopyInto(&out.Output)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ButaneConfigSpec.
+func (in *ButaneConfigSpec) DeepCopy() *ButaneConfigSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ButaneConfigSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ButaneConfigStatus) DeepCopyInto(out *ButaneConfigStatus) {
+	*out = *in
+	if in.SpilledSecretNames != nil {
+		in, out := &in.SpilledSecretNames, &out.SpilledSecretNames
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.AppliedPolicies != nil {
+		in, out := &in.AppliedPolicies, &out.AppliedPolicies
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.PinnedImages != nil {
+		in, out := &in.PinnedImages, &out.PinnedImages
+		*out = make([]PinnedImage, len(*in))
+		copy(*out, *in)
+	}
+	if in.LintFindings != nil {
+		in, out := &in.LintFindings, &out.LintFindings
+		*out = make([]LintFinding, len(*in))
+		copy(*out, *in)
+	}
+	if in.OCIArtifact != nil {
+		in, out := &in.OCIArtifact, &out.OCIArtifact
+		*out = new(OCIArtifact)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.S3Object != nil {
+		in, out := &in.S3Object, &out.S3Object
+		*out = new(S3Object)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ButaneConfigStatus.
+func (in *ButaneConfigStatus) DeepCopy() *ButaneConfigStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ButaneConfigStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ButaneInjectionPolicy) DeepCopyInto(out *ButaneInjectionPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ButaneInjectionPolicy.
+func (in *ButaneInjectionPolicy) DeepCopy() *ButaneInjectionPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(ButaneInjectionPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ButaneInjectionPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ButaneInjectionPolicyList) DeepCopyInto(out *ButaneInjectionPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ButaneInjectionPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ButaneInjectionPolicyList.
+func (in *ButaneInjectionPolicyList) DeepCopy() *ButaneInjectionPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(ButaneInjectionPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ButaneInjectionPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ButaneInjectionPolicySpec) DeepCopyInto(out *ButaneInjectionPolicySpec) {
+	*out = *in
+	if in.NamespaceSelector != nil {
+		in, out := &in.NamespaceSelector, &out.NamespaceSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Selector != nil {
+		in, out := &in.Selector, &out.Selector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.MergeFrom != nil {
+		in, out := &in.MergeFrom, &out.MergeFrom
+		*out = make([]ClusterButaneConfigReference, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ButaneInjectionPolicySpec.
+func (in *ButaneInjectionPolicySpec) DeepCopy() *ButaneInjectionPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ButaneInjectionPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterButaneConfig) DeepCopyInto(out *ClusterButaneConfig) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterButaneConfig.
+func (in *ClusterButaneConfig) DeepCopy() *ClusterButaneConfig {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterButaneConfig)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterButaneConfig) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterButaneConfigList) DeepCopyInto(out *ClusterButaneConfigList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]ClusterButaneConfig, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterButaneConfigList.
+func (in *ClusterButaneConfigList) DeepCopy() *ClusterButaneConfigList {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterButaneConfigList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *ClusterButaneConfigList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterButaneConfigReference) DeepCopyInto(out *ClusterButaneConfigReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterButaneConfigReference.
+func (in *ClusterButaneConfigReference) DeepCopy() *ClusterButaneConfigReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterButaneConfigReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterButaneConfigSpec) DeepCopyInto(out *ClusterButaneConfigSpec) {
+	*out = *in
+	if in.Config != nil {
+		in, out := &in.Config, &out.Config
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RawConfig != nil {
+		in, out := &in.RawConfig, &out.RawConfig
+		*out = new(runtime.RawExtension)
+		(*in).DeepCopyInto(*out)
+	}
+	in.Translation.DeepCopyInto(&out.Translation)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterButaneConfigSpec.
+func (in *ClusterButaneConfigSpec) DeepCopy() *ClusterButaneConfigSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterButaneConfigSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ClusterButaneConfigStatus) DeepCopyInto(out *ClusterButaneConfigStatus) {
+	*out = *in
+	if in.Consumers != nil {
+		in, out := &in.Consumers, &out.Consumers
+		*out = make([]ConsumerReference, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ClusterButaneConfigStatus.
+func (in *ClusterButaneConfigStatus) DeepCopy() *ClusterButaneConfigStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(ClusterButaneConfigStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ConsumerReference) DeepCopyInto(out *ConsumerReference) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ConsumerReference.
+func (in *ConsumerReference) DeepCopy() *ConsumerReference {
+	if in == nil {
+		return nil
+	}
+	out := new(ConsumerReference)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *EncryptionSpec) DeepCopyInto(out *EncryptionSpec) {
+	*out = *in
+	if in.RecipientsRef != nil {
+		in, out := &in.RecipientsRef, &out.RecipientsRef
+		*out = new(v1.ConfigMapKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Remote != nil {
+		in, out := &in.Remote, &out.Remote
+		*out = new(RemoteSourceSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new EncryptionSpec.
+func (in *EncryptionSpec) DeepCopy() *EncryptionSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(EncryptionSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *ImagesSpec) DeepCopyInto(out *ImagesSpec) {
+	*out = *in
+	if in.PullSecretRef != nil {
+		in, out := &in.PullSecretRef, &out.PullSecretRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new ImagesSpec.
+func (in *ImagesSpec) DeepCopy() *ImagesSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(ImagesSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *LintFinding) DeepCopyInto(out *LintFinding) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new LintFinding.
+func (in *LintFinding) DeepCopy() *LintFinding {
+	if in == nil {
+		return nil
+	}
+	out := new(LintFinding)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OCIArtifact) DeepCopyInto(out *OCIArtifact) {
+	*out = *in
+	if in.Tags != nil {
+		in, out := &in.Tags, &out.Tags
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OCIArtifact.
+func (in *OCIArtifact) DeepCopy() *OCIArtifact {
+	if in == nil {
+		return nil
+	}
+	out := new(OCIArtifact)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OCISpec) DeepCopyInto(out *OCISpec) {
+	*out = *in
+	if in.PushSecretRef != nil {
+		in, out := &in.PushSecretRef, &out.PushSecretRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OCISpec.
+func (in *OCISpec) DeepCopy() *OCISpec {
+	if in == nil {
+		return nil
+	}
+	out := new(OCISpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *OutputSpec) DeepCopyInto(out *OutputSpec) {
+	*out = *in
+	if in.Encryption != nil {
+		in, out := &in.Encryption, &out.Encryption
+		*out = new(EncryptionSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Signing != nil {
+		in, out := &in.Signing, &out.Signing
+		*out = new(SigningSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Size != nil {
+		in, out := &in.Size, &out.Size
+		*out = new(SizeSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.OCI != nil {
+		in, out := &in.OCI, &out.OCI
+		*out = new(OCISpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.S3 != nil {
+		in, out := &in.S3, &out.S3
+		*out = new(S3Spec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.RevisionHistoryLimit != nil {
+		in, out := &in.RevisionHistoryLimit, &out.RevisionHistoryLimit
+		*out = new(int32)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new OutputSpec.
+func (in *OutputSpec) DeepCopy() *OutputSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(OutputSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PinnedImage) DeepCopyInto(out *PinnedImage) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PinnedImage.
+func (in *PinnedImage) DeepCopy() *PinnedImage {
+	if in == nil {
+		return nil
+	}
+	out := new(PinnedImage)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PresignedURLSpec) DeepCopyInto(out *PresignedURLSpec) {
+	*out = *in
+	if in.Expiry != nil {
+		in, out := &in.Expiry, &out.Expiry
+		*out = new(metav1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PresignedURLSpec.
+func (in *PresignedURLSpec) DeepCopy() *PresignedURLSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(PresignedURLSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *RemoteSourceSpec) DeepCopyInto(out *RemoteSourceSpec) {
+	*out = *in
+	if in.Paths != nil {
+		in, out := &in.Paths, &out.Paths
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.HeadersSecretRef != nil {
+		in, out := &in.HeadersSecretRef, &out.HeadersSecretRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new RemoteSourceSpec.
+func (in *RemoteSourceSpec) DeepCopy() *RemoteSourceSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(RemoteSourceSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *S3Object) DeepCopyInto(out *S3Object) {
+	*out = *in
+	if in.URLExpiresAt != nil {
+		in, out := &in.URLExpiresAt, &out.URLExpiresAt
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new S3Object.
+func (in *S3Object) DeepCopy() *S3Object {
+	if in == nil {
+		return nil
+	}
+	out := new(S3Object)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *S3Spec) DeepCopyInto(out *S3Spec) {
+	*out = *in
+	out.CredentialsSecretRef = in.CredentialsSecretRef
+	if in.PresignedURL != nil {
+		in, out := &in.PresignedURL, &out.PresignedURL
+		*out = new(PresignedURLSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new S3Spec.
+func (in *S3Spec) DeepCopy() *S3Spec {
+	if in == nil {
+		return nil
+	}
+	out := new(S3Spec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SSHAuthorizedKeysSource) DeepCopyInto(out *SSHAuthorizedKeysSource) {
+	*out = *in
+	if in.SecretSelector != nil {
+		in, out := &in.SecretSelector, &out.SecretSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ConfigMapSelector != nil {
+		in, out := &in.ConfigMapSelector, &out.ConfigMapSelector
+		*out = new(metav1.LabelSelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SSHAuthorizedKeysSource.
+func (in *SSHAuthorizedKeysSource) DeepCopy() *SSHAuthorizedKeysSource {
+	if in == nil {
+		return nil
+	}
+	out := new(SSHAuthorizedKeysSource)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SigningSpec) DeepCopyInto(out *SigningSpec) {
+	*out = *in
+	in.KeySecretRef.DeepCopyInto(&out.KeySecretRef)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SigningSpec.
+func (in *SigningSpec) DeepCopy() *SigningSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SigningSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SizeSpec) DeepCopyInto(out *SizeSpec) {
+	*out = *in
+	if in.Limit != nil {
+		in, out := &in.Limit, &out.Limit
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.Spill != nil {
+		in, out := &in.Spill, &out.Spill
+		*out = new(SpillSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SizeSpec.
+func (in *SizeSpec) DeepCopy() *SizeSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SizeSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SpillSpec) DeepCopyInto(out *SpillSpec) {
+	*out = *in
+	if in.Threshold != nil {
+		in, out := &in.Threshold, &out.Threshold
+		x := (*in).DeepCopy()
+		*out = &x
+	}
+	if in.HeadersSecretRef != nil {
+		in, out := &in.HeadersSecretRef, &out.HeadersSecretRef
+		*out = new(v1.LocalObjectReference)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SpillSpec.
+func (in *SpillSpec) DeepCopy() *SpillSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SpillSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TranslationSpec) DeepCopyInto(out *TranslationSpec) {
+	*out = *in
+	if in.Strict != nil {
+		in, out := &in.Strict, &out.Strict
+		*out = new(bool)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TranslationSpec.
+func (in *TranslationSpec) DeepCopy() *TranslationSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(TranslationSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *UserSpec) DeepCopyInto(out *UserSpec) {
+	*out = *in
+	if in.SSHAuthorizedKeysFrom != nil {
+		in, out := &in.SSHAuthorizedKeysFrom, &out.SSHAuthorizedKeysFrom
+		*out = make([]SSHAuthorizedKeysSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.PasswordFrom != nil {
+		in, out := &in.PasswordFrom, &out.PasswordFrom
+		*out = new(v1.SecretKeySelector)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new UserSpec.
+func (in *UserSpec) DeepCopy() *UserSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(UserSpec)
+	in.DeepCopyInto(out)
+	return out
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/serializer"
+	utilyaml "k8s.io/apimachinery/pkg/util/yaml"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	butanev1alpha1 "github.com/naval-group/butane-operator/api/v1alpha1"
+	butanev1beta1 "github.com/naval-group/butane-operator/api/v1beta1"
+)
+
+// manifest is a Kubernetes object read from a local file.
+type manifest struct {
+	obj  client.Object
+	file string
+}
+
+// loadManifests reads every YAML or JSON document from paths. Directories are
+// walked recursively and "-" reads from stdin. Documents whose kind is not
+// registered in scheme are skipped, so mixed kustomize outputs can be fed as-is.
+func loadManifests(paths []string, scheme *runtime.Scheme, namespace string, stdin io.Reader) ([]manifest, error) {
+	decoder := serializer.NewCodecFactory(scheme).UniversalDeserializer()
+
+	var files []string
+	for _, p := range paths {
+		if p == "-" {
+			files = append(files, p)
+			continue
+		}
+		err := filepath.WalkDir(p, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			switch strings.ToLower(filepath.Ext(path)) {
+			case ".yaml", ".yml", ".json":
+				files = append(files, path)
+			default:
+				if path == p {
+					// Explicitly named files are read whatever their extension.
+					files = append(files, path)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var out []manifest
+	for _, file := range files {
+		var r io.Reader = stdin
+		if file != "-" {
+			f, err := os.Open(file)
+			if err != nil {
+				return nil, err
+			}
+			defer func() { _ = f.Close() }()
+			r = f
+		}
+
+		reader := utilyaml.NewYAMLReader(bufio.NewReader(r))
+		for {
+			doc, err := reader.Read()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			if len(bytes.TrimSpace(doc)) == 0 {
+				continue
+			}
+
+			var typeMeta metav1.TypeMeta
+			if err := yaml.Unmarshal(doc, &typeMeta); err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			if typeMeta.Kind == "" {
+				continue
+			}
+
+			obj, _, err := decoder.Decode(doc, nil, nil)
+			if runtime.IsNotRegisteredError(err) {
+				continue
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", file, err)
+			}
+			cobj, ok := obj.(client.Object)
+			if !ok {
+				continue
+			}
+			if alpha, ok := cobj.(*butanev1alpha1.ButaneConfig); ok {
+				// The API server converts older versions to the storage
+				// version; the fake client does not.
+				hub := &butanev1beta1.ButaneConfig{}
+				if err := alpha.ConvertTo(hub); err != nil {
+					return nil, fmt.Errorf("%s: %w", file, err)
+				}
+				cobj = hub
+			}
+			if !clusterScoped(cobj) && cobj.GetNamespace() == "" {
+				cobj.SetNamespace(namespace)
+			}
+			if secret, ok := cobj.(*corev1.Secret); ok {
+				// The API server folds stringData into data; the fake client does not.
+				for k, v := range secret.StringData {
+					if secret.Data == nil {
+						secret.Data = map[string][]byte{}
+					}
+					secret.Data[k] = []byte(v)
+				}
+				secret.StringData = nil
+			}
+			out = append(out, manifest{obj: cobj, file: file})
+		}
+	}
+	return out, nil
+}
+
+// clusterScoped reports whether obj is of a cluster-scoped kind, which must not
+// be given a namespace.
+func clusterScoped(obj client.Object) bool {
+	switch obj.(type) {
+	case *corev1.Namespace, *butanev1beta1.ClusterButaneConfig, *butanev1beta1.ButaneInjectionPolicy:
+		return true
+	}
+	return false
+}
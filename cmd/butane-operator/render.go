@@ -0,0 +1,343 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/yaml"
+
+	butanev1alpha1 "github.com/naval-group/butane-operator/api/v1alpha1"
+	butanev1beta1 "github.com/naval-group/butane-operator/api/v1beta1"
+	"github.com/naval-group/butane-operator/internal/controller"
+	"github.com/naval-group/butane-operator/internal/userdir"
+)
+
+func newScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(butanev1alpha1.AddToScheme(scheme))
+	utilruntime.Must(butanev1beta1.AddToScheme(scheme))
+	return scheme
+}
+
+type renderOptions struct {
+	output       string
+	outputDir    string
+	reportFormat string
+	reportFile   string
+	namespace    string
+	userDir      string
+	filesDir     string
+}
+
+func runRender(args []string, stdout, stderr io.Writer) int {
+	opts := renderOptions{}
+	fs := flag.NewFlagSet("render", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&opts.output, "output", "ignition", "What to write for each ButaneConfig: ignition or secret.")
+	fs.StringVar(&opts.outputDir, "output-dir", "",
+		"Write one file per ButaneConfig into this directory instead of stdout.")
+	fs.StringVar(&opts.reportFormat, "report-format", "text", "Format of the validation report: text, json or sarif.")
+	fs.StringVar(&opts.reportFile, "report-file", "", "Write the validation report to this file instead of stderr.")
+	fs.StringVar(&opts.namespace, "namespace", "default", "Namespace for manifests that do not set one.")
+	fs.StringVar(&opts.userDir, "user-directory", "",
+		"User directory file for the spec.users entries that read SSH authorized keys from it.")
+	fs.StringVar(&opts.filesDir, "files-dir", "",
+		"Directory the local contents and trees of the Butane configs are read from, as with butane --files-dir.")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "Usage: butane-operator render [flags] <file|dir|->...")
+		_, _ = fmt.Fprintln(stderr)
+		_, _ = fmt.Fprintln(stderr, "Validates ButaneConfig manifests with the admission webhook logic and renders them")
+		_, _ = fmt.Fprintln(stderr, "with the controller logic. ConfigMaps, Secrets and ClusterButaneConfigs found in the")
+		_, _ = fmt.Fprintln(stderr, "inputs are used to resolve references, as they would be in the cluster.")
+		_, _ = fmt.Fprintln(stderr)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+	if opts.output != "ignition" && opts.output != "secret" {
+		_, _ = fmt.Fprintf(stderr, "invalid --output %q: must be ignition or secret\n", opts.output)
+		return exitUsage
+	}
+	switch opts.reportFormat {
+	case "text", "json", "sarif":
+	default:
+		_, _ = fmt.Fprintf(stderr, "invalid --report-format %q: must be text, json or sarif\n", opts.reportFormat)
+		return exitUsage
+	}
+
+	scheme := newScheme()
+	manifests, err := loadManifests(fs.Args(), scheme, opts.namespace, os.Stdin)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitFailed
+	}
+
+	var directory *userdir.Directory
+	if opts.userDir != "" {
+		directory = userdir.NewDirectory(opts.userDir, logr.Discard())
+	}
+	outputs, diags := renderManifests(context.Background(), scheme, manifests, opts.output, directory, opts.filesDir)
+
+	reportOut := stderr
+	if opts.reportFile != "" {
+		f, err := os.Create(opts.reportFile)
+		if err != nil {
+			_, _ = fmt.Fprintf(stderr, "error: %v\n", err)
+			return exitFailed
+		}
+		defer func() { _ = f.Close() }()
+		reportOut = f
+	}
+	if err := writeReport(reportOut, opts.reportFormat, diags); err != nil {
+		_, _ = fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitFailed
+	}
+
+	if err := writeOutputs(stdout, opts.outputDir, outputs); err != nil {
+		_, _ = fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitFailed
+	}
+	if hasErrors(diags) {
+		return exitFailed
+	}
+	return exitOK
+}
+
+// defaultObject applies the defaulting webhook of obj, if it has one.
+func defaultObject(ctx context.Context, obj client.Object) error {
+	switch obj := obj.(type) {
+	case *butanev1beta1.ButaneConfig:
+		return (&butanev1beta1.ButaneConfigCustomDefaulter{}).Default(ctx, obj)
+	case *butanev1beta1.ClusterButaneConfig:
+		return (&butanev1beta1.ClusterButaneConfigCustomDefaulter{}).Default(ctx, obj)
+	}
+	return nil
+}
+
+// renderedFile is one artifact produced for a ButaneConfig.
+type renderedFile struct {
+	name string
+	data []byte
+}
+
+// renderManifests validates and renders every ButaneConfig in manifests. The
+// controller runs against a fake client seeded with all manifests, so
+// references are resolved from the local files exactly as in the cluster. It
+// runs in dry-run mode, so that rendering reaches no registry or object storage.
+func renderManifests(ctx context.Context, scheme *runtime.Scheme, manifests []manifest, output string, directory *userdir.Directory, filesDir string) ([]renderedFile, []diagnostic) {
+	builder := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithStatusSubresource(&butanev1beta1.ButaneConfig{}, &butanev1beta1.ClusterButaneConfig{})
+	var diags []diagnostic
+	for _, m := range manifests {
+		// Default the configs as the mutating webhooks do before they are stored
+		if err := defaultObject(ctx, m.obj); err != nil {
+			base := diagnostic{File: m.file, Object: m.obj.GetName()}
+			if ns := m.obj.GetNamespace(); ns != "" {
+				base.Object = ns + "/" + m.obj.GetName()
+			}
+			diags = append(diags, diagnosticsFromError(base, ruleValidation, err)...)
+		}
+		builder = builder.WithObjects(m.obj)
+	}
+	c := builder.Build()
+
+	clusterConfigs := controller.NewClusterConfigCache()
+	clusterConfigs.FilesDir = filesDir
+	reconciler := &controller.ButaneConfigReconciler{
+		Client:   c,
+		Log:      logr.Discard(),
+		Scheme:   scheme,
+		Recorder: &events.FakeRecorder{},
+
+		ClusterConfigs: clusterConfigs,
+		Directory:      directory,
+		FilesDir:       filesDir,
+		DryRun:         true,
+	}
+	validator := &butanev1beta1.ButaneConfigCustomValidator{FilesDir: filesDir}
+	clusterValidator := &butanev1beta1.ClusterButaneConfigCustomValidator{FilesDir: filesDir}
+
+	var outputs []renderedFile
+	for _, m := range manifests {
+		// ClusterButaneConfigs produce no output of their own, but are
+		// validated since the ButaneConfigs merging them depend on it.
+		if cbc, ok := m.obj.(*butanev1beta1.ClusterButaneConfig); ok {
+			if _, err := clusterValidator.ValidateCreate(ctx, cbc); err != nil {
+				base := diagnostic{File: m.file, Object: cbc.Name}
+				diags = append(diags, diagnosticsFromError(base, ruleValidation, err)...)
+			}
+			continue
+		}
+		bc, ok := m.obj.(*butanev1beta1.ButaneConfig)
+		if !ok {
+			continue
+		}
+		key := client.ObjectKeyFromObject(bc)
+		base := diagnostic{File: m.file, Object: key.String()}
+
+		warnings, err := validator.ValidateCreate(ctx, bc)
+		for _, w := range warnings {
+			d := base
+			d.Rule = ruleValidation
+			d.Severity = severityWarning
+			d.Message = w
+			diags = append(diags, d)
+		}
+		if err != nil {
+			diags = append(diags, diagnosticsFromError(base, ruleValidation, err)...)
+			continue
+		}
+
+		if _, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key}); err != nil {
+			// Whether the controller would retry does not matter offline.
+			if errors.Is(err, reconcile.TerminalError(nil)) {
+				err = errors.Unwrap(err)
+			}
+			diags = append(diags, diagnosticsFromError(base, ruleRender, err)...)
+			continue
+		}
+
+		if oci := bc.Spec.Output.OCI; oci != nil {
+			d := base
+			d.Rule = ruleRender
+			d.Severity = severityInfo
+			d.Message = fmt.Sprintf("spec.output.oci is not pushed offline; the controller pushes the Ignition to %s", oci.Repository)
+			diags = append(diags, d)
+		}
+		if s3 := bc.Spec.Output.S3; s3 != nil {
+			d := base
+			d.Rule = ruleRender
+			d.Severity = severityInfo
+			d.Message = fmt.Sprintf("spec.output.s3 is not uploaded offline; the controller uploads the Ignition to s3://%s/%s",
+				s3.Bucket, s3.ObjectKey(bc.Namespace, bc.Name, bc.Generation))
+			diags = append(diags, d)
+		}
+
+		files, err := renderedOutput(ctx, c, key, output)
+		if err != nil {
+			diags = append(diags, diagnosticsFromError(base, ruleRender, err)...)
+			continue
+		}
+		outputs = append(outputs, files...)
+	}
+	return outputs, diags
+}
+
+// renderedOutput reads back what the controller produced for the ButaneConfig.
+func renderedOutput(ctx context.Context, c client.Client, key client.ObjectKey, output string) ([]renderedFile, error) {
+	var bc butanev1beta1.ButaneConfig
+	if err := c.Get(ctx, key, &bc); err != nil {
+		return nil, err
+	}
+	var secret corev1.Secret
+	if err := c.Get(ctx, client.ObjectKey{Namespace: key.Namespace, Name: bc.Status.SecretName}, &secret); err != nil {
+		return nil, err
+	}
+
+	if output == "ignition" {
+		return []renderedFile{{
+			name: fmt.Sprintf("%s_%s.ign", key.Namespace, key.Name),
+			data: append(butanev1beta1.IgnitionData(secret.Data), '\n'),
+		}}, nil
+	}
+
+	secrets := []corev1.Secret{secret}
+	names := bc.Status.SpilledSecretNames
+	if bc.Status.FilesSecretName != "" {
+		names = append([]string{bc.Status.FilesSecretName}, names...)
+	}
+	for _, name := range names {
+		var files corev1.Secret
+		if err := c.Get(ctx, client.ObjectKey{Namespace: key.Namespace, Name: name}, &files); err != nil {
+			return nil, err
+		}
+		secrets = append(secrets, files)
+	}
+
+	var rendered []renderedFile
+	for _, secret := range secrets {
+		// Only keep what would be sent to the API server; owner references,
+		// resource versions and the like are assigned by the cluster.
+		out := corev1.Secret{
+			TypeMeta: metav1.TypeMeta{APIVersion: "v1", Kind: "Secret"},
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        secret.Name,
+				Namespace:   secret.Namespace,
+				Labels:      secret.Labels,
+				Annotations: secret.Annotations,
+			},
+			Type: secret.Type,
+			Data: secret.Data,
+		}
+		data, err := yaml.Marshal(&out)
+		if err != nil {
+			return nil, err
+		}
+		rendered = append(rendered, renderedFile{name: fmt.Sprintf("%s_%s.yaml", key.Namespace, secret.Name), data: data})
+	}
+	return rendered, nil
+}
+
+func writeOutputs(stdout io.Writer, dir string, outputs []renderedFile) error {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return err
+		}
+		for _, o := range outputs {
+			if err := os.WriteFile(filepath.Join(dir, o.name), o.data, 0o600); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i, o := range outputs {
+		if i > 0 && filepath.Ext(o.name) == ".yaml" {
+			if _, err := io.WriteString(stdout, "---\n"); err != nil {
+				return err
+			}
+		}
+		if _, err := stdout.Write(o.data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,973 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	"github.com/naval-group/butane-operator/internal/signing"
+)
+
+const validManifest = `apiVersion: butane.operators.naval-group.com/v1alpha1
+kind: ButaneConfig
+metadata:
+  name: motd
+spec:
+  config:
+    variant: fcos
+    version: 1.5.0
+    storage:
+      files:
+        - path: /etc/motd
+          contents:
+            inline: hello
+`
+
+const invalidManifest = `apiVersion: butane.operators.naval-group.com/v1alpha1
+kind: ButaneConfig
+metadata:
+  name: relative
+  namespace: team-a
+spec:
+  config:
+    variant: fcos
+    version: 1.5.0
+    storage:
+      files:
+        - path: etc/motd
+`
+
+func writeManifest(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "butane.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRenderIgnition(t *testing.T) {
+	path := writeManifest(t, validManifest)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"render", path}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("render exit code = %d, stderr = %s", code, stderr.String())
+	}
+
+	var ign map[string]interface{}
+	if err := json.Unmarshal(stdout.Bytes(), &ign); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, stdout.String())
+	}
+	if _, ok := ign["ignition"]; !ok {
+		t.Errorf("output has no ignition section: %s", stdout.String())
+	}
+}
+
+func TestRenderV1beta1Translation(t *testing.T) {
+	manifest := `apiVersion: butane.operators.naval-group.com/v1beta1
+kind: ButaneConfig
+metadata:
+  name: motd
+spec:
+  rawConfig:
+    variant: fcos
+    version: 1.5.0
+    storage:
+      files:
+        - path: /etc/motd
+          unknown: ignored
+  translation:
+    strict: %s
+    pretty: true
+`
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"render", writeManifest(t, fmt.Sprintf(manifest, "true"))}, &stdout, &stderr); code != exitFailed {
+		t.Fatalf("strict render exit code = %d, want %d", code, exitFailed)
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if code := run([]string{"render", writeManifest(t, fmt.Sprintf(manifest, "false"))}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("render exit code = %d, stderr = %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "\n  \"ignition\"") {
+		t.Errorf("output should be indented:\n%s", stdout.String())
+	}
+}
+
+func TestRenderSecretToDir(t *testing.T) {
+	path := writeManifest(t, validManifest)
+	outDir := t.TempDir()
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"render", "--output", "secret", "--output-dir", outDir, path}, &stdout, &stderr)
+	if code != exitOK {
+		t.Fatalf("render exit code = %d, stderr = %s", code, stderr.String())
+	}
+
+	data, err := os.ReadFile(filepath.Join(outDir, "default_motd-ignition.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"kind: Secret", "name: motd-ignition", "userdata:"} {
+		if !strings.Contains(string(data), want) {
+			t.Errorf("secret manifest missing %q:\n%s", want, data)
+		}
+	}
+	if strings.Contains(string(data), "ownerReferences") {
+		t.Errorf("secret manifest should not carry cluster-assigned fields:\n%s", data)
+	}
+}
+
+func TestRenderReportsFailures(t *testing.T) {
+	path := writeManifest(t, validManifest+"---\n"+invalidManifest)
+
+	var stdout, stderr bytes.Buffer
+	code := run([]string{"render", "--report-format", "json", path}, &stdout, &stderr)
+	if code != exitFailed {
+		t.Fatalf("render exit code = %d, want %d", code, exitFailed)
+	}
+
+	var diags []diagnostic
+	if err := json.Unmarshal(stderr.Bytes(), &diags); err != nil {
+		t.Fatalf("report is not JSON: %v\n%s", err, stderr.String())
+	}
+	if len(diags) == 0 {
+		t.Fatal("expected at least one diagnostic")
+	}
+	d := diags[0]
+	if d.Object != "team-a/relative" || d.Severity != severityError || d.Path != "$.storage.files.0.path" {
+		t.Errorf("unexpected diagnostic %+v", d)
+	}
+	if stdout.Len() == 0 {
+		t.Error("valid configs should still be rendered")
+	}
+}
+
+func TestRenderDefaultsVersion(t *testing.T) {
+	// The mutating webhooks set the newest stable version of the variant
+	path := writeManifest(t, `apiVersion: butane.operators.naval-group.com/v1beta1
+kind: ClusterButaneConfig
+metadata:
+  name: baseline
+spec:
+  config:
+    variant: fcos
+    storage:
+      files:
+        - path: /etc/chrony.d/platform.conf
+          contents:
+            inline: server ntp.example.com
+---
+apiVersion: butane.operators.naval-group.com/v1beta1
+kind: ButaneConfig
+metadata:
+  name: motd
+spec:
+  mergeFrom:
+    - name: baseline
+  config:
+    variant: fcos
+    storage:
+      files:
+        - path: /etc/motd
+          contents:
+            inline: hello
+`)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"render", path}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("render exit code = %d, stderr = %s", code, stderr.String())
+	}
+	out := stdout.String()
+	if !strings.Contains(out, "/etc/chrony.d/platform.conf") || !strings.Contains(out, "data:,hello") {
+		t.Errorf("configs without a version should render like in the cluster:\n%s", out)
+	}
+}
+
+func TestRenderButaneText(t *testing.T) {
+	manifest := `apiVersion: butane.operators.naval-group.com/v1beta1
+kind: ButaneConfig
+metadata:
+  name: motd
+spec:
+  butane: |
+    variant: fcos
+    version: 1.5.0
+    # The message of the day
+    storage:
+      files:
+        - path: /etc/motd
+          mode: 0644
+        - path: etc/issue
+`
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"render", "--report-format", "json", writeManifest(t, manifest)}, &stdout, &stderr); code != exitFailed {
+		t.Fatalf("render exit code = %d, want %d", code, exitFailed)
+	}
+	var diags []diagnostic
+	if err := json.Unmarshal(stderr.Bytes(), &diags); err != nil {
+		t.Fatalf("report is not JSON: %v\n%s", err, stderr.String())
+	}
+	if len(diags) != 1 || diags[0].Path != "$.storage.files.1.path" || diags[0].Line != 8 || diags[0].Column != 13 {
+		t.Errorf("positions should refer to the Butane text, got %+v", diags)
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	fixed := strings.Replace(manifest, "path: etc/issue", "path: /etc/issue", 1)
+	if code := run([]string{"render", writeManifest(t, fixed)}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("render exit code = %d, stderr = %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), `"mode":420`) {
+		t.Errorf("octal mode should be kept:\n%s", stdout.String())
+	}
+}
+
+func TestRenderButaneFrom(t *testing.T) {
+	manifest := `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: motd-butane
+data:
+  config.bu: |
+    variant: fcos
+    version: 1.5.0
+    storage:
+      files:
+        - path: /etc/motd
+---
+apiVersion: butane.operators.naval-group.com/v1beta1
+kind: ButaneConfig
+metadata:
+  name: motd
+spec:
+  butaneFrom:
+    name: motd-butane
+    key: %s
+`
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"render", writeManifest(t, fmt.Sprintf(manifest, "config.bu"))}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("render exit code = %d, stderr = %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), "/etc/motd") {
+		t.Errorf("output should be rendered from the ConfigMap:\n%s", stdout.String())
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if code := run([]string{"render", writeManifest(t, fmt.Sprintf(manifest, "missing.bu"))}, &stdout, &stderr); code != exitFailed {
+		t.Fatalf("render exit code = %d, want %d", code, exitFailed)
+	}
+	if !strings.Contains(stderr.String(), "has no key missing.bu") {
+		t.Errorf("missing key should be reported:\n%s", stderr.String())
+	}
+}
+
+func TestRenderMergeFrom(t *testing.T) {
+	manifest := `apiVersion: butane.operators.naval-group.com/v1beta1
+kind: ClusterButaneConfig
+metadata:
+  name: baseline
+spec:
+  butane: |
+    variant: fcos
+    version: 1.5.0
+    storage:
+      files:
+        - path: /etc/chrony.d/platform.conf
+          contents:
+            inline: server ntp.example.com
+        - path: /etc/motd
+          contents:
+            inline: baseline
+---
+apiVersion: butane.operators.naval-group.com/v1beta1
+kind: ButaneConfig
+metadata:
+  name: motd
+spec:
+  mergeFrom:
+    - name: %s
+  butane: |
+    variant: fcos
+    version: 1.6.0
+    storage:
+      files:
+        - path: /etc/motd
+          contents:
+            inline: hello
+`
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"render", writeManifest(t, fmt.Sprintf(manifest, "baseline"))}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("render exit code = %d, stderr = %s", code, stderr.String())
+	}
+	out := stdout.String()
+	if !strings.Contains(out, "/etc/chrony.d/platform.conf") || !strings.Contains(out, "data:,hello") || strings.Contains(out, "baseline") {
+		t.Errorf("output should merge the config over the baseline:\n%s", out)
+	}
+	if strings.Count(out, "\n") != 1 {
+		t.Errorf("the ClusterButaneConfig should not be rendered on its own:\n%s", out)
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if code := run([]string{"render", writeManifest(t, fmt.Sprintf(manifest, "missing"))}, &stdout, &stderr); code != exitFailed {
+		t.Fatalf("render exit code = %d, want %d", code, exitFailed)
+	}
+	if !strings.Contains(stderr.String(), "ClusterButaneConfig missing") {
+		t.Errorf("missing ClusterButaneConfig should be reported:\n%s", stderr.String())
+	}
+}
+
+func TestRenderInjectionPolicy(t *testing.T) {
+	manifest := `apiVersion: v1
+kind: Namespace
+metadata:
+  name: secure
+  labels:
+    security-tier: %s
+---
+apiVersion: butane.operators.naval-group.com/v1beta1
+kind: ClusterButaneConfig
+metadata:
+  name: hardening
+spec:
+  butane: |
+    variant: fcos
+    version: 1.5.0
+    storage:
+      files:
+        - path: /etc/ssh/sshd_config.d/40-hardening.conf
+          contents:
+            inline: PermitRootLogin no
+---
+apiVersion: butane.operators.naval-group.com/v1beta1
+kind: ButaneInjectionPolicy
+metadata:
+  name: high-security
+spec:
+  namespaceSelector:
+    matchLabels:
+      security-tier: high
+  mergeFrom:
+    - name: hardening
+---
+apiVersion: butane.operators.naval-group.com/v1beta1
+kind: ButaneConfig
+metadata:
+  name: motd
+  namespace: secure
+spec:
+  butane: |
+    variant: fcos
+    version: 1.5.0
+    storage:
+      files:
+        - path: /etc/motd
+`
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"render", "--output", "secret", writeManifest(t, fmt.Sprintf(manifest, "high"))}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("render exit code = %d, stderr = %s", code, stderr.String())
+	}
+	var secret corev1.Secret
+	if err := yaml.Unmarshal(stdout.Bytes(), &secret); err != nil {
+		t.Fatal(err)
+	}
+	if got := secret.Annotations["butane.operators.naval-group.com/injection-policies"]; got != "high-security" {
+		t.Errorf("injection-policies annotation = %q, want high-security", got)
+	}
+	if !strings.Contains(string(secret.Data["userdata"]), "40-hardening.conf") {
+		t.Errorf("the hardening config should be injected:\n%s", secret.Data["userdata"])
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if code := run([]string{"render", writeManifest(t, fmt.Sprintf(manifest, "low"))}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("render exit code = %d, stderr = %s", code, stderr.String())
+	}
+	if strings.Contains(stdout.String(), "40-hardening.conf") {
+		t.Errorf("the policy should not select namespaces of another tier:\n%s", stdout.String())
+	}
+}
+
+func TestRenderUserKeys(t *testing.T) {
+	manifest := `apiVersion: v1
+kind: Secret
+metadata:
+  name: alice-keys
+  labels:
+    ssh-keys/core: "%s"
+stringData:
+  authorized_keys: |
+    # alice
+    ssh-ed25519 AAAAalice alice@laptop
+---
+apiVersion: butane.operators.naval-group.com/v1beta1
+kind: ButaneConfig
+metadata:
+  name: users
+spec:
+  butane: |
+    variant: fcos
+    version: 1.5.0
+    passwd:
+      users:
+        - name: core
+          groups: [wheel]
+          ssh_authorized_keys:
+            - ssh-ed25519 AAAAbreakglass
+  users:
+    - name: core
+      sshAuthorizedKeysFrom:
+        - secretSelector:
+            matchLabels:
+              ssh-keys/core: "true"
+    - name: ops
+      sshAuthorizedKeysFrom:
+        - directory: true
+`
+	dir := filepath.Join(t.TempDir(), "users.yaml")
+	if err := os.WriteFile(dir, []byte("users:\n- name: ops\n  sshAuthorizedKeys: [ssh-ed25519 AAAAops]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"render", "--user-directory", dir, writeManifest(t, fmt.Sprintf(manifest, "true"))}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("render exit code = %d, stderr = %s", code, stderr.String())
+	}
+	var ignition struct {
+		Passwd struct {
+			Users []struct {
+				Name              string   `json:"name"`
+				Groups            []string `json:"groups"`
+				SSHAuthorizedKeys []string `json:"sshAuthorizedKeys"`
+			} `json:"users"`
+		} `json:"passwd"`
+	}
+	if err := json.Unmarshal(stdout.Bytes(), &ignition); err != nil {
+		t.Fatal(err)
+	}
+	keys := map[string][]string{}
+	for _, user := range ignition.Passwd.Users {
+		keys[user.Name] = user.SSHAuthorizedKeys
+		if user.Name == "core" && len(user.Groups) != 1 {
+			t.Errorf("the groups of core should be kept, got %v", user.Groups)
+		}
+	}
+	if got := strings.Join(keys["core"], ","); got != "ssh-ed25519 AAAAbreakglass,ssh-ed25519 AAAAalice alice@laptop" {
+		t.Errorf("keys of core = %q, want the inline and the Secret key", got)
+	}
+	if got := strings.Join(keys["ops"], ","); got != "ssh-ed25519 AAAAops" {
+		t.Errorf("keys of ops = %q, want the directory key", got)
+	}
+
+	// Unlabeling the Secret revokes the key.
+	stdout.Reset()
+	stderr.Reset()
+	if code := run([]string{"render", "--user-directory", dir, writeManifest(t, fmt.Sprintf(manifest, "false"))}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("render exit code = %d, stderr = %s", code, stderr.String())
+	}
+	if strings.Contains(stdout.String(), "AAAAalice") {
+		t.Errorf("the key of an unselected Secret should not be granted:\n%s", stdout.String())
+	}
+
+	// Without a user directory, the config cannot be rendered.
+	stdout.Reset()
+	stderr.Reset()
+	if code := run([]string{"render", writeManifest(t, fmt.Sprintf(manifest, "true"))}, &stdout, &stderr); code != exitFailed {
+		t.Fatalf("render exit code = %d, want %d", code, exitFailed)
+	}
+	if !strings.Contains(stderr.String(), "no user directory file is configured") {
+		t.Errorf("the missing user directory should be reported:\n%s", stderr.String())
+	}
+}
+
+func TestRenderUserPassword(t *testing.T) {
+	manifest := `apiVersion: v1
+kind: Secret
+metadata:
+  name: admin-password
+stringData:
+  password: |
+    hunter2
+---
+apiVersion: butane.operators.naval-group.com/v1beta1
+kind: ButaneConfig
+metadata:
+  name: users
+spec:
+  butane: |
+    variant: fcos
+    version: 1.5.0
+    passwd:
+      users:
+        - name: admin
+          password_hash: %s
+  users:
+    - name: admin
+      passwordFrom:
+        name: admin-password
+        key: password
+`
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"render", "--output", "secret", writeManifest(t, fmt.Sprintf(manifest, "'!'"))}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("render exit code = %d, stderr = %s", code, stderr.String())
+	}
+	var secret corev1.Secret
+	if err := yaml.Unmarshal(stdout.Bytes(), &secret); err != nil {
+		t.Fatal(err)
+	}
+	userdata := string(secret.Data["userdata"])
+	if !strings.Contains(userdata, `"passwordHash":"$6$`) {
+		t.Errorf("the password should be hashed with SHA-512 crypt:\n%s", userdata)
+	}
+	if strings.Contains(stdout.String(), "hunter2") {
+		t.Errorf("the plaintext password should not be in the output:\n%s", stdout.String())
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if code := run([]string{"render", writeManifest(t, fmt.Sprintf(manifest, "hunter2"))}, &stdout, &stderr); code != exitFailed {
+		t.Fatalf("render exit code = %d, want %d", code, exitFailed)
+	}
+	if !strings.Contains(stderr.String(), "password_hash of user admin is not a crypt(3) hash") {
+		t.Errorf("the plaintext password_hash should be rejected:\n%s", stderr.String())
+	}
+}
+
+func TestRenderVariantOutputs(t *testing.T) {
+	manifest := `apiVersion: butane.operators.naval-group.com/v1beta1
+kind: ButaneConfig
+metadata:
+  name: flatcar
+spec:
+  butane: |
+    variant: flatcar
+    version: 1.1.0
+---
+apiVersion: butane.operators.naval-group.com/v1beta1
+kind: ButaneConfig
+metadata:
+  name: worker
+spec:
+  butane: |
+    variant: openshift
+    version: 4.21.0
+    metadata:
+      name: 99-worker
+      labels:
+        machineconfiguration.openshift.io/role: worker
+`
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"render", "--output", "secret", writeManifest(t, manifest)}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("render exit code = %d, stderr = %s", code, stderr.String())
+	}
+	for _, want := range []string{"config.ign:", "userdata:"} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("output should contain %q:\n%s", want, stdout.String())
+		}
+	}
+	for _, doc := range strings.Split(stdout.String(), "---\n") {
+		var secret corev1.Secret
+		if err := yaml.Unmarshal([]byte(doc), &secret); err != nil {
+			t.Fatal(err)
+		}
+		if secret.Name == "worker-ignition" && !strings.Contains(string(secret.Data["userdata"]), "kind: MachineConfig") {
+			t.Errorf("userdata of openshift configs should hold the MachineConfig:\n%s", secret.Data["userdata"])
+		}
+	}
+
+	stdout.Reset()
+	if code := run([]string{"render", writeManifest(t, manifest)}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("render exit code = %d, stderr = %s", code, stderr.String())
+	}
+	if strings.Contains(stdout.String(), "MachineConfig") || !strings.Contains(stdout.String(), `"version":"3.5.0"`) {
+		t.Errorf("openshift configs should render to bare Ignition:\n%s", stdout.String())
+	}
+}
+
+func TestRenderIgnitionVersion(t *testing.T) {
+	manifest := `apiVersion: butane.operators.naval-group.com/v1beta1
+kind: ButaneConfig
+metadata:
+  name: legacy
+spec:
+  output:
+    ignitionVersion: 3.2.0
+  butane: |
+    variant: fcos
+    version: 1.6.0
+    %s
+`
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"render", writeManifest(t, fmt.Sprintf(manifest, ""))}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("render exit code = %d, stderr = %s", code, stderr.String())
+	}
+	if !strings.Contains(stdout.String(), `"version":"3.2.0"`) {
+		t.Errorf("output should be converted to Ignition 3.2.0:\n%s", stdout.String())
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	args := []string{"render", writeManifest(t, fmt.Sprintf(manifest, "kernel_arguments: {should_exist: [quiet]}"))}
+	if code := run(args, &stdout, &stderr); code != exitFailed {
+		t.Fatalf("render exit code = %d, want %d", code, exitFailed)
+	}
+	if !strings.Contains(stderr.String(), "cannot be represented in Ignition spec 3.2.0") || !strings.Contains(stderr.String(), "kernelArguments") {
+		t.Errorf("unrepresentable fields should be reported:\n%s", stderr.String())
+	}
+}
+
+func TestRenderSizeLimit(t *testing.T) {
+	// Random data does not compress, so only spilling can make it fit
+	blob := make([]byte, 96*1024)
+	if _, err := rand.Read(blob); err != nil {
+		t.Fatal(err)
+	}
+	manifest := `apiVersion: butane.operators.naval-group.com/v1beta1
+kind: ButaneConfig
+metadata:
+  name: large
+spec:
+  output:
+    size:
+      limit: 64Ki
+%s
+  butane: |
+    variant: fcos
+    version: 1.5.0
+    storage:
+      files:
+        - path: /opt/blob
+          contents:
+            source: data:;base64,` + base64.StdEncoding.EncodeToString(blob) + `
+        - path: /etc/motd
+          contents:
+            inline: hello
+`
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"render", writeManifest(t, fmt.Sprintf(manifest, ""))}, &stdout, &stderr); code != exitFailed {
+		t.Fatalf("render exit code = %d, want %d", code, exitFailed)
+	}
+	if !strings.Contains(stderr.String(), "over the limit of 65536 bytes") {
+		t.Errorf("the size limit should be reported:\n%s", stderr.String())
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	spill := "      spill:\n        url: https://files.example.com/large\n        threshold: 16Ki"
+	args := []string{"render", "--output", "secret", writeManifest(t, fmt.Sprintf(manifest, spill))}
+	if code := run(args, &stdout, &stderr); code != exitOK {
+		t.Fatalf("render exit code = %d, stderr = %s", code, stderr.String())
+	}
+	out := stdout.String()
+	if !strings.Contains(out, "name: large-ignition-spill-") || !strings.Contains(out, "butane.operators.naval-group.com/spilled-from: large") {
+		t.Errorf("the large file should be spilled to its own Secret:\n%.2000s", out)
+	}
+	if strings.Count(out, "kind: Secret") != 2 {
+		t.Errorf("only the large file should be spilled:\n%.2000s", out)
+	}
+}
+
+func TestRenderRejectsSeveralSources(t *testing.T) {
+	manifest := `apiVersion: butane.operators.naval-group.com/v1beta1
+kind: ButaneConfig
+metadata:
+  name: motd
+spec:
+  config:
+    variant: fcos
+    version: 1.5.0
+  butane: |
+    variant: fcos
+    version: 1.5.0
+`
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"render", writeManifest(t, manifest)}, &stdout, &stderr); code != exitFailed {
+		t.Fatalf("render exit code = %d, want %d", code, exitFailed)
+	}
+	if !strings.Contains(stderr.String(), "only one of spec.config, spec.rawConfig, spec.butane and spec.butaneFrom may be set") {
+		t.Errorf("unexpected report:\n%s", stderr.String())
+	}
+}
+
+func TestRenderSARIF(t *testing.T) {
+	path := writeManifest(t, invalidManifest)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"render", "--report-format", "sarif", path}, &stdout, &stderr); code != exitFailed {
+		t.Fatalf("render exit code = %d, want %d", code, exitFailed)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(stderr.Bytes(), &log); err != nil {
+		t.Fatalf("report is not JSON: %v", err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 || len(log.Runs[0].Results) == 0 {
+		t.Fatalf("unexpected SARIF log %+v", log)
+	}
+	if got := log.Runs[0].Results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI; got != path {
+		t.Errorf("artifact URI = %q, want %q", got, path)
+	}
+}
+
+func TestRenderEncrypted(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := writeManifest(t, `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: recipients
+data:
+  recipients.txt: `+identity.Recipient().String()+`
+---
+`+validManifest+`  output:
+    encryption:
+      mode: age
+      recipientsRef:
+        name: recipients
+        key: recipients.txt
+`)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"render", path}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("render exit code = %d, stderr = %s", code, stderr.String())
+	}
+	r, err := age.Decrypt(armor.NewReader(&stdout), identity)
+	if err != nil {
+		t.Fatalf("output is not encrypted to the recipient: %v", err)
+	}
+	plaintext, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(plaintext), "/etc/motd") {
+		t.Errorf("unexpected plaintext %s", plaintext)
+	}
+}
+
+func TestRenderUsage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"render", "--output", "xml", "x.yaml"}, &stdout, &stderr); code != exitUsage {
+		t.Errorf("exit code = %d, want %d", code, exitUsage)
+	}
+	if code := run([]string{"frobnicate"}, &stdout, &stderr); code != exitUsage {
+		t.Errorf("exit code = %d, want %d", code, exitUsage)
+	}
+}
+
+func TestRenderAndVerifySigned(t *testing.T) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	pubDER, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubPath := filepath.Join(t.TempDir(), "signing.pub")
+	if err := os.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDER}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	path := writeManifest(t, `apiVersion: v1
+kind: Secret
+metadata:
+  name: signing-key
+data:
+  key.pem: `+base64.StdEncoding.EncodeToString(keyPEM)+`
+---
+`+validManifest+`  output:
+    signing:
+      keySecretRef:
+        name: signing-key
+        key: key.pem
+`)
+	outDir := t.TempDir()
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"render", "--output", "secret", "--output-dir", outDir, path}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("render exit code = %d, stderr = %s", code, stderr.String())
+	}
+	secretPath := filepath.Join(outDir, "default_motd-ignition.yaml")
+
+	stdout.Reset()
+	if code := run([]string{"verify", "--key", pubPath, "--output", "json", secretPath}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("verify exit code = %d, stderr = %s", code, stderr.String())
+	}
+	var provenance signing.Provenance
+	if err := json.Unmarshal(stdout.Bytes(), &provenance); err != nil {
+		t.Fatal(err)
+	}
+	if provenance.Subject.Namespace != "default" || provenance.Subject.Name != "motd" {
+		t.Errorf("unexpected provenance %+v", provenance)
+	}
+
+	// Swap in another config: the signature no longer matches.
+	data, err := os.ReadFile(secretPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var secret corev1.Secret
+	if err := yaml.Unmarshal(data, &secret); err != nil {
+		t.Fatal(err)
+	}
+	secret.Data["userdata"] = []byte(`{"ignition":{"version":"3.4.0"}}`)
+	if data, err = yaml.Marshal(&secret); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(secretPath, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	stderr.Reset()
+	if code := run([]string{"verify", "--key", pubPath, secretPath}, &stdout, &stderr); code != exitFailed {
+		t.Fatalf("verify of tampered userdata exit code = %d, want %d", code, exitFailed)
+	}
+	if !strings.Contains(stderr.String(), "verification failed") {
+		t.Errorf("unexpected error output %s", stderr.String())
+	}
+}
+
+func TestRenderFilesDir(t *testing.T) {
+	filesDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(filesDir, "app"), 0o750); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(filesDir, "motd"), []byte("hello from a file"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(filesDir, "app", "app.conf"), []byte("debug = false"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	path := writeManifest(t, `apiVersion: butane.operators.naval-group.com/v1beta1
+kind: ButaneConfig
+metadata:
+  name: local
+spec:
+  butane: |
+    variant: fcos
+    version: 1.5.0
+    storage:
+      files:
+        - path: /etc/motd
+          contents:
+            local: motd
+      trees:
+        - local: app
+          path: /etc/app
+`)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"render", path}, &stdout, &stderr); code != exitFailed {
+		t.Fatalf("render without --files-dir exit code = %d, want %d", code, exitFailed)
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	if code := run([]string{"render", "--files-dir", filesDir, path}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("render exit code = %d, stderr = %s", code, stderr.String())
+	}
+	for _, want := range []string{`"path":"/etc/motd"`, `"path":"/etc/app/app.conf"`} {
+		if !strings.Contains(stdout.String(), want) {
+			t.Errorf("output lacks %s: %s", want, stdout.String())
+		}
+	}
+}
+
+func TestRenderOCIOutput(t *testing.T) {
+	// The registry does not resolve, so pushing would fail the render
+	path := writeManifest(t, `apiVersion: butane.operators.naval-group.com/v1beta1
+kind: ButaneConfig
+metadata:
+  name: boot
+spec:
+  output:
+    oci:
+      repository: registry.invalid/boot/ignition
+  butane: |
+    variant: fcos
+    version: 1.5.0
+`)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"render", path}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("render exit code = %d, stderr = %s", code, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "info: spec.output.oci is not pushed offline") {
+		t.Errorf("the skipped push should be reported:\n%s", stderr.String())
+	}
+	if !strings.Contains(stdout.String(), `"ignition"`) {
+		t.Errorf("the Ignition should still be rendered: %s", stdout.String())
+	}
+}
+
+func TestRenderS3Output(t *testing.T) {
+	// The credentials Secret is not among the inputs, so uploading would fail
+	// the render
+	path := writeManifest(t, `apiVersion: butane.operators.naval-group.com/v1beta1
+kind: ButaneConfig
+metadata:
+  name: boot
+  namespace: team-a
+spec:
+  output:
+    s3:
+      endpoint: https://s3.invalid
+      bucket: ignition
+      credentialsSecretRef:
+        name: creds
+      presignedURL: {}
+  butane: |
+    variant: fcos
+    version: 1.5.0
+`)
+
+	var stdout, stderr bytes.Buffer
+	if code := run([]string{"render", "--output", "secret", path}, &stdout, &stderr); code != exitOK {
+		t.Fatalf("render exit code = %d, stderr = %s", code, stderr.String())
+	}
+	if !strings.Contains(stderr.String(), "info: spec.output.s3 is not uploaded offline; the controller uploads the Ignition to s3://ignition/team-a/boot.ign") {
+		t.Errorf("the skipped upload should be reported:\n%s", stderr.String())
+	}
+	if out := stdout.String(); !strings.Contains(out, "name: boot-ignition\n") || strings.Contains(out, "boot-ignition-pointer") {
+		t.Errorf("only the Ignition Secret should be rendered:\n%s", out)
+	}
+}
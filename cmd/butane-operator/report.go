@@ -0,0 +1,246 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/coreos/vcontext/report"
+
+	"github.com/naval-group/butane-operator/internal/render"
+)
+
+const (
+	severityError   = "error"
+	severityWarning = "warning"
+	severityInfo    = "info"
+
+	ruleTranslation = "butane/translation"
+	ruleValidation  = "butane/validation"
+	ruleRender      = "butane/render"
+)
+
+// diagnostic is a single finding about one ButaneConfig.
+type diagnostic struct {
+	File     string `json:"file"`
+	Object   string `json:"object"`
+	Rule     string `json:"rule"`
+	Severity string `json:"severity"`
+	Path     string `json:"path,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	Column   int    `json:"column,omitempty"`
+	Message  string `json:"message"`
+}
+
+// diagnosticsFromError expands a translation report wrapped in err into one
+// diagnostic per entry, or returns a single diagnostic for any other error.
+func diagnosticsFromError(base diagnostic, rule string, err error) []diagnostic {
+	var reportErr *render.ReportError
+	if !errors.As(err, &reportErr) {
+		d := base
+		d.Rule = rule
+		d.Severity = severityError
+		d.Message = err.Error()
+		return []diagnostic{d}
+	}
+
+	// A report without errors only fails a strict translation, which makes
+	// its warnings errors.
+	strict := !reportErr.Report.IsFatal()
+	out := make([]diagnostic, 0, len(reportErr.Report.Entries))
+	for _, e := range reportErr.Report.Entries {
+		d := base
+		d.Rule = ruleTranslation
+		d.Severity = severityFor(e.Kind)
+		if strict && d.Severity == severityWarning {
+			d.Severity = severityError
+		}
+		d.Message = e.Message
+		if e.Context.Len() != 0 {
+			d.Path = e.Context.String()
+		}
+		if e.Marker.StartP != nil {
+			d.Line = int(e.Marker.StartP.Line)
+			d.Column = int(e.Marker.StartP.Column)
+		}
+		out = append(out, d)
+	}
+	return out
+}
+
+func severityFor(kind report.EntryKind) string {
+	switch {
+	case kind.IsFatal():
+		return severityError
+	case kind == report.Info:
+		return severityInfo
+	default:
+		return severityWarning
+	}
+}
+
+func hasErrors(diags []diagnostic) bool {
+	for _, d := range diags {
+		if d.Severity == severityError {
+			return true
+		}
+	}
+	return false
+}
+
+func writeReport(w io.Writer, format string, diags []diagnostic) error {
+	switch format {
+	case "text":
+		for _, d := range diags {
+			at := ""
+			if d.Path != "" {
+				at = " at " + d.Path
+			}
+			if d.Line != 0 {
+				at += fmt.Sprintf(" (line %d col %d)", d.Line, d.Column)
+			}
+			if _, err := fmt.Fprintf(w, "%s: %s: %s%s: %s\n", d.File, d.Object, d.Severity, at, d.Message); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "json":
+		if diags == nil {
+			diags = []diagnostic{}
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diags)
+	case "sarif":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(toSARIF(diags))
+	default:
+		return fmt.Errorf("unknown report format %q", format)
+	}
+}
+
+// The SARIF types below cover the subset of SARIF 2.1.0 needed to surface
+// findings in code scanning UIs.
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation  `json:"physicalLocation"`
+	LogicalLocations []sarifLogicalLocation `json:"logicalLocations,omitempty"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifLogicalLocation struct {
+	FullyQualifiedName string `json:"fullyQualifiedName"`
+	Kind               string `json:"kind"`
+}
+
+func toSARIF(diags []diagnostic) sarifLog {
+	results := make([]sarifResult, 0, len(diags))
+	for _, d := range diags {
+		level := "note"
+		switch d.Severity {
+		case severityError:
+			level = "error"
+		case severityWarning:
+			level = "warning"
+		}
+
+		// Butane positions refer to the embedded config rather than the
+		// manifest file, so they are reported as a logical location.
+		logical := []sarifLogicalLocation{{FullyQualifiedName: d.Object, Kind: "object"}}
+		if d.Path != "" {
+			logical = append(logical, sarifLogicalLocation{FullyQualifiedName: d.Object + d.Path, Kind: "member"})
+		}
+		msg := d.Message
+		if d.Line != 0 {
+			msg = fmt.Sprintf("%s (config line %d col %d)", msg, d.Line, d.Column)
+		}
+
+		results = append(results, sarifResult{
+			RuleID:  d.Rule,
+			Level:   level,
+			Message: sarifMessage{Text: msg},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{ArtifactLocation: sarifArtifactLocation{URI: d.File}},
+				LogicalLocations: logical,
+			}},
+		})
+	}
+
+	return sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "butane-operator",
+				InformationURI: "https://github.com/naval-group/butane-operator",
+				Rules: []sarifRule{
+					{ID: ruleTranslation, ShortDescription: sarifMessage{Text: "Butane to Ignition translation report"}},
+					{ID: ruleValidation, ShortDescription: sarifMessage{Text: "ButaneConfig admission validation"}},
+					{ID: ruleRender, ShortDescription: sarifMessage{Text: "ButaneConfig rendering"}},
+				},
+			}},
+			Results: results,
+		}},
+	}
+}
@@ -0,0 +1,190 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	"sigs.k8s.io/yaml"
+
+	butanev1beta1 "github.com/naval-group/butane-operator/api/v1beta1"
+	"github.com/naval-group/butane-operator/internal/signing"
+)
+
+type verifyOptions struct {
+	key                 string
+	userdata            string
+	signature           string
+	provenance          string
+	provenanceSignature string
+	output              string
+}
+
+func runVerify(args []string, stdout, stderr io.Writer) int {
+	opts := verifyOptions{}
+	fs := flag.NewFlagSet("verify", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&opts.key, "key", "", "PEM encoded public key to verify with (required).")
+	fs.StringVar(&opts.userdata, "userdata", "", "Ignition config to verify, instead of a Secret manifest.")
+	fs.StringVar(&opts.signature, "signature", "", "Detached signature of --userdata.")
+	fs.StringVar(&opts.provenance, "provenance", "", "Provenance document of --userdata.")
+	fs.StringVar(&opts.provenanceSignature, "provenance-signature", "", "Detached signature of --provenance.")
+	fs.StringVar(&opts.output, "output", "text", "Format of the verified provenance: text or json.")
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "Usage: butane-operator verify --key <public.pem> <secret.yaml|->")
+		_, _ = fmt.Fprintln(stderr, "       butane-operator verify --key <public.pem> --userdata <file> --signature <file> \\")
+		_, _ = fmt.Fprintln(stderr, "                              --provenance <file> --provenance-signature <file>")
+		_, _ = fmt.Fprintln(stderr)
+		_, _ = fmt.Fprintln(stderr, "Verifies the signature and provenance of an Ignition config signed by the operator,")
+		_, _ = fmt.Fprintln(stderr, "either from the generated Secret or from files extracted from it.")
+		_, _ = fmt.Fprintln(stderr)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	files := opts.userdata != "" || opts.signature != "" || opts.provenance != "" || opts.provenanceSignature != ""
+	if opts.key == "" || (files && fs.NArg() != 0) || (!files && fs.NArg() != 1) {
+		fs.Usage()
+		return exitUsage
+	}
+	if opts.output != "text" && opts.output != "json" {
+		_, _ = fmt.Fprintf(stderr, "invalid --output %q: must be text or json\n", opts.output)
+		return exitUsage
+	}
+
+	keyPEM, err := os.ReadFile(opts.key)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitFailed
+	}
+	pub, err := signing.ParsePublicKey(keyPEM)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "error: %s: %v\n", opts.key, err)
+		return exitFailed
+	}
+
+	var userdata []byte
+	var artifacts signing.Artifacts
+	if files {
+		userdata, artifacts, err = readArtifactFiles(opts)
+	} else {
+		userdata, artifacts, err = readArtifactSecret(fs.Arg(0), os.Stdin)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitFailed
+	}
+
+	provenance, err := signing.VerifyOutput(pub, userdata, artifacts)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "verification failed: %v\n", err)
+		return exitFailed
+	}
+
+	if opts.output == "json" {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(provenance); err != nil {
+			_, _ = fmt.Fprintf(stderr, "error: %v\n", err)
+			return exitFailed
+		}
+		return exitOK
+	}
+	s := provenance.Subject
+	_, _ = fmt.Fprintf(stdout, "Verified OK\n")
+	_, _ = fmt.Fprintf(stdout, "  ButaneConfig: %s/%s (uid %s, generation %d)\n", s.Namespace, s.Name, s.UID, s.Generation)
+	_, _ = fmt.Fprintf(stdout, "  Digest:       sha256:%s\n", provenance.Digest["sha256"])
+	_, _ = fmt.Fprintf(stdout, "  Signed at:    %s\n", provenance.Timestamp.Format(time.RFC3339))
+	_, _ = fmt.Fprintf(stdout, "  Key:          %s\n", provenance.KeyID)
+	return exitOK
+}
+
+func readArtifactFiles(opts verifyOptions) ([]byte, signing.Artifacts, error) {
+	var contents [4][]byte
+	for i, path := range []string{opts.userdata, opts.signature, opts.provenance, opts.provenanceSignature} {
+		if path == "" {
+			return nil, signing.Artifacts{}, fmt.Errorf("--userdata, --signature, --provenance and --provenance-signature must all be set")
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, signing.Artifacts{}, err
+		}
+		contents[i] = data
+	}
+	return contents[0], signing.Artifacts{
+		Signature:           contents[1],
+		Provenance:          contents[2],
+		ProvenanceSignature: contents[3],
+	}, nil
+}
+
+// readArtifactSecret reads a Secret manifest, as printed by
+// "kubectl get secret -o yaml" or "butane-operator render --output secret".
+func readArtifactSecret(path string, stdin io.Reader) ([]byte, signing.Artifacts, error) {
+	var data []byte
+	var err error
+	if path == "-" {
+		data, err = io.ReadAll(stdin)
+	} else {
+		data, err = os.ReadFile(path)
+	}
+	if err != nil {
+		return nil, signing.Artifacts{}, err
+	}
+
+	var secret corev1.Secret
+	if err := yaml.UnmarshalStrict(data, &secret); err != nil {
+		return nil, signing.Artifacts{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if secret.Kind != "Secret" {
+		return nil, signing.Artifacts{}, fmt.Errorf("%s: expected a Secret, got %q", path, secret.Kind)
+	}
+	get := func(key string) ([]byte, error) {
+		if v, ok := secret.StringData[key]; ok {
+			return []byte(v), nil
+		}
+		if v, ok := secret.Data[key]; ok {
+			return v, nil
+		}
+		return nil, fmt.Errorf("%s: Secret has no %s key, was it signed?", path, key)
+	}
+
+	// The userdata of openshift configs holds the MachineConfig wrapping the
+	// signed Ignition config
+	ignitionKey := butanev1beta1.KeyUserdata
+	if _, err := get(butanev1beta1.KeyIgnitionFile); err == nil {
+		ignitionKey = butanev1beta1.KeyIgnitionFile
+	}
+	var values [4][]byte
+	for i, key := range []string{ignitionKey, signing.SignatureKey, signing.ProvenanceKey, signing.ProvenanceSignatureKey} {
+		if values[i], err = get(key); err != nil {
+			return nil, signing.Artifacts{}, err
+		}
+	}
+	return values[0], signing.Artifacts{
+		Signature:           values[1],
+		Provenance:          values[2],
+		ProvenanceSignature: values[3],
+	}, nil
+}
@@ -0,0 +1,466 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pmezard/go-difflib/difflib"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/yaml"
+
+	butanev1beta1 "github.com/naval-group/butane-operator/api/v1beta1"
+	"github.com/naval-group/butane-operator/internal/controller"
+	"github.com/naval-group/butane-operator/internal/render"
+)
+
+// errDiffers is returned by diff when the compared configs are not identical.
+var errDiffers = errors.New("configs differ")
+
+type plugin struct {
+	client    client.Client
+	namespace string
+	out       io.Writer
+	// errOut receives the warnings.
+	errOut io.Writer
+}
+
+func (p *plugin) getConfig(ctx context.Context, name string) (*butanev1beta1.ButaneConfig, error) {
+	var bc butanev1beta1.ButaneConfig
+	if err := p.client.Get(ctx, client.ObjectKey{Namespace: p.namespace, Name: name}, &bc); err != nil {
+		return nil, err
+	}
+	return &bc, nil
+}
+
+// butaneSource returns the Butane config of the ButaneConfig as YAML. Configs
+// written as text, in spec.butane or spec.butaneFrom, are returned as is;
+// configs stored as JSON objects are converted to YAML.
+func (p *plugin) butaneSource(ctx context.Context, bc *butanev1beta1.ButaneConfig) ([]byte, error) {
+	if ref := bc.Spec.ButaneFrom; ref != nil {
+		var cm corev1.ConfigMap
+		if err := p.client.Get(ctx, client.ObjectKey{Namespace: bc.Namespace, Name: ref.Name}, &cm); err != nil {
+			return nil, err
+		}
+		text, ok := cm.Data[ref.Key]
+		if !ok {
+			return nil, fmt.Errorf("configmap %s/%s has no key %s", bc.Namespace, ref.Name, ref.Key)
+		}
+		return []byte(text), nil
+	}
+	if bc.Spec.Butane != "" {
+		return []byte(bc.Spec.Butane), nil
+	}
+	if len(bc.Spec.Source()) == 0 {
+		return nil, fmt.Errorf("ButaneConfig %s/%s has no config", bc.Namespace, bc.Name)
+	}
+	return yaml.JSONToYAML(bc.Spec.Source())
+}
+
+// liveIgnition returns the Ignition the operator stored for the ButaneConfig.
+func (p *plugin) liveIgnition(ctx context.Context, bc *butanev1beta1.ButaneConfig) ([]byte, error) {
+	secret, err := p.liveSecret(ctx, bc)
+	if err != nil {
+		return nil, err
+	}
+	return secretIgnition(secret)
+}
+
+// liveSecret returns the Secret the operator stored the Ignition of the
+// ButaneConfig in.
+func (p *plugin) liveSecret(ctx context.Context, bc *butanev1beta1.ButaneConfig) (*corev1.Secret, error) {
+	if bc.Status.SecretName == "" {
+		return nil, fmt.Errorf("ButaneConfig %s/%s has not been rendered yet", bc.Namespace, bc.Name)
+	}
+	var secret corev1.Secret
+	if err := p.client.Get(ctx, client.ObjectKey{Namespace: bc.Namespace, Name: bc.Status.SecretName}, &secret); err != nil {
+		return nil, err
+	}
+	return &secret, nil
+}
+
+// revisionIgnition returns the given revision of the Ignition of the
+// ButaneConfig, which is the live Ignition for the current revision.
+func (p *plugin) revisionIgnition(ctx context.Context, bc *butanev1beta1.ButaneConfig, revision int) ([]byte, error) {
+	live, err := p.liveSecret(ctx, bc)
+	if err != nil {
+		return nil, err
+	}
+	if revision == secretRevision(live) {
+		return secretIgnition(live)
+	}
+	var secret corev1.Secret
+	key := client.ObjectKey{Namespace: bc.Namespace, Name: controller.RevisionSecretName(live.Name, revision)}
+	if err := p.client.Get(ctx, key, &secret); apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("revision %d of ButaneConfig %s/%s is not kept; run \"kubectl butane history %s\" to list them",
+			revision, bc.Namespace, bc.Name, bc.Name)
+	} else if err != nil {
+		return nil, err
+	}
+	return secretIgnition(&secret)
+}
+
+// secretRevision returns the revision of the Ignition secret holds. Secrets
+// written before revisions were recorded hold revision 1.
+func secretRevision(secret *corev1.Secret) int {
+	if n, err := strconv.Atoi(secret.Annotations[butanev1beta1.AnnotationRevision]); err == nil && n > 0 {
+		return n
+	}
+	return 1
+}
+
+// secretIgnition returns the Ignition secret holds.
+func secretIgnition(secret *corev1.Secret) ([]byte, error) {
+	key := client.ObjectKeyFromObject(secret)
+	if mode := secret.Annotations[butanev1beta1.AnnotationEncryption]; mode == string(butanev1beta1.EncryptionModeAge) {
+		return nil, fmt.Errorf("the Ignition in secret %s is encrypted with age; decrypt it with \"age -d -i <identity>\"", key)
+	}
+	data := butanev1beta1.IgnitionData(secret.Data)
+	if data == nil {
+		return nil, fmt.Errorf("secret %s has no %s key", key, butanev1beta1.KeyUserdata)
+	}
+	return data, nil
+}
+
+func indent(ignition []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := json.Indent(&buf, ignition, "", "  "); err != nil {
+		return nil, fmt.Errorf("ignition is not valid JSON: %w", err)
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+func runShow(ctx context.Context, p *plugin, fs *flag.FlagSet) error {
+	bc, err := p.getConfig(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	ignition, err := p.liveIgnition(ctx, bc)
+	if err != nil {
+		return err
+	}
+	pretty, err := indent(ignition)
+	if err != nil {
+		return err
+	}
+	_, err = p.out.Write(pretty)
+	return err
+}
+
+// runDiff compares the live Ignition of NAME with what its current spec
+// renders to, which shows changes the operator has not applied yet. With a
+// REVISION it compares that earlier revision with the live Ignition instead,
+// and with two revisions the first with the second.
+func runDiff(ctx context.Context, p *plugin, fs *flag.FlagSet) error {
+	var revisions []int
+	for _, arg := range fs.Args()[1:] {
+		n, err := strconv.Atoi(arg)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid revision %q: must be a positive number", arg)
+		}
+		revisions = append(revisions, n)
+	}
+	bc, err := p.getConfig(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var from, to []byte
+	var fromName, toName string
+	switch len(revisions) {
+	case 0:
+		if from, err = p.liveIgnition(ctx, bc); err != nil {
+			return err
+		}
+		cfg, err := p.operatorConfig(ctx, fs.Lookup("operator-config").Value.String())
+		if err != nil {
+			return err
+		}
+		if to, err = p.renderSpec(ctx, bc, cfg); err != nil {
+			return fmt.Errorf("failed to render the current spec: %w", err)
+		}
+		fromName, toName = "live/"+bc.Name, "rendered/"+bc.Name
+	case 1:
+		if from, err = p.revisionIgnition(ctx, bc, revisions[0]); err != nil {
+			return err
+		}
+		if to, err = p.liveIgnition(ctx, bc); err != nil {
+			return err
+		}
+		fromName, toName = fmt.Sprintf("revision-%d/%s", revisions[0], bc.Name), "live/"+bc.Name
+	default:
+		if from, err = p.revisionIgnition(ctx, bc, revisions[0]); err != nil {
+			return err
+		}
+		if to, err = p.revisionIgnition(ctx, bc, revisions[1]); err != nil {
+			return err
+		}
+		fromName = fmt.Sprintf("revision-%d/%s", revisions[0], bc.Name)
+		toName = fmt.Sprintf("revision-%d/%s", revisions[1], bc.Name)
+	}
+
+	a, err := indent(from)
+	if err != nil {
+		return err
+	}
+	b, err := indent(to)
+	if err != nil {
+		return err
+	}
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(string(a)),
+		B:        difflib.SplitLines(string(b)),
+		FromFile: fromName,
+		ToFile:   toName,
+		Context:  3,
+	})
+	if err != nil {
+		return err
+	}
+	if diff == "" {
+		return nil
+	}
+	if _, err := io.WriteString(p.out, diff); err != nil {
+		return err
+	}
+	return errDiffers
+}
+
+// runHistory lists the revisions of the Ignition of NAME that the operator
+// keeps, oldest first, and the live one.
+func runHistory(ctx context.Context, p *plugin, fs *flag.FlagSet) error {
+	bc, err := p.getConfig(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	live, err := p.liveSecret(ctx, bc)
+	if err != nil {
+		return err
+	}
+	var list corev1.SecretList
+	if err := p.client.List(ctx, &list, client.InNamespace(bc.Namespace),
+		client.MatchingLabels{butanev1beta1.LabelRevisionOf: bc.Name}); err != nil {
+		return err
+	}
+	secrets := []*corev1.Secret{live}
+	for i := range list.Items {
+		if metav1.IsControlledBy(&list.Items[i], bc) {
+			secrets = append(secrets, &list.Items[i])
+		}
+	}
+	sort.Slice(secrets, func(i, j int) bool { return secretRevision(secrets[i]) < secretRevision(secrets[j]) })
+
+	w := tabwriter.NewWriter(p.out, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "REVISION\tSECRET\tSTATUS")
+	for _, secret := range secrets {
+		status := "kept"
+		if secret == live {
+			status = "live"
+		}
+		_, _ = fmt.Fprintf(w, "%d\t%s\t%s\n", secretRevision(secret), secret.Name, status)
+	}
+	return w.Flush()
+}
+
+func diffFlags(fs *flag.FlagSet) {
+	fs.String("operator-config", defaultOperatorConfig,
+		"The ConfigMap, as NAMESPACE/NAME, holding the operator config the current spec is rendered with. Empty uses the built-in defaults.")
+}
+
+// ignitionEntry is the subset of Ignition storage and systemd entries that
+// files prints.
+type ignitionEntry struct {
+	Path     string `json:"path"`
+	Name     string `json:"name"`
+	Mode     *int   `json:"mode"`
+	Target   string `json:"target"`
+	Hard     *bool  `json:"hard"`
+	Enabled  *bool  `json:"enabled"`
+	Mask     *bool  `json:"mask"`
+	Contents *struct {
+		Source      string `json:"source"`
+		Compression string `json:"compression"`
+	} `json:"contents"`
+	Dropins []ignitionEntry `json:"dropins"`
+}
+
+type ignitionListing struct {
+	Storage struct {
+		Files       []ignitionEntry `json:"files"`
+		Directories []ignitionEntry `json:"directories"`
+		Links       []ignitionEntry `json:"links"`
+	} `json:"storage"`
+	Systemd struct {
+		Units []ignitionEntry `json:"units"`
+	} `json:"systemd"`
+}
+
+func runFiles(ctx context.Context, p *plugin, fs *flag.FlagSet) error {
+	bc, err := p.getConfig(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	ignition, err := p.liveIgnition(ctx, bc)
+	if err != nil {
+		return err
+	}
+	var listing ignitionListing
+	if err := json.Unmarshal(ignition, &listing); err != nil {
+		return fmt.Errorf("ignition is not valid JSON: %w", err)
+	}
+
+	w := tabwriter.NewWriter(p.out, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "TYPE\tPATH\tMODE\tDETAILS")
+	for _, f := range listing.Storage.Files {
+		_, _ = fmt.Fprintf(w, "file\t%s\t%s\t%s\n", f.Path, mode(f.Mode), fileDetails(f))
+	}
+	for _, d := range listing.Storage.Directories {
+		_, _ = fmt.Fprintf(w, "directory\t%s\t%s\t\n", d.Path, mode(d.Mode))
+	}
+	for _, l := range listing.Storage.Links {
+		kind := "symlink"
+		if l.Hard != nil && *l.Hard {
+			kind = "hardlink"
+		}
+		_, _ = fmt.Fprintf(w, "link\t%s\t\t%s -> %s\n", l.Path, kind, l.Target)
+	}
+	for _, u := range listing.Systemd.Units {
+		_, _ = fmt.Fprintf(w, "unit\t/etc/systemd/system/%s\t\t%s\n", u.Name, unitDetails(u))
+		for _, d := range u.Dropins {
+			_, _ = fmt.Fprintf(w, "dropin\t/etc/systemd/system/%s.d/%s\t\t\n", u.Name, d.Name)
+		}
+	}
+	return w.Flush()
+}
+
+func mode(m *int) string {
+	if m == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%04o", *m)
+}
+
+func fileDetails(f ignitionEntry) string {
+	if f.Contents == nil || f.Contents.Source == "" {
+		return "empty"
+	}
+	var details []string
+	switch scheme, _, _ := strings.Cut(f.Contents.Source, ":"); scheme {
+	case "data":
+		details = append(details, "inline")
+	default:
+		details = append(details, f.Contents.Source)
+	}
+	if f.Contents.Compression != "" {
+		details = append(details, f.Contents.Compression)
+	}
+	return strings.Join(details, ", ")
+}
+
+func unitDetails(u ignitionEntry) string {
+	var details []string
+	if u.Enabled != nil {
+		if *u.Enabled {
+			details = append(details, "enabled")
+		} else {
+			details = append(details, "disabled")
+		}
+	}
+	if u.Mask != nil && *u.Mask {
+		details = append(details, "masked")
+	}
+	if n := len(u.Dropins); n > 0 {
+		details = append(details, fmt.Sprintf("%d dropin(s)", n))
+	}
+	return strings.Join(details, ", ")
+}
+
+func explainFlags(fs *flag.FlagSet) {
+	fs.String("o", "table", "Output format: table or json.")
+	fs.Bool("show-source", false, "Also print the Butane source with line numbers, as the lines reported refer to it.")
+}
+
+// runExplain maps every Ignition entry to the Butane node it was translated
+// from. Line numbers refer to the Butane text of spec.butane or
+// spec.butaneFrom. A spec.config is stored as JSON in the cluster, so it is
+// converted back to YAML first and line numbers refer to that YAML, which
+// --show-source prints.
+func runExplain(ctx context.Context, p *plugin, fs *flag.FlagSet) error {
+	output := fs.Lookup("o").Value.String()
+	if output != "table" && output != "json" {
+		return fmt.Errorf("invalid output format %q: must be table or json", output)
+	}
+	bc, err := p.getConfig(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	source, err := p.butaneSource(ctx, bc)
+	if err != nil {
+		return err
+	}
+	origins, err := render.Explain(source)
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(origins, func(i, j int) bool { return origins[i].Line < origins[j].Line })
+
+	if output == "json" {
+		enc := json.NewEncoder(p.out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(origins)
+	}
+
+	w := tabwriter.NewWriter(p.out, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "IGNITION PATH\tKIND\tNAME\tBUTANE PATH\tLINE")
+	for _, o := range origins {
+		butanePath, line := o.ButanePath, "-"
+		if butanePath == "" {
+			butanePath = "-"
+		}
+		if o.Line > 0 {
+			line = fmt.Sprintf("%d:%d", o.Line, o.Column)
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", o.IgnitionPath, o.Kind, o.Name, butanePath, line)
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if fs.Lookup("show-source").Value.(flag.Getter).Get().(bool) {
+		_, _ = fmt.Fprintln(p.out)
+		for i, l := range strings.Split(strings.TrimRight(string(source), "\n"), "\n") {
+			if _, err := fmt.Fprintf(p.out, "%4d  %s\n", i+1, l); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command kubectl-butane is a kubectl plugin to inspect the Ignition configs
+// rendered by the operator. Install it anywhere in PATH and run "kubectl butane".
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/clientcmd"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	butanev1beta1 "github.com/naval-group/butane-operator/api/v1beta1"
+)
+
+const (
+	exitOK = iota
+	exitFailed
+	exitUsage
+)
+
+// exitDiffers is returned by diff when the compared configs differ, like kubectl diff.
+const exitDiffers = exitFailed
+
+type command struct {
+	name    string
+	usage   string
+	summary string
+	minArgs int
+	maxArgs int
+	run     func(ctx context.Context, p *plugin, fs *flag.FlagSet) error
+	flags   func(fs *flag.FlagSet)
+}
+
+var commands = []command{
+	{
+		name: "show", usage: "NAME", summary: "Print the decoded, pretty-printed Ignition of a ButaneConfig",
+		minArgs: 1, maxArgs: 1, run: runShow,
+	},
+	{
+		name: "diff", usage: "NAME [REVISION [REVISION]]",
+		summary: "Diff the live Ignition against the current spec, or revisions of the Ignition",
+		minArgs: 1, maxArgs: 3, run: runDiff, flags: diffFlags,
+	},
+	{
+		name: "history", usage: "NAME", summary: "List the revisions of the Ignition kept for a ButaneConfig",
+		minArgs: 1, maxArgs: 1, run: runHistory,
+	},
+	{
+		name: "files", usage: "NAME", summary: "List the files, directories, links and units the Ignition creates",
+		minArgs: 1, maxArgs: 1, run: runFiles,
+	},
+	{
+		name: "explain", usage: "NAME", summary: "Map Ignition entries back to the Butane source lines",
+		minArgs: 1, maxArgs: 1, run: runExplain, flags: explainFlags,
+	},
+}
+
+// globalOptions are accepted by every subcommand, with kubectl's names.
+type globalOptions struct {
+	kubeconfig string
+	context    string
+	namespace  string
+}
+
+func (g *globalOptions) bind(fs *flag.FlagSet) {
+	fs.StringVar(&g.kubeconfig, "kubeconfig", "", "Path to the kubeconfig file to use.")
+	fs.StringVar(&g.context, "context", "", "The name of the kubeconfig context to use.")
+	fs.StringVar(&g.namespace, "namespace", "", "The namespace of the ButaneConfig.")
+	fs.StringVar(&g.namespace, "n", "", "Shorthand for --namespace.")
+}
+
+func main() {
+	os.Exit(run(context.Background(), os.Args[1:], os.Stdout, os.Stderr, nil))
+}
+
+// run executes the plugin. newClient may be nil, in which case a client is
+// built from the kubeconfig.
+func run(ctx context.Context, args []string, stdout, stderr io.Writer,
+	newClient func(g globalOptions) (client.Client, string, error)) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "--help" || args[0] == "help" {
+		usage(stderr)
+		return exitUsage
+	}
+
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == args[0] {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		_, _ = fmt.Fprintf(stderr, "unknown command %q\n\n", args[0])
+		usage(stderr)
+		return exitUsage
+	}
+
+	var g globalOptions
+	fs := flag.NewFlagSet("kubectl butane "+cmd.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	g.bind(fs)
+	if cmd.flags != nil {
+		cmd.flags(fs)
+	}
+	fs.Usage = func() {
+		_, _ = fmt.Fprintf(stderr, "Usage: kubectl butane %s [flags] %s\n\n%s.\n\n", cmd.name, cmd.usage, cmd.summary)
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() < cmd.minArgs || fs.NArg() > cmd.maxArgs {
+		fs.Usage()
+		return exitUsage
+	}
+
+	if newClient == nil {
+		newClient = kubeClient
+	}
+	c, namespace, err := newClient(g)
+	if err != nil {
+		_, _ = fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitFailed
+	}
+
+	p := &plugin{client: c, namespace: namespace, out: stdout, errOut: stderr}
+	if err := cmd.run(ctx, p, fs); err != nil {
+		if err == errDiffers {
+			return exitDiffers
+		}
+		_, _ = fmt.Fprintf(stderr, "error: %v\n", err)
+		return exitFailed
+	}
+	return exitOK
+}
+
+func usage(w io.Writer) {
+	_, _ = fmt.Fprintln(w, "Usage: kubectl butane <command> [flags]")
+	_, _ = fmt.Fprintln(w)
+	_, _ = fmt.Fprintln(w, "Commands:")
+	for _, c := range commands {
+		_, _ = fmt.Fprintf(w, "  %-10s %s\n", c.name, c.summary)
+	}
+}
+
+// kubeClient builds a client and resolves the namespace the way kubectl does.
+func kubeClient(g globalOptions) (client.Client, string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = g.kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: g.context}
+	overrides.Context.Namespace = g.namespace
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides)
+
+	restConfig, err := loader.ClientConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	namespace, _, err := loader.Namespace()
+	if err != nil {
+		return nil, "", err
+	}
+
+	c, err := client.New(restConfig, client.Options{Scheme: newScheme()})
+	if err != nil {
+		return nil, "", err
+	}
+	return c, namespace, nil
+}
+
+func newScheme() *runtime.Scheme {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(butanev1beta1.AddToScheme(scheme))
+	return scheme
+}
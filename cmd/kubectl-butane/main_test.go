@@ -0,0 +1,415 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	butanev1beta1 "github.com/naval-group/butane-operator/api/v1beta1"
+	"github.com/naval-group/butane-operator/internal/controller"
+	"github.com/naval-group/butane-operator/internal/render"
+)
+
+const motdConfig = `{"variant":"fcos","version":"1.5.0","storage":{"files":[{"path":"/etc/motd","mode":420,"contents":{"inline":"hello"}}],"links":[{"path":"/etc/localtime","target":"../usr/share/zoneinfo/UTC"}]},"systemd":{"units":[{"name":"motd.service","enabled":true,"dropins":[{"name":"10-env.conf"}]}]}}`
+
+const issueConfig = `{"variant":"fcos","version":"1.5.0","storage":{"files":[{"path":"/etc/issue","contents":{"inline":"hi"}}]}}`
+
+// renderedConfig returns a ButaneConfig and the Secret the controller would
+// have written for it.
+func renderedConfig(t *testing.T, name, config string) (*butanev1beta1.ButaneConfig, *corev1.Secret) {
+	t.Helper()
+	ignition, _, err := render.Translate([]byte(config), render.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	bc := &butanev1beta1.ButaneConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "team-a"},
+		Spec:       butanev1beta1.ButaneConfigSpec{Config: &runtime.RawExtension{Raw: []byte(config)}},
+		Status:     butanev1beta1.ButaneConfigStatus{SecretName: name + "-ignition"},
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{Name: name + "-ignition", Namespace: "team-a"},
+		Data:       map[string][]byte{"userdata": ignition},
+	}
+	return bc, secret
+}
+
+func runPlugin(t *testing.T, objs []client.Object, args ...string) (int, string, string) {
+	t.Helper()
+	c := fake.NewClientBuilder().WithScheme(newScheme()).WithObjects(objs...).Build()
+	newClient := func(g globalOptions) (client.Client, string, error) {
+		if g.namespace == "" {
+			return c, "default", nil
+		}
+		return c, g.namespace, nil
+	}
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, &stdout, &stderr, newClient)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestShow(t *testing.T) {
+	bc, secret := renderedConfig(t, "motd", motdConfig)
+
+	code, out, stderr := runPlugin(t, []client.Object{bc, secret}, "show", "-n", "team-a", "motd")
+	if code != exitOK {
+		t.Fatalf("exit code = %d, stderr = %s", code, stderr)
+	}
+	var ign map[string]interface{}
+	if err := json.Unmarshal([]byte(out), &ign); err != nil {
+		t.Fatalf("output is not JSON: %v", err)
+	}
+	if !strings.Contains(out, "\n  \"ignition\": {") {
+		t.Errorf("output is not pretty-printed:\n%s", out)
+	}
+
+	if code, _, _ := runPlugin(t, []client.Object{bc, secret}, "show", "motd"); code != exitFailed {
+		t.Errorf("show in the wrong namespace: exit code = %d, want %d", code, exitFailed)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	bc, secret := renderedConfig(t, "motd", motdConfig)
+	objs := []client.Object{bc, secret}
+
+	if code, out, stderr := runPlugin(t, objs, "diff", "--namespace", "team-a", "motd"); code != exitOK || out != "" {
+		t.Fatalf("unchanged config: exit code = %d, output = %q, stderr = %s", code, out, stderr)
+	}
+
+	// A spec change the operator has not applied yet shows up against the live Secret.
+	bc.Spec.Config.Raw = []byte(issueConfig)
+	code, out, _ := runPlugin(t, objs, "diff", "-n", "team-a", "motd")
+	if code != exitDiffers || !strings.Contains(out, "+++ rendered/motd") {
+		t.Errorf("exit code = %d, output:\n%s", code, out)
+	}
+}
+
+func TestDiffRevisions(t *testing.T) {
+	ctx := context.Background()
+	bc, _ := renderedConfig(t, "motd", motdConfig)
+	bc.Status = butanev1beta1.ButaneConfigStatus{}
+	c := fake.NewClientBuilder().WithScheme(newScheme()).WithObjects(bc).WithStatusSubresource(bc).Build()
+	newClient := func(globalOptions) (client.Client, string, error) { return c, "team-a", nil }
+	plugin := func(args ...string) (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		code := run(ctx, args, &stdout, &stderr, newClient)
+		return code, stdout.String(), stderr.String()
+	}
+
+	// Let the operator render the config, then a change of it
+	reconciler := &controller.ButaneConfigReconciler{
+		Client:   c,
+		Log:      logr.Discard(),
+		Scheme:   c.Scheme(),
+		Recorder: &events.FakeRecorder{},
+	}
+	for _, config := range []string{motdConfig, issueConfig} {
+		if err := c.Get(ctx, client.ObjectKeyFromObject(bc), bc); err != nil {
+			t.Fatal(err)
+		}
+		bc.Spec.Config.Raw = []byte(config)
+		if err := c.Update(ctx, bc); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(bc)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	code, out, stderr := plugin("history", "motd")
+	if code != exitOK || !strings.Contains(out, "1         motd-ignition-rev-1  kept") || !strings.Contains(out, "2         motd-ignition        live") {
+		t.Errorf("history: exit code = %d, output:\n%s\nstderr = %s", code, out, stderr)
+	}
+
+	for _, args := range [][]string{{"diff", "motd", "1"}, {"diff", "motd", "1", "2"}} {
+		code, out, stderr := plugin(args...)
+		if code != exitDiffers {
+			t.Fatalf("%v: exit code = %d, want %d, stderr = %s", args, code, exitDiffers, stderr)
+		}
+		if !strings.Contains(out, "--- revision-1/motd") {
+			t.Errorf("%v: diff should start from revision 1:\n%s", args, out)
+		}
+		var removed, added bool
+		for _, line := range strings.Split(out, "\n") {
+			removed = removed || strings.HasPrefix(line, "-") && strings.Contains(line, `"/etc/motd"`)
+			added = added || strings.HasPrefix(line, "+") && strings.Contains(line, `"/etc/issue"`)
+		}
+		if !removed || !added {
+			t.Errorf("%v: diff does not replace /etc/motd with /etc/issue:\n%s", args, out)
+		}
+	}
+	if code, out, _ := plugin("diff", "motd", "2"); code != exitOK || out != "" {
+		t.Errorf("the live revision: exit code = %d, output:\n%s", code, out)
+	}
+	if code, _, stderr := plugin("diff", "motd", "3"); code != exitFailed || !strings.Contains(stderr, "revision 3 of ButaneConfig team-a/motd is not kept") {
+		t.Errorf("unknown revision: exit code = %d, stderr = %s", code, stderr)
+	}
+	if code, _, stderr := plugin("diff", "motd", "latest"); code != exitFailed || !strings.Contains(stderr, "invalid revision") {
+		t.Errorf("invalid revision: exit code = %d, stderr = %s", code, stderr)
+	}
+}
+
+func TestDiffRendersLikeController(t *testing.T) {
+	// The controller converts the Ignition to spec.output.ignitionVersion,
+	// which a plain translation does not.
+	bc, secret := renderedConfig(t, "motd", motdConfig)
+	bc.Spec.Output.IgnitionVersion = "3.3.0"
+	ignition, err := render.ConvertVersion(secret.Data["userdata"], "3.3.0", render.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	secret.Data["userdata"] = ignition
+	c := fake.NewClientBuilder().WithScheme(newScheme()).WithObjects(bc, secret).Build()
+	newClient := func(globalOptions) (client.Client, string, error) { return c, "team-a", nil }
+
+	var stdout, stderr bytes.Buffer
+	if code := run(context.Background(), []string{"diff", "motd"}, &stdout, &stderr, newClient); code != exitOK || stdout.Len() != 0 {
+		t.Fatalf("exit code = %d, output:\n%s\nstderr = %s", code, stdout.String(), stderr.String())
+	}
+
+	// Rendering leaves the cluster alone.
+	var after butanev1beta1.ButaneConfig
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(bc), &after); err != nil {
+		t.Fatal(err)
+	}
+	if after.ResourceVersion != bc.ResourceVersion || len(after.Status.Conditions) != 0 {
+		t.Errorf("the ButaneConfig was changed: %+v", after)
+	}
+	var secrets corev1.SecretList
+	if err := c.List(context.Background(), &secrets); err != nil {
+		t.Fatal(err)
+	}
+	if len(secrets.Items) != 1 || secrets.Items[0].ResourceVersion != secret.ResourceVersion {
+		t.Errorf("the Secrets were changed: %+v", secrets.Items)
+	}
+}
+
+func TestDiffMergeFrom(t *testing.T) {
+	ctx := context.Background()
+	baseline := &butanev1beta1.ClusterButaneConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "baseline"},
+		Spec: butanev1beta1.ClusterButaneConfigSpec{
+			Butane: "variant: fcos\nversion: 1.5.0\nstorage:\n  files:\n    - path: /etc/chrony.d/platform.conf\n" +
+				"      contents:\n        inline: server ntp.example.com\n",
+		},
+	}
+	bc, _ := renderedConfig(t, "motd", motdConfig)
+	bc.Spec.MergeFrom = []butanev1beta1.ClusterButaneConfigReference{{Name: baseline.Name}}
+	bc.Status = butanev1beta1.ButaneConfigStatus{}
+	c := fake.NewClientBuilder().
+		WithScheme(newScheme()).
+		WithObjects(baseline, bc).
+		WithStatusSubresource(bc).
+		Build()
+	newClient := func(globalOptions) (client.Client, string, error) { return c, "team-a", nil }
+	diff := func() (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		code := run(ctx, []string{"diff", "motd"}, &stdout, &stderr, newClient)
+		return code, stdout.String(), stderr.String()
+	}
+
+	// Let the operator render the merged config
+	reconciler := &controller.ButaneConfigReconciler{
+		Client:   c,
+		Log:      logr.Discard(),
+		Scheme:   c.Scheme(),
+		Recorder: &events.FakeRecorder{},
+	}
+	if _, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(bc)}); err != nil {
+		t.Fatal(err)
+	}
+	if code, out, stderr := diff(); code != exitOK || out != "" {
+		t.Fatalf("merged config: exit code = %d, output = %q, stderr = %s", code, out, stderr)
+	}
+
+	// A change of the ClusterButaneConfig shows up before the operator applies it
+	baseline.Spec.Butane = strings.Replace(baseline.Spec.Butane, "ntp.example.com", "ntp.example.org", 1)
+	if err := c.Update(ctx, baseline); err != nil {
+		t.Fatal(err)
+	}
+	code, out, _ := diff()
+	if code != exitDiffers || !strings.Contains(out, "+++ rendered/motd") || !strings.Contains(out, "ntp.example.org") {
+		t.Errorf("changed baseline: exit code = %d, output:\n%s", code, out)
+	}
+
+	if err := c.Delete(ctx, baseline); err != nil {
+		t.Fatal(err)
+	}
+	code, _, stderr := diff()
+	if code != exitFailed || !strings.Contains(stderr, "failed to render the current spec") || !strings.Contains(stderr, "ClusterButaneConfig baseline") {
+		t.Errorf("missing baseline: exit code = %d, stderr = %s", code, stderr)
+	}
+}
+
+func TestDiffOperatorConfig(t *testing.T) {
+	ctx := context.Background()
+	digest := "sha256:" + strings.Repeat("ab", 32)
+	var requests []string
+	registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.URL.Path)
+		w.Header().Set("Docker-Content-Digest", digest)
+	}))
+	defer registry.Close()
+	mirror := strings.TrimPrefix(registry.URL, "http://")
+	operatorConfig := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Name: "butane-operator-manager-config", Namespace: "butane-operator-system"},
+		Data: map[string]string{"config.yaml": "apiVersion: config.butane.operators.naval-group.com/v1alpha1\nkind: OperatorConfig\n" +
+			"images:\n  mirrors:\n    registry.invalid: " + mirror + "\n  plainHTTPRegistries: [" + mirror + "]\n"},
+	}
+
+	// The operator pinned the image before; its digest is recorded in status
+	unit := func(images ...string) string {
+		butane := "variant: fcos\nversion: 1.5.0\nsystemd:\n  units:\n"
+		for i, image := range images {
+			butane += fmt.Sprintf("    - name: app%d.service\n      contents: |\n        [Service]\n        ExecStart=/usr/bin/podman run %s\n", i, image)
+		}
+		return butane
+	}
+	recorded := "sha256:" + strings.Repeat("cd", 32)
+	bc := &butanev1beta1.ButaneConfig{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "team-a"},
+		Spec: butanev1beta1.ButaneConfigSpec{
+			Butane: unit("registry.invalid/team/web:v1"),
+			Images: butanev1beta1.ImagesSpec{Pin: true},
+		},
+		Status: butanev1beta1.ButaneConfigStatus{
+			PinnedImages: []butanev1beta1.PinnedImage{{Image: "registry.invalid/team/web:v1", Digest: recorded}},
+		},
+	}
+	c := fake.NewClientBuilder().WithScheme(newScheme()).WithObjects(bc, operatorConfig).WithStatusSubresource(bc).Build()
+	reconciler := &controller.ButaneConfigReconciler{
+		Client:   c,
+		Log:      logr.Discard(),
+		Scheme:   c.Scheme(),
+		Recorder: &events.FakeRecorder{},
+	}
+	if _, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(bc)}); err != nil {
+		t.Fatal(err)
+	}
+	newClient := func(globalOptions) (client.Client, string, error) { return c, "team-a", nil }
+	diff := func(args ...string) (int, string, string) {
+		var stdout, stderr bytes.Buffer
+		code := run(ctx, append(append([]string{"diff"}, args...), "app"), &stdout, &stderr, newClient)
+		return code, stdout.String(), stderr.String()
+	}
+
+	if code, out, stderr := diff(); code != exitOK || out != "" || stderr != "" || len(requests) != 0 {
+		t.Fatalf("recorded pin: exit code = %d, output = %q, stderr = %s, requests = %v", code, out, stderr, requests)
+	}
+
+	// A new image is resolved through the mirror of the operator config
+	if err := c.Get(ctx, client.ObjectKeyFromObject(bc), bc); err != nil {
+		t.Fatal(err)
+	}
+	bc.Spec.Butane = unit("registry.invalid/team/web:v1", "registry.invalid/team/api:v2")
+	if err := c.Update(ctx, bc); err != nil {
+		t.Fatal(err)
+	}
+	code, out, stderr := diff()
+	if code != exitDiffers || !strings.Contains(out, "registry.invalid/team/api:v2@"+digest) || strings.Contains(out, "+"+recorded) {
+		t.Errorf("new image: exit code = %d, output:\n%s\nstderr = %s", code, out, stderr)
+	}
+	if len(requests) != 1 || requests[0] != "/v2/team/api/manifests/v2" {
+		t.Errorf("got registry requests %v, want only the new image", requests)
+	}
+
+	// Without the operator config, the built-in defaults apply
+	code, _, stderr = diff("--operator-config", "butane-operator-system/missing")
+	if code != exitFailed || !strings.Contains(stderr, "warning: rendering with the built-in operator defaults") {
+		t.Errorf("missing operator config: exit code = %d, stderr = %s", code, stderr)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	bc, secret := renderedConfig(t, "motd", motdConfig)
+
+	code, out, stderr := runPlugin(t, []client.Object{bc, secret}, "files", "-n", "team-a", "motd")
+	if code != exitOK {
+		t.Fatalf("exit code = %d, stderr = %s", code, stderr)
+	}
+	for _, want := range []string{
+		"file    /etc/motd",
+		"0644",
+		"inline",
+		"symlink -> ../usr/share/zoneinfo/UTC",
+		"/etc/systemd/system/motd.service",
+		"enabled, 1 dropin(s)",
+		"/etc/systemd/system/motd.service.d/10-env.conf",
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("listing missing %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestExplain(t *testing.T) {
+	bc, secret := renderedConfig(t, "motd", motdConfig)
+
+	code, out, stderr := runPlugin(t, []client.Object{bc, secret}, "explain", "-n", "team-a", "-o", "json", "motd")
+	if code != exitOK {
+		t.Fatalf("exit code = %d, stderr = %s", code, stderr)
+	}
+	var origins []render.Origin
+	if err := json.Unmarshal([]byte(out), &origins); err != nil {
+		t.Fatalf("output is not JSON: %v\n%s", err, out)
+	}
+	var found bool
+	for _, o := range origins {
+		if o.Kind == "file" && o.Name == "/etc/motd" {
+			found = true
+			if o.ButanePath != "$.storage.files.0" || o.Line == 0 {
+				t.Errorf("unexpected origin %+v", o)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("no origin for /etc/motd in %+v", origins)
+	}
+
+	code, out, _ = runPlugin(t, []client.Object{bc, secret}, "explain", "-n", "team-a", "--show-source", "motd")
+	if code != exitOK || !strings.Contains(out, "IGNITION PATH") || !strings.Contains(out, "   1  storage:") {
+		t.Errorf("exit code = %d, output:\n%s", code, out)
+	}
+}
+
+func TestUsage(t *testing.T) {
+	if code, _, _ := runPlugin(t, nil); code != exitUsage {
+		t.Errorf("exit code = %d, want %d", code, exitUsage)
+	}
+	if code, _, _ := runPlugin(t, nil, "show"); code != exitUsage {
+		t.Errorf("exit code = %d, want %d", code, exitUsage)
+	}
+	if code, _, _ := runPlugin(t, nil, "frobnicate"); code != exitUsage {
+		t.Errorf("exit code = %d, want %d", code, exitUsage)
+	}
+}
@@ -0,0 +1,195 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/util/sets"
+	"k8s.io/client-go/tools/events"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/apiutil"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	butanev1beta1 "github.com/naval-group/butane-operator/api/v1beta1"
+	"github.com/naval-group/butane-operator/internal/controller"
+	"github.com/naval-group/butane-operator/internal/images"
+	"github.com/naval-group/butane-operator/internal/operatorconfig"
+)
+
+// overlayClient reads objects from the cluster and keeps what is written in
+// memory, so that the controller can render a ButaneConfig without changing
+// anything in the cluster. Objects are copied into memory the first time they
+// are read, and read from there afterwards.
+type overlayClient struct {
+	client.WithWatch
+	cluster client.Reader
+	copied  sets.Set[string]
+}
+
+func newOverlayClient(cluster client.Client) *overlayClient {
+	return &overlayClient{
+		WithWatch: fake.NewClientBuilder().
+			WithScheme(cluster.Scheme()).
+			WithStatusSubresource(&butanev1beta1.ButaneConfig{}).
+			Build(),
+		cluster: cluster,
+		copied:  sets.New[string](),
+	}
+}
+
+func (c *overlayClient) Get(ctx context.Context, key client.ObjectKey, obj client.Object, opts ...client.GetOption) error {
+	id, err := c.id(obj, key)
+	if err != nil {
+		return err
+	}
+	if !c.copied.Has(id) {
+		live := obj.DeepCopyObject().(client.Object)
+		switch err := c.cluster.Get(ctx, key, live, opts...); {
+		case apierrors.IsNotFound(err):
+			c.copied.Insert(id)
+		case err != nil:
+			return err
+		default:
+			if err := c.copy(ctx, live); err != nil {
+				return err
+			}
+		}
+	}
+	return c.WithWatch.Get(ctx, key, obj, opts...)
+}
+
+func (c *overlayClient) List(ctx context.Context, list client.ObjectList, opts ...client.ListOption) error {
+	live := list.DeepCopyObject().(client.ObjectList)
+	if err := c.cluster.List(ctx, live, opts...); err != nil {
+		return err
+	}
+	items, err := meta.ExtractList(live)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := c.copy(ctx, item.(client.Object)); err != nil {
+			return err
+		}
+	}
+	return c.WithWatch.List(ctx, list, opts...)
+}
+
+// copy stores obj, read from the cluster, in memory unless it was read or
+// written there before.
+func (c *overlayClient) copy(ctx context.Context, obj client.Object) error {
+	id, err := c.id(obj, client.ObjectKeyFromObject(obj))
+	if err != nil {
+		return err
+	}
+	if c.copied.Has(id) {
+		return nil
+	}
+	c.copied.Insert(id)
+	obj.SetResourceVersion("")
+	obj.SetManagedFields(nil)
+	if err := c.WithWatch.Create(ctx, obj); err != nil && !apierrors.IsAlreadyExists(err) {
+		return err
+	}
+	return nil
+}
+
+func (c *overlayClient) id(obj client.Object, key client.ObjectKey) (string, error) {
+	gvk, err := apiutil.GVKForObject(obj, c.Scheme())
+	if err != nil {
+		return "", err
+	}
+	return gvk.GroupKind().String() + "/" + key.String(), nil
+}
+
+// defaultOperatorConfig is the ConfigMap holding the operator config of the
+// operator deployed with config/default.
+const defaultOperatorConfig = "butane-operator-system/butane-operator-manager-config"
+
+// operatorConfigKey is the key of the operator config in its ConfigMap.
+const operatorConfigKey = "config.yaml"
+
+// operatorConfig returns the operator config held by the ConfigMap ref, as
+// NAMESPACE/NAME. The built-in defaults are returned, with a warning, when
+// the ConfigMap cannot be read, and without one when ref is empty.
+func (p *plugin) operatorConfig(ctx context.Context, ref string) (*operatorconfig.OperatorConfig, error) {
+	if ref == "" {
+		return operatorconfig.Default(), nil
+	}
+	namespace, name, ok := strings.Cut(ref, "/")
+	if !ok || namespace == "" || name == "" {
+		return nil, fmt.Errorf("invalid operator config %q: must be NAMESPACE/NAME", ref)
+	}
+	var cm corev1.ConfigMap
+	if err := p.client.Get(ctx, client.ObjectKey{Namespace: namespace, Name: name}, &cm); err != nil {
+		if !apierrors.IsNotFound(err) && !apierrors.IsForbidden(err) {
+			return nil, err
+		}
+		_, _ = fmt.Fprintf(p.errOut, "warning: rendering with the built-in operator defaults: %v\n", err)
+		return operatorconfig.Default(), nil
+	}
+	data, ok := cm.Data[operatorConfigKey]
+	if !ok {
+		return nil, fmt.Errorf("configmap %s has no key %s", ref, operatorConfigKey)
+	}
+	return operatorconfig.Parse([]byte(data), operatorconfig.Default())
+}
+
+// renderSpec returns the Ignition the current spec of bc renders to, running
+// the controller in dry-run mode against an overlayClient so that the merged
+// ClusterButaneConfigs, injection policies, users, pinned images, Ignition
+// version and compression are all applied as the operator would. The defaults
+// and policy come from the operator config cfg, and the images are resolved
+// through its mirrors, unless status.pinnedImages records them already.
+func (p *plugin) renderSpec(ctx context.Context, bc *butanev1beta1.ButaneConfig, cfg *operatorconfig.OperatorConfig) ([]byte, error) {
+	c := newOverlayClient(p.client)
+	reconciler := &controller.ButaneConfigReconciler{
+		Client:   c,
+		Log:      logr.Discard(),
+		Scheme:   c.Scheme(),
+		Recorder: &events.FakeRecorder{},
+		Config:   operatorconfig.NewStore(cfg),
+		Images: &images.Resolver{
+			Mirrors:   cfg.Images.Mirrors,
+			PlainHTTP: cfg.Images.PlainHTTPRegistries,
+		},
+		DryRun: true,
+	}
+	key := client.ObjectKeyFromObject(bc)
+	if _, err := reconciler.Reconcile(ctx, reconcile.Request{NamespacedName: key}); err != nil {
+		// Whether the controller would retry does not matter here.
+		if errors.Is(err, reconcile.TerminalError(nil)) {
+			err = errors.Unwrap(err)
+		}
+		return nil, err
+	}
+
+	var rendered butanev1beta1.ButaneConfig
+	if err := c.Get(ctx, key, &rendered); err != nil {
+		return nil, err
+	}
+	return (&plugin{client: c, namespace: p.namespace}).liveIgnition(ctx, &rendered)
+}
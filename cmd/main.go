@@ -20,25 +20,40 @@ import (
 	"context"
 	"crypto/tls"
 	"flag"
+	"fmt"
 	"os"
+	"sort"
+	"strings"
 	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	"k8s.io/client-go/kubernetes"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 	"sigs.k8s.io/controller-runtime/pkg/webhook"
 
 	butanev1alpha1 "github.com/naval-group/butane-operator/api/v1alpha1"
+	butanev1beta1 "github.com/naval-group/butane-operator/api/v1beta1"
 	"github.com/naval-group/butane-operator/internal/controller"
+	"github.com/naval-group/butane-operator/internal/images"
+	"github.com/naval-group/butane-operator/internal/metrics"
+	"github.com/naval-group/butane-operator/internal/migration"
+	"github.com/naval-group/butane-operator/internal/operatorconfig"
+	"github.com/naval-group/butane-operator/internal/preview"
+	"github.com/naval-group/butane-operator/internal/userdir"
 	webhookcerts "github.com/naval-group/butane-operator/pkg/webhook/certs"
 	//+kubebuilder:scaffold:imports
 )
@@ -50,19 +65,32 @@ var (
 
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
 
 	utilruntime.Must(butanev1alpha1.AddToScheme(scheme))
+	utilruntime.Must(butanev1beta1.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
 func main() {
+	defaults := operatorconfig.Default()
+	var configFile string
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
 	var secureMetrics bool
 	var enableHTTP2 bool
-	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
-	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
+	var maxConcurrentReconciles int
+	var rateLimiterBaseDelay time.Duration
+	var rateLimiterMaxDelay time.Duration
+	var rateLimiterQPS float64
+	var rateLimiterBurst int
+	var watchNamespaces string
+	var watchNamespaceSelector string
+	flag.StringVar(&configFile, "config", "",
+		"The operator config file. The flags that are set override its settings.")
+	flag.StringVar(&metricsAddr, "metrics-bind-address", defaults.Manager.MetricsBindAddress, "The address the metric endpoint binds to.")
+	flag.StringVar(&probeAddr, "health-probe-bind-address", defaults.Manager.HealthProbeBindAddress, "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
@@ -70,6 +98,21 @@ func main() {
 		"If set the metrics endpoint is served securely")
 	flag.BoolVar(&enableHTTP2, "enable-http2", false,
 		"If set, HTTP/2 will be enabled for the metrics and webhook servers")
+	flag.IntVar(&maxConcurrentReconciles, "max-concurrent-reconciles", defaults.Manager.MaxConcurrentReconciles,
+		"The number of ButaneConfigs reconciled in parallel.")
+	flag.DurationVar(&rateLimiterBaseDelay, "rate-limiter-base-delay", defaults.Manager.RateLimiter.BaseDelay.Duration,
+		"The delay before the first retry of a failed reconciliation, doubled on every further failure.")
+	flag.DurationVar(&rateLimiterMaxDelay, "rate-limiter-max-delay", defaults.Manager.RateLimiter.MaxDelay.Duration,
+		"The longest delay between two retries of a failed reconciliation.")
+	flag.Float64Var(&rateLimiterQPS, "rate-limiter-qps", defaults.Manager.RateLimiter.QPS,
+		"The overall number of retries per second across all ButaneConfigs.")
+	flag.IntVar(&rateLimiterBurst, "rate-limiter-burst", defaults.Manager.RateLimiter.Burst,
+		"The number of retries allowed in a burst above rate-limiter-qps.")
+	flag.StringVar(&watchNamespaces, "watch-namespaces", "",
+		"Comma-separated list of the namespaces to watch. By default, all namespaces are watched.")
+	flag.StringVar(&watchNamespaceSelector, "watch-namespace-selector", "",
+		"Label selector of namespaces to watch in addition to --watch-namespaces. "+
+			"It is evaluated on startup, so the manager must be restarted to pick up namespace changes.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -78,6 +121,51 @@ func main() {
 
 	ctrl.SetLogger(zap.New(zap.UseFlagOptions(&opts)))
 
+	// Settings come from the defaults, then the environment variables, then
+	// the config file, then the flags that are set.
+	cfg := configFromEnv(defaults)
+	if configFile != "" {
+		loaded, err := operatorconfig.Load(configFile, cfg)
+		if err != nil {
+			setupLog.Error(err, "unable to load the operator config", "path", configFile)
+			os.Exit(1)
+		}
+		cfg = loaded
+	}
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "metrics-bind-address":
+			cfg.Manager.MetricsBindAddress = metricsAddr
+		case "health-probe-bind-address":
+			cfg.Manager.HealthProbeBindAddress = probeAddr
+		case "leader-elect":
+			cfg.Manager.LeaderElection = enableLeaderElection
+		case "metrics-secure":
+			cfg.Manager.SecureMetrics = secureMetrics
+		case "enable-http2":
+			cfg.Webhook.EnableHTTP2 = enableHTTP2
+		case "max-concurrent-reconciles":
+			cfg.Manager.MaxConcurrentReconciles = maxConcurrentReconciles
+		case "rate-limiter-base-delay":
+			cfg.Manager.RateLimiter.BaseDelay.Duration = rateLimiterBaseDelay
+		case "rate-limiter-max-delay":
+			cfg.Manager.RateLimiter.MaxDelay.Duration = rateLimiterMaxDelay
+		case "rate-limiter-qps":
+			cfg.Manager.RateLimiter.QPS = rateLimiterQPS
+		case "rate-limiter-burst":
+			cfg.Manager.RateLimiter.Burst = rateLimiterBurst
+		case "watch-namespaces":
+			cfg.Manager.WatchNamespaces = splitList(watchNamespaces)
+		case "watch-namespace-selector":
+			cfg.Manager.WatchNamespaceSelector = watchNamespaceSelector
+		}
+	})
+	if err := cfg.Validate(); err != nil {
+		setupLog.Error(err, "invalid settings")
+		os.Exit(1)
+	}
+	configStore := operatorconfig.NewStore(cfg)
+
 	// if the enable-http2 flag is false (the default), http/2 should be disabled
 	// due to its vulnerabilities. More specifically, disabling http/2 will
 	// prevent from being vulnerable to the HTTP/2 Stream Cancellation and
@@ -90,19 +178,19 @@ func main() {
 	}
 
 	tlsOpts := []func(*tls.Config){}
-	if !enableHTTP2 {
+	if !cfg.Webhook.EnableHTTP2 {
 		tlsOpts = append(tlsOpts, disableHTTP2)
 	}
 
 	mgrOpts := ctrl.Options{
 		Scheme: scheme,
 		Metrics: metricsserver.Options{
-			BindAddress:   metricsAddr,
-			SecureServing: secureMetrics,
+			BindAddress:   cfg.Manager.MetricsBindAddress,
+			SecureServing: cfg.Manager.SecureMetrics,
 			TLSOpts:       tlsOpts,
 		},
-		HealthProbeBindAddress: probeAddr,
-		LeaderElection:         enableLeaderElection,
+		HealthProbeBindAddress: cfg.Manager.HealthProbeBindAddress,
+		LeaderElection:         cfg.Manager.LeaderElection,
 		LeaderElectionID:       "b6a4bd7e.operators.naval-group.com",
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
@@ -117,32 +205,57 @@ func main() {
 		// LeaderElectionReleaseOnCancel: true,
 	}
 
-	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
-		certDir := envOrDefault("WEBHOOK_CERT_DIR", "/tmp/k8s-webhook-server/serving-certs")
+	kubeClient, err := kubernetes.NewForConfig(ctrl.GetConfigOrDie())
+	if err != nil {
+		setupLog.Error(err, "unable to create Kubernetes client")
+		os.Exit(1)
+	}
+	namespaces, err := resolveNamespaces(context.Background(), kubeClient, cfg.Manager.WatchNamespaces, cfg.Manager.WatchNamespaceSelector)
+	if err != nil {
+		setupLog.Error(err, "unable to resolve the namespaces to watch")
+		os.Exit(1)
+	}
+	if len(namespaces) > 0 {
+		setupLog.Info("watching namespaces", "namespaces", namespaces)
+		defaultNamespaces := make(map[string]cache.Config, len(namespaces))
+		for _, ns := range namespaces {
+			defaultNamespaces[ns] = cache.Config{}
+		}
+		mgrOpts.Cache = cache.Options{DefaultNamespaces: defaultNamespaces}
+	}
+
+	if cfg.Webhook.IsEnabled() {
+		certDir := cfg.Webhook.CertDir
 
 		// Provision TLS certs before starting the webhook server.
 		// Use a standalone client since the manager's cached client isn't available yet.
-		kubeClient, err := kubernetes.NewForConfig(ctrl.GetConfigOrDie())
+		crdClient, err := apiextensionsclientset.NewForConfig(ctrl.GetConfigOrDie())
 		if err != nil {
-			setupLog.Error(err, "unable to create Kubernetes client for webhook cert provisioning")
+			setupLog.Error(err, "unable to create CRD client for webhook cert provisioning")
 			os.Exit(1)
 		}
 
 		certCfg := webhookcerts.Config{
-			ServiceName:       envOrDefault("WEBHOOK_SERVICE_NAME", "butane-operator-webhook-service"),
-			Namespace:         envOrDefault("POD_NAMESPACE", "butane-operator-system"),
-			SecretName:        envOrDefault("WEBHOOK_SECRET_NAME", "webhook-server-cert"),
-			WebhookConfigName: envOrDefault("WEBHOOK_CONFIG_NAME", "butane-operator-validating-webhook-configuration"),
+			ServiceName:       cfg.Webhook.ServiceName,
+			Namespace:         cfg.Webhook.Namespace,
+			SecretName:        cfg.Webhook.SecretName,
+			WebhookConfigName: cfg.Webhook.ConfigName,
 			CertDir:           certDir,
-			CertValidity:      365 * 24 * time.Hour,
-			RenewalThreshold:  30 * 24 * time.Hour,
+			CertValidity:      cfg.Certs.Validity.Duration,
+			RenewalThreshold:  cfg.Certs.RenewalThreshold.Duration,
+			CRDNames:          cfg.Manager.CRDNames,
 		}
 
 		ctx := context.Background()
-		if err := webhookcerts.Ensure(ctx, kubeClient, certCfg, setupLog); err != nil {
+		if err := webhookcerts.Ensure(ctx, kubeClient, crdClient, certCfg, setupLog); err != nil {
 			setupLog.Error(err, "unable to provision webhook certificates")
 			os.Exit(1)
 		}
+		// The certificate is read on each scrape, since the webhook server
+		// reloads it whenever the files of certDir change
+		ctrlmetrics.Registry.MustRegister(metrics.NewCertExpiryCollector(func() (time.Time, error) {
+			return webhookcerts.ReadExpiry(certDir)
+		}))
 
 		webhookServer := webhook.NewServer(webhook.Options{
 			CertDir: certDir,
@@ -157,21 +270,96 @@ func main() {
 		os.Exit(1)
 	}
 
+	// ClusterButaneConfigs are translated once and shared by every ButaneConfig merging them
+	clusterConfigs := controller.NewClusterConfigCache()
+	// The user directory is checked for changes on the leader, which
+	// re-renders the ButaneConfigs of the users whose keys changed
+	var userDirectory *userdir.Directory
+	if cfg.Users.DirectoryFile != "" {
+		userDirectory = userdir.NewDirectory(cfg.Users.DirectoryFile, ctrl.Log.WithName("userdir"))
+		userDirectory.Interval = cfg.Users.DirectoryInterval.Duration
+		if err := mgr.Add(userDirectory); err != nil {
+			setupLog.Error(err, "unable to set up the user directory")
+			os.Exit(1)
+		}
+	}
 	if err = (&controller.ButaneConfigReconciler{
 		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("ButaneConfig"),
 		Scheme: mgr.GetScheme(),
+
+		MaxConcurrentReconciles: cfg.Manager.MaxConcurrentReconciles,
+		RateLimiter: controller.NewRateLimiter(cfg.Manager.RateLimiter.BaseDelay.Duration,
+			cfg.Manager.RateLimiter.MaxDelay.Duration, cfg.Manager.RateLimiter.QPS, cfg.Manager.RateLimiter.Burst),
+		Config:         configStore,
+		ClusterConfigs: clusterConfigs,
+		Directory:      userDirectory,
+		Images: &images.Resolver{
+			Mirrors:   cfg.Images.Mirrors,
+			PlainHTTP: cfg.Images.PlainHTTPRegistries,
+		},
+		Pusher: &images.Pusher{
+			PlainHTTP: cfg.Images.PlainHTTPRegistries,
+		},
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "ButaneConfig")
 		os.Exit(1)
 	}
-	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
-		if err = (&butanev1alpha1.ButaneConfig{}).SetupWebhookWithManager(mgr); err != nil {
+	if err = (&controller.ClusterButaneConfigReconciler{
+		Client: mgr.GetClient(),
+		Log:    ctrl.Log.WithName("controllers").WithName("ClusterButaneConfig"),
+		Cache:  clusterConfigs,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "ClusterButaneConfig")
+		os.Exit(1)
+	}
+	if cfg.Webhook.IsEnabled() {
+		if err = (&butanev1beta1.ButaneConfig{}).SetupWebhookWithManager(mgr, configStore); err != nil {
 			setupLog.Error(err, "unable to create webhook", "webhook", "ButaneConfig")
 			os.Exit(1)
 		}
+		if err = (&butanev1beta1.ClusterButaneConfig{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ClusterButaneConfig")
+			os.Exit(1)
+		}
+		if err = (&butanev1beta1.ButaneInjectionPolicy{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "ButaneInjectionPolicy")
+			os.Exit(1)
+		}
+		// Previews of proposed ButaneConfigs are served with the webhook TLS certificate
+		mgr.GetWebhookServer().Register(preview.Path, &preview.Handler{
+			Client: mgr.GetClient(),
+			Config: configStore,
+		})
 	}
 	//+kubebuilder:scaffold:builder
 
+	// Rewrite objects stored in older versions so that they can be removed from the CRD
+	if err := mgr.Add(&migration.StorageVersionMigrator{
+		Client:     mgr.GetClient(),
+		Reader:     mgr.GetAPIReader(),
+		CRDName:    cfg.Manager.CRDNames[0],
+		Namespaces: namespaces,
+		Log:        ctrl.Log.WithName("migration"),
+	}); err != nil {
+		setupLog.Error(err, "unable to set up storage version migration")
+		os.Exit(1)
+	}
+
+	// Reload the defaults and policy when the mounted config file changes
+	if configFile != "" {
+		if err := mgr.Add(&operatorconfig.Watcher{
+			Path:  configFile,
+			Store: configStore,
+			Log:   ctrl.Log.WithName("operatorconfig"),
+		}); err != nil {
+			setupLog.Error(err, "unable to set up operator config reloading")
+			os.Exit(1)
+		}
+	}
+
+	ctrlmetrics.Registry.MustRegister(metrics.NewReadyCollector(mgr.GetClient()))
+
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
 		setupLog.Error(err, "unable to set up health check")
 		os.Exit(1)
@@ -188,6 +376,64 @@ func main() {
 	}
 }
 
+// resolveNamespaces returns the namespaces listed in watchNamespaces and those
+// matching selector, listed with kubeClient, sorted. None means all
+// namespaces are watched.
+func resolveNamespaces(ctx context.Context, kubeClient kubernetes.Interface, watchNamespaces []string, selector string) ([]string, error) {
+	set := map[string]bool{}
+	for _, ns := range watchNamespaces {
+		set[ns] = true
+	}
+	if selector != "" {
+		list, err := kubeClient.CoreV1().Namespaces().List(ctx, metav1.ListOptions{LabelSelector: selector})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list the namespaces matching %q: %w", selector, err)
+		}
+		for _, ns := range list.Items {
+			set[ns.Name] = true
+		}
+		// Watching nothing must not turn into watching everything.
+		if len(set) == 0 {
+			return nil, fmt.Errorf("no namespace matches the selector %q", selector)
+		}
+	}
+	namespaces := make([]string, 0, len(set))
+	for ns := range set {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+	return namespaces, nil
+}
+
+// configFromEnv applies the environment variables that configured the manager
+// before the config file, which take precedence over the defaults of cfg.
+func configFromEnv(cfg *operatorconfig.OperatorConfig) *operatorconfig.OperatorConfig {
+	if os.Getenv("ENABLE_WEBHOOKS") == "false" {
+		enabled := false
+		cfg.Webhook.Enabled = &enabled
+	}
+	cfg.Webhook.CertDir = envOrDefault("WEBHOOK_CERT_DIR", cfg.Webhook.CertDir)
+	cfg.Webhook.ServiceName = envOrDefault("WEBHOOK_SERVICE_NAME", cfg.Webhook.ServiceName)
+	cfg.Webhook.Namespace = envOrDefault("POD_NAMESPACE", cfg.Webhook.Namespace)
+	cfg.Webhook.SecretName = envOrDefault("WEBHOOK_SECRET_NAME", cfg.Webhook.SecretName)
+	cfg.Webhook.ConfigName = envOrDefault("WEBHOOK_CONFIG_NAME", cfg.Webhook.ConfigName)
+	if crdNames := os.Getenv("CRD_NAMES"); crdNames != "" {
+		cfg.Manager.CRDNames = splitList(crdNames)
+	}
+	return cfg
+}
+
+// splitList splits a comma-separated list, dropping empty items.
+func splitList(list string) []string {
+	var out []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
 func envOrDefault(key, defaultVal string) string {
 	if v := os.Getenv(key); v != "" {
 		return v
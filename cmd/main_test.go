@@ -0,0 +1,72 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestResolveNamespaces(t *testing.T) {
+	namespace := func(name string, labels map[string]string) *corev1.Namespace {
+		return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+	}
+	client := fake.NewClientset(
+		namespace("tenant-b", map[string]string{"butane.operators.naval-group.com/tenant": "true"}),
+		namespace("tenant-c", map[string]string{"butane.operators.naval-group.com/tenant": "true"}),
+		namespace("kube-system", nil),
+	)
+
+	tests := []struct {
+		name            string
+		watchNamespaces []string
+		selector        string
+		want            []string
+		wantErr         bool
+	}{
+		{name: "all namespaces", want: []string{}},
+		{name: "listed", watchNamespaces: []string{"tenant-b", "tenant-a"}, want: []string{"tenant-a", "tenant-b"}},
+		{
+			name:     "selected",
+			selector: "butane.operators.naval-group.com/tenant=true",
+			want:     []string{"tenant-b", "tenant-c"},
+		},
+		{
+			name:            "listed and selected",
+			watchNamespaces: []string{"tenant-a", "tenant-b"},
+			selector:        "butane.operators.naval-group.com/tenant=true",
+			want:            []string{"tenant-a", "tenant-b", "tenant-c"},
+		},
+		{name: "nothing selected", selector: "butane.operators.naval-group.com/tenant=false", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := resolveNamespaces(context.Background(), client, tt.watchNamespaces, tt.selector)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveNamespaces() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolveNamespaces() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command butane-schema replaces the schema controller-gen generates for the
+// spec.config RawExtension of a ButaneConfig CRD version with the typed schema
+// generated from the Butane specification structs.
+//
+//	go run ./hack/butane-schema --version v1beta1 config/crd/bases/butane.operators.naval-group.com_butaneconfigs.yaml
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"sigs.k8s.io/yaml"
+
+	"github.com/naval-group/butane-operator/internal/schema"
+)
+
+func main() {
+	version := flag.String("version", "v1beta1", "CRD version whose spec.config schema is replaced.")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: butane-schema [--version <version>] <crd.yaml>")
+		os.Exit(2)
+	}
+	if err := patch(flag.Arg(0), *version); err != nil {
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func patch(path, version string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var crd map[string]interface{}
+	if err := yaml.Unmarshal(data, &crd); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	config, err := schema.Config()
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	var generated interface{}
+	if err := json.Unmarshal(raw, &generated); err != nil {
+		return err
+	}
+
+	found := false
+	versions, _ := lookup(crd, "spec", "versions").([]interface{})
+	for _, v := range versions {
+		v, _ := v.(map[string]interface{})
+		if v == nil || v["name"] != version {
+			continue
+		}
+		specProps, _ := lookup(v, "schema", "openAPIV3Schema", "properties", "spec", "properties").(map[string]interface{})
+		if specProps == nil || specProps["config"] == nil {
+			return fmt.Errorf("%s: version %s has no spec.config", path, version)
+		}
+		specProps["config"] = generated
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("%s: no version %s", path, version)
+	}
+
+	out, err := yaml.Marshal(crd)
+	if err != nil {
+		return err
+	}
+	if bytes.HasPrefix(data, []byte("---\n")) {
+		out = append([]byte("---\n"), out...)
+	}
+	return os.WriteFile(path, out, 0o644)
+}
+
+func lookup(obj interface{}, keys ...string) interface{} {
+	for _, k := range keys {
+		m, ok := obj.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		obj = m[k]
+	}
+	return obj
+}
@@ -18,99 +18,444 @@ package controller
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
-	"github.com/coreos/butane/config"
-	"github.com/coreos/butane/config/common"
+	"github.com/coreos/vcontext/report"
 	"github.com/go-logr/logr"
-	butanev1alpha1 "github.com/naval-group/butane-operator/api/v1alpha1"
+	butanev1beta1 "github.com/naval-group/butane-operator/api/v1beta1"
+	"github.com/naval-group/butane-operator/internal/images"
+	"github.com/naval-group/butane-operator/internal/lint"
+	"github.com/naval-group/butane-operator/internal/metrics"
+	"github.com/naval-group/butane-operator/internal/operatorconfig"
+	"github.com/naval-group/butane-operator/internal/render"
+	"github.com/naval-group/butane-operator/internal/userdir"
+	"golang.org/x/time/rate"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/sets"
+	corev1ac "k8s.io/client-go/applyconfigurations/core/v1"
+	metav1ac "k8s.io/client-go/applyconfigurations/meta/v1"
 	"k8s.io/client-go/tools/events"
+	"k8s.io/client-go/util/csaupgrade"
+	"k8s.io/client-go/util/workqueue"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 )
 
+// FieldManager is the field manager the operator applies the generated
+// Secrets with.
+const FieldManager = "butane-operator"
+
+// legacyFieldManager is the field manager of the Secrets the operator wrote
+// with Create and Update: the default of controller-runtime, the name of the
+// manager binary.
+const legacyFieldManager = "manager"
+
 // ButaneConfigReconciler reconciles a ButaneConfig object
 type ButaneConfigReconciler struct {
 	client.Client
 	Log      logr.Logger
 	Scheme   *runtime.Scheme
 	Recorder events.EventRecorder
+
+	// MaxConcurrentReconciles is the number of ButaneConfigs reconciled in
+	// parallel. Zero uses the controller-runtime default of one.
+	MaxConcurrentReconciles int
+	// RateLimiter paces the retries of transient failures. Nil uses the
+	// controller-runtime default.
+	RateLimiter workqueue.TypedRateLimiter[reconcile.Request]
+	// Config holds the operator config, whose defaults apply to the settings
+	// a ButaneConfig leaves unset. Nil uses the built-in defaults.
+	Config *operatorconfig.Store
+	// ClusterConfigs caches the translated ClusterButaneConfigs of
+	// spec.mergeFrom. Nil translates them on every reconcile.
+	ClusterConfigs *ClusterConfigCache
+	// Directory serves the SSH authorized keys of the user directory file.
+	// Nil fails the ButaneConfigs reading keys from it.
+	Directory *userdir.Directory
+	// Images resolves the container images of the ButaneConfigs pinning
+	// them to digests. Nil resolves them against the registries over HTTPS.
+	Images *images.Resolver
+	// Pusher pushes the Ignition of the ButaneConfigs setting
+	// spec.output.oci. Nil pushes to the registries over HTTPS.
+	Pusher *images.Pusher
+	// FilesDir is the directory local contents and trees are read from, as
+	// with butane --files-dir. Empty, as in the cluster, rejects them.
+	FilesDir string
+	// DryRun renders without pushing to the registry of spec.output.oci, nor
+	// uploading to or deleting from the object storage of spec.output.s3, for
+	// the tools rendering offline.
+	DryRun bool
 }
 
 //+kubebuilder:rbac:groups=butane.operators.naval-group.com,resources=butaneconfigs,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=butane.operators.naval-group.com,resources=butaneconfigs/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=butane.operators.naval-group.com,resources=butaneconfigs/finalizers,verbs=update
+//+kubebuilder:rbac:groups=butane.operators.naval-group.com,resources=clusterbutaneconfigs,verbs=get;list;watch
+//+kubebuilder:rbac:groups=butane.operators.naval-group.com,resources=butaneinjectionpolicies,verbs=get;list;watch
 //+kubebuilder:rbac:groups="",resources=secrets,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups="",resources=configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=namespaces,verbs=get;list;watch
 //+kubebuilder:rbac:groups=events.k8s.io,resources=events,verbs=create;patch;update
 //+kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=validatingwebhookconfigurations,verbs=get;list;watch;update;patch
 //+kubebuilder:rbac:groups=admissionregistration.k8s.io,resources=mutatingwebhookconfigurations,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get;list;watch;update;patch
+//+kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions/status,verbs=update
 
+// Reconcile renders a ButaneConfig into its Secrets. Failures that only a new
+// spec can fix, such as an invalid config, are returned as terminal errors so
+// they are not retried; failures reaching the API server or referenced objects
+// are retried with backoff.
 func (r *ButaneConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	log := r.Log.WithValues("butaneconfig", req.NamespacedName)
 
 	// Fetch the ButaneConfig instance
-	var butaneConfig butanev1alpha1.ButaneConfig
+	var butaneConfig butanev1beta1.ButaneConfig
 	if err := r.Get(ctx, req.NamespacedName, &butaneConfig); err != nil {
 		if apierrors.IsNotFound(err) {
 			return ctrl.Result{}, nil
 		}
 		return ctrl.Result{}, err
 	}
+
+	// Delete the S3 object along with the ButaneConfig, or once
+	// spec.output.s3 is removed, which the finalizer holds until then
+	if !butaneConfig.DeletionTimestamp.IsZero() {
+		if !controllerutil.ContainsFinalizer(&butaneConfig, butanev1beta1.FinalizerS3Object) {
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, r.releaseObject(ctx, &butaneConfig)
+	}
+	if butaneConfig.Spec.Output.S3 != nil {
+		if controllerutil.AddFinalizer(&butaneConfig, butanev1beta1.FinalizerS3Object) {
+			if err := r.Update(ctx, &butaneConfig); err != nil {
+				return ctrl.Result{}, err
+			}
+		}
+	} else if controllerutil.ContainsFinalizer(&butaneConfig, butanev1beta1.FinalizerS3Object) {
+		if err := r.releaseObject(ctx, &butaneConfig); err != nil {
+			return ctrl.Result{}, err
+		}
+	}
 	r.Recorder.Eventf(&butaneConfig, nil, corev1.EventTypeNormal, "ConfigRetrieved", "ConfigRetrieved", "Successfully retrieved ButaneConfig")
 
-	// Extract the raw Butane configuration from the runtime.RawExtension
-	rawConfig := butaneConfig.Spec.Config.Raw
+	// Extract the Butane configuration from the spec, or the ConfigMap it references
+	rawConfig, err := r.butaneSource(ctx, &butaneConfig)
+	if err != nil {
+		log.Error(err, "Error reading the Butane config")
+		r.Recorder.Eventf(&butaneConfig, nil, corev1.EventTypeWarning, "SourceUnavailable", "SourceUnavailable", "Failed to read the Butane config: %v", err)
+		r.setReady(ctx, &butaneConfig, metav1.ConditionFalse, butanev1beta1.ReasonSourceUnavailable, err.Error())
+		return ctrl.Result{}, err
+	}
 	if rawConfig == nil {
 		log.Error(nil, "ButaneConfig is missing a Config")
-		return ctrl.Result{}, fmt.Errorf("missing Config in ButaneConfig %s", butaneConfig.Name)
+		r.setReady(ctx, &butaneConfig, metav1.ConditionFalse, butanev1beta1.ReasonMissingConfig, "spec has no Butane config")
+		return ctrl.Result{}, reconcile.TerminalError(fmt.Errorf("missing Config in ButaneConfig %s", butaneConfig.Name))
 	}
 
 	// Convert the ButaneConfig to an Ignition config
-	ignitionConfig, rpt, err := config.TranslateBytes(rawConfig, common.TranslateBytesOptions{})
-	if err != nil || len(rpt.Entries) > 0 {
+	start := time.Now()
+	ignitionConfig, rpt, err := render.Translate(rawConfig, r.translateOptions(&butaneConfig))
+	metrics.ObserveTranslation(start, ignitionConfig, rpt, err)
+	if err != nil {
 		log.Error(err, "Error translating ButaneConfig to Ignition config")
 		r.Recorder.Eventf(&butaneConfig, nil, corev1.EventTypeWarning, "ConversionFailed", "ConversionFailed", "Failed to convert ButaneConfig to Ignition config: %s", rpt.String())
+		r.setReady(ctx, &butaneConfig, metav1.ConditionFalse, butanev1beta1.ReasonTranslationFailed, translationMessage(rpt, err))
+		return ctrl.Result{}, reconcile.TerminalError(err)
+	}
+
+	// Reject plaintext passwords, which the webhook cannot check for butaneFrom
+	if err := render.CheckPasswordHashes(ignitionConfig); err != nil {
+		log.Error(err, "ButaneConfig sets a plaintext password")
+		r.Recorder.Eventf(&butaneConfig, nil, corev1.EventTypeWarning, "ConversionFailed", "ConversionFailed", "%v", err)
+		r.setReady(ctx, &butaneConfig, metav1.ConditionFalse, butanev1beta1.ReasonTranslationFailed, err.Error())
+		return ctrl.Result{}, reconcile.TerminalError(err)
+	}
+
+	// Merge the configuration over the cluster-wide configurations it builds
+	// on, and the snippets of the injection policies selecting it over the result
+	policies, err := r.injectionPolicies(ctx, &butaneConfig)
+	var conflicts []lint.Finding
+	if err == nil {
+		butaneConfig.Status.AppliedPolicies = policyNames(policies)
+		ignitionConfig, conflicts, err = r.mergeBases(ctx, &butaneConfig, ignitionConfig, policies)
+	}
+	if err != nil {
+		log.Error(err, "Error merging ClusterButaneConfigs")
+		r.Recorder.Eventf(&butaneConfig, nil, corev1.EventTypeWarning, "MergeFailed", "MergeFailed", "Failed to merge ClusterButaneConfigs: %v", err)
+		r.setReady(ctx, &butaneConfig, metav1.ConditionFalse, butanev1beta1.ReasonMergeFailed, err.Error())
+		// A missing or invalid ClusterButaneConfig is only fixed by changing
+		// it, which the watch picks up; failures reaching the API server are retried.
+		var status apierrors.APIStatus
+		if errors.As(err, &status) && !apierrors.IsNotFound(err) {
+			return ctrl.Result{}, err
+		}
+		return ctrl.Result{}, reconcile.TerminalError(err)
+	}
+
+	// Add the SSH authorized keys of the users, read from labeled Secrets and
+	// ConfigMaps or from the user directory, and hash their passwords
+	ignitionConfig, err = r.mergeUsers(ctx, &butaneConfig, ignitionConfig)
+	if err != nil {
+		log.Error(err, "Error reading the SSH authorized keys or passwords of the users")
+		r.Recorder.Eventf(&butaneConfig, nil, corev1.EventTypeWarning, "UserKeysUnavailable", "UserKeysUnavailable", "Failed to add the SSH authorized keys and passwords of spec.users: %v", err)
+		r.setReady(ctx, &butaneConfig, metav1.ConditionFalse, butanev1beta1.ReasonUserKeysUnavailable, err.Error())
+		// Only configuring the operator with a user directory fixes this one
+		if errors.Is(err, userdir.ErrNotConfigured) {
+			return ctrl.Result{}, reconcile.TerminalError(err)
+		}
 		return ctrl.Result{}, err
 	}
 
-	// Create or update the Secret containing the Ignition configuration
+	// Pin the container images the config runs to their digests
+	ignitionConfig, err = r.pinImages(ctx, &butaneConfig, ignitionConfig)
+	if err != nil {
+		log.Error(err, "Error pinning the container images")
+		r.Recorder.Eventf(&butaneConfig, nil, corev1.EventTypeWarning, "ImagePinningFailed", "ImagePinningFailed", "Failed to pin the container images: %v", err)
+		r.setReady(ctx, &butaneConfig, metav1.ConditionFalse, butanev1beta1.ReasonImagePinningFailed, err.Error())
+		return ctrl.Result{}, err
+	}
+
+	// Convert the Ignition configuration to the pinned specification version
+	if version := butaneConfig.Spec.Output.IgnitionVersion; version != "" {
+		ignitionConfig, err = render.ConvertVersion(ignitionConfig, version, butaneConfig.Spec.Translation.RenderOptions())
+		if err != nil {
+			log.Error(err, "Error converting Ignition config", "ignitionVersion", version)
+			r.Recorder.Eventf(&butaneConfig, nil, corev1.EventTypeWarning, "IgnitionVersionFailed", "IgnitionVersionFailed", "Failed to convert the Ignition config to spec %s: %v", version, err)
+			r.setReady(ctx, &butaneConfig, metav1.ConditionFalse, butanev1beta1.ReasonIgnitionVersionFailed, err.Error())
+			return ctrl.Result{}, reconcile.TerminalError(err)
+		}
+	}
+
+	// Record the variant and Ignition version the config targets
+	header, err := render.ReadHeader(rawConfig)
+	if err == nil {
+		butaneConfig.Status.IgnitionVersion, err = render.IgnitionVersion(ignitionConfig)
+	}
+	if err != nil {
+		log.Error(err, "Error reading the Butane variant")
+		r.setReady(ctx, &butaneConfig, metav1.ConditionFalse, butanev1beta1.ReasonTranslationFailed, err.Error())
+		return ctrl.Result{}, reconcile.TerminalError(err)
+	}
+	butaneConfig.Status.Variant = header.Variant
+
+	// Enforce the operator policy, which the webhook cannot check for butaneFrom
+	policy := r.Config.Get().Policy
+	if err := errors.Join(policy.CheckVariant(header.Variant), policy.CheckEncryption(butaneConfig.Spec.Output.Encryption != nil)); err != nil {
+		log.Error(err, "ButaneConfig violates the operator policy")
+		r.Recorder.Eventf(&butaneConfig, nil, corev1.EventTypeWarning, "PolicyViolation", "PolicyViolation", "%v", err)
+		r.setReady(ctx, &butaneConfig, metav1.ConditionFalse, butanev1beta1.ReasonPolicyViolation, err.Error())
+		return ctrl.Result{}, reconcile.TerminalError(err)
+	}
+
+	// Lint the systemd units and the storage of the merged configuration
+	unitFindings, err := lint.Units(ignitionConfig)
+	var storageFindings []lint.Finding
+	if err == nil {
+		storageFindings, err = lint.Ignition(ignitionConfig)
+	}
+	if err != nil {
+		log.Error(err, "Error linting the Ignition config")
+		r.setReady(ctx, &butaneConfig, metav1.ConditionFalse, butanev1beta1.ReasonTranslationFailed, err.Error())
+		return ctrl.Result{}, reconcile.TerminalError(err)
+	}
+	storageFindings = append(conflicts, storageFindings...)
+	butaneConfig.Status.LintFindings = lintFindings(policy, unitFindings, storageFindings)
+	unitWarnings, err := policy.UnitLint.Apply("systemd units", unitFindings)
+	var storageWarnings []string
+	if err == nil {
+		storageWarnings, err = policy.IgnitionLint.Apply("Ignition storage", storageFindings)
+	}
+	if err != nil {
+		log.Error(err, "ButaneConfig violates the operator policy")
+		r.Recorder.Eventf(&butaneConfig, nil, corev1.EventTypeWarning, "PolicyViolation", "PolicyViolation", "%v", err)
+		r.setReady(ctx, &butaneConfig, metav1.ConditionFalse, butanev1beta1.ReasonPolicyViolation, err.Error())
+		return ctrl.Result{}, reconcile.TerminalError(err)
+	}
+	for _, warning := range unitWarnings {
+		r.Recorder.Eventf(&butaneConfig, nil, corev1.EventTypeWarning, "UnitLint", "UnitLint", "%s", warning)
+	}
+	for _, warning := range storageWarnings {
+		r.Recorder.Eventf(&butaneConfig, nil, corev1.EventTypeWarning, "IgnitionLint", "IgnitionLint", "%s", warning)
+	}
+
+	// Compress the Ignition configuration and spill large files out of it
+	ignitionConfig, spilled, err := r.fitOutput(ctx, &butaneConfig, ignitionConfig)
+	if err != nil {
+		log.Error(err, "Error reducing the size of the Ignition config")
+		r.Recorder.Eventf(&butaneConfig, nil, corev1.EventTypeWarning, "OutputTooLarge", "OutputTooLarge", "Failed to reduce the size of the Ignition config: %v", err)
+		r.setReady(ctx, &butaneConfig, metav1.ConditionFalse, butanev1beta1.ReasonOutputTooLarge, err.Error())
+		return ctrl.Result{}, err
+	}
+
+	// Apply the output settings, e.g. encryption, to the Ignition configuration
 	secretName := fmt.Sprintf("%s-ignition", butaneConfig.Name)
+	output, err := r.protectOutput(ctx, &butaneConfig, secretName, ignitionConfig)
+	if err != nil {
+		log.Error(err, "Error protecting Ignition config")
+		r.Recorder.Eventf(&butaneConfig, nil, corev1.EventTypeWarning, "EncryptionFailed", "EncryptionFailed", "Failed to encrypt the Ignition config: %v", err)
+		r.setReady(ctx, &butaneConfig, metav1.ConditionFalse, butanev1beta1.ReasonEncryptionFailed, err.Error())
+		return ctrl.Result{}, err
+	}
+
+	// Sign the Ignition configuration and its provenance
+	signatures, err := r.signOutput(ctx, &butaneConfig, secretName, output.userdata)
+	if err != nil {
+		log.Error(err, "Error signing Ignition config")
+		r.Recorder.Eventf(&butaneConfig, nil, corev1.EventTypeWarning, "SigningFailed", "SigningFailed", "Failed to sign the Ignition config: %v", err)
+		r.setReady(ctx, &butaneConfig, metav1.ConditionFalse, butanev1beta1.ReasonSigningFailed, err.Error())
+		return ctrl.Result{}, err
+	}
+
+	// Add the keys the tooling of the variant expects
+	variantData, err := r.variantOutput(&butaneConfig, header.Variant, rawConfig, output)
+	if err != nil {
+		log.Error(err, "Error translating ButaneConfig to MachineConfig")
+		r.setReady(ctx, &butaneConfig, metav1.ConditionFalse, butanev1beta1.ReasonTranslationFailed, err.Error())
+		return ctrl.Result{}, reconcile.TerminalError(err)
+	}
+
+	// Build the Secret containing the Ignition configuration
 	secret := &corev1.Secret{
 		ObjectMeta: metav1.ObjectMeta{
 			Name:      secretName,
 			Namespace: butaneConfig.Namespace,
 		},
 		Data: map[string][]byte{
-			"userdata": ignitionConfig,
+			butanev1beta1.KeyUserdata: output.userdata,
 		},
 	}
+	for key, value := range variantData {
+		secret.Data[key] = value
+	}
+	for key, value := range signatures {
+		secret.Data[key] = value
+	}
+	if output.mode != "" || len(policies) > 0 {
+		secret.Annotations = map[string]string{}
+	}
+	if output.mode != "" {
+		secret.Annotations[butanev1beta1.AnnotationEncryption] = string(output.mode)
+	}
+	if output.digest != "" {
+		secret.Annotations[butanev1beta1.AnnotationPlaintextDigest] = output.digest
+	}
+	if len(policies) > 0 {
+		secret.Annotations[butanev1beta1.AnnotationInjectionPolicies] = strings.Join(butaneConfig.Status.AppliedPolicies, ",")
+	}
 
-	// Set the owner reference to the ButaneConfig instance
-	if err := controllerutil.SetControllerReference(&butaneConfig, secret, r.Scheme); err != nil {
-		r.Recorder.Eventf(&butaneConfig, nil, corev1.EventTypeWarning, "SetOwnerReferenceFailed", "SetOwnerReferenceFailed", "Failed to set owner reference for the Secret")
+	// Enforce the size limit before anything is written
+	size, limit := secretDataSize(secret.Data), r.sizeLimit(&butaneConfig.Spec.Output)
+	if size > limit {
+		msg := fmt.Sprintf("Ignition secret data is %d bytes, over the limit of %d bytes; spill large files with spec.output.size.spill", size, limit)
+		log.Error(nil, msg)
+		r.Recorder.Eventf(&butaneConfig, nil, corev1.EventTypeWarning, "OutputTooLarge", "OutputTooLarge", msg)
+		meta.SetStatusCondition(&butaneConfig.Status.Conditions, metav1.Condition{
+			Type:               butanev1beta1.ConditionSizeWithinLimit,
+			Status:             metav1.ConditionFalse,
+			Reason:             butanev1beta1.ReasonOutputTooLarge,
+			Message:            msg,
+			ObservedGeneration: butaneConfig.Generation,
+		})
+		r.setReady(ctx, &butaneConfig, metav1.ConditionFalse, butanev1beta1.ReasonOutputTooLarge, msg)
+		return ctrl.Result{}, reconcile.TerminalError(errors.New(msg))
+	}
+	meta.SetStatusCondition(&butaneConfig.Status.Conditions, metav1.Condition{
+		Type:               butanev1beta1.ConditionSizeWithinLimit,
+		Status:             metav1.ConditionTrue,
+		Reason:             butanev1beta1.ReasonWithinLimit,
+		Message:            fmt.Sprintf("Ignition secret data is %d of %d bytes", size, limit),
+		ObservedGeneration: butaneConfig.Generation,
+	})
+
+	// Record whether applying the Secrets takes over fields from other managers
+	meta.SetStatusCondition(&butaneConfig.Status.Conditions, metav1.Condition{
+		Type:               butanev1beta1.ConditionSecretsOwned,
+		Status:             metav1.ConditionTrue,
+		Reason:             butanev1beta1.ReasonNoConflict,
+		Message:            "Secrets were applied without conflicts",
+		ObservedGeneration: butaneConfig.Generation,
+	})
+
+	// Store the spilled files before the Ignition configuration that references them
+	spilledSecretNames, err := r.writeSpilled(ctx, &butaneConfig, spilled)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	// Keep the Ignition the Secret holds as an earlier revision if it changes
+	if err := r.recordRevision(ctx, &butaneConfig, secret); err != nil {
+		return ctrl.Result{}, err
+	}
+	if err := r.writeSecret(ctx, &butaneConfig, secret); err != nil {
 		return ctrl.Result{}, err
 	}
 
-	// Create or update the Secret in the cluster
-	if err := r.Create(ctx, secret); err != nil {
-		if apierrors.IsAlreadyExists(err) {
-			if err := r.Update(ctx, secret); err != nil {
-				r.Recorder.Eventf(&butaneConfig, nil, corev1.EventTypeWarning, "SecretUpdateFailed", "SecretUpdateFailed", "Failed to update the Secret")
-				return ctrl.Result{}, err
-			}
-		} else {
-			r.Recorder.Eventf(&butaneConfig, nil, corev1.EventTypeWarning, "SecretCreateFailed", "SecretCreateFailed", "Failed to create the Secret")
+	// Store the contents moved out of the Ignition configuration, or remove
+	// them once they are not needed anymore
+	filesSecretName := ""
+	if output.files != nil {
+		filesSecretName = fmt.Sprintf("%s-ignition-files", butaneConfig.Name)
+		filesSecret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      filesSecretName,
+				Namespace: butaneConfig.Namespace,
+			},
+			Data: output.files,
+		}
+		if err := r.writeSecret(ctx, &butaneConfig, filesSecret); err != nil {
 			return ctrl.Result{}, err
 		}
+	} else if butaneConfig.Status.FilesSecretName != "" {
+		stale := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: butaneConfig.Status.FilesSecretName, Namespace: butaneConfig.Namespace}}
+		if err := r.Delete(ctx, stale); err != nil && !apierrors.IsNotFound(err) {
+			r.setReady(ctx, &butaneConfig, metav1.ConditionFalse, butanev1beta1.ReasonSecretWriteFailed, err.Error())
+			return ctrl.Result{}, err
+		}
+		metrics.SecretWrites.WithLabelValues("delete").Inc()
+	}
+
+	// Push the Ignition configuration to the OCI registry of spec.output.oci
+	if err := r.pushOutput(ctx, &butaneConfig, output, signatures); err != nil {
+		log.Error(err, "Error pushing Ignition config")
+		r.Recorder.Eventf(&butaneConfig, nil, corev1.EventTypeWarning, "OCIPushFailed", "OCIPushFailed", "Failed to push the Ignition config: %v", err)
+		r.setReady(ctx, &butaneConfig, metav1.ConditionFalse, butanev1beta1.ReasonOCIPushFailed, err.Error())
+		return ctrl.Result{}, err
+	}
+
+	// Upload the Ignition configuration to the object storage of spec.output.s3
+	renewal, err := r.uploadOutput(ctx, &butaneConfig, output)
+	if err != nil {
+		log.Error(err, "Error uploading Ignition config")
+		r.Recorder.Eventf(&butaneConfig, nil, corev1.EventTypeWarning, "S3UploadFailed", "S3UploadFailed", "Failed to upload the Ignition config: %v", err)
+		r.setReady(ctx, &butaneConfig, metav1.ConditionFalse, butanev1beta1.ReasonS3UploadFailed, err.Error())
+		return ctrl.Result{}, err
 	}
 
 	// Update the status of ButaneConfig
 	butaneConfig.Status.SecretName = secretName
+	butaneConfig.Status.FilesSecretName = filesSecretName
+	butaneConfig.Status.SpilledSecretNames = spilledSecretNames
+	meta.SetStatusCondition(&butaneConfig.Status.Conditions, metav1.Condition{
+		Type:               butanev1beta1.ConditionReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             butanev1beta1.ReasonReconciled,
+		Message:            "Ignition secret is up to date",
+		ObservedGeneration: butaneConfig.Generation,
+	})
 	if err := r.Status().Update(ctx, &butaneConfig); err != nil {
 		r.Recorder.Eventf(&butaneConfig, nil, corev1.EventTypeWarning, "StatusUpdateFailed", "StatusUpdateFailed", "Failed to update ButaneConfig status")
 		return ctrl.Result{}, err
@@ -119,13 +464,174 @@ func (r *ButaneConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request
 	log.Info("Successfully processed ButaneConfig", "secretName", secretName)
 	r.Recorder.Eventf(&butaneConfig, nil, corev1.EventTypeNormal, "ReconciliationSucceeded", "ReconciliationSucceeded", "Successfully reconciled ButaneConfig")
 
-	return ctrl.Result{}, nil
+	// Renew the pre-signed URL of the pointer config before it expires
+	return ctrl.Result{RequeueAfter: renewal}, nil
+}
+
+// writeSecret applies a Secret owned by the ButaneConfig with server-side
+// apply, so that only the fields the operator sets are managed and the labels
+// and annotations other tools add are kept. Fields another manager changed are
+// taken over, and the conflict is recorded on the SecretsOwned condition.
+// Failures are recorded on the Ready condition.
+func (r *ButaneConfigReconciler) writeSecret(ctx context.Context, bc *butanev1beta1.ButaneConfig, secret *corev1.Secret) error {
+	// Set the owner reference to the ButaneConfig instance
+	if err := controllerutil.SetControllerReference(bc, secret, r.Scheme); err != nil {
+		r.Recorder.Eventf(bc, nil, corev1.EventTypeWarning, "SetOwnerReferenceFailed", "SetOwnerReferenceFailed", "Failed to set owner reference for the Secret")
+		return err
+	}
+
+	if err := r.upgradeFieldOwnership(ctx, secret); err != nil {
+		r.setReady(ctx, bc, metav1.ConditionFalse, butanev1beta1.ReasonSecretWriteFailed, err.Error())
+		return err
+	}
+	err := r.Apply(ctx, secretApplyConfiguration(secret), client.FieldOwner(FieldManager))
+	if apierrors.IsConflict(err) {
+		r.Recorder.Eventf(bc, nil, corev1.EventTypeWarning, "SecretConflict", "SecretConflict", "Overwriting fields of Secret %s changed by other field managers: %v", secret.Name, err)
+		recordConflict(bc, secret.Name, err)
+		err = r.Apply(ctx, secretApplyConfiguration(secret), client.FieldOwner(FieldManager), client.ForceOwnership)
+	}
+	if err != nil {
+		r.Recorder.Eventf(bc, nil, corev1.EventTypeWarning, "SecretApplyFailed", "SecretApplyFailed", "Failed to apply the Secret")
+		r.setReady(ctx, bc, metav1.ConditionFalse, butanev1beta1.ReasonSecretWriteFailed, err.Error())
+		return err
+	}
+	metrics.SecretWrites.WithLabelValues("apply").Inc()
+	return nil
+}
+
+// secretApplyConfiguration returns the apply configuration of the fields the
+// operator sets on a Secret.
+func secretApplyConfiguration(secret *corev1.Secret) *corev1ac.SecretApplyConfiguration {
+	ac := corev1ac.Secret(secret.Name, secret.Namespace).
+		WithData(secret.Data)
+	if len(secret.Labels) > 0 {
+		ac.WithLabels(secret.Labels)
+	}
+	if len(secret.Annotations) > 0 {
+		ac.WithAnnotations(secret.Annotations)
+	}
+	for _, ref := range secret.OwnerReferences {
+		owner := metav1ac.OwnerReference().
+			WithAPIVersion(ref.APIVersion).
+			WithKind(ref.Kind).
+			WithName(ref.Name).
+			WithUID(ref.UID)
+		if ref.Controller != nil {
+			owner.WithController(*ref.Controller)
+		}
+		if ref.BlockOwnerDeletion != nil {
+			owner.WithBlockOwnerDeletion(*ref.BlockOwnerDeletion)
+		}
+		ac.WithOwnerReferences(owner)
+	}
+	return ac
+}
+
+// upgradeFieldOwnership hands the fields of a Secret written by the operator
+// before it applied Secrets server-side, with Create and Update under
+// legacyFieldManager, over to FieldManager. The first apply then neither
+// reports the operator's own fields as a conflict nor keeps the keys it does
+// not write anymore.
+func (r *ButaneConfigReconciler) upgradeFieldOwnership(ctx context.Context, secret *corev1.Secret) error {
+	var current corev1.Secret
+	if err := r.Get(ctx, client.ObjectKeyFromObject(secret), &current); err != nil {
+		return client.IgnoreNotFound(err)
+	}
+	patch, err := csaupgrade.UpgradeManagedFieldsPatch(&current, sets.New(legacyFieldManager), FieldManager)
+	if err != nil || patch == nil {
+		return err
+	}
+	return r.Patch(ctx, &current, client.RawPatch(types.JSONPatchType, patch))
+}
+
+// recordConflict adds a Secret whose fields were taken over to the
+// SecretsOwned condition, which Reconcile resets before writing the Secrets.
+func recordConflict(bc *butanev1beta1.ButaneConfig, name string, err error) {
+	msg := fmt.Sprintf("overwrote fields of Secret %s: %v", name, err)
+	if c := meta.FindStatusCondition(bc.Status.Conditions, butanev1beta1.ConditionSecretsOwned); c != nil && c.Status == metav1.ConditionFalse {
+		msg = c.Message + "; " + msg
+	}
+	meta.SetStatusCondition(&bc.Status.Conditions, metav1.Condition{
+		Type:               butanev1beta1.ConditionSecretsOwned,
+		Status:             metav1.ConditionFalse,
+		Reason:             butanev1beta1.ReasonFieldConflict,
+		Message:            msg,
+		ObservedGeneration: bc.Generation,
+	})
+}
+
+// setReady records the Ready condition on a failure path. Errors are only logged
+// since the caller is already returning the error that caused the failure.
+func (r *ButaneConfigReconciler) setReady(ctx context.Context, bc *butanev1beta1.ButaneConfig, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&bc.Status.Conditions, metav1.Condition{
+		Type:               butanev1beta1.ConditionReady,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: bc.Generation,
+	})
+	if err := r.Status().Update(ctx, bc); err != nil {
+		r.Log.Error(err, "Failed to update ButaneConfig status", "butaneconfig", client.ObjectKeyFromObject(bc))
+	}
+}
+
+// translationMessage summarizes a failed translation for the Ready condition.
+func translationMessage(rpt report.Report, err error) string {
+	if len(rpt.Entries) > 0 {
+		return strings.TrimSpace(rpt.String())
+	}
+	if err != nil {
+		return err.Error()
+	}
+	return "translation failed"
 }
 
+// butaneConfigChanged filters the ButaneConfig updates that can change the
+// rendered Ignition.
+var butaneConfigChanged = predicate.Or(predicate.GenerationChangedPredicate{}, predicate.LabelChangedPredicate{})
+
+// referenceableSecret filters out the Secrets generated for ButaneConfigs,
+// which no ButaneConfig reads, so that writing them does not list the
+// ButaneConfigs of their namespace.
+var referenceableSecret = predicate.NewPredicateFuncs(func(obj client.Object) bool { return !generatedSecret(obj) })
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *ButaneConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	r.Recorder = mgr.GetEventRecorder("butaneconfig-controller")
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&butanev1alpha1.ButaneConfig{}).
-		Complete(r)
+	b := ctrl.NewControllerManagedBy(mgr).
+		// Status updates do not change the generation, so a config that
+		// failed terminally is only reconciled again once its spec or labels
+		// change or an object it references does. Labels select the
+		// injection policies that apply to the config.
+		For(&butanev1beta1.ButaneConfig{}, builder.WithPredicates(butaneConfigChanged)).
+		// Restore the generated Secrets when they are edited or deleted
+		Owns(&corev1.Secret{}).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.configsReferencing)).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.configsReferencing),
+			builder.WithPredicates(referenceableSecret)).
+		Watches(&butanev1beta1.ClusterButaneConfig{}, handler.EnqueueRequestsFromMapFunc(r.configsMerging),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&butanev1beta1.ButaneInjectionPolicy{}, handler.EnqueueRequestsFromMapFunc(r.configsInjected),
+			builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&corev1.Namespace{}, handler.EnqueueRequestsFromMapFunc(r.configsInNamespace),
+			builder.WithPredicates(predicate.LabelChangedPredicate{})).
+		WithOptions(controller.Options{
+			MaxConcurrentReconciles: r.MaxConcurrentReconciles,
+			RateLimiter:             r.RateLimiter,
+		})
+	if r.Directory != nil {
+		b = b.WatchesRawSource(source.Channel(r.Directory.Events(),
+			handler.TypedEnqueueRequestsFromMapFunc(r.configsUsingDirectory)))
+	}
+	return b.Complete(r)
+}
+
+// NewRateLimiter returns a rate limiter that retries each ButaneConfig with an
+// exponential backoff between baseDelay and maxDelay, while capping the overall
+// retry rate at qps with bursts of burst.
+func NewRateLimiter(baseDelay, maxDelay time.Duration, qps float64, burst int) workqueue.TypedRateLimiter[reconcile.Request] {
+	return workqueue.NewTypedMaxOfRateLimiter(
+		workqueue.NewTypedItemExponentialFailureRateLimiter[reconcile.Request](baseDelay, maxDelay),
+		&workqueue.TypedBucketRateLimiter[reconcile.Request]{Limiter: rate.NewLimiter(rate.Limit(qps), burst)},
+	)
 }
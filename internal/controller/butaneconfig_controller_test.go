@@ -17,22 +17,52 @@ limitations under the License.
 package controller
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/pem"
+	goerrors "errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
 
+	"filippo.io/age"
+	"filippo.io/age/armor"
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
 	. "github.com/onsi/ginkgo/v2"
 	. "github.com/onsi/gomega"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	apiresource "k8s.io/apimachinery/pkg/api/resource"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/tools/events"
+	"k8s.io/utils/ptr"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/event"
 	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
-	butanev1alpha1 "github.com/naval-group/butane-operator/api/v1alpha1"
+	butanev1beta1 "github.com/naval-group/butane-operator/api/v1beta1"
+	"github.com/naval-group/butane-operator/internal/images"
+	"github.com/naval-group/butane-operator/internal/operatorconfig"
+	"github.com/naval-group/butane-operator/internal/render"
+	"github.com/naval-group/butane-operator/internal/signing"
 )
 
 var _ = Describe("ButaneConfig Controller", func() {
@@ -45,7 +75,7 @@ var _ = Describe("ButaneConfig Controller", func() {
 			Name:      resourceName,
 			Namespace: "default",
 		}
-		butaneconfig := &butanev1alpha1.ButaneConfig{}
+		butaneconfig := &butanev1beta1.ButaneConfig{}
 
 		BeforeEach(func() {
 			By("creating the custom resource for the Kind ButaneConfig")
@@ -72,13 +102,13 @@ var _ = Describe("ButaneConfig Controller", func() {
 				configJSON, err := json.Marshal(butaneConfig)
 				Expect(err).NotTo(HaveOccurred())
 
-				resource := &butanev1alpha1.ButaneConfig{
+				resource := &butanev1beta1.ButaneConfig{
 					ObjectMeta: metav1.ObjectMeta{
 						Name:      resourceName,
 						Namespace: "default",
 					},
-					Spec: butanev1alpha1.ButaneConfigSpec{
-						Config: runtime.RawExtension{
+					Spec: butanev1beta1.ButaneConfigSpec{
+						Config: &runtime.RawExtension{
 							Raw: configJSON,
 						},
 					},
@@ -89,8 +119,12 @@ var _ = Describe("ButaneConfig Controller", func() {
 
 		AfterEach(func() {
 			// TODO(user): Cleanup logic after each test, like removing the resource instance.
-			resource := &butanev1alpha1.ButaneConfig{}
+			resource := &butanev1beta1.ButaneConfig{}
 			err := k8sClient.Get(ctx, typeNamespacedName, resource)
+			if errors.IsNotFound(err) {
+				// Deleted by the test already
+				return
+			}
 			Expect(err).NotTo(HaveOccurred())
 
 			By("Cleanup the specific resource instance ButaneConfig")
@@ -158,10 +192,945 @@ var _ = Describe("ButaneConfig Controller", func() {
 			Expect(contents).To(HaveKey("source"), "Contents should have source (base64 data URL)")
 
 			By("Checking if the ButaneConfig status was updated")
-			updatedButaneConfig := &butanev1alpha1.ButaneConfig{}
+			updatedButaneConfig := &butanev1beta1.ButaneConfig{}
 			err = k8sClient.Get(ctx, typeNamespacedName, updatedButaneConfig)
 			Expect(err).NotTo(HaveOccurred())
 			Expect(updatedButaneConfig.Status.SecretName).To(Equal(secretName))
+			ready := meta.FindStatusCondition(updatedButaneConfig.Status.Conditions, butanev1beta1.ConditionReady)
+			Expect(ready).NotTo(BeNil(), "Ready condition should be set")
+			Expect(ready.Status).To(Equal(metav1.ConditionTrue))
+		})
+
+		It("should apply the Secret without dropping the fields of other managers", func() {
+			recorder := events.NewFakeRecorder(100)
+			controllerReconciler := &ButaneConfigReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Log:      ctrl.Log.WithName("controllers").WithName("ButaneConfig"),
+				Recorder: recorder,
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Labelling the Secret and editing its data as another manager")
+			secret := &corev1.Secret{}
+			secretKey := types.NamespacedName{Name: resourceName + "-ignition", Namespace: "default"}
+			Expect(k8sClient.Get(ctx, secretKey, secret)).To(Succeed())
+			userdata := secret.Data["userdata"]
+			secret.Labels = map[string]string{"velero.io/backup-name": "nightly"}
+			secret.Data["userdata"] = []byte("{}")
+			Expect(k8sClient.Update(ctx, secret, client.FieldOwner("kubectl-edit"))).To(Succeed())
+
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Checking the label is kept and the data is restored")
+			Expect(k8sClient.Get(ctx, secretKey, secret)).To(Succeed())
+			Expect(secret.Labels).To(HaveKeyWithValue("velero.io/backup-name", "nightly"))
+			Expect(secret.Data["userdata"]).To(Equal(userdata))
+
+			By("Checking the conflict is reported")
+			updated := &butanev1beta1.ButaneConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, updated)).To(Succeed())
+			owned := meta.FindStatusCondition(updated.Status.Conditions, butanev1beta1.ConditionSecretsOwned)
+			Expect(owned).NotTo(BeNil())
+			Expect(owned.Status).To(Equal(metav1.ConditionFalse))
+			Expect(owned.Reason).To(Equal(butanev1beta1.ReasonFieldConflict))
+			Expect(owned.Message).To(ContainSubstring("kubectl-edit"))
+			Eventually(recorder.Events).Should(Receive(ContainSubstring("SecretConflict")))
+			Expect(secret.ManagedFields).To(ContainElement(And(
+				HaveField("Manager", FieldManager),
+				HaveField("Operation", metav1.ManagedFieldsOperationApply),
+				HaveField("FieldsV1.Raw", ContainSubstring(`"f:userdata"`)),
+			)))
+
+			By("Reconciling again without conflicts")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, updated)).To(Succeed())
+			owned = meta.FindStatusCondition(updated.Status.Conditions, butanev1beta1.ConditionSecretsOwned)
+			Expect(owned.Status).To(Equal(metav1.ConditionTrue))
+		})
+
+		It("should take over the fields the operator wrote before applying Secrets", func() {
+			By("Writing the Secret with Update, as earlier versions of the operator did")
+			resource := &butanev1beta1.ButaneConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			secret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: resourceName + "-ignition", Namespace: "default"},
+				Data:       map[string][]byte{"userdata": []byte("{}"), "stale": []byte("removed since")},
+			}
+			Expect(controllerutil.SetControllerReference(resource, secret, k8sClient.Scheme())).To(Succeed())
+			Expect(k8sClient.Create(ctx, secret, client.FieldOwner(legacyFieldManager))).To(Succeed())
+
+			recorder := events.NewFakeRecorder(100)
+			controllerReconciler := &ButaneConfigReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Log:      ctrl.Log.WithName("controllers").WithName("ButaneConfig"),
+				Recorder: recorder,
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Checking the fields were taken over without a conflict")
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(secret), secret)).To(Succeed())
+			Expect(secret.Data).NotTo(HaveKey("stale"))
+			Expect(string(secret.Data["userdata"])).To(ContainSubstring(`"ignition"`))
+			Expect(secret.ManagedFields).NotTo(ContainElement(HaveField("Manager", legacyFieldManager)))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			owned := meta.FindStatusCondition(resource.Status.Conditions, butanev1beta1.ConditionSecretsOwned)
+			Expect(owned).NotTo(BeNil())
+			Expect(owned.Status).To(Equal(metav1.ConditionTrue))
+			Consistently(recorder.Events).ShouldNot(Receive(ContainSubstring("SecretConflict")))
+		})
+
+		It("should refuse configs the operator policy does not allow", func() {
+			cfg := operatorconfig.Default()
+			cfg.Policy.AllowedVariants = []string{"flatcar"}
+			controllerReconciler := &ButaneConfigReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Log:      ctrl.Log.WithName("controllers").WithName("ButaneConfig"),
+				Recorder: events.NewFakeRecorder(100),
+				Config:   operatorconfig.NewStore(cfg),
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).To(MatchError(ContainSubstring(`variant "fcos" is not allowed`)))
+			Expect(goerrors.Is(err, reconcile.TerminalError(nil))).To(BeTrue())
+
+			updated := &butanev1beta1.ButaneConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, updated)).To(Succeed())
+			ready := meta.FindStatusCondition(updated.Status.Conditions, butanev1beta1.ConditionReady)
+			Expect(ready).NotTo(BeNil())
+			Expect(ready.Reason).To(Equal(butanev1beta1.ReasonPolicyViolation))
+		})
+
+		It("should lint the systemd units of the merged config", func() {
+			resource := &butanev1beta1.ButaneConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.Config = nil
+			resource.Spec.Butane = "variant: fcos\nversion: 1.5.0\nsystemd:\n  units:\n    - name: app.service\n" +
+				"      contents: |\n        [Service]\n        ExecStart=/usr/bin/app\n        RestartSecs=5\n"
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			recorder := events.NewFakeRecorder(100)
+			controllerReconciler := &ButaneConfigReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Log:      ctrl.Log.WithName("controllers").WithName("ButaneConfig"),
+				Recorder: recorder,
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Eventually(recorder.Events).Should(Receive(ContainSubstring("unknown directive RestartSecs in [Service]")))
+
+			By("Rejecting them when the operator policy says so")
+			cfg := operatorconfig.Default()
+			cfg.Policy.UnitLint = operatorconfig.LintReject
+			controllerReconciler.Config = operatorconfig.NewStore(cfg)
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(goerrors.Is(err, reconcile.TerminalError(nil))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			ready := meta.FindStatusCondition(resource.Status.Conditions, butanev1beta1.ConditionReady)
+			Expect(ready).NotTo(BeNil())
+			Expect(ready.Reason).To(Equal(butanev1beta1.ReasonPolicyViolation))
+		})
+
+		It("should encrypt the Ignition output to age recipients", func() {
+			By("Creating the recipients ConfigMap")
+			identity, err := age.GenerateX25519Identity()
+			Expect(err).NotTo(HaveOccurred())
+			recipients := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "age-recipients", Namespace: "default"},
+				Data:       map[string]string{"recipients.txt": "# ops team\n" + identity.Recipient().String() + "\n"},
+			}
+			Expect(k8sClient.Create(ctx, recipients)).To(Succeed())
+			DeferCleanup(func() { Expect(k8sClient.Delete(ctx, recipients)).To(Succeed()) })
+
+			By("Enabling age encryption on the resource")
+			resource := &butanev1beta1.ButaneConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.Output = butanev1beta1.OutputSpec{
+				Encryption: &butanev1beta1.EncryptionSpec{
+					Mode: butanev1beta1.EncryptionModeAge,
+					RecipientsRef: &corev1.ConfigMapKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "age-recipients"},
+						Key:                  "recipients.txt",
+					},
+				},
+			}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			controllerReconciler := &ButaneConfigReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Log:      ctrl.Log.WithName("controllers").WithName("ButaneConfig"),
+				Recorder: events.NewFakeRecorder(100),
+			}
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Verifying the Secret only holds the encrypted Ignition")
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-ignition", Namespace: "default"}, secret)).To(Succeed())
+			Expect(secret.Annotations).To(HaveKeyWithValue(butanev1beta1.AnnotationEncryption, "age"))
+			Expect(string(secret.Data["userdata"])).To(HavePrefix("-----BEGIN AGE ENCRYPTED FILE-----"))
+			Expect(string(secret.Data["userdata"])).NotTo(ContainSubstring("/etc/hostname"))
+
+			By("Decrypting it with the consumer-side identity")
+			r, err := age.Decrypt(armor.NewReader(bytes.NewReader(secret.Data["userdata"])), identity)
+			Expect(err).NotTo(HaveOccurred())
+			plaintext, err := io.ReadAll(r)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(string(plaintext)).To(ContainSubstring("/etc/hostname"))
+
+			By("Keeping the ciphertext while the plaintext and recipients do not change")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			unchanged := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(secret), unchanged)).To(Succeed())
+			Expect(unchanged.ResourceVersion).To(Equal(secret.ResourceVersion))
+			Expect(unchanged.Data["userdata"]).To(Equal(secret.Data["userdata"]))
+
+			By("Encrypting again once the recipients change")
+			other, err := age.GenerateX25519Identity()
+			Expect(err).NotTo(HaveOccurred())
+			recipients.Data["recipients.txt"] += other.Recipient().String() + "\n"
+			Expect(k8sClient.Update(ctx, recipients)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(secret), unchanged)).To(Succeed())
+			Expect(unchanged.Data["userdata"]).NotTo(Equal(secret.Data["userdata"]))
+		})
+
+		It("should keep the earlier revisions of the Ignition", func() {
+			controllerReconciler := &ButaneConfigReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Log:      ctrl.Log.WithName("controllers").WithName("ButaneConfig"),
+				Recorder: events.NewFakeRecorder(100),
+			}
+			secretKey := types.NamespacedName{Name: resourceName + "-ignition", Namespace: "default"}
+			render := func(motd string) (*corev1.Secret, int) {
+				resource := &butanev1beta1.ButaneConfig{}
+				Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+				resource.Spec.Output.RevisionHistoryLimit = ptr.To[int32](1)
+				resource.Spec.Config = &runtime.RawExtension{Raw: []byte(`{"variant":"fcos","version":"1.5.0","storage":{"files":[{"path":"/etc/motd","contents":{"inline":"` + motd + `"}}]}}`)}
+				Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+				Expect(err).NotTo(HaveOccurred())
+
+				secret := &corev1.Secret{}
+				Expect(k8sClient.Get(ctx, secretKey, secret)).To(Succeed())
+				revision, err := strconv.Atoi(secret.Annotations[butanev1beta1.AnnotationRevision])
+				Expect(err).NotTo(HaveOccurred())
+				return secret, revision
+			}
+			kept := func() []string {
+				var list corev1.SecretList
+				Expect(k8sClient.List(ctx, &list, client.InNamespace("default"), client.MatchingLabels{butanev1beta1.LabelRevisionOf: resourceName})).To(Succeed())
+				var names []string
+				for _, secret := range list.Items {
+					if secret.DeletionTimestamp == nil {
+						names = append(names, secret.Name)
+					}
+				}
+				return names
+			}
+
+			By("Rendering a first revision")
+			first, revision := render("first")
+
+			By("Keeping it once the Ignition changes")
+			second, next := render("second")
+			Expect(next).To(Equal(revision + 1))
+			kept1 := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: RevisionSecretName(secretKey.Name, revision), Namespace: "default"}, kept1)).To(Succeed())
+			Expect(kept1.Data["userdata"]).To(Equal(first.Data["userdata"]))
+			Expect(kept1.Annotations).To(HaveKeyWithValue(butanev1beta1.AnnotationRevision, strconv.Itoa(revision)))
+
+			By("Keeping the revision while the Ignition does not change")
+			unchanged, same := render("second")
+			Expect(same).To(Equal(next))
+			Expect(unchanged.ResourceVersion).To(Equal(second.ResourceVersion))
+
+			By("Deleting the revisions past the limit")
+			_, last := render("third")
+			Expect(last).To(Equal(revision + 2))
+			Expect(kept()).To(ConsistOf(RevisionSecretName(secretKey.Name, revision+1)))
+		})
+
+		It("should sign the Ignition output and its provenance", func() {
+			By("Creating the signing key Secret")
+			_, key, err := ed25519.GenerateKey(rand.Reader)
+			Expect(err).NotTo(HaveOccurred())
+			der, err := x509.MarshalPKCS8PrivateKey(key)
+			Expect(err).NotTo(HaveOccurred())
+			keySecret := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "signing-key", Namespace: "default"},
+				Data:       map[string][]byte{"key.pem": pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})},
+			}
+			Expect(k8sClient.Create(ctx, keySecret)).To(Succeed())
+			DeferCleanup(func() { Expect(k8sClient.Delete(ctx, keySecret)).To(Succeed()) })
+
+			By("Enabling signing on the resource")
+			resource := &butanev1beta1.ButaneConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.Output = butanev1beta1.OutputSpec{
+				Signing: &butanev1beta1.SigningSpec{
+					KeySecretRef: corev1.SecretKeySelector{
+						LocalObjectReference: corev1.LocalObjectReference{Name: "signing-key"},
+						Key:                  "key.pem",
+					},
+				},
+			}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			controllerReconciler := &ButaneConfigReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Log:      ctrl.Log.WithName("controllers").WithName("ButaneConfig"),
+				Recorder: events.NewFakeRecorder(100),
+			}
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			By("Verifying the signature and provenance with the public key")
+			secretKey := types.NamespacedName{Name: resourceName + "-ignition", Namespace: "default"}
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, secretKey, secret)).To(Succeed())
+			provenance, err := signing.VerifyOutput(key.Public(), secret.Data["userdata"], signing.Artifacts{
+				Signature:           secret.Data[signing.SignatureKey],
+				Provenance:          secret.Data[signing.ProvenanceKey],
+				ProvenanceSignature: secret.Data[signing.ProvenanceSignatureKey],
+			})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(provenance.Subject.UID).To(Equal(string(resource.UID)))
+			Expect(provenance.Subject.Generation).To(Equal(resource.Generation))
+
+			By("Keeping the provenance when nothing changed")
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			again := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, secretKey, again)).To(Succeed())
+			Expect(again.Data[signing.ProvenanceKey]).To(Equal(secret.Data[signing.ProvenanceKey]))
+		})
+
+		It("should apply the translation options", func() {
+			By("Adding a key Butane warns about, which only rawConfig keeps")
+			resource := &butanev1beta1.ButaneConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.Config = nil
+			resource.Spec.RawConfig = &runtime.RawExtension{Raw: []byte(`{"variant":"fcos","version":"1.5.0","storage":{"files":[{"path":"/etc/hostname","unknown":true}]}}`)}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			controllerReconciler := &ButaneConfigReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Log:      ctrl.Log.WithName("controllers").WithName("ButaneConfig"),
+				Recorder: events.NewFakeRecorder(100),
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).To(HaveOccurred(), "warnings should fail a strict translation")
+
+			By("Allowing warnings and pretty printing the output")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.Translation = butanev1beta1.TranslationSpec{Strict: ptr.To(false), Pretty: true}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-ignition", Namespace: "default"}, secret)).To(Succeed())
+			Expect(string(secret.Data["userdata"])).To(ContainSubstring("\n  \"ignition\""))
+		})
+
+		It("should render the Butane text of a ConfigMap", func() {
+			By("Creating the ConfigMap")
+			cm := &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "butane-source", Namespace: "default"},
+				Data:       map[string]string{"config.bu": "variant: fcos\nversion: 1.5.0\nstorage:\n  files:\n    - path: /etc/from-configmap\n      mode: 0644\n"},
+			}
+			Expect(k8sClient.Create(ctx, cm)).To(Succeed())
+			DeferCleanup(func() { Expect(k8sClient.Delete(ctx, cm)).To(Succeed()) })
+
+			By("Pointing the resource at it")
+			resource := &butanev1beta1.ButaneConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.Config = nil
+			resource.Spec.ButaneFrom = &corev1.ConfigMapKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "butane-source"},
+				Key:                  "config.bu",
+			}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+			Expect(referencesObject(resource, cm)).To(BeTrue())
+
+			controllerReconciler := &ButaneConfigReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Log:      ctrl.Log.WithName("controllers").WithName("ButaneConfig"),
+				Recorder: events.NewFakeRecorder(100),
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-ignition", Namespace: "default"}, secret)).To(Succeed())
+			Expect(string(secret.Data["userdata"])).To(ContainSubstring(`"path":"/etc/from-configmap"`))
+			Expect(string(secret.Data["userdata"])).To(ContainSubstring(`"mode":420`))
+
+			By("Reporting a missing key")
+			resource.Spec.ButaneFrom.Key = "missing.bu"
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).To(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			ready := meta.FindStatusCondition(resource.Status.Conditions, butanev1beta1.ConditionReady)
+			Expect(ready).NotTo(BeNil())
+			Expect(ready.Reason).To(Equal(butanev1beta1.ReasonSourceUnavailable))
+		})
+
+		It("should ignore the generated Secrets when watching and selecting Secrets", func() {
+			resource := &butanev1beta1.ButaneConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.Users = []butanev1beta1.UserSpec{{
+				Name: "core",
+				SSHAuthorizedKeysFrom: []butanev1beta1.SSHAuthorizedKeysSource{{
+					SecretSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"ssh-keys/core": "true"}},
+				}},
+			}}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			By("Creating a labeled Secret controlled by the ButaneConfig")
+			generated := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "generated-keys", Namespace: "default", Labels: map[string]string{"ssh-keys/core": "true"}},
+				StringData: map[string]string{"authorized_keys": "ssh-ed25519 AAAAgenerated generated\n"},
+			}
+			Expect(controllerutil.SetControllerReference(resource, generated, k8sClient.Scheme())).To(Succeed())
+			Expect(k8sClient.Create(ctx, generated)).To(Succeed())
+			DeferCleanup(func() { Expect(k8sClient.Delete(ctx, generated)).To(Succeed()) })
+			Expect(referenceableSecret.Create(event.CreateEvent{Object: generated})).To(BeFalse())
+			Expect(referenceableSecret.Update(event.UpdateEvent{ObjectOld: generated, ObjectNew: generated})).To(BeFalse())
+
+			keys := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "alice-keys", Namespace: "default"}}
+			Expect(referenceableSecret.Create(event.CreateEvent{Object: keys})).To(BeTrue())
+
+			controllerReconciler := &ButaneConfigReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Log:      ctrl.Log.WithName("controllers").WithName("ButaneConfig"),
+				Recorder: events.NewFakeRecorder(100),
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-ignition", Namespace: "default"}, secret)).To(Succeed())
+			Expect(string(secret.Data["userdata"])).NotTo(ContainSubstring("AAAAgenerated"))
+		})
+
+		It("should add the SSH authorized keys of labeled Secrets to the users", func() {
+			By("Creating a labeled key Secret")
+			keys := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "alice-keys", Namespace: "default", Labels: map[string]string{"ssh-keys/core": "true"}},
+				StringData: map[string]string{"authorized_keys": "ssh-ed25519 AAAAalice alice@laptop\n"},
+			}
+			Expect(k8sClient.Create(ctx, keys)).To(Succeed())
+			DeferCleanup(func() { Expect(k8sClient.Delete(ctx, keys)).To(Succeed()) })
+
+			By("Selecting it from spec.users")
+			resource := &butanev1beta1.ButaneConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.Users = []butanev1beta1.UserSpec{{
+				Name: "core",
+				SSHAuthorizedKeysFrom: []butanev1beta1.SSHAuthorizedKeysSource{{
+					SecretSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"ssh-keys/core": "true"}},
+				}},
+			}}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+			Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(keys), keys)).To(Succeed())
+			Expect(referencesObject(resource, keys)).To(BeTrue())
+
+			controllerReconciler := &ButaneConfigReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Log:      ctrl.Log.WithName("controllers").WithName("ButaneConfig"),
+				Recorder: events.NewFakeRecorder(100),
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-ignition", Namespace: "default"}, secret)).To(Succeed())
+			Expect(string(secret.Data["userdata"])).To(ContainSubstring("ssh-ed25519 AAAAalice alice@laptop"))
+
+			By("Revoking the key by removing the label")
+			keys.Labels = nil
+			Expect(k8sClient.Update(ctx, keys)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-ignition", Namespace: "default"}, secret)).To(Succeed())
+			Expect(string(secret.Data["userdata"])).NotTo(ContainSubstring("AAAAalice"))
+
+			By("Hashing the password of a Secret")
+			password := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "core-password", Namespace: "default"},
+				StringData: map[string]string{"password": "hunter2\n"},
+			}
+			Expect(k8sClient.Create(ctx, password)).To(Succeed())
+			DeferCleanup(func() { Expect(k8sClient.Delete(ctx, password)).To(Succeed()) })
+			resource.Spec.Users[0].PasswordFrom = &corev1.SecretKeySelector{
+				LocalObjectReference: corev1.LocalObjectReference{Name: "core-password"}, Key: "password",
+			}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+			Expect(referencesObject(resource, password)).To(BeTrue())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-ignition", Namespace: "default"}, secret)).To(Succeed())
+			Expect(string(secret.Data["userdata"])).To(ContainSubstring(`"passwordHash":"$6$`))
+			Expect(string(secret.Data["userdata"])).NotTo(ContainSubstring("hunter2"))
+
+			By("Failing the users reading keys from a missing user directory")
+			resource.Spec.Users[0].SSHAuthorizedKeysFrom = []butanev1beta1.SSHAuthorizedKeysSource{{Directory: true}}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(goerrors.Is(err, reconcile.TerminalError(nil))).To(BeTrue())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			ready := meta.FindStatusCondition(resource.Status.Conditions, butanev1beta1.ConditionReady)
+			Expect(ready).NotTo(BeNil())
+			Expect(ready.Reason).To(Equal(butanev1beta1.ReasonUserKeysUnavailable))
+		})
+
+		It("should pin the container images to their digests", func() {
+			digest := "sha256:" + strings.Repeat("ab", 32)
+			var requests int
+			registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if r.URL.Path != "/v2/team/web/manifests/v1" {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Header().Set("Docker-Content-Digest", digest)
+			}))
+			DeferCleanup(registry.Close)
+			host := strings.TrimPrefix(registry.URL, "http://")
+
+			resource := &butanev1beta1.ButaneConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.Config = nil
+			resource.Spec.Butane = "variant: fcos\nversion: 1.5.0\nsystemd:\n  units:\n    - name: web.service\n" +
+				"      contents: |\n        [Service]\n        ExecStart=/usr/bin/podman run --rm -p 80:80 " + host + "/team/web:v1\n"
+			resource.Spec.Images.Pin = true
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			controllerReconciler := &ButaneConfigReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Log:      ctrl.Log.WithName("controllers").WithName("ButaneConfig"),
+				Recorder: events.NewFakeRecorder(100),
+				Images:   &images.Resolver{PlainHTTP: []string{host}},
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-ignition", Namespace: "default"}, secret)).To(Succeed())
+			Expect(string(secret.Data["userdata"])).To(ContainSubstring(host + "/team/web:v1@" + digest))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.PinnedImages).To(Equal([]butanev1beta1.PinnedImage{{Image: host + "/team/web:v1", Digest: digest}}))
+
+			By("Reusing the recorded digest")
+			requests = 0
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requests).To(BeZero())
+
+			By("Failing on a tag the registry does not serve")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.Butane = strings.Replace(resource.Spec.Butane, "web:v1", "web:v2", 1)
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).To(MatchError(ContainSubstring("not found")))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			ready := meta.FindStatusCondition(resource.Status.Conditions, butanev1beta1.ConditionReady)
+			Expect(ready).NotTo(BeNil())
+			Expect(ready.Reason).To(Equal(butanev1beta1.ReasonImagePinningFailed))
+		})
+
+		It("should push the Ignition to the OCI repository", func() {
+			var requests int
+			backend := ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0)))
+			registry := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				backend.ServeHTTP(w, r)
+			}))
+			DeferCleanup(registry.Close)
+			host := strings.TrimPrefix(registry.URL, "http://")
+
+			resource := &butanev1beta1.ButaneConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.Output.OCI = &butanev1beta1.OCISpec{Repository: host + "/boot/web"}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			controllerReconciler := &ButaneConfigReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Log:      ctrl.Log.WithName("controllers").WithName("ButaneConfig"),
+				Recorder: events.NewFakeRecorder(100),
+				Pusher:   &images.Pusher{PlainHTTP: []string{host}},
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-ignition", Namespace: "default"}, secret)).To(Succeed())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			pushed := resource.Status.OCIArtifact
+			Expect(pushed).NotTo(BeNil())
+			Expect(pushed.Repository).To(Equal(host + "/boot/web"))
+			sum := sha256.Sum256(secret.Data["userdata"])
+			Expect(pushed.Tags).To(Equal([]string{
+				fmt.Sprintf("generation-%d", resource.Generation),
+				"sha256-" + hex.EncodeToString(sum[:]),
+			}))
+
+			By("Serving the Ignition under both tags")
+			for _, tag := range pushed.Tags {
+				resp, err := http.Get(fmt.Sprintf("%s/v2/boot/web/manifests/%s", registry.URL, tag))
+				Expect(err).NotTo(HaveOccurred())
+				var manifest struct {
+					ArtifactType string `json:"artifactType"`
+					Layers       []struct {
+						Digest string `json:"digest"`
+					} `json:"layers"`
+				}
+				Expect(json.NewDecoder(resp.Body).Decode(&manifest)).To(Succeed())
+				Expect(resp.Body.Close()).To(Succeed())
+				Expect(resp.Header.Get("Docker-Content-Digest")).To(Equal(pushed.Digest))
+				Expect(manifest.ArtifactType).To(Equal(butanev1beta1.MediaTypeIgnition))
+				Expect(manifest.Layers).To(HaveLen(1))
+				Expect(manifest.Layers[0].Digest).To(Equal("sha256:" + hex.EncodeToString(sum[:])))
+			}
+
+			By("Not pushing an artifact the registry has")
+			requests = 0
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(requests).To(BeZero())
+		})
+
+		It("should upload the Ignition to S3 and delete it along with the ButaneConfig", func() {
+			var mu sync.Mutex
+			objects := map[string][]byte{}
+			var puts int
+			storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=minio/") &&
+					!strings.HasPrefix(r.URL.Query().Get("X-Amz-Credential"), "minio/") {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				switch r.Method {
+				case http.MethodPut:
+					puts++
+					objects[r.URL.Path], _ = io.ReadAll(r.Body)
+				case http.MethodGet:
+					data, ok := objects[r.URL.Path]
+					if !ok {
+						w.WriteHeader(http.StatusNotFound)
+						return
+					}
+					_, _ = w.Write(data)
+				case http.MethodDelete:
+					delete(objects, r.URL.Path)
+					w.WriteHeader(http.StatusNoContent)
+				}
+			}))
+			DeferCleanup(storage.Close)
+
+			credentials := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "s3-credentials", Namespace: "default"},
+				StringData: map[string]string{
+					butanev1beta1.KeyAccessKeyID:     "minio",
+					butanev1beta1.KeySecretAccessKey: "minio123",
+				},
+			}
+			Expect(k8sClient.Create(ctx, credentials)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, credentials)
+
+			resource := &butanev1beta1.ButaneConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.Output.S3 = &butanev1beta1.S3Spec{
+				Endpoint:             storage.URL,
+				Bucket:               "ignition",
+				CredentialsSecretRef: corev1.LocalObjectReference{Name: credentials.Name},
+				PresignedURL:         &butanev1beta1.PresignedURLSpec{},
+			}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			controllerReconciler := &ButaneConfigReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Log:      ctrl.Log.WithName("controllers").WithName("ButaneConfig"),
+				Recorder: events.NewFakeRecorder(100),
+			}
+			result, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.RequeueAfter).To(Equal(butanev1beta1.DefaultPresignedURLExpiry / 2))
+
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-ignition", Namespace: "default"}, secret)).To(Succeed())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Finalizers).To(ContainElement(butanev1beta1.FinalizerS3Object))
+			Expect(resource.Status.S3Object).NotTo(BeNil())
+			Expect(resource.Status.S3Object.Key).To(Equal("default/" + resourceName + ".ign"))
+			Expect(objects).To(HaveKeyWithValue("/ignition/default/"+resourceName+".ign", secret.Data["userdata"]))
+
+			By("Fetching the Ignition from the pre-signed URL of the pointer config")
+			pointerSecret := &corev1.Secret{}
+			Expect(resource.Status.PointerSecretName).To(Equal(resourceName + "-ignition-pointer"))
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resource.Status.PointerSecretName, Namespace: "default"}, pointerSecret)).To(Succeed())
+			var pointer struct {
+				Ignition struct {
+					Config struct {
+						Replace struct {
+							Source string `json:"source"`
+						} `json:"replace"`
+					} `json:"config"`
+				} `json:"ignition"`
+			}
+			Expect(json.Unmarshal(pointerSecret.Data["userdata"], &pointer)).To(Succeed())
+			Expect(pointer.Ignition.Config.Replace.Source).To(ContainSubstring("X-Amz-Signature="))
+			resp, err := http.Get(pointer.Ignition.Config.Replace.Source)
+			Expect(err).NotTo(HaveOccurred())
+			data, err := io.ReadAll(resp.Body)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(resp.Body.Close()).To(Succeed())
+			Expect(data).To(Equal(secret.Data["userdata"]))
+
+			By("Not uploading an object the storage has")
+			puts = 0
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(puts).To(BeZero())
+
+			By("Deleting the object left behind by a new key")
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.Output.S3.Key = "{namespace}/{name}-{generation}.ign"
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(objects).To(HaveLen(1))
+			Expect(objects).To(HaveKey(fmt.Sprintf("/ignition/default/%s-%d.ign", resourceName, resource.Generation)))
+
+			By("Deleting the object along with the ButaneConfig")
+			Expect(k8sClient.Delete(ctx, resource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(objects).To(BeEmpty())
+			Expect(errors.IsNotFound(k8sClient.Get(ctx, typeNamespacedName, resource))).To(BeTrue())
+		})
+
+		It("should delete the S3 object once spec.output.s3 is removed", func() {
+			var mu sync.Mutex
+			objects := map[string][]byte{}
+			storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+				if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=minio/") {
+					w.WriteHeader(http.StatusForbidden)
+					return
+				}
+				switch r.Method {
+				case http.MethodPut:
+					objects[r.URL.Path], _ = io.ReadAll(r.Body)
+				case http.MethodDelete:
+					delete(objects, r.URL.Path)
+					w.WriteHeader(http.StatusNoContent)
+				}
+			}))
+			DeferCleanup(storage.Close)
+
+			credentials := &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "s3-credentials", Namespace: "default"},
+				StringData: map[string]string{
+					butanev1beta1.KeyAccessKeyID:     "minio",
+					butanev1beta1.KeySecretAccessKey: "minio123",
+				},
+			}
+			Expect(k8sClient.Create(ctx, credentials)).To(Succeed())
+			DeferCleanup(k8sClient.Delete, ctx, credentials)
+
+			resource := &butanev1beta1.ButaneConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.Output.S3 = &butanev1beta1.S3Spec{
+				Endpoint:             storage.URL,
+				Bucket:               "ignition",
+				CredentialsSecretRef: corev1.LocalObjectReference{Name: credentials.Name},
+			}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			controllerReconciler := &ButaneConfigReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Log:      ctrl.Log.WithName("controllers").WithName("ButaneConfig"),
+				Recorder: events.NewFakeRecorder(100),
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(objects).To(HaveLen(1))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.S3Object).NotTo(BeNil())
+			Expect(resource.Status.S3Object.CredentialsSecretName).To(Equal(credentials.Name))
+
+			By("Deleting the object with the credentials it was uploaded with")
+			resource.Spec.Output.S3 = nil
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(objects).To(BeEmpty())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Finalizers).NotTo(ContainElement(butanev1beta1.FinalizerS3Object))
+			Expect(resource.Status.S3Object).To(BeNil())
+		})
+
+		DescribeTable("should render every Butane variant",
+			func(butane, ignitionVersion string, keys ...string) {
+				resource := &butanev1beta1.ButaneConfig{}
+				Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+				resource.Spec.Config = nil
+				resource.Spec.Butane = butane
+				Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+				controllerReconciler := &ButaneConfigReconciler{
+					Client:   k8sClient,
+					Scheme:   k8sClient.Scheme(),
+					Log:      ctrl.Log.WithName("controllers").WithName("ButaneConfig"),
+					Recorder: events.NewFakeRecorder(100),
+				}
+				_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+				Expect(err).NotTo(HaveOccurred())
+
+				Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+				header, err := render.ReadHeader([]byte(butane))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(resource.Status.Variant).To(Equal(header.Variant))
+				Expect(resource.Status.IgnitionVersion).To(Equal(ignitionVersion))
+
+				secret := &corev1.Secret{}
+				Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-ignition", Namespace: "default"}, secret)).To(Succeed())
+				Expect(secret.Data).To(HaveLen(len(keys)))
+				for _, key := range keys {
+					Expect(secret.Data).To(HaveKey(key))
+				}
+				version, err := render.IgnitionVersion(butanev1beta1.IgnitionData(secret.Data))
+				Expect(err).NotTo(HaveOccurred())
+				Expect(version).To(Equal(ignitionVersion))
+				if header.Variant == render.VariantOpenShift {
+					Expect(string(secret.Data[butanev1beta1.KeyUserdata])).To(ContainSubstring("kind: MachineConfig"))
+				} else {
+					Expect(render.IgnitionVersion(secret.Data[butanev1beta1.KeyUserdata])).To(Equal(ignitionVersion))
+				}
+				if ign, ok := secret.Data[butanev1beta1.KeyIgnitionFile]; ok && header.Variant == render.VariantFlatcar {
+					Expect(ign).To(Equal(secret.Data[butanev1beta1.KeyUserdata]))
+				}
+			},
+			Entry("fcos", "variant: fcos\nversion: 1.6.0\n", "3.5.0", butanev1beta1.KeyUserdata),
+			Entry("fiot", "variant: fiot\nversion: 1.0.0\n", "3.4.0", butanev1beta1.KeyUserdata),
+			Entry("flatcar", "variant: flatcar\nversion: 1.1.0\n", "3.4.0",
+				butanev1beta1.KeyUserdata, butanev1beta1.KeyIgnitionFile),
+			Entry("r4e", "variant: r4e\nversion: 1.1.0\n", "3.4.0", butanev1beta1.KeyUserdata),
+			Entry("openshift", "variant: openshift\nversion: 4.21.0\nmetadata:\n  name: 99-worker\n  labels:\n"+
+				"    machineconfiguration.openshift.io/role: worker\n", "3.5.0",
+				butanev1beta1.KeyUserdata, butanev1beta1.KeyIgnitionFile),
+		)
+
+		It("should convert the output to the pinned Ignition version", func() {
+			resource := &butanev1beta1.ButaneConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.Output.IgnitionVersion = "3.2.0"
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			controllerReconciler := &ButaneConfigReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Log:      ctrl.Log.WithName("controllers").WithName("ButaneConfig"),
+				Recorder: events.NewFakeRecorder(100),
+			}
+			_, err := controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(resource.Status.IgnitionVersion).To(Equal("3.2.0"))
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-ignition", Namespace: "default"}, secret)).To(Succeed())
+			Expect(string(secret.Data["userdata"])).To(ContainSubstring(`"version":"3.2.0"`))
+			Expect(string(secret.Data["userdata"])).To(ContainSubstring(`"path":"/etc/hostname"`))
+
+			By("Failing on features the version cannot represent")
+			resource.Spec.Config = nil
+			resource.Spec.Butane = "variant: fcos\nversion: 1.5.0\nkernel_arguments:\n  should_exist:\n    - quiet\n"
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).To(MatchError(ContainSubstring("kernelArguments")))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			ready := meta.FindStatusCondition(resource.Status.Conditions, butanev1beta1.ConditionReady)
+			Expect(ready).NotTo(BeNil())
+			Expect(ready.Reason).To(Equal(butanev1beta1.ReasonIgnitionVersionFailed))
+		})
+
+		It("should enforce the size limit and spill large files", func() {
+			blob := make([]byte, 96*1024)
+			_, err := rand.Read(blob)
+			Expect(err).NotTo(HaveOccurred())
+
+			resource := &butanev1beta1.ButaneConfig{}
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			resource.Spec.Config = nil
+			resource.Spec.Butane = "variant: fcos\nversion: 1.5.0\nstorage:\n  files:\n    - path: /opt/blob\n      contents:\n" +
+				"        source: data:;base64," + base64.StdEncoding.EncodeToString(blob) + "\n"
+			limit := resource.Spec.Output.SizeLimit()
+			Expect(limit).To(Equal(int64(1024 * 1024)))
+			resource.Spec.Output.Size = &butanev1beta1.SizeSpec{Limit: ptr.To(apiresource.MustParse("64Ki"))}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+
+			controllerReconciler := &ButaneConfigReconciler{
+				Client:   k8sClient,
+				Scheme:   k8sClient.Scheme(),
+				Log:      ctrl.Log.WithName("controllers").WithName("ButaneConfig"),
+				Recorder: events.NewFakeRecorder(100),
+			}
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).To(MatchError(ContainSubstring("over the limit of 65536 bytes")))
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			sizeCondition := meta.FindStatusCondition(resource.Status.Conditions, butanev1beta1.ConditionSizeWithinLimit)
+			Expect(sizeCondition).NotTo(BeNil())
+			Expect(sizeCondition.Status).To(Equal(metav1.ConditionFalse))
+			Expect(meta.FindStatusCondition(resource.Status.Conditions, butanev1beta1.ConditionReady).Reason).To(Equal(butanev1beta1.ReasonOutputTooLarge))
+
+			By("Spilling the large file")
+			resource.Spec.Output.Size.Spill = &butanev1beta1.SpillSpec{URL: "https://files.example.com/spill"}
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, typeNamespacedName, resource)).To(Succeed())
+			Expect(meta.IsStatusConditionTrue(resource.Status.Conditions, butanev1beta1.ConditionSizeWithinLimit)).To(BeTrue())
+			Expect(resource.Status.SpilledSecretNames).To(HaveLen(1))
+			spilled := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resource.Status.SpilledSecretNames[0], Namespace: "default"}, spilled)).To(Succeed())
+			Expect(spilled.Labels).To(HaveKeyWithValue(butanev1beta1.LabelSpilledFrom, resourceName))
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: resourceName + "-ignition", Namespace: "default"}, secret)).To(Succeed())
+			Expect(string(secret.Data["userdata"])).To(ContainSubstring("https://files.example.com/spill/"))
+
+			By("Removing the spilled Secret once the file fits")
+			resource.Spec.Output.Size = nil
+			Expect(k8sClient.Update(ctx, resource)).To(Succeed())
+			_, err = controllerReconciler.Reconcile(ctx, reconcile.Request{NamespacedName: typeNamespacedName})
+			Expect(err).NotTo(HaveOccurred())
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Name: spilled.Name, Namespace: "default"}, spilled)).NotTo(Succeed())
 		})
 
 		It("should handle invalid Butane configuration", func() {
@@ -181,13 +1150,13 @@ var _ = Describe("ButaneConfig Controller", func() {
 			configJSON, err := json.Marshal(invalidConfig)
 			Expect(err).NotTo(HaveOccurred())
 
-			invalidResource := &butanev1alpha1.ButaneConfig{
+			invalidResource := &butanev1beta1.ButaneConfig{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      invalidResourceName,
 					Namespace: "default",
 				},
-				Spec: butanev1alpha1.ButaneConfigSpec{
-					Config: runtime.RawExtension{
+				Spec: butanev1beta1.ButaneConfigSpec{
+					Config: &runtime.RawExtension{
 						Raw: configJSON,
 					},
 				},
@@ -206,6 +1175,7 @@ var _ = Describe("ButaneConfig Controller", func() {
 				NamespacedName: invalidTypeNamespacedName,
 			})
 			Expect(err).To(HaveOccurred(), "Should return error for invalid Butane config")
+			Expect(goerrors.Is(err, reconcile.TerminalError(nil))).To(BeTrue(), "Invalid config should not be retried")
 
 			By("Verifying no Secret was created for invalid config")
 			secretName := invalidResourceName + "-ignition"
@@ -217,6 +1187,14 @@ var _ = Describe("ButaneConfig Controller", func() {
 			err = k8sClient.Get(ctx, secretKey, secret)
 			Expect(errors.IsNotFound(err)).To(BeTrue(), "Secret should not exist for invalid config")
 
+			By("Verifying the Ready condition reports the translation failure")
+			failed := &butanev1beta1.ButaneConfig{}
+			Expect(k8sClient.Get(ctx, invalidTypeNamespacedName, failed)).To(Succeed())
+			ready := meta.FindStatusCondition(failed.Status.Conditions, butanev1beta1.ConditionReady)
+			Expect(ready).NotTo(BeNil(), "Ready condition should be set")
+			Expect(ready.Status).To(Equal(metav1.ConditionFalse))
+			Expect(ready.Reason).To(Equal(butanev1beta1.ReasonTranslationFailed))
+
 			By("Cleanup the invalid resource")
 			Expect(k8sClient.Delete(ctx, invalidResource)).To(Succeed())
 		})
@@ -229,12 +1207,12 @@ var _ = Describe("ButaneConfig Controller", func() {
 				Namespace: "default",
 			}
 
-			resourceWithoutConfig := &butanev1alpha1.ButaneConfig{
+			resourceWithoutConfig := &butanev1beta1.ButaneConfig{
 				ObjectMeta: metav1.ObjectMeta{
 					Name:      missingConfigResourceName,
 					Namespace: "default",
 				},
-				Spec: butanev1alpha1.ButaneConfigSpec{
+				Spec: butanev1beta1.ButaneConfigSpec{
 					// Config is not set
 				},
 			}
@@ -253,6 +1231,7 @@ var _ = Describe("ButaneConfig Controller", func() {
 			})
 			Expect(err).To(HaveOccurred(), "Should return error for missing config")
 			Expect(err.Error()).To(ContainSubstring("missing Config"), "Error should indicate missing config")
+			Expect(goerrors.Is(err, reconcile.TerminalError(nil))).To(BeTrue(), "Missing config should not be retried")
 
 			By("Cleanup the resource without config")
 			Expect(k8sClient.Delete(ctx, resourceWithoutConfig)).To(Succeed())
@@ -0,0 +1,284 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	butanev1beta1 "github.com/naval-group/butane-operator/api/v1beta1"
+	"github.com/naval-group/butane-operator/internal/metrics"
+	"github.com/naval-group/butane-operator/internal/render"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// ClusterConfigCache holds the translated ClusterButaneConfigs, so that a
+// config merged by many ButaneConfigs is translated once per generation
+// rather than once per ButaneConfig. It is shared by both reconcilers.
+type ClusterConfigCache struct {
+	// FilesDir is the directory local contents and trees are read from, as
+	// with butane --files-dir. Empty, as in the cluster, rejects them.
+	FilesDir string
+
+	mu      sync.Mutex
+	entries map[string]clusterConfigEntry
+}
+
+type clusterConfigEntry struct {
+	uid        types.UID
+	generation int64
+	ignition   []byte
+	err        error
+}
+
+// NewClusterConfigCache returns an empty ClusterConfigCache.
+func NewClusterConfigCache() *ClusterConfigCache {
+	return &ClusterConfigCache{entries: map[string]clusterConfigEntry{}}
+}
+
+// Render returns the Ignition config of a ClusterButaneConfig, translating it
+// unless the cache holds the same generation. A nil cache translates every
+// time. The returned config must not be modified.
+func (c *ClusterConfigCache) Render(cbc *butanev1beta1.ClusterButaneConfig) ([]byte, error) {
+	if c == nil {
+		return translateClusterConfig(cbc, "")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[cbc.Name]; ok && e.uid == cbc.UID && e.generation == cbc.Generation {
+		return e.ignition, e.err
+	}
+	ignition, err := translateClusterConfig(cbc, c.FilesDir)
+	c.entries[cbc.Name] = clusterConfigEntry{uid: cbc.UID, generation: cbc.Generation, ignition: ignition, err: err}
+	return ignition, err
+}
+
+// Forget drops the cached translation of a deleted ClusterButaneConfig.
+func (c *ClusterConfigCache) Forget(name string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, name)
+}
+
+func translateClusterConfig(cbc *butanev1beta1.ClusterButaneConfig, filesDir string) ([]byte, error) {
+	source := cbc.Spec.Source()
+	if source == nil {
+		return nil, fmt.Errorf("ClusterButaneConfig %s has no Butane config", cbc.Name)
+	}
+	start := time.Now()
+	opts := cbc.Spec.Translation.RenderOptions()
+	opts.FilesDir = filesDir
+	ignition, rpt, err := render.Translate(source, opts)
+	metrics.ObserveTranslation(start, ignition, rpt, err)
+	if err != nil {
+		return nil, fmt.Errorf("failed to translate ClusterButaneConfig %s: %s", cbc.Name, translationMessage(rpt, err))
+	}
+	return ignition, nil
+}
+
+// ClusterButaneConfigReconciler reconciles a ClusterButaneConfig object. It
+// translates the config into the shared cache and lists the ButaneConfigs
+// merging it in its status; the ButaneConfig reconciler does the merging.
+type ClusterButaneConfigReconciler struct {
+	client.Client
+	Log      logr.Logger
+	Recorder events.EventRecorder
+
+	// Cache holds the translated configs. Nil translates on every use.
+	Cache *ClusterConfigCache
+}
+
+//+kubebuilder:rbac:groups=butane.operators.naval-group.com,resources=clusterbutaneconfigs,verbs=get;list;watch
+//+kubebuilder:rbac:groups=butane.operators.naval-group.com,resources=clusterbutaneconfigs/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=butane.operators.naval-group.com,resources=butaneinjectionpolicies,verbs=get;list;watch
+
+// Reconcile translates a ClusterButaneConfig and records its consumers.
+// Translation failures are terminal, since only a new spec can fix them.
+func (r *ClusterButaneConfigReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	log := r.Log.WithValues("clusterbutaneconfig", req.Name)
+
+	var cbc butanev1beta1.ClusterButaneConfig
+	if err := r.Get(ctx, req.NamespacedName, &cbc); err != nil {
+		if apierrors.IsNotFound(err) {
+			r.Cache.Forget(req.Name)
+			return ctrl.Result{}, nil
+		}
+		return ctrl.Result{}, err
+	}
+
+	consumers, err := r.consumers(ctx, cbc.Name)
+	if err != nil {
+		return ctrl.Result{}, err
+	}
+	cbc.Status.Consumers = consumers
+
+	ignition, err := r.Cache.Render(&cbc)
+	if err == nil {
+		var header render.Header
+		if header, err = render.ReadHeader(cbc.Spec.Source()); err == nil {
+			cbc.Status.Variant = header.Variant
+			cbc.Status.IgnitionVersion, err = render.IgnitionVersion(ignition)
+		}
+	}
+	if err != nil {
+		log.Error(err, "Error translating ClusterButaneConfig")
+		r.Recorder.Eventf(&cbc, nil, corev1.EventTypeWarning, "ConversionFailed", "ConversionFailed", "Failed to convert ClusterButaneConfig to Ignition config: %v", err)
+		r.setReady(&cbc, metav1.ConditionFalse, butanev1beta1.ReasonTranslationFailed, err.Error())
+		if uerr := r.Status().Update(ctx, &cbc); uerr != nil {
+			return ctrl.Result{}, uerr
+		}
+		return ctrl.Result{}, reconcile.TerminalError(err)
+	}
+
+	r.setReady(&cbc, metav1.ConditionTrue, butanev1beta1.ReasonReconciled,
+		fmt.Sprintf("Ignition config is cached for %d ButaneConfigs", len(consumers)))
+	if err := r.Status().Update(ctx, &cbc); err != nil {
+		return ctrl.Result{}, err
+	}
+	log.Info("Successfully processed ClusterButaneConfig", "consumers", len(consumers))
+	return ctrl.Result{}, nil
+}
+
+// consumers returns the ButaneConfigs merging the ClusterButaneConfig,
+// directly or through injection policies, sorted by namespace and name.
+func (r *ClusterButaneConfigReconciler) consumers(ctx context.Context, name string) ([]butanev1beta1.ConsumerReference, error) {
+	var list butanev1beta1.ButaneConfigList
+	if err := r.List(ctx, &list); err != nil {
+		return nil, err
+	}
+	policies, err := policiesByName(ctx, r.Client)
+	if err != nil {
+		return nil, err
+	}
+	var consumers []butanev1beta1.ConsumerReference
+	for i := range list.Items {
+		if usesClusterConfig(&list.Items[i], name, policies) {
+			consumers = append(consumers, butanev1beta1.ConsumerReference{Namespace: list.Items[i].Namespace, Name: list.Items[i].Name})
+		}
+	}
+	sort.Slice(consumers, func(i, j int) bool {
+		if consumers[i].Namespace != consumers[j].Namespace {
+			return consumers[i].Namespace < consumers[j].Namespace
+		}
+		return consumers[i].Name < consumers[j].Name
+	})
+	return consumers, nil
+}
+
+func (r *ClusterButaneConfigReconciler) setReady(cbc *butanev1beta1.ClusterButaneConfig, status metav1.ConditionStatus, reason, message string) {
+	meta.SetStatusCondition(&cbc.Status.Conditions, metav1.Condition{
+		Type:               butanev1beta1.ConditionReady,
+		Status:             status,
+		Reason:             reason,
+		Message:            message,
+		ObservedGeneration: cbc.Generation,
+	})
+}
+
+// mergesFrom reports whether refs names the ClusterButaneConfig.
+func mergesFrom(refs []butanev1beta1.ClusterButaneConfigReference, name string) bool {
+	for _, ref := range refs {
+		if ref.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// mergedConfigs maps a ButaneConfig to the ClusterButaneConfigs it merges,
+// directly or through injection policies, so that their consumers are updated
+// when it starts or stops merging them.
+func (r *ClusterButaneConfigReconciler) mergedConfigs(ctx context.Context, obj client.Object) []reconcile.Request {
+	bc, ok := obj.(*butanev1beta1.ButaneConfig)
+	if !ok {
+		return nil
+	}
+	refs := bc.Spec.MergeFrom
+	if len(bc.Status.AppliedPolicies) > 0 {
+		policies, err := policiesByName(ctx, r.Client)
+		if err != nil {
+			r.Log.Error(err, "Failed to list ButaneInjectionPolicies")
+		}
+		for _, name := range bc.Status.AppliedPolicies {
+			if policy, ok := policies[name]; ok {
+				refs = append(slices.Clip(refs), policy.Spec.MergeFrom...)
+			}
+		}
+	}
+	return configRequests(refs)
+}
+
+// injectedConfigs maps a ButaneInjectionPolicy to the ClusterButaneConfigs it
+// injects.
+func injectedConfigs(_ context.Context, obj client.Object) []reconcile.Request {
+	policy, ok := obj.(*butanev1beta1.ButaneInjectionPolicy)
+	if !ok {
+		return nil
+	}
+	return configRequests(policy.Spec.MergeFrom)
+}
+
+func configRequests(refs []butanev1beta1.ClusterButaneConfigReference) []reconcile.Request {
+	requests := make([]reconcile.Request, 0, len(refs))
+	for _, ref := range refs {
+		requests = append(requests, reconcile.Request{NamespacedName: types.NamespacedName{Name: ref.Name}})
+	}
+	return requests
+}
+
+// consumersChanged passes the ButaneConfig updates that may change the
+// ClusterButaneConfigs they merge: spec changes, and changes of the injection
+// policies applied to them.
+var consumersChanged = predicate.Or[client.Object](
+	predicate.GenerationChangedPredicate{},
+	predicate.Funcs{UpdateFunc: func(e event.UpdateEvent) bool {
+		oldBC, okOld := e.ObjectOld.(*butanev1beta1.ButaneConfig)
+		newBC, okNew := e.ObjectNew.(*butanev1beta1.ButaneConfig)
+		return okOld && okNew && !slices.Equal(oldBC.Status.AppliedPolicies, newBC.Status.AppliedPolicies)
+	}},
+)
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *ClusterButaneConfigReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.Recorder = mgr.GetEventRecorder("clusterbutaneconfig-controller")
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&butanev1beta1.ClusterButaneConfig{}, builder.WithPredicates(predicate.GenerationChangedPredicate{})).
+		Watches(&butanev1beta1.ButaneConfig{}, handler.EnqueueRequestsFromMapFunc(r.mergedConfigs),
+			builder.WithPredicates(consumersChanged)).
+		Watches(&butanev1beta1.ButaneInjectionPolicy{}, handler.EnqueueRequestsFromMapFunc(injectedConfigs)).
+		Complete(r)
+}
@@ -0,0 +1,272 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	goerrors "errors"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/events"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	butanev1beta1 "github.com/naval-group/butane-operator/api/v1beta1"
+)
+
+var _ = Describe("ClusterButaneConfig Controller", func() {
+	ctx := context.Background()
+
+	It("should merge the baseline into ButaneConfigs and list them as consumers", func() {
+		baseline := &butanev1beta1.ClusterButaneConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "baseline"},
+			Spec: butanev1beta1.ClusterButaneConfigSpec{
+				Butane: "variant: fcos\nversion: 1.5.0\nstorage:\n  files:\n    - path: /etc/chrony.d/platform.conf\n      contents:\n        inline: server ntp.example.com\n    - path: /etc/motd\n      contents:\n        inline: baseline\n",
+			},
+		}
+		Expect(k8sClient.Create(ctx, baseline)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ctx, baseline)
+
+		bc := &butanev1beta1.ButaneConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "merged", Namespace: "default"},
+			Spec: butanev1beta1.ButaneConfigSpec{
+				MergeFrom: []butanev1beta1.ClusterButaneConfigReference{{Name: "baseline"}},
+				Butane:    "variant: fcos\nversion: 1.6.0\nstorage:\n  files:\n    - path: /etc/motd\n      contents:\n        inline: hello\n",
+			},
+		}
+		Expect(k8sClient.Create(ctx, bc)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ctx, bc)
+
+		cache := NewClusterConfigCache()
+		clusterReconciler := &ClusterButaneConfigReconciler{
+			Client:   k8sClient,
+			Recorder: &events.FakeRecorder{},
+			Cache:    cache,
+		}
+		_, err := clusterReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "baseline"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(baseline), baseline)).To(Succeed())
+		Expect(baseline.Status.Consumers).To(ConsistOf(butanev1beta1.ConsumerReference{Namespace: "default", Name: "merged"}))
+		Expect(meta.IsStatusConditionTrue(baseline.Status.Conditions, butanev1beta1.ConditionReady)).To(BeTrue())
+
+		reconciler := &ButaneConfigReconciler{
+			Client:         k8sClient,
+			Scheme:         k8sClient.Scheme(),
+			Recorder:       &events.FakeRecorder{},
+			ClusterConfigs: cache,
+		}
+		_, err = reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(bc)})
+		Expect(err).NotTo(HaveOccurred())
+
+		secret := &corev1.Secret{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "merged-ignition", Namespace: "default"}, secret)).To(Succeed())
+		userdata := string(secret.Data[butanev1beta1.KeyUserdata])
+		Expect(userdata).To(ContainSubstring("/etc/chrony.d/platform.conf"))
+		Expect(userdata).To(ContainSubstring("data:,hello"))
+		Expect(userdata).NotTo(ContainSubstring("baseline"))
+
+		By("Reporting the file both configs set")
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(bc), bc)).To(Succeed())
+		Expect(bc.Status.LintFindings).To(ContainElement(butanev1beta1.LintFinding{
+			Rule:     "PathConflict",
+			Location: "file /etc/motd",
+			Message:  "set by both ClusterButaneConfig baseline and the ButaneConfig, which overrides it",
+		}))
+	})
+
+	It("should fail terminally when a merged ClusterButaneConfig is missing", func() {
+		bc := &butanev1beta1.ButaneConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "merges-missing", Namespace: "default"},
+			Spec: butanev1beta1.ButaneConfigSpec{
+				MergeFrom: []butanev1beta1.ClusterButaneConfigReference{{Name: "missing"}},
+				Butane:    "variant: fcos\nversion: 1.5.0\n",
+			},
+		}
+		Expect(k8sClient.Create(ctx, bc)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ctx, bc)
+
+		reconciler := &ButaneConfigReconciler{
+			Client:   k8sClient,
+			Scheme:   k8sClient.Scheme(),
+			Recorder: &events.FakeRecorder{},
+		}
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(bc)})
+		Expect(goerrors.Is(err, reconcile.TerminalError(nil))).To(BeTrue())
+
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(bc), bc)).To(Succeed())
+		ready := meta.FindStatusCondition(bc.Status.Conditions, butanev1beta1.ConditionReady)
+		Expect(ready).NotTo(BeNil())
+		Expect(ready.Reason).To(Equal(butanev1beta1.ReasonMergeFailed))
+	})
+
+	It("should inject the snippets of the policies selecting a ButaneConfig", func() {
+		ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "secure", Labels: map[string]string{"security-tier": "high"}}}
+		Expect(k8sClient.Create(ctx, ns)).To(Succeed())
+
+		hardening := &butanev1beta1.ClusterButaneConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "hardening"},
+			Spec: butanev1beta1.ClusterButaneConfigSpec{
+				Butane: "variant: fcos\nversion: 1.5.0\nstorage:\n  files:\n    - path: /etc/ssh/sshd_config.d/40-hardening.conf\n      contents:\n        inline: PermitRootLogin no\n",
+			},
+		}
+		Expect(k8sClient.Create(ctx, hardening)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ctx, hardening)
+
+		policy := &butanev1beta1.ButaneInjectionPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "high-security"},
+			Spec: butanev1beta1.ButaneInjectionPolicySpec{
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"security-tier": "high"}},
+				MergeFrom:         []butanev1beta1.ClusterButaneConfigReference{{Name: "hardening"}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, policy)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ctx, policy)
+
+		// The injected snippet takes precedence over the ButaneConfig
+		bc := &butanev1beta1.ButaneConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "injected", Namespace: "secure"},
+			Spec: butanev1beta1.ButaneConfigSpec{
+				Butane: "variant: fcos\nversion: 1.5.0\nstorage:\n  files:\n    - path: /etc/ssh/sshd_config.d/40-hardening.conf\n      contents:\n        inline: PermitRootLogin yes\n",
+			},
+		}
+		Expect(k8sClient.Create(ctx, bc)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ctx, bc)
+
+		cache := NewClusterConfigCache()
+		reconciler := &ButaneConfigReconciler{
+			Client:         k8sClient,
+			Scheme:         k8sClient.Scheme(),
+			Recorder:       &events.FakeRecorder{},
+			ClusterConfigs: cache,
+		}
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: client.ObjectKeyFromObject(bc)})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(bc), bc)).To(Succeed())
+		Expect(bc.Status.AppliedPolicies).To(Equal([]string{"high-security"}))
+		secret := &corev1.Secret{}
+		Expect(k8sClient.Get(ctx, types.NamespacedName{Name: "injected-ignition", Namespace: "secure"}, secret)).To(Succeed())
+		Expect(secret.Annotations).To(HaveKeyWithValue(butanev1beta1.AnnotationInjectionPolicies, "high-security"))
+		Expect(string(secret.Data[butanev1beta1.KeyUserdata])).To(ContainSubstring("PermitRootLogin%20no"))
+
+		clusterReconciler := &ClusterButaneConfigReconciler{
+			Client:   k8sClient,
+			Recorder: &events.FakeRecorder{},
+			Cache:    cache,
+		}
+		_, err = clusterReconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Name: "hardening"}})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(k8sClient.Get(ctx, client.ObjectKeyFromObject(hardening), hardening)).To(Succeed())
+		Expect(hardening.Status.Consumers).To(ConsistOf(butanev1beta1.ConsumerReference{Namespace: "secure", Name: "injected"}))
+	})
+
+	It("should apply the policies selecting a relabeled ButaneConfig", func() {
+		hardening := &butanev1beta1.ClusterButaneConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "worker-hardening"},
+			Spec: butanev1beta1.ClusterButaneConfigSpec{
+				Butane: "variant: fcos\nversion: 1.5.0\nstorage:\n  files:\n    - path: /etc/ssh/sshd_config.d/40-hardening.conf\n      contents:\n        inline: PermitRootLogin no\n",
+			},
+		}
+		Expect(k8sClient.Create(ctx, hardening)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ctx, hardening)
+
+		policy := &butanev1beta1.ButaneInjectionPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "worker-security"},
+			Spec: butanev1beta1.ButaneInjectionPolicySpec{
+				Selector:  &metav1.LabelSelector{MatchLabels: map[string]string{"role": "worker"}},
+				MergeFrom: []butanev1beta1.ClusterButaneConfigReference{{Name: "worker-hardening"}},
+			},
+		}
+		Expect(k8sClient.Create(ctx, policy)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ctx, policy)
+
+		bc := &butanev1beta1.ButaneConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "relabeled", Namespace: "default"},
+			Spec:       butanev1beta1.ButaneConfigSpec{Butane: "variant: fcos\nversion: 1.5.0\n"},
+		}
+		Expect(k8sClient.Create(ctx, bc)).To(Succeed())
+		DeferCleanup(k8sClient.Delete, ctx, bc)
+
+		reconciler := &ButaneConfigReconciler{
+			Client:         k8sClient,
+			Scheme:         k8sClient.Scheme(),
+			Recorder:       &events.FakeRecorder{},
+			ClusterConfigs: NewClusterConfigCache(),
+		}
+		key := client.ObjectKeyFromObject(bc)
+		secretKey := types.NamespacedName{Name: "relabeled-ignition", Namespace: "default"}
+		reconcileRelabeled := func(labels map[string]string) (*butanev1beta1.ButaneConfig, *corev1.Secret) {
+			old := &butanev1beta1.ButaneConfig{}
+			Expect(k8sClient.Get(ctx, key, old)).To(Succeed())
+			if labels != nil {
+				relabeled := old.DeepCopy()
+				relabeled.Labels = labels
+				Expect(k8sClient.Update(ctx, relabeled)).To(Succeed())
+				// Relabeling leaves the generation as is, yet must be reconciled
+				Expect(relabeled.Generation).To(Equal(old.Generation))
+				Expect(butaneConfigChanged.Update(event.UpdateEvent{ObjectOld: old, ObjectNew: relabeled})).To(BeTrue())
+			}
+			_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: key})
+			Expect(err).NotTo(HaveOccurred())
+
+			reconciled := &butanev1beta1.ButaneConfig{}
+			Expect(k8sClient.Get(ctx, key, reconciled)).To(Succeed())
+			secret := &corev1.Secret{}
+			Expect(k8sClient.Get(ctx, secretKey, secret)).To(Succeed())
+			return reconciled, secret
+		}
+
+		reconciled, secret := reconcileRelabeled(nil)
+		Expect(reconciled.Status.AppliedPolicies).To(BeEmpty())
+		Expect(string(secret.Data[butanev1beta1.KeyUserdata])).NotTo(ContainSubstring("PermitRootLogin"))
+
+		reconciled, secret = reconcileRelabeled(map[string]string{"role": "worker"})
+		Expect(reconciled.Status.AppliedPolicies).To(Equal([]string{"worker-security"}))
+		Expect(string(secret.Data[butanev1beta1.KeyUserdata])).To(ContainSubstring("PermitRootLogin%20no"))
+
+		reconciled, secret = reconcileRelabeled(map[string]string{"role": "control-plane"})
+		Expect(reconciled.Status.AppliedPolicies).To(BeEmpty())
+		Expect(string(secret.Data[butanev1beta1.KeyUserdata])).NotTo(ContainSubstring("PermitRootLogin"))
+	})
+
+	It("should translate a ClusterButaneConfig once per generation", func() {
+		cbc := &butanev1beta1.ClusterButaneConfig{
+			ObjectMeta: metav1.ObjectMeta{Name: "cached", UID: "uid", Generation: 1},
+			Spec:       butanev1beta1.ClusterButaneConfigSpec{Butane: "variant: fcos\nversion: 1.5.0\n"},
+		}
+		cache := NewClusterConfigCache()
+		first, err := cache.Render(cbc)
+		Expect(err).NotTo(HaveOccurred())
+
+		cbc.Spec.Butane = "variant: fcos\nversion: 1.6.0\n"
+		cached, err := cache.Render(cbc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(cached).To(Equal(first))
+
+		cbc.Generation = 2
+		rendered, err := cache.Render(cbc)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(string(rendered)).To(ContainSubstring(`"version":"3.5.0"`))
+	})
+})
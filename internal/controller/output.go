@@ -0,0 +1,1183 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	butanev1beta1 "github.com/naval-group/butane-operator/api/v1beta1"
+	"github.com/naval-group/butane-operator/internal/encryption"
+	"github.com/naval-group/butane-operator/internal/images"
+	"github.com/naval-group/butane-operator/internal/lint"
+	"github.com/naval-group/butane-operator/internal/metrics"
+	"github.com/naval-group/butane-operator/internal/operatorconfig"
+	"github.com/naval-group/butane-operator/internal/render"
+	"github.com/naval-group/butane-operator/internal/s3"
+	"github.com/naval-group/butane-operator/internal/signing"
+	"github.com/naval-group/butane-operator/internal/userdir"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+)
+
+// translateOptions returns the options to translate the Butane config of bc
+// with, reading its local contents from FilesDir.
+func (r *ButaneConfigReconciler) translateOptions(bc *butanev1beta1.ButaneConfig) render.Options {
+	opts := bc.Spec.Translation.RenderOptions()
+	opts.FilesDir = r.FilesDir
+	return opts
+}
+
+// butaneSource returns the Butane config of bc, reading the ConfigMap key
+// selected by spec.butaneFrom if set.
+func (r *ButaneConfigReconciler) butaneSource(ctx context.Context, bc *butanev1beta1.ButaneConfig) ([]byte, error) {
+	ref := bc.Spec.ButaneFrom
+	if ref == nil {
+		return bc.Spec.Source(), nil
+	}
+	var cm corev1.ConfigMap
+	if err := r.Get(ctx, client.ObjectKey{Namespace: bc.Namespace, Name: ref.Name}, &cm); err != nil {
+		return nil, fmt.Errorf("failed to get Butane ConfigMap %s: %w", ref.Name, err)
+	}
+	text, ok := cm.Data[ref.Key]
+	if !ok {
+		return nil, fmt.Errorf("butane ConfigMap %s has no key %s", ref.Name, ref.Key)
+	}
+	return []byte(text), nil
+}
+
+// mergeBases merges the translated config over the ClusterButaneConfigs of
+// spec.mergeFrom, then merges the snippets of the injection policies over the
+// result, in order. The ClusterButaneConfigs are translated once and cached,
+// whatever the number of ButaneConfigs merging them. It also returns the
+// files, directories and links set by several of the merged configs.
+func (r *ButaneConfigReconciler) mergeBases(ctx context.Context, bc *butanev1beta1.ButaneConfig, ignition []byte, policies []butanev1beta1.ButaneInjectionPolicy) ([]byte, []lint.Finding, error) {
+	opts := bc.Spec.Translation.RenderOptions()
+	var merged []byte
+	var conflicts []lint.Finding
+	owners := map[string]string{}
+	mergeLayer := func(config []byte, name string) error {
+		found, err := lint.Conflicts(config, name, owners)
+		if err != nil {
+			return err
+		}
+		conflicts = append(conflicts, found...)
+		merged, err = mergeOver(merged, config, opts)
+		return err
+	}
+	mergeFrom := func(refs []butanev1beta1.ClusterButaneConfigReference) error {
+		for _, ref := range refs {
+			var cbc butanev1beta1.ClusterButaneConfig
+			if err := r.Get(ctx, client.ObjectKey{Name: ref.Name}, &cbc); err != nil {
+				return fmt.Errorf("failed to get ClusterButaneConfig %s: %w", ref.Name, err)
+			}
+			base, err := r.ClusterConfigs.Render(&cbc)
+			if err != nil {
+				return err
+			}
+			if err := mergeLayer(base, "ClusterButaneConfig "+ref.Name); err != nil {
+				return fmt.Errorf("failed to merge ClusterButaneConfig %s: %w", ref.Name, err)
+			}
+		}
+		return nil
+	}
+
+	if err := mergeFrom(bc.Spec.MergeFrom); err != nil {
+		return nil, nil, err
+	}
+	if err := mergeLayer(ignition, "the ButaneConfig"); err != nil {
+		return nil, nil, fmt.Errorf("failed to merge the config over spec.mergeFrom: %w", err)
+	}
+	for i := range policies {
+		if err := mergeFrom(policies[i].Spec.MergeFrom); err != nil {
+			return nil, nil, fmt.Errorf("ButaneInjectionPolicy %s: %w", policies[i].Name, err)
+		}
+	}
+	return merged, conflicts, nil
+}
+
+// lintFindings returns the findings of the unit and storage linters the
+// operator policy does not ignore, for status.lintFindings.
+func lintFindings(policy operatorconfig.PolicyConfig, units, storage []lint.Finding) []butanev1beta1.LintFinding {
+	var findings []butanev1beta1.LintFinding
+	for _, set := range []struct {
+		action   operatorconfig.LintAction
+		findings []lint.Finding
+	}{{policy.UnitLint, units}, {policy.IgnitionLint, storage}} {
+		if set.action == operatorconfig.LintIgnore {
+			continue
+		}
+		for _, f := range set.findings {
+			findings = append(findings, butanev1beta1.LintFinding{Rule: string(f.Rule), Location: f.Location, Message: f.Message})
+		}
+	}
+	return findings
+}
+
+// mergeOver merges config over merged, or returns config as is when there is
+// nothing to merge it over.
+func mergeOver(merged, config []byte, opts render.Options) ([]byte, error) {
+	if merged == nil {
+		return config, nil
+	}
+	return render.Merge(merged, config, opts)
+}
+
+// mergeUsers merges the SSH authorized keys and password hashes of spec.users
+// over the config, so that the keys are added to those the config sets for the
+// same users and the hashes replace theirs.
+func (r *ButaneConfigReconciler) mergeUsers(ctx context.Context, bc *butanev1beta1.ButaneConfig, ignition []byte) ([]byte, error) {
+	if len(bc.Spec.Users) == 0 {
+		return ignition, nil
+	}
+	type user struct {
+		Name              string   `json:"name"`
+		PasswordHash      *string  `json:"passwordHash,omitempty"`
+		SSHAuthorizedKeys []string `json:"sshAuthorizedKeys,omitempty"`
+	}
+	users := make([]user, 0, len(bc.Spec.Users))
+	for _, spec := range bc.Spec.Users {
+		var keys []string
+		for _, source := range spec.SSHAuthorizedKeysFrom {
+			more, err := r.authorizedKeys(ctx, bc.Namespace, spec.Name, source)
+			if err != nil {
+				return nil, fmt.Errorf("user %s: %w", spec.Name, err)
+			}
+			keys = userdir.AppendKeys(keys, more...)
+		}
+		var hash *string
+		if spec.PasswordFrom != nil {
+			h, err := r.passwordHash(ctx, bc.Namespace, spec.PasswordFrom)
+			if err != nil {
+				return nil, fmt.Errorf("user %s: %w", spec.Name, err)
+			}
+			hash = &h
+		}
+		users = append(users, user{Name: spec.Name, PasswordHash: hash, SSHAuthorizedKeys: keys})
+	}
+
+	snippet, err := json.Marshal(map[string]any{
+		"ignition": map[string]string{"version": "3.0.0"},
+		"passwd":   map[string]any{"users": users},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return render.Merge(ignition, snippet, bc.Spec.Translation.RenderOptions())
+}
+
+// passwordHash hashes the plaintext password held by the Secret key ref
+// selects. A trailing newline, as left by editors and kubectl create secret
+// --from-file, is not part of the password.
+func (r *ButaneConfigReconciler) passwordHash(ctx context.Context, namespace string, ref *corev1.SecretKeySelector) (string, error) {
+	var secret corev1.Secret
+	if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, &secret); err != nil {
+		return "", fmt.Errorf("failed to get password Secret %s: %w", ref.Name, err)
+	}
+	password, ok := secret.Data[ref.Key]
+	if !ok {
+		return "", fmt.Errorf("password Secret %s has no key %s", ref.Name, ref.Key)
+	}
+	text := strings.TrimSuffix(strings.TrimSuffix(string(password), "\n"), "\r")
+	if text == "" {
+		return "", fmt.Errorf("password Secret %s has an empty key %s", ref.Name, ref.Key)
+	}
+	return render.HashPassword(text, string(secret.UID))
+}
+
+// authorizedKeys returns the SSH authorized keys of a source of spec.users:
+// every value of the selected Secrets or ConfigMaps, read in name order, or
+// the keys the user directory lists for the user.
+func (r *ButaneConfigReconciler) authorizedKeys(ctx context.Context, namespace, user string, source butanev1beta1.SSHAuthorizedKeysSource) ([]string, error) {
+	if source.Directory {
+		return r.Directory.Keys(user)
+	}
+
+	var texts []string
+	switch {
+	case source.SecretSelector != nil:
+		selector, err := metav1.LabelSelectorAsSelector(source.SecretSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid secretSelector: %w", err)
+		}
+		var list corev1.SecretList
+		if err := r.List(ctx, &list, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+			return nil, fmt.Errorf("failed to list key Secrets: %w", err)
+		}
+		sort.Slice(list.Items, func(i, j int) bool { return list.Items[i].Name < list.Items[j].Name })
+		for _, secret := range list.Items {
+			// The Ignition a ButaneConfig generates never holds keys of its own
+			if generatedSecret(&secret) {
+				continue
+			}
+			for _, key := range slices.Sorted(maps.Keys(secret.Data)) {
+				texts = append(texts, string(secret.Data[key]))
+			}
+		}
+	case source.ConfigMapSelector != nil:
+		selector, err := metav1.LabelSelectorAsSelector(source.ConfigMapSelector)
+		if err != nil {
+			return nil, fmt.Errorf("invalid configMapSelector: %w", err)
+		}
+		var list corev1.ConfigMapList
+		if err := r.List(ctx, &list, client.InNamespace(namespace), client.MatchingLabelsSelector{Selector: selector}); err != nil {
+			return nil, fmt.Errorf("failed to list key ConfigMaps: %w", err)
+		}
+		sort.Slice(list.Items, func(i, j int) bool { return list.Items[i].Name < list.Items[j].Name })
+		for _, cm := range list.Items {
+			for _, key := range slices.Sorted(maps.Keys(cm.Data)) {
+				texts = append(texts, cm.Data[key])
+			}
+		}
+	}
+
+	var keys []string
+	for _, text := range texts {
+		keys = userdir.AppendKeys(keys, userdir.ParseAuthorizedKeys(text)...)
+	}
+	return keys, nil
+}
+
+// pinImages rewrites the container images of the config to their digests
+// when spec.images.pin is set, and records the digests in status. A digest
+// recorded for a reference is reused, so that the output only changes when
+// the references do; the others are resolved against their registry.
+func (r *ButaneConfigReconciler) pinImages(ctx context.Context, bc *butanev1beta1.ButaneConfig, ignition []byte) ([]byte, error) {
+	if !bc.Spec.Images.Pin {
+		bc.Status.PinnedImages = nil
+		return ignition, nil
+	}
+	refs, err := render.FindImages(ignition)
+	if err != nil {
+		return nil, err
+	}
+
+	recorded := make(map[string]string, len(bc.Status.PinnedImages))
+	for _, pinned := range bc.Status.PinnedImages {
+		recorded[pinned.Image] = pinned.Digest
+	}
+	resolver := r.Images
+	if resolver == nil {
+		resolver = &images.Resolver{}
+	}
+	var credentials map[string]images.Credentials
+	digests := make(map[string]string, len(refs))
+	for _, ref := range refs {
+		if _, ok := digests[ref.Image]; ok {
+			continue
+		}
+		if digest, ok := recorded[ref.Image]; ok {
+			digests[ref.Image] = digest
+			continue
+		}
+		if credentials == nil {
+			if credentials, err = r.pullCredentials(ctx, bc); err != nil {
+				return nil, err
+			}
+		}
+		parsed, err := images.ParseReference(ref.Image)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", ref.Location, err)
+		}
+		digest, err := resolver.Resolve(ctx, parsed, credentials)
+		if err != nil {
+			return nil, fmt.Errorf("%s: failed to resolve %s: %w", ref.Location, ref.Image, err)
+		}
+		digests[ref.Image] = digest
+	}
+
+	bc.Status.PinnedImages = make([]butanev1beta1.PinnedImage, 0, len(digests))
+	for _, image := range slices.Sorted(maps.Keys(digests)) {
+		bc.Status.PinnedImages = append(bc.Status.PinnedImages, butanev1beta1.PinnedImage{Image: image, Digest: digests[image]})
+	}
+	return render.PinImages(ignition, digests, bc.Spec.Translation.RenderOptions())
+}
+
+// pullCredentials returns the registry credentials of the Secret of
+// spec.images.pullSecretRef, or none when it is not set.
+func (r *ButaneConfigReconciler) pullCredentials(ctx context.Context, bc *butanev1beta1.ButaneConfig) (map[string]images.Credentials, error) {
+	return r.registryCredentials(ctx, bc.Namespace, bc.Spec.Images.PullSecretRef, "pull")
+}
+
+// registryCredentials returns the registry credentials of the
+// kubernetes.io/dockerconfigjson Secret ref, or none when ref is nil. use
+// names the Secret in errors, e.g. pull.
+func (r *ButaneConfigReconciler) registryCredentials(ctx context.Context, namespace string, ref *corev1.LocalObjectReference, use string) (map[string]images.Credentials, error) {
+	if ref == nil {
+		return map[string]images.Credentials{}, nil
+	}
+	var secret corev1.Secret
+	if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, &secret); err != nil {
+		return nil, fmt.Errorf("failed to get %s Secret %s: %w", use, ref.Name, err)
+	}
+	data, ok := secret.Data[corev1.DockerConfigJsonKey]
+	if !ok {
+		return nil, fmt.Errorf("%s Secret %s has no key %s", use, ref.Name, corev1.DockerConfigJsonKey)
+	}
+	credentials, err := images.ParseDockerConfig(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s Secret %s: %w", use, ref.Name, err)
+	}
+	return credentials, nil
+}
+
+// injectionPolicies returns the ButaneInjectionPolicies selecting the
+// ButaneConfig, sorted by name.
+func (r *ButaneConfigReconciler) injectionPolicies(ctx context.Context, bc *butanev1beta1.ButaneConfig) ([]butanev1beta1.ButaneInjectionPolicy, error) {
+	var list butanev1beta1.ButaneInjectionPolicyList
+	if err := r.List(ctx, &list); err != nil {
+		return nil, fmt.Errorf("failed to list ButaneInjectionPolicies: %w", err)
+	}
+	if len(list.Items) == 0 {
+		return nil, nil
+	}
+	var ns corev1.Namespace
+	if err := r.Get(ctx, client.ObjectKey{Name: bc.Namespace}, &ns); err != nil && !apierrors.IsNotFound(err) {
+		return nil, fmt.Errorf("failed to get namespace %s: %w", bc.Namespace, err)
+	}
+
+	var policies []butanev1beta1.ButaneInjectionPolicy
+	for _, policy := range list.Items {
+		ok, err := policy.Spec.Selects(ns.Labels, bc.Labels)
+		if err != nil {
+			return nil, fmt.Errorf("invalid selector in ButaneInjectionPolicy %s: %w", policy.Name, err)
+		}
+		if ok {
+			policies = append(policies, policy)
+		}
+	}
+	sort.Slice(policies, func(i, j int) bool { return policies[i].Name < policies[j].Name })
+	return policies, nil
+}
+
+// protectedOutput is what gets stored for a ButaneConfig once its output
+// settings have been applied to the Ignition config.
+type protectedOutput struct {
+	// userdata is the content of the Ignition Secret.
+	userdata []byte
+	// mode is the encryption mode applied, empty when the output is plain.
+	mode butanev1beta1.EncryptionMode
+	// files holds the contents moved out of the Ignition config by the remote mode.
+	files map[string][]byte
+	// digest identifies the plaintext and recipients userdata was encrypted
+	// from in age mode.
+	digest string
+}
+
+// protectOutput applies spec.output.encryption to the Ignition config. Age
+// encryption is randomised, so the ciphertext of the current Secret is kept
+// while it was encrypted from the same plaintext to the same recipients, so
+// that the Secret does not change on every reconciliation.
+func (r *ButaneConfigReconciler) protectOutput(ctx context.Context, bc *butanev1beta1.ButaneConfig, secretName string, ignition []byte) (protectedOutput, error) {
+	if bc.Spec.Output.Encryption == nil {
+		return protectedOutput{userdata: ignition}, nil
+	}
+	enc := bc.Spec.Output.Encryption
+
+	switch enc.Mode {
+	case butanev1beta1.EncryptionModeRemote:
+		if enc.Remote == nil {
+			return protectedOutput{}, fmt.Errorf("spec.output.encryption.remote is required in remote mode")
+		}
+		headers, err := r.httpHeaders(ctx, bc, enc.Remote.HeadersSecretRef)
+		if err != nil {
+			return protectedOutput{}, err
+		}
+		userdata, files, err := encryption.Externalize(ignition, enc.Remote.URL, enc.Remote.Paths, headers)
+		if err != nil {
+			return protectedOutput{}, err
+		}
+		return protectedOutput{userdata: userdata, mode: enc.Mode, files: files}, nil
+
+	default:
+		ref := enc.RecipientsRef
+		if ref == nil {
+			return protectedOutput{}, fmt.Errorf("spec.output.encryption.recipientsRef is required in age mode")
+		}
+		var cm corev1.ConfigMap
+		if err := r.Get(ctx, client.ObjectKey{Namespace: bc.Namespace, Name: ref.Name}, &cm); err != nil {
+			return protectedOutput{}, fmt.Errorf("failed to get recipients ConfigMap %s: %w", ref.Name, err)
+		}
+		text, ok := cm.Data[ref.Key]
+		if !ok {
+			return protectedOutput{}, fmt.Errorf("recipients ConfigMap %s has no key %s", ref.Name, ref.Key)
+		}
+		recipients, err := encryption.ParseRecipients(text)
+		if err != nil {
+			return protectedOutput{}, fmt.Errorf("recipients ConfigMap %s: %w", ref.Name, err)
+		}
+		sum := sha256.New()
+		sum.Write([]byte(text))
+		sum.Write([]byte{0})
+		sum.Write(ignition)
+		digest := "sha256:" + hex.EncodeToString(sum.Sum(nil))
+
+		var current corev1.Secret
+		if err := r.Get(ctx, client.ObjectKey{Namespace: bc.Namespace, Name: secretName}, &current); err == nil {
+			if userdata := butanev1beta1.IgnitionData(current.Data); len(userdata) > 0 &&
+				current.Annotations[butanev1beta1.AnnotationEncryption] == string(butanev1beta1.EncryptionModeAge) &&
+				current.Annotations[butanev1beta1.AnnotationPlaintextDigest] == digest {
+				return protectedOutput{userdata: userdata, mode: butanev1beta1.EncryptionModeAge, digest: digest}, nil
+			}
+		} else if !apierrors.IsNotFound(err) {
+			return protectedOutput{}, err
+		}
+
+		userdata, err := encryption.Age(ignition, recipients)
+		if err != nil {
+			return protectedOutput{}, err
+		}
+		return protectedOutput{userdata: userdata, mode: butanev1beta1.EncryptionModeAge, digest: digest}, nil
+	}
+}
+
+// httpHeaders returns the HTTP headers held by the Secret ref selects, if any.
+func (r *ButaneConfigReconciler) httpHeaders(ctx context.Context, bc *butanev1beta1.ButaneConfig, ref *corev1.LocalObjectReference) (map[string]string, error) {
+	headers := map[string]string{}
+	if ref == nil {
+		return headers, nil
+	}
+	var secret corev1.Secret
+	if err := r.Get(ctx, client.ObjectKey{Namespace: bc.Namespace, Name: ref.Name}, &secret); err != nil {
+		return nil, fmt.Errorf("failed to get headers Secret %s: %w", ref.Name, err)
+	}
+	for name, value := range secret.Data {
+		headers[name] = string(value)
+	}
+	return headers, nil
+}
+
+// fitOutput shrinks the Ignition config: uncompressed inline contents are
+// gzipped, and files larger than the threshold of spec.output.size.spill are
+// moved out of it. The spilled contents are returned by key.
+func (r *ButaneConfigReconciler) fitOutput(ctx context.Context, bc *butanev1beta1.ButaneConfig, ignition []byte) ([]byte, map[string][]byte, error) {
+	opts := bc.Spec.Translation.RenderOptions()
+	if !opts.NoResourceAutoCompression {
+		compressed, _, err := render.Compress(ignition, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		ignition = compressed
+	}
+
+	size := bc.Spec.Output.Size
+	if size == nil || size.Spill == nil {
+		return ignition, nil, nil
+	}
+	paths, err := render.LargeFiles(ignition, r.spillThreshold(size.Spill))
+	if err != nil || len(paths) == 0 {
+		return ignition, nil, err
+	}
+	headers, err := r.httpHeaders(ctx, bc, size.Spill.HeadersSecretRef)
+	if err != nil {
+		return nil, nil, err
+	}
+	return encryption.Externalize(ignition, size.Spill.URL, paths, headers)
+}
+
+// writeSpilled stores each spilled file in its own Secret, so that no Secret
+// grows past the limit of the API server, and deletes the Secrets of files
+// that are not spilled anymore. It returns the names of the Secrets, sorted.
+func (r *ButaneConfigReconciler) writeSpilled(ctx context.Context, bc *butanev1beta1.ButaneConfig, spilled map[string][]byte) ([]string, error) {
+	names := make([]string, 0, len(spilled))
+	current := make(map[string]bool, len(spilled))
+	for key, data := range spilled {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      fmt.Sprintf("%s-ignition-spill-%s", bc.Name, key[:12]),
+				Namespace: bc.Namespace,
+				Labels:    map[string]string{butanev1beta1.LabelSpilledFrom: bc.Name},
+			},
+			Data: map[string][]byte{key: data},
+		}
+		if err := r.writeSecret(ctx, bc, secret); err != nil {
+			return nil, err
+		}
+		names = append(names, secret.Name)
+		current[secret.Name] = true
+	}
+	sort.Strings(names)
+
+	var existing corev1.SecretList
+	if err := r.List(ctx, &existing, client.InNamespace(bc.Namespace), client.MatchingLabels{butanev1beta1.LabelSpilledFrom: bc.Name}); err != nil {
+		r.setReady(ctx, bc, metav1.ConditionFalse, butanev1beta1.ReasonSecretWriteFailed, err.Error())
+		return nil, err
+	}
+	for i := range existing.Items {
+		stale := &existing.Items[i]
+		if current[stale.Name] || !metav1.IsControlledBy(stale, bc) {
+			continue
+		}
+		if err := r.Delete(ctx, stale); err != nil && !apierrors.IsNotFound(err) {
+			r.setReady(ctx, bc, metav1.ConditionFalse, butanev1beta1.ReasonSecretWriteFailed, err.Error())
+			return nil, err
+		}
+		metrics.SecretWrites.WithLabelValues("delete").Inc()
+	}
+	return names, nil
+}
+
+// recordRevision sets the revision of the Ignition Secret secret, which
+// increases each time its Ignition changes. The Ignition it replaces is kept
+// in a Secret named after its revision, and the revisions past
+// spec.output.revisionHistoryLimit are deleted.
+func (r *ButaneConfigReconciler) recordRevision(ctx context.Context, bc *butanev1beta1.ButaneConfig, secret *corev1.Secret) error {
+	revision := 1
+	var current corev1.Secret
+	err := r.Get(ctx, client.ObjectKeyFromObject(secret), &current)
+	switch {
+	case apierrors.IsNotFound(err):
+	case err != nil:
+		r.setReady(ctx, bc, metav1.ConditionFalse, butanev1beta1.ReasonSecretWriteFailed, err.Error())
+		return err
+	default:
+		// Secrets written before revisions were recorded hold revision 1
+		if n, err := strconv.Atoi(current.Annotations[butanev1beta1.AnnotationRevision]); err == nil && n > 0 {
+			revision = n
+		}
+		if previous := butanev1beta1.IgnitionData(current.Data); previous != nil &&
+			!bytes.Equal(previous, butanev1beta1.IgnitionData(secret.Data)) {
+			if bc.Spec.Output.RevisionLimit() > 0 {
+				if err := r.writeSecret(ctx, bc, revisionSecret(bc, &current, revision)); err != nil {
+					return err
+				}
+			}
+			revision++
+		}
+	}
+	if secret.Annotations == nil {
+		secret.Annotations = map[string]string{}
+	}
+	secret.Annotations[butanev1beta1.AnnotationRevision] = strconv.Itoa(revision)
+
+	var existing corev1.SecretList
+	if err := r.List(ctx, &existing, client.InNamespace(bc.Namespace), client.MatchingLabels{butanev1beta1.LabelRevisionOf: bc.Name}); err != nil {
+		r.setReady(ctx, bc, metav1.ConditionFalse, butanev1beta1.ReasonSecretWriteFailed, err.Error())
+		return err
+	}
+	oldest := revision - bc.Spec.Output.RevisionLimit()
+	for i := range existing.Items {
+		stale := &existing.Items[i]
+		n, err := strconv.Atoi(stale.Annotations[butanev1beta1.AnnotationRevision])
+		if (err == nil && n >= oldest && n < revision) || !metav1.IsControlledBy(stale, bc) {
+			continue
+		}
+		if err := r.Delete(ctx, stale); err != nil && !apierrors.IsNotFound(err) {
+			r.setReady(ctx, bc, metav1.ConditionFalse, butanev1beta1.ReasonSecretWriteFailed, err.Error())
+			return err
+		}
+		metrics.SecretWrites.WithLabelValues("delete").Inc()
+	}
+	return nil
+}
+
+// revisionSecret returns the Secret keeping the userdata and Ignition of the
+// Ignition Secret current as revision of the ButaneConfig.
+func revisionSecret(bc *butanev1beta1.ButaneConfig, current *corev1.Secret, revision int) *corev1.Secret {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        RevisionSecretName(current.Name, revision),
+			Namespace:   bc.Namespace,
+			Labels:      map[string]string{butanev1beta1.LabelRevisionOf: bc.Name},
+			Annotations: map[string]string{butanev1beta1.AnnotationRevision: strconv.Itoa(revision)},
+		},
+		Data: map[string][]byte{butanev1beta1.KeyUserdata: current.Data[butanev1beta1.KeyUserdata]},
+	}
+	if ignition, ok := current.Data[butanev1beta1.KeyIgnitionFile]; ok {
+		secret.Data[butanev1beta1.KeyIgnitionFile] = ignition
+	}
+	if mode, ok := current.Annotations[butanev1beta1.AnnotationEncryption]; ok {
+		secret.Annotations[butanev1beta1.AnnotationEncryption] = mode
+	}
+	return secret
+}
+
+// RevisionSecretName returns the name of the Secret keeping the given
+// revision of the Ignition Secret secretName.
+func RevisionSecretName(secretName string, revision int) string {
+	return fmt.Sprintf("%s-rev-%d", secretName, revision)
+}
+
+// sizeLimit returns the size limit of the output, in bytes, taking the default
+// from the operator config.
+func (r *ButaneConfigReconciler) sizeLimit(output *butanev1beta1.OutputSpec) int64 {
+	if output.Size == nil || output.Size.Limit == nil {
+		if limit := r.Config.Get().Defaults.SizeLimit; limit != nil {
+			return limit.Value()
+		}
+	}
+	return output.SizeLimit()
+}
+
+// spillThreshold returns the size above which files are spilled, in bytes,
+// taking the default from the operator config.
+func (r *ButaneConfigReconciler) spillThreshold(spill *butanev1beta1.SpillSpec) int64 {
+	if spill.Threshold == nil {
+		if threshold := r.Config.Get().Defaults.SpillThreshold; threshold != nil {
+			return threshold.Value()
+		}
+	}
+	return spill.ThresholdBytes()
+}
+
+// secretDataSize returns the size of the data of a Secret, as the API server
+// counts it against its limit.
+func secretDataSize(data map[string][]byte) int64 {
+	var size int64
+	for _, value := range data {
+		size += int64(len(value))
+	}
+	return size
+}
+
+// variantOutput returns the Secret keys that the tooling of variant expects:
+// the Ignition config under the name Flatcar provisioning reads, or for an
+// OpenShift config also the MachineConfig wrapping it in userdata, as
+// Butane translates openshift configs.
+func (r *ButaneConfigReconciler) variantOutput(bc *butanev1beta1.ButaneConfig, variant string, butane []byte, output protectedOutput) (map[string][]byte, error) {
+	switch variant {
+	case render.VariantFlatcar:
+		return map[string][]byte{butanev1beta1.KeyIgnitionFile: output.userdata}, nil
+	case render.VariantOpenShift:
+		// A MachineConfig embeds the Ignition config in clear
+		if bc.Spec.Output.Encryption != nil {
+			return map[string][]byte{butanev1beta1.KeyIgnitionFile: output.userdata}, nil
+		}
+		mc, _, err := render.MachineConfig(butane, r.translateOptions(bc))
+		if err != nil {
+			return nil, err
+		}
+		// Wrap the config as stored in userdata, e.g. converted or with
+		// files spilled out of it
+		if mc, err = render.EmbedIgnition(mc, output.userdata); err != nil {
+			return nil, err
+		}
+		return map[string][]byte{butanev1beta1.KeyIgnitionFile: output.userdata, butanev1beta1.KeyUserdata: mc}, nil
+	}
+	return nil, nil
+}
+
+// signOutput returns the signing artifacts for userdata. The artifacts of the
+// current Secret are kept while they still describe userdata, so that the
+// Secret does not change on every reconciliation.
+func (r *ButaneConfigReconciler) signOutput(ctx context.Context, bc *butanev1beta1.ButaneConfig, secretName string, userdata []byte) (map[string][]byte, error) {
+	if bc.Spec.Output.Signing == nil {
+		return nil, nil
+	}
+	ref := bc.Spec.Output.Signing.KeySecretRef
+
+	var keySecret corev1.Secret
+	if err := r.Get(ctx, client.ObjectKey{Namespace: bc.Namespace, Name: ref.Name}, &keySecret); err != nil {
+		return nil, fmt.Errorf("failed to get signing key Secret %s: %w", ref.Name, err)
+	}
+	keyPEM, ok := keySecret.Data[ref.Key]
+	if !ok {
+		return nil, fmt.Errorf("signing key Secret %s has no key %s", ref.Name, ref.Key)
+	}
+	signer, err := signing.ParsePrivateKey(keyPEM)
+	if err != nil {
+		return nil, fmt.Errorf("signing key Secret %s: %w", ref.Name, err)
+	}
+
+	subject := signing.Subject{
+		Namespace:  bc.Namespace,
+		Name:       bc.Name,
+		UID:        string(bc.UID),
+		Generation: bc.Generation,
+	}
+	var current corev1.Secret
+	if err := r.Get(ctx, client.ObjectKey{Namespace: bc.Namespace, Name: secretName}, &current); err == nil {
+		existing := signing.Artifacts{
+			Signature:           current.Data[signing.SignatureKey],
+			Provenance:          current.Data[signing.ProvenanceKey],
+			ProvenanceSignature: current.Data[signing.ProvenanceSignatureKey],
+		}
+		if signing.Current(existing, signer.Public(), userdata, subject) {
+			return existing.Data(), nil
+		}
+	} else if !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	artifacts, err := signing.SignOutput(signer, userdata, subject, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return artifacts.Data(), nil
+}
+
+// pushOutput pushes userdata to the repository of spec.output.oci, annotated
+// with its encryption mode and signing artifacts, and records the artifact in
+// status. Nothing is pushed when status records the artifact already, tagged
+// with the current generation. Nothing is pushed in dry-run mode either.
+func (r *ButaneConfigReconciler) pushOutput(ctx context.Context, bc *butanev1beta1.ButaneConfig, output protectedOutput, signatures map[string][]byte) error {
+	oci := bc.Spec.Output.OCI
+	if oci == nil {
+		bc.Status.OCIArtifact = nil
+		return nil
+	}
+	if r.DryRun {
+		return nil
+	}
+	ref, err := images.ParseRepository(oci.Repository)
+	if err != nil {
+		return reconcile.TerminalError(err)
+	}
+
+	annotations := map[string]string{}
+	if output.mode != "" {
+		annotations[butanev1beta1.AnnotationEncryption] = string(output.mode)
+	}
+	for key, annotation := range map[string]string{
+		signing.SignatureKey:           butanev1beta1.AnnotationSignature,
+		signing.ProvenanceKey:          butanev1beta1.AnnotationProvenance,
+		signing.ProvenanceSignatureKey: butanev1beta1.AnnotationProvenanceSignature,
+	} {
+		if value, ok := signatures[key]; ok {
+			annotations[annotation] = string(value)
+		}
+	}
+	artifact := images.Artifact{
+		ArtifactType: butanev1beta1.MediaTypeIgnition,
+		Layers: []images.Blob{{
+			MediaType:   butanev1beta1.MediaTypeIgnition,
+			Data:        output.userdata,
+			Annotations: map[string]string{"org.opencontainers.image.title": butanev1beta1.KeyIgnitionFile},
+		}},
+		Annotations: annotations,
+	}
+	_, digest, err := artifact.Manifest()
+	if err != nil {
+		return err
+	}
+	pushed := &butanev1beta1.OCIArtifact{
+		Repository: ref.String(),
+		Digest:     digest,
+		Tags: []string{
+			fmt.Sprintf("generation-%d", bc.Generation),
+			"sha256-" + signing.Digest(output.userdata)["sha256"],
+		},
+	}
+	if reflect.DeepEqual(bc.Status.OCIArtifact, pushed) {
+		return nil
+	}
+
+	credentials, err := r.registryCredentials(ctx, bc.Namespace, oci.PushSecretRef, "push")
+	if err != nil {
+		return err
+	}
+	pusher := r.Pusher
+	if pusher == nil {
+		pusher = &images.Pusher{}
+	}
+	if _, err := pusher.Push(ctx, ref, artifact, pushed.Tags, credentials); err != nil {
+		return fmt.Errorf("failed to push to %s: %w", ref, err)
+	}
+	bc.Status.OCIArtifact = pushed
+	return nil
+}
+
+// uploadOutput uploads userdata to the object of spec.output.s3 and records
+// it in status, deleting the object left behind when its location changed.
+// Nothing is uploaded when status records the object already. With
+// spec.output.s3.presignedURL, the pointer Ignition config is written to its
+// Secret and renewed once half of the validity of its URL has passed; the
+// returned duration is when to reconcile again to renew it. Nothing is
+// uploaded in dry-run mode.
+func (r *ButaneConfigReconciler) uploadOutput(ctx context.Context, bc *butanev1beta1.ButaneConfig, output protectedOutput) (time.Duration, error) {
+	userdata := output.userdata
+	spec := bc.Spec.Output.S3
+	if spec == nil {
+		bc.Status.S3Object = nil
+		return 0, r.deletePointer(ctx, bc)
+	}
+	if r.DryRun {
+		return 0, nil
+	}
+	storage, err := r.s3Client(ctx, bc.Namespace, spec.Endpoint, spec.Region, spec.CredentialsSecretRef)
+	if err != nil {
+		return 0, err
+	}
+	uploaded := &butanev1beta1.S3Object{
+		Endpoint: spec.Endpoint,
+		Region:   spec.Region,
+		Bucket:   spec.Bucket,
+		Key:      spec.ObjectKey(bc.Namespace, bc.Name, bc.Generation),
+		Digest:   "sha256:" + signing.Digest(userdata)["sha256"],
+
+		CredentialsSecretName: spec.CredentialsSecretRef.Name,
+	}
+	previous := bc.Status.S3Object
+	moved := previous != nil && (previous.Endpoint != uploaded.Endpoint || previous.Bucket != uploaded.Bucket || previous.Key != uploaded.Key)
+	if previous == nil || moved || previous.Digest != uploaded.Digest {
+		if err := storage.PutObject(ctx, uploaded.Bucket, uploaded.Key, userdata, "application/json"); err != nil {
+			return 0, err
+		}
+	}
+	if moved {
+		// The previous location may be gone for good, so failing to clean it
+		// up does not fail the upload
+		if err := r.deleteObject(ctx, bc, previous); err != nil {
+			r.Recorder.Eventf(bc, nil, corev1.EventTypeWarning, "S3DeleteFailed", "S3DeleteFailed", "Failed to delete the previous object s3://%s/%s: %v", previous.Bucket, previous.Key, err)
+		}
+	}
+
+	if spec.PresignedURL == nil {
+		bc.Status.S3Object = uploaded
+		return 0, r.deletePointer(ctx, bc)
+	}
+	if output.mode == butanev1beta1.EncryptionModeAge {
+		return 0, reconcile.TerminalError(fmt.Errorf("spec.output.s3.presignedURL cannot point Ignition to a config encrypted with %s", output.mode))
+	}
+	expiry := spec.PresignedURL.ExpiryDuration()
+	if !moved && previous != nil && previous.Digest == uploaded.Digest && previous.URLExpiresAt != nil && bc.Status.PointerSecretName != "" {
+		if renewal := time.Until(previous.URLExpiresAt.Add(-expiry / 2)); renewal > 0 {
+			uploaded.URLExpiresAt = previous.URLExpiresAt
+			bc.Status.S3Object = uploaded
+			return renewal, nil
+		}
+	}
+	now := time.Now()
+	source, err := storage.PresignGetObject(uploaded.Bucket, uploaded.Key, expiry)
+	if err != nil {
+		return 0, reconcile.TerminalError(err)
+	}
+	pointer, err := render.PointerConfig(bc.Status.IgnitionVersion, source, userdata)
+	if err != nil {
+		return 0, reconcile.TerminalError(err)
+	}
+	pointerSecret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      fmt.Sprintf("%s-ignition-pointer", bc.Name),
+			Namespace: bc.Namespace,
+		},
+		Data: map[string][]byte{butanev1beta1.KeyUserdata: pointer},
+	}
+	if err := r.writeSecret(ctx, bc, pointerSecret); err != nil {
+		return 0, err
+	}
+	uploaded.URLExpiresAt = &metav1.Time{Time: now.Add(expiry)}
+	bc.Status.S3Object = uploaded
+	bc.Status.PointerSecretName = pointerSecret.Name
+	return expiry / 2, nil
+}
+
+// deletePointer deletes the pointer Ignition config Secret recorded in status,
+// once spec.output.s3.presignedURL is not set anymore.
+func (r *ButaneConfigReconciler) deletePointer(ctx context.Context, bc *butanev1beta1.ButaneConfig) error {
+	if bc.Status.PointerSecretName == "" {
+		return nil
+	}
+	stale := &corev1.Secret{ObjectMeta: metav1.ObjectMeta{Name: bc.Status.PointerSecretName, Namespace: bc.Namespace}}
+	if err := r.Delete(ctx, stale); err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	metrics.SecretWrites.WithLabelValues("delete").Inc()
+	bc.Status.PointerSecretName = ""
+	return nil
+}
+
+// deleteObject deletes an S3 object recorded in status, with the credentials
+// it was uploaded with.
+func (r *ButaneConfigReconciler) deleteObject(ctx context.Context, bc *butanev1beta1.ButaneConfig, object *butanev1beta1.S3Object) error {
+	ref := corev1.LocalObjectReference{Name: object.CredentialsSecretName}
+	storage, err := r.s3Client(ctx, bc.Namespace, object.Endpoint, object.Region, ref)
+	if err != nil {
+		return err
+	}
+	return storage.DeleteObject(ctx, object.Bucket, object.Key)
+}
+
+// releaseObject deletes the S3 object recorded in status, then removes the
+// finalizer that held it. When the credentials Secret is gone, e.g. deleted
+// along with the namespace, the object is left in the bucket rather than
+// holding the ButaneConfig forever. Nothing is deleted in dry-run mode.
+func (r *ButaneConfigReconciler) releaseObject(ctx context.Context, bc *butanev1beta1.ButaneConfig) error {
+	if object := bc.Status.S3Object; object != nil && !r.DryRun {
+		err := r.deleteObject(ctx, bc, object)
+		switch {
+		case apierrors.IsNotFound(err):
+			r.Recorder.Eventf(bc, nil, corev1.EventTypeWarning, "S3ObjectLeft", "S3ObjectLeft", "Left s3://%s/%s in place: %v", object.Bucket, object.Key, err)
+		case err != nil:
+			r.Recorder.Eventf(bc, nil, corev1.EventTypeWarning, "S3DeleteFailed", "S3DeleteFailed", "Failed to delete s3://%s/%s: %v", object.Bucket, object.Key, err)
+			return err
+		default:
+			r.Recorder.Eventf(bc, nil, corev1.EventTypeNormal, "S3ObjectDeleted", "S3ObjectDeleted", "Deleted s3://%s/%s", object.Bucket, object.Key)
+		}
+	}
+	if bc.DeletionTimestamp.IsZero() && bc.Status.S3Object != nil {
+		// spec.output.s3 was removed: forget the object before the finalizer
+		// stops guarding it
+		bc.Status.S3Object = nil
+		if err := r.Status().Update(ctx, bc); err != nil {
+			return err
+		}
+	}
+	controllerutil.RemoveFinalizer(bc, butanev1beta1.FinalizerS3Object)
+	return r.Update(ctx, bc)
+}
+
+// s3Client returns a client of the S3 endpoint, authenticated with the
+// credentials of the Secret ref names.
+func (r *ButaneConfigReconciler) s3Client(ctx context.Context, namespace, endpoint, region string, ref corev1.LocalObjectReference) (*s3.Client, error) {
+	var secret corev1.Secret
+	if err := r.Get(ctx, client.ObjectKey{Namespace: namespace, Name: ref.Name}, &secret); err != nil {
+		return nil, fmt.Errorf("failed to get S3 credentials Secret %s: %w", ref.Name, err)
+	}
+	for _, key := range []string{butanev1beta1.KeyAccessKeyID, butanev1beta1.KeySecretAccessKey} {
+		if len(secret.Data[key]) == 0 {
+			return nil, fmt.Errorf("S3 credentials Secret %s has no %s key", ref.Name, key)
+		}
+	}
+	return &s3.Client{
+		Endpoint: endpoint,
+		Region:   region,
+		Credentials: s3.Credentials{
+			AccessKeyID:     string(secret.Data[butanev1beta1.KeyAccessKeyID]),
+			SecretAccessKey: string(secret.Data[butanev1beta1.KeySecretAccessKey]),
+			SessionToken:    string(secret.Data[butanev1beta1.KeySessionToken]),
+		},
+	}, nil
+}
+
+// referencesObject reports whether bc reads obj, so that editing the Butane
+// ConfigMap or rotating recipients, credentials or keys re-renders the config.
+func referencesObject(bc *butanev1beta1.ButaneConfig, obj client.Object) bool {
+	if bc.Namespace != obj.GetNamespace() {
+		return false
+	}
+	if selectsKeys(bc, obj) {
+		return true
+	}
+	output := bc.Spec.Output
+	enc := output.Encryption
+	switch obj.(type) {
+	case *corev1.ConfigMap:
+		if bc.Spec.ButaneFrom != nil && bc.Spec.ButaneFrom.Name == obj.GetName() {
+			return true
+		}
+		return enc != nil && enc.RecipientsRef != nil && enc.RecipientsRef.Name == obj.GetName()
+	case *corev1.Secret:
+		for _, user := range bc.Spec.Users {
+			if user.PasswordFrom != nil && user.PasswordFrom.Name == obj.GetName() {
+				return true
+			}
+		}
+		if ref := bc.Spec.Images.PullSecretRef; ref != nil && ref.Name == obj.GetName() {
+			return true
+		}
+		if oci := output.OCI; oci != nil && oci.PushSecretRef != nil && oci.PushSecretRef.Name == obj.GetName() {
+			return true
+		}
+		if output.S3 != nil && output.S3.CredentialsSecretRef.Name == obj.GetName() {
+			return true
+		}
+		if output.Signing != nil && output.Signing.KeySecretRef.Name == obj.GetName() {
+			return true
+		}
+		if size := output.Size; size != nil && size.Spill != nil && size.Spill.HeadersSecretRef != nil && size.Spill.HeadersSecretRef.Name == obj.GetName() {
+			return true
+		}
+		return enc != nil && enc.Remote != nil && enc.Remote.HeadersSecretRef != nil && enc.Remote.HeadersSecretRef.Name == obj.GetName()
+	}
+	return false
+}
+
+// selectsKeys reports whether a source of spec.users selects obj, a Secret or
+// ConfigMap holding SSH authorized keys. Updates are mapped from both the old
+// and the new object, so removing the label of a revoked key re-renders too.
+func selectsKeys(bc *butanev1beta1.ButaneConfig, obj client.Object) bool {
+	for _, user := range bc.Spec.Users {
+		for _, source := range user.SSHAuthorizedKeysFrom {
+			ls := source.ConfigMapSelector
+			if _, ok := obj.(*corev1.Secret); ok {
+				ls = source.SecretSelector
+			}
+			if ls == nil {
+				continue
+			}
+			if selector, err := metav1.LabelSelectorAsSelector(ls); err == nil && selector.Matches(labels.Set(obj.GetLabels())) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// generatedSecret reports whether obj is a Secret generated for a
+// ButaneConfig, e.g. its Ignition Secret or a revision of it.
+func generatedSecret(obj client.Object) bool {
+	owner := metav1.GetControllerOf(obj)
+	return owner != nil && owner.Kind == "ButaneConfig" &&
+		strings.HasPrefix(owner.APIVersion, butanev1beta1.GroupVersion.Group+"/")
+}
+
+// configsUsingDirectory maps a user whose keys changed in the user directory
+// to the ButaneConfigs reading its keys from it.
+func (r *ButaneConfigReconciler) configsUsingDirectory(ctx context.Context, user string) []reconcile.Request {
+	var list butanev1beta1.ButaneConfigList
+	if err := r.List(ctx, &list); err != nil {
+		r.Log.Error(err, "Failed to list ButaneConfigs")
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range list.Items {
+		for _, spec := range list.Items[i].Spec.Users {
+			if spec.Name == user && slices.ContainsFunc(spec.SSHAuthorizedKeysFrom, func(s butanev1beta1.SSHAuthorizedKeysSource) bool { return s.Directory }) {
+				requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&list.Items[i])})
+				break
+			}
+		}
+	}
+	return requests
+}
+
+// configsReferencing maps a ConfigMap or Secret to the ButaneConfigs that use it.
+func (r *ButaneConfigReconciler) configsReferencing(ctx context.Context, obj client.Object) []reconcile.Request {
+	var list butanev1beta1.ButaneConfigList
+	if err := r.List(ctx, &list, client.InNamespace(obj.GetNamespace())); err != nil {
+		r.Log.Error(err, "Failed to list ButaneConfigs", "namespace", obj.GetNamespace())
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range list.Items {
+		if referencesObject(&list.Items[i], obj) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&list.Items[i])})
+		}
+	}
+	return requests
+}
+
+// configsMerging maps a ClusterButaneConfig to the ButaneConfigs that merge
+// it, directly or through the injection policies applied to them.
+func (r *ButaneConfigReconciler) configsMerging(ctx context.Context, obj client.Object) []reconcile.Request {
+	var list butanev1beta1.ButaneConfigList
+	if err := r.List(ctx, &list); err != nil {
+		r.Log.Error(err, "Failed to list ButaneConfigs")
+		return nil
+	}
+	policies, err := policiesByName(ctx, r.Client)
+	if err != nil {
+		r.Log.Error(err, "Failed to list ButaneInjectionPolicies")
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range list.Items {
+		if usesClusterConfig(&list.Items[i], obj.GetName(), policies) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&list.Items[i])})
+		}
+	}
+	return requests
+}
+
+// configsInjected maps a ButaneInjectionPolicy to the ButaneConfigs it was
+// applied to, and to those it may select now.
+func (r *ButaneConfigReconciler) configsInjected(ctx context.Context, obj client.Object) []reconcile.Request {
+	policy, ok := obj.(*butanev1beta1.ButaneInjectionPolicy)
+	if !ok {
+		return nil
+	}
+	var list butanev1beta1.ButaneConfigList
+	if err := r.List(ctx, &list); err != nil {
+		r.Log.Error(err, "Failed to list ButaneConfigs")
+		return nil
+	}
+	var requests []reconcile.Request
+	for i := range list.Items {
+		bc := &list.Items[i]
+		// Namespace labels are checked on reconcile, so only the object
+		// selector narrows the ButaneConfigs down here.
+		selector := butanev1beta1.ButaneInjectionPolicySpec{Selector: policy.Spec.Selector}
+		selected, err := selector.Selects(nil, bc.Labels)
+		if (err == nil && selected) || slices.Contains(bc.Status.AppliedPolicies, policy.Name) {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(bc)})
+		}
+	}
+	return requests
+}
+
+// configsInNamespace maps a Namespace whose labels changed to its
+// ButaneConfigs, which injection policies may select or stop selecting.
+func (r *ButaneConfigReconciler) configsInNamespace(ctx context.Context, obj client.Object) []reconcile.Request {
+	var policies butanev1beta1.ButaneInjectionPolicyList
+	if err := r.List(ctx, &policies, client.Limit(1)); err != nil || len(policies.Items) == 0 {
+		return nil
+	}
+	var list butanev1beta1.ButaneConfigList
+	if err := r.List(ctx, &list, client.InNamespace(obj.GetName())); err != nil {
+		r.Log.Error(err, "Failed to list ButaneConfigs", "namespace", obj.GetName())
+		return nil
+	}
+	requests := make([]reconcile.Request, 0, len(list.Items))
+	for i := range list.Items {
+		requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&list.Items[i])})
+	}
+	return requests
+}
+
+// policiesByName returns the ButaneInjectionPolicies by name.
+func policiesByName(ctx context.Context, c client.Reader) (map[string]*butanev1beta1.ButaneInjectionPolicy, error) {
+	var list butanev1beta1.ButaneInjectionPolicyList
+	if err := c.List(ctx, &list); err != nil {
+		return nil, err
+	}
+	policies := make(map[string]*butanev1beta1.ButaneInjectionPolicy, len(list.Items))
+	for i := range list.Items {
+		policies[list.Items[i].Name] = &list.Items[i]
+	}
+	return policies, nil
+}
+
+// usesClusterConfig reports whether a ButaneConfig merges the named
+// ClusterButaneConfig, from spec.mergeFrom or through one of the injection
+// policies recorded in its status.
+func usesClusterConfig(bc *butanev1beta1.ButaneConfig, name string, policies map[string]*butanev1beta1.ButaneInjectionPolicy) bool {
+	if mergesFrom(bc.Spec.MergeFrom, name) {
+		return true
+	}
+	for _, applied := range bc.Status.AppliedPolicies {
+		if policy, ok := policies[applied]; ok && mergesFrom(policy.Spec.MergeFrom, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// policyNames returns the names of the policies.
+func policyNames(policies []butanev1beta1.ButaneInjectionPolicy) []string {
+	var names []string
+	for _, policy := range policies {
+		names = append(names, policy.Name)
+	}
+	return names
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package encryption protects the content of generated Ignition configs
+// before they are stored in a Secret.
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"filippo.io/age/armor"
+	"github.com/vincent-petithory/dataurl"
+)
+
+// ParseRecipients parses age recipients, one per line. Native age recipients
+// and SSH public keys are accepted; empty lines and comments are ignored.
+func ParseRecipients(text string) ([]age.Recipient, error) {
+	var recipients []age.Recipient
+	scanner := bufio.NewScanner(strings.NewReader(text))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var r age.Recipient
+		var err error
+		if strings.HasPrefix(line, "ssh-") {
+			r, err = agessh.ParseRecipient(line)
+		} else {
+			var parsed []age.Recipient
+			if parsed, err = age.ParseRecipients(strings.NewReader(line)); err == nil {
+				r = parsed[0]
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid recipient on line %d: %w", n, err)
+		}
+		recipients = append(recipients, r)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(recipients) == 0 {
+		return nil, fmt.Errorf("no recipients found")
+	}
+	return recipients, nil
+}
+
+// Age encrypts the Ignition config to the recipients and returns it ASCII
+// armored, so that it can be decrypted with "age -d -i <identity>".
+func Age(ignition []byte, recipients []age.Recipient) ([]byte, error) {
+	var buf bytes.Buffer
+	armored := armor.NewWriter(&buf)
+	w, err := age.Encrypt(armored, recipients...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(ignition); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	if err := armored.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Externalize moves the inline contents of the files in paths out of the
+// Ignition config; all files with inline contents are moved when paths is
+// empty. Each file is replaced by a reference to baseURL/<key>, verified by
+// its SHA-512, and fetched with the given HTTP headers. The moved contents are
+// returned by key.
+func Externalize(ignition []byte, baseURL string, paths []string, headers map[string]string) ([]byte, map[string][]byte, error) {
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(ignition, &cfg); err != nil {
+		return nil, nil, fmt.Errorf("invalid Ignition config: %w", err)
+	}
+	if len(headers) > 0 {
+		version, _ := lookup(cfg, "ignition", "version").(string)
+		if strings.HasPrefix(version, "3.0.") {
+			return nil, nil, fmt.Errorf("HTTP headers require Ignition spec 3.1.0 or later, config is %s", version)
+		}
+	}
+
+	selected := make(map[string]bool, len(paths))
+	for _, p := range paths {
+		selected[p] = false
+	}
+	httpHeaders := make([]interface{}, 0, len(headers))
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		httpHeaders = append(httpHeaders, map[string]interface{}{"name": name, "value": headers[name]})
+	}
+
+	moved := map[string][]byte{}
+	files, _ := lookup(cfg, "storage", "files").([]interface{})
+	for _, f := range files {
+		file, _ := f.(map[string]interface{})
+		path, _ := file["path"].(string)
+		if _, ok := selected[path]; len(paths) > 0 && !ok {
+			continue
+		}
+
+		resources := []interface{}{file["contents"]}
+		if appends, ok := file["append"].([]interface{}); ok {
+			resources = append(resources, appends...)
+		}
+		inline := false
+		for _, r := range resources {
+			resource, _ := r.(map[string]interface{})
+			ok, err := externalize(resource, baseURL, httpHeaders, moved)
+			if err != nil {
+				return nil, nil, fmt.Errorf("file %s: %w", path, err)
+			}
+			inline = inline || ok
+		}
+		if len(paths) > 0 {
+			if !inline {
+				return nil, nil, fmt.Errorf("file %s has no inline contents", path)
+			}
+			selected[path] = true
+		}
+	}
+	for _, p := range paths {
+		if !selected[p] {
+			return nil, nil, fmt.Errorf("file %s is not in the Ignition config", p)
+		}
+	}
+
+	out, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, nil, err
+	}
+	return out, moved, nil
+}
+
+// externalize replaces an inline resource by a remote one and reports
+// whether it did.
+func externalize(resource map[string]interface{}, baseURL string, headers []interface{}, moved map[string][]byte) (bool, error) {
+	source, _ := resource["source"].(string)
+	if !strings.HasPrefix(source, "data:") {
+		return false, nil
+	}
+	decoded, err := dataurl.DecodeString(source)
+	if err != nil {
+		return false, fmt.Errorf("invalid data URL: %w", err)
+	}
+
+	// Ignition verifies the decompressed content.
+	content := decoded.Data
+	if compression, _ := resource["compression"].(string); compression == "gzip" {
+		zr, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return false, fmt.Errorf("invalid gzip contents: %w", err)
+		}
+		if content, err = io.ReadAll(zr); err != nil {
+			return false, fmt.Errorf("invalid gzip contents: %w", err)
+		}
+	}
+	digest := sha512.Sum512(content)
+
+	// Keys name what is served, which is the stored, possibly compressed, data.
+	sum := sha256.Sum256(decoded.Data)
+	key := hex.EncodeToString(sum[:])
+	moved[key] = decoded.Data
+
+	resource["source"] = strings.TrimSuffix(baseURL, "/") + "/" + key
+	resource["verification"] = map[string]interface{}{"hash": "sha512-" + hex.EncodeToString(digest[:])}
+	if len(headers) > 0 {
+		resource["httpHeaders"] = headers
+	}
+	return true, nil
+}
+
+func lookup(m map[string]interface{}, keys ...string) interface{} {
+	var cur interface{} = m
+	for _, k := range keys {
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = obj[k]
+	}
+	return cur
+}
@@ -0,0 +1,202 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package encryption
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/agessh"
+	"filippo.io/age/armor"
+	"golang.org/x/crypto/ssh"
+)
+
+func TestAgeRoundTrip(t *testing.T) {
+	native, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, sshKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshIdentity, err := agessh.NewEd25519Identity(sshKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPub, err := ssh.NewPublicKey(sshKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recipients, err := ParseRecipients("# operators\n" + native.Recipient().String() + "\n\n" +
+		strings.TrimSpace(string(ssh.MarshalAuthorizedKey(sshPub))) + " ops@example.com\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recipients) != 2 {
+		t.Fatalf("parsed %d recipients, want 2", len(recipients))
+	}
+
+	ignition := []byte(`{"ignition":{"version":"3.4.0"}}`)
+	encrypted, err := Age(ignition, recipients)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(encrypted, []byte("-----BEGIN AGE ENCRYPTED FILE-----")) {
+		t.Fatalf("output is not armored:\n%s", encrypted)
+	}
+
+	for name, identity := range map[string]age.Identity{"age": native, "ssh": sshIdentity} {
+		r, err := age.Decrypt(armor.NewReader(bytes.NewReader(encrypted)), identity)
+		if err != nil {
+			t.Fatalf("%s identity: %v", name, err)
+		}
+		plaintext, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(plaintext, ignition) {
+			t.Errorf("%s identity decrypted %q", name, plaintext)
+		}
+	}
+}
+
+func TestParseRecipientsErrors(t *testing.T) {
+	for _, text := range []string{"", "# nobody\n", "age1notakey\n", "ssh-ed25519 garbage\n"} {
+		if _, err := ParseRecipients(text); err == nil {
+			t.Errorf("ParseRecipients(%q) should fail", text)
+		}
+	}
+}
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+type resource struct {
+	Source       string `json:"source"`
+	Compression  string `json:"compression"`
+	Verification struct {
+		Hash string `json:"hash"`
+	} `json:"verification"`
+	HTTPHeaders []struct {
+		Name  string `json:"name"`
+		Value string `json:"value"`
+	} `json:"httpHeaders"`
+}
+
+type ignitionFiles struct {
+	Storage struct {
+		Files []struct {
+			Path     string     `json:"path"`
+			Contents resource   `json:"contents"`
+			Append   []resource `json:"append"`
+		} `json:"files"`
+	} `json:"storage"`
+}
+
+func TestExternalize(t *testing.T) {
+	compressed := gzipped(t, "secret key")
+	ignition := `{"ignition":{"version":"3.4.0"},"storage":{"files":[` +
+		`{"path":"/etc/motd","contents":{"source":"data:,hello"}},` +
+		`{"path":"/etc/key","contents":{"compression":"gzip","source":"data:;base64,` + base64.StdEncoding.EncodeToString(compressed) + `"}},` +
+		`{"path":"/etc/remote","contents":{"source":"https://example.com/remote"}}]}}`
+
+	out, moved, err := Externalize([]byte(ignition), "https://files.example.com/ign/", []string{"/etc/key"},
+		map[string]string{"Authorization": "Bearer token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moved) != 1 {
+		t.Fatalf("moved %d files, want 1", len(moved))
+	}
+
+	var cfg ignitionFiles
+	if err := json.Unmarshal(out, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	files := cfg.Storage.Files
+	if files[0].Contents.Source != "data:,hello" {
+		t.Errorf("unselected file was changed: %+v", files[0])
+	}
+	if files[2].Contents.Source != "https://example.com/remote" {
+		t.Errorf("remote file was changed: %+v", files[2])
+	}
+
+	key := files[1].Contents
+	name := strings.TrimPrefix(key.Source, "https://files.example.com/ign/")
+	if !bytes.Equal(moved[name], compressed) {
+		t.Errorf("source %s does not serve the stored contents", key.Source)
+	}
+	digest := sha512.Sum512([]byte("secret key"))
+	if key.Verification.Hash != "sha512-"+hex.EncodeToString(digest[:]) {
+		t.Errorf("hash %s does not describe the decompressed contents", key.Verification.Hash)
+	}
+	if key.Compression != "gzip" {
+		t.Errorf("compression = %q, want gzip", key.Compression)
+	}
+	if len(key.HTTPHeaders) != 1 || key.HTTPHeaders[0].Name != "Authorization" || key.HTTPHeaders[0].Value != "Bearer token" {
+		t.Errorf("unexpected headers %+v", key.HTTPHeaders)
+	}
+}
+
+func TestExternalizeAll(t *testing.T) {
+	ignition := `{"ignition":{"version":"3.0.0"},"storage":{"files":[` +
+		`{"path":"/etc/a","contents":{"source":"data:,a"},"append":[{"source":"data:,b"}]},` +
+		`{"path":"/etc/empty"}]}}`
+
+	out, moved, err := Externalize([]byte(ignition), "https://files.example.com", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moved) != 2 {
+		t.Errorf("moved %d resources, want 2", len(moved))
+	}
+	if strings.Contains(string(out), "data:") {
+		t.Errorf("inline contents left in the config: %s", out)
+	}
+
+	if _, _, err := Externalize([]byte(ignition), "https://files.example.com", nil, map[string]string{"A": "b"}); err == nil {
+		t.Error("headers should be rejected for Ignition 3.0.0")
+	}
+	if _, _, err := Externalize([]byte(ignition), "https://files.example.com", []string{"/etc/missing"}, nil); err == nil {
+		t.Error("unknown paths should be rejected")
+	}
+	if _, _, err := Externalize([]byte(ignition), "https://files.example.com", []string{"/etc/empty"}, nil); err == nil {
+		t.Error("paths without inline contents should be rejected")
+	}
+}
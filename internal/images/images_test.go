@@ -0,0 +1,225 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	ggcrregistry "github.com/google/go-containerregistry/pkg/registry"
+)
+
+const testDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestParseReference(t *testing.T) {
+	tests := map[string]string{
+		"nginx":                                 "docker.io/library/nginx:latest",
+		"nginx:alpine":                          "docker.io/library/nginx:alpine",
+		"grafana/grafana:11.0.0":                "docker.io/grafana/grafana:11.0.0",
+		"quay.io/fedora/fedora-coreos:stable":   "quay.io/fedora/fedora-coreos:stable",
+		"localhost:5000/app":                    "localhost:5000/app:latest",
+		"registry.local:5000/team/app:v1":       "registry.local:5000/team/app:v1",
+		"nginx:alpine@" + testDigest:            "docker.io/library/nginx:alpine@" + testDigest,
+		"ghcr.io/org/app@" + testDigest:         "ghcr.io/org/app@" + testDigest,
+		"docker.io/library/postgres:16-alpine3": "docker.io/library/postgres:16-alpine3",
+	}
+	for in, want := range tests {
+		ref, err := ParseReference(in)
+		if err != nil {
+			t.Errorf("ParseReference(%q) failed: %v", in, err)
+			continue
+		}
+		if got := ref.String(); got != want {
+			t.Errorf("ParseReference(%q) = %q, want %q", in, got, want)
+		}
+	}
+
+	for _, in := range []string{"Nginx", "nginx:", "nginx@sha256:abc", "-d", "/opt/app:/data"} {
+		if _, err := ParseReference(in); err == nil {
+			t.Errorf("ParseReference(%q) should fail", in)
+		}
+	}
+}
+
+// registry serves the digest of app:v1, behind a token service when token is
+// set, and only for GET requests when getOnly is set.
+func registry(t *testing.T, token string, getOnly bool) *httptest.Server {
+	t.Helper()
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/token":
+			if user, pass, _ := r.BasicAuth(); user != "robot" || pass != "secret" {
+				w.WriteHeader(http.StatusUnauthorized)
+				return
+			}
+			if r.URL.Query().Get("scope") != "repository:team/app:pull" {
+				t.Errorf("unexpected scope %q", r.URL.Query().Get("scope"))
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{"token": token})
+		case token != "" && r.Header.Get("Authorization") != "Bearer "+token:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+srv.URL+`/token",service="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+		case r.URL.Path != "/v2/team/app/manifests/v1":
+			w.WriteHeader(http.StatusNotFound)
+		case !strings.Contains(r.Header.Get("Accept"), "application/vnd.oci.image.index.v1+json"):
+			t.Errorf("the index media type should be accepted, got %q", r.Header.Get("Accept"))
+		case getOnly && r.Method == http.MethodHead:
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.Header().Set("Docker-Content-Digest", testDigest)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestResolve(t *testing.T) {
+	ctx := context.Background()
+	for name, getOnly := range map[string]bool{"head": false, "get only": true} {
+		t.Run(name, func(t *testing.T) {
+			srv := registry(t, "", getOnly)
+			host := strings.TrimPrefix(srv.URL, "http://")
+			r := &Resolver{PlainHTTP: []string{host}}
+
+			ref, _ := ParseReference(host + "/team/app:v1")
+			digest, err := r.Resolve(ctx, ref, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if digest != testDigest {
+				t.Errorf("Resolve() = %q, want %q", digest, testDigest)
+			}
+
+			ref, _ = ParseReference(host + "/team/app:v2")
+			if _, err := r.Resolve(ctx, ref, nil); err == nil || !strings.Contains(err.Error(), "not found") {
+				t.Errorf("Resolve() of a missing tag = %v, want not found", err)
+			}
+		})
+	}
+}
+
+func TestResolveMirrorAndToken(t *testing.T) {
+	srv := registry(t, "t0k3n", false)
+	host := strings.TrimPrefix(srv.URL, "http://")
+	r := &Resolver{Mirrors: map[string]string{"registry.example.com": host}, PlainHTTP: []string{host}}
+	ref, _ := ParseReference("registry.example.com/team/app:v1")
+
+	if _, err := r.Resolve(context.Background(), ref, nil); err == nil {
+		t.Error("Resolve() without credentials should fail")
+	}
+	creds, err := ParseDockerConfig([]byte(`{"auths":{"http://` + host + `/":{"auth":"cm9ib3Q6c2VjcmV0"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	digest, err := r.Resolve(context.Background(), ref, creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if digest != testDigest {
+		t.Errorf("Resolve() = %q, want %q", digest, testDigest)
+	}
+}
+
+func TestParseDockerConfig(t *testing.T) {
+	creds, err := ParseDockerConfig([]byte(`{"auths":{"https://index.docker.io/v1/":{"username":"me","password":"pw"}}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := creds[DockerHub]; got.Username != "me" || got.Password != "pw" {
+		t.Errorf("credentials of docker.io = %+v", got)
+	}
+}
+
+func TestPush(t *testing.T) {
+	var uploads int
+	backend := ggcrregistry.New(ggcrregistry.Logger(log.New(io.Discard, "", 0)))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "robot" || pass != "secret" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodPost {
+			uploads++
+		}
+		backend.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	host := strings.TrimPrefix(srv.URL, "http://")
+	p := &Pusher{PlainHTTP: []string{host}}
+	ref, err := ParseRepository(host + "/boot/web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	artifact := Artifact{
+		ArtifactType: "application/vnd.coreos.ignition+json",
+		Layers:       []Blob{{MediaType: "application/vnd.coreos.ignition+json", Data: []byte(`{"ignition":{"version":"3.4.0"}}`)}},
+		Annotations:  map[string]string{"org.opencontainers.image.title": "web"},
+	}
+
+	if _, err := p.Push(context.Background(), ref, artifact, []string{"v1"}, nil); err == nil {
+		t.Error("Push() without credentials should fail")
+	}
+	creds := map[string]Credentials{host: {Username: "robot", Password: "secret"}}
+	digest, err := p.Push(context.Background(), ref, artifact, []string{"v1", "latest"}, creds)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, want, _ := artifact.Manifest(); digest != want {
+		t.Errorf("Push() = %q, want the manifest digest %q", digest, want)
+	}
+	for _, tag := range []string{"v1", "latest"} {
+		resolved, err := (&Resolver{PlainHTTP: []string{host}}).Resolve(context.Background(),
+			Reference{Registry: host, Repository: "boot/web", Tag: tag}, creds)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resolved != digest {
+			t.Errorf("tag %s resolves to %q, want %q", tag, resolved, digest)
+		}
+	}
+
+	uploads = 0
+	if _, err := p.Push(context.Background(), ref, artifact, []string{"v2"}, creds); err != nil {
+		t.Fatal(err)
+	}
+	if uploads != 0 {
+		t.Errorf("pushing again uploaded %d blobs, want none", uploads)
+	}
+}
+
+func TestParseRepository(t *testing.T) {
+	ref, err := ParseRepository("registry.example.com/boot/web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := ref.String(); got != "registry.example.com/boot/web" {
+		t.Errorf("ParseRepository() = %q", got)
+	}
+	for _, in := range []string{"registry.example.com/boot/web:v1", "boot:latest", "web@" + testDigest, "Boot"} {
+		if _, err := ParseRepository(in); err == nil {
+			t.Errorf("ParseRepository(%q) should fail", in)
+		}
+	}
+}
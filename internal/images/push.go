@@ -0,0 +1,229 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+const (
+	// MediaTypeManifest is the media type of OCI image manifests.
+	MediaTypeManifest = "application/vnd.oci.image.manifest.v1+json"
+	// MediaTypeEmpty is the media type of the empty config of OCI artifacts.
+	MediaTypeEmpty = "application/vnd.oci.empty.v1+json"
+)
+
+// Blob is a layer of an artifact.
+type Blob struct {
+	MediaType   string
+	Data        []byte
+	Annotations map[string]string
+}
+
+// Artifact is an OCI artifact: an image manifest with an empty config.
+type Artifact struct {
+	// ArtifactType is the media type of the artifact.
+	ArtifactType string
+	Layers       []Blob
+	// Annotations are set on the manifest.
+	Annotations map[string]string
+}
+
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int               `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+type manifest struct {
+	SchemaVersion int               `json:"schemaVersion"`
+	MediaType     string            `json:"mediaType"`
+	ArtifactType  string            `json:"artifactType,omitempty"`
+	Config        descriptor        `json:"config"`
+	Layers        []descriptor      `json:"layers"`
+	Annotations   map[string]string `json:"annotations,omitempty"`
+}
+
+// emptyConfig is the config of artifacts, per the OCI image specification.
+var emptyConfig = []byte("{}")
+
+// Manifest returns the image manifest of the artifact and its digest. The
+// manifest only depends on the artifact, so pushing an unchanged artifact
+// again yields the same digest.
+func (a Artifact) Manifest() ([]byte, string, error) {
+	m := manifest{
+		SchemaVersion: 2,
+		MediaType:     MediaTypeManifest,
+		ArtifactType:  a.ArtifactType,
+		Config:        descriptor{MediaType: MediaTypeEmpty, Digest: digestOf(emptyConfig), Size: len(emptyConfig)},
+		Layers:        make([]descriptor, 0, len(a.Layers)),
+		Annotations:   a.Annotations,
+	}
+	for _, layer := range a.Layers {
+		m.Layers = append(m.Layers, descriptor{
+			MediaType:   layer.MediaType,
+			Digest:      digestOf(layer.Data),
+			Size:        len(layer.Data),
+			Annotations: layer.Annotations,
+		})
+	}
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, digestOf(data), nil
+}
+
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// Pusher pushes artifacts with the OCI distribution API.
+type Pusher struct {
+	// Client sends the requests. Nil uses a client with a 30 second timeout.
+	Client *http.Client
+	// PlainHTTP lists the registries reached over HTTP instead of HTTPS.
+	PlainHTTP []string
+}
+
+// Push uploads the blobs and the manifest of the artifact to the repository of
+// ref, tagged with each of tags, using the credentials of the registry, if
+// any. Blobs the repository has are not uploaded again. It returns the digest
+// of the manifest.
+func (p *Pusher) Push(ctx context.Context, ref Reference, artifact Artifact, tags []string, credentials map[string]Credentials) (string, error) {
+	manifestData, digest, err := artifact.Manifest()
+	if err != nil {
+		return "", err
+	}
+	creds, hasCreds := credentials[ref.Registry]
+	s := &pushSession{
+		client:     httpClient(p.Client),
+		base:       fmt.Sprintf("%s/v2/%s", baseURL(ref.Registry, p.PlainHTTP), ref.Repository),
+		repository: ref.Repository,
+		creds:      creds,
+		hasCreds:   hasCreds,
+	}
+
+	blobs := [][]byte{emptyConfig}
+	for _, layer := range artifact.Layers {
+		blobs = append(blobs, layer.Data)
+	}
+	for _, blob := range blobs {
+		if err := s.uploadBlob(ctx, blob); err != nil {
+			return "", fmt.Errorf("failed to push a blob to %s: %w", ref.Registry, err)
+		}
+	}
+	for _, tag := range tags {
+		resp, err := s.do(ctx, http.MethodPut, s.base+"/manifests/"+tag, MediaTypeManifest, manifestData)
+		if err != nil {
+			return "", fmt.Errorf("failed to push the manifest to %s: %w", ref.Registry, err)
+		}
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
+			return "", fmt.Errorf("failed to push the manifest of tag %s to %s: %s", tag, ref.Registry, resp.Status)
+		}
+	}
+	return digest, nil
+}
+
+// pushSession sends the requests of a push, authenticating once the registry
+// asks for it.
+type pushSession struct {
+	client     *http.Client
+	base       string
+	repository string
+	creds      Credentials
+	hasCreds   bool
+	auth       string
+}
+
+// uploadBlob uploads data with a monolithic upload, unless the repository has
+// it already.
+func (s *pushSession) uploadBlob(ctx context.Context, data []byte) error {
+	digest := digestOf(data)
+	resp, err := s.do(ctx, http.MethodHead, s.base+"/blobs/"+digest, "", nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	uploads, err := url.Parse(s.base + "/blobs/uploads/")
+	if err != nil {
+		return err
+	}
+	if resp, err = s.do(ctx, http.MethodPost, uploads.String(), "", nil); err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("starting the upload of %s returned %s", digest, resp.Status)
+	}
+	location, err := uploads.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.Header.Get("Location") == "" {
+		return fmt.Errorf("starting the upload of %s returned no valid location", digest)
+	}
+	query := location.Query()
+	query.Set("digest", digest)
+	location.RawQuery = query.Encode()
+
+	if resp, err = s.do(ctx, http.MethodPut, location.String(), "application/octet-stream", data); err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("uploading %s returned %s", digest, resp.Status)
+	}
+	return nil
+}
+
+// do sends a request with body, answering the challenge of the registry and
+// retrying once when it is unauthorized. The body of the response is closed.
+func (s *pushSession) do(ctx context.Context, method, target, contentType string, body []byte) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		if s.auth != "" {
+			req.Header.Set("Authorization", s.auth)
+		}
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 1<<20))
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusUnauthorized || attempt > 0 {
+			return resp, nil
+		}
+		if s.auth, err = authorize(ctx, s.client, resp.Header.Get("WWW-Authenticate"), s.repository, "pull,push", s.creds, s.hasCreds); err != nil {
+			return nil, fmt.Errorf("failed to authenticate: %w", err)
+		}
+	}
+}
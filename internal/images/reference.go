@@ -0,0 +1,112 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package images resolves container image references to the digests their
+// registries serve for them, so that configs can pin the images they run, and
+// pushes artifacts to registries.
+package images
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DockerHub is the registry of references that do not name one.
+const DockerHub = "docker.io"
+
+var (
+	pathComponent = regexp.MustCompile(`^[a-z0-9]+(?:(?:[._]|__|-+)[a-z0-9]+)*$`)
+	tagPattern    = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]{0,127}$`)
+	digestPattern = regexp.MustCompile(`^sha256:[0-9a-f]{64}$`)
+)
+
+// Reference is a parsed container image reference.
+type Reference struct {
+	// Registry is the host, and port, of the registry, e.g. docker.io.
+	Registry string
+	// Repository is the path of the image in the registry, e.g. library/nginx.
+	Repository string
+	// Tag is the tag of the image, latest when the reference names none.
+	Tag string
+	// Digest is the digest the reference is pinned to, if any.
+	Digest string
+}
+
+// ParseReference parses an image reference the way Podman and Docker do:
+// references without a registry are Docker Hub images, whose single component
+// names are library images.
+func ParseReference(ref string) (Reference, error) {
+	var r Reference
+	name := ref
+	if i := strings.Index(name, "@"); i >= 0 {
+		name, r.Digest = name[:i], name[i+1:]
+		if !digestPattern.MatchString(r.Digest) {
+			return Reference{}, fmt.Errorf("invalid image reference %q: unsupported digest %q", ref, r.Digest)
+		}
+	}
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		name, r.Tag = name[:i], name[i+1:]
+		if !tagPattern.MatchString(r.Tag) {
+			return Reference{}, fmt.Errorf("invalid image reference %q: invalid tag %q", ref, r.Tag)
+		}
+	}
+
+	r.Registry, r.Repository = DockerHub, name
+	if i := strings.Index(name, "/"); i >= 0 {
+		if host := name[:i]; strings.ContainsAny(host, ".:") || host == "localhost" {
+			r.Registry, r.Repository = host, name[i+1:]
+		}
+	}
+	if r.Registry == DockerHub && !strings.Contains(r.Repository, "/") {
+		r.Repository = "library/" + r.Repository
+	}
+	for _, component := range strings.Split(r.Repository, "/") {
+		if !pathComponent.MatchString(component) {
+			return Reference{}, fmt.Errorf("invalid image reference %q", ref)
+		}
+	}
+	if r.Tag == "" && r.Digest == "" {
+		r.Tag = "latest"
+	}
+	return r, nil
+}
+
+// String returns the fully qualified reference.
+func (r Reference) String() string {
+	s := r.Registry + "/" + r.Repository
+	if r.Tag != "" {
+		s += ":" + r.Tag
+	}
+	if r.Digest != "" {
+		s += "@" + r.Digest
+	}
+	return s
+}
+
+// ParseRepository parses a repository reference, e.g. registry.example.com/boot,
+// which names no tag or digest.
+func ParseRepository(repo string) (Reference, error) {
+	r, err := ParseReference(repo)
+	if err != nil {
+		return Reference{}, err
+	}
+	if r.Digest != "" || r.Tag != "latest" || strings.HasSuffix(repo, ":latest") {
+		return Reference{}, fmt.Errorf("invalid repository %q: a repository names no tag or digest", repo)
+	}
+	r.Tag = ""
+	return r, nil
+}
@@ -0,0 +1,289 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package images
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+)
+
+// manifestTypes are the manifest media types accepted, indexes first, so that
+// multi-architecture images are pinned to their index rather than to the
+// manifest of the architecture of the operator.
+var manifestTypes = []string{
+	"application/vnd.oci.image.index.v1+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// Credentials are the credentials of a registry.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// Resolver resolves image tags to digests with the OCI distribution API.
+type Resolver struct {
+	// Client sends the requests. Nil uses a client with a 30 second timeout.
+	Client *http.Client
+	// Mirrors maps registries to the registry their images are resolved
+	// against, e.g. docker.io to a local mirror.
+	Mirrors map[string]string
+	// PlainHTTP lists the registries reached over HTTP instead of HTTPS.
+	PlainHTTP []string
+}
+
+// Resolve returns the digest the registry serves for the tag of ref, using the
+// credentials of the registry, if any. Pinned references resolve to their
+// digest.
+func (r *Resolver) Resolve(ctx context.Context, ref Reference, credentials map[string]Credentials) (string, error) {
+	if ref.Digest != "" {
+		return ref.Digest, nil
+	}
+	registry := ref.Registry
+	if mirror, ok := r.Mirrors[registry]; ok {
+		registry = mirror
+	}
+	manifestURL := fmt.Sprintf("%s/v2/%s/manifests/%s", baseURL(registry, r.PlainHTTP), ref.Repository, ref.Tag)
+	creds, hasCreds := credentials[registry]
+
+	resp, err := r.manifest(ctx, manifestURL, "")
+	if err == nil && resp.StatusCode == http.StatusUnauthorized {
+		auth, aerr := authorize(ctx, r.client(), resp.Header.Get("WWW-Authenticate"), ref.Repository, "pull", creds, hasCreds)
+		if aerr != nil {
+			return "", fmt.Errorf("failed to authenticate to %s: %w", registry, aerr)
+		}
+		resp, err = r.manifest(ctx, manifestURL, auth)
+	}
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", fmt.Errorf("image %s not found in %s", ref, registry)
+	default:
+		return "", fmt.Errorf("failed to get the manifest of %s from %s: %s", ref, registry, resp.Status)
+	}
+	digest := resp.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+		if err != nil {
+			return "", err
+		}
+		sum := sha256.Sum256(body)
+		digest = "sha256:" + hex.EncodeToString(sum[:])
+	}
+	if !digestPattern.MatchString(digest) {
+		return "", fmt.Errorf("registry %s returned an unsupported digest %q for %s", registry, digest, ref)
+	}
+	return digest, nil
+}
+
+// manifest requests a manifest with HEAD, falling back to GET for registries
+// that only return the digest of GET requests. The body of the response is
+// only left open for GET requests that succeeded.
+func (r *Resolver) manifest(ctx context.Context, manifestURL, auth string) (*http.Response, error) {
+	resp, err := r.request(ctx, http.MethodHead, manifestURL, auth)
+	if err != nil {
+		return nil, err
+	}
+	_ = resp.Body.Close()
+	resp.Body = http.NoBody
+	if resp.StatusCode != http.StatusMethodNotAllowed &&
+		(resp.StatusCode != http.StatusOK || resp.Header.Get("Docker-Content-Digest") != "") {
+		return resp, nil
+	}
+
+	if resp, err = r.request(ctx, http.MethodGet, manifestURL, auth); err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		resp.Body = http.NoBody
+	}
+	return resp, nil
+}
+
+func (r *Resolver) request(ctx context.Context, method, manifestURL, auth string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, manifestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", strings.Join(manifestTypes, ", "))
+	if auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+	return r.client().Do(req)
+}
+
+// baseURL returns the URL of the distribution API of registry, reached over
+// HTTP when it is one of plainHTTP.
+func baseURL(registry string, plainHTTP []string) string {
+	host := registry
+	if host == DockerHub {
+		host = "registry-1.docker.io"
+	}
+	if slices.Contains(plainHTTP, registry) {
+		return "http://" + host
+	}
+	return "https://" + host
+}
+
+// authorize answers the challenge of a registry, returning the Authorization
+// header to send: basic credentials, or a bearer token for actions, e.g.
+// pull,push, on repository obtained from the token service of the registry.
+func authorize(ctx context.Context, httpClient *http.Client, challenge, repository, actions string, creds Credentials, hasCreds bool) (string, error) {
+	scheme, params := parseChallenge(challenge)
+	basic := "Basic " + base64.StdEncoding.EncodeToString([]byte(creds.Username+":"+creds.Password))
+	switch scheme {
+	case "basic":
+		if !hasCreds {
+			return "", fmt.Errorf("the registry requires credentials")
+		}
+		return basic, nil
+	case "bearer":
+	default:
+		return "", fmt.Errorf("unsupported authentication challenge %q", challenge)
+	}
+
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return "", fmt.Errorf("invalid token realm %q", params["realm"])
+	}
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	query.Set("scope", "repository:"+repository+":"+actions)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if hasCreds {
+		req.Header.Set("Authorization", basic)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("token service returned %s", resp.Status)
+	}
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&token); err != nil {
+		return "", fmt.Errorf("invalid token response: %w", err)
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return "", fmt.Errorf("token service returned no token")
+	}
+	return "Bearer " + token.Token, nil
+}
+
+func (r *Resolver) client() *http.Client {
+	return httpClient(r.Client)
+}
+
+// httpClient returns c, or a client with a 30 second timeout when c is nil.
+func httpClient(c *http.Client) *http.Client {
+	if c != nil {
+		return c
+	}
+	return &http.Client{Timeout: 30 * time.Second}
+}
+
+// parseChallenge parses a WWW-Authenticate header into its lowercase scheme
+// and parameters.
+func parseChallenge(header string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	params := map[string]string{}
+	for rest != "" {
+		var key, value string
+		key, rest, _ = strings.Cut(strings.TrimLeft(rest, ", "), "=")
+		if strings.HasPrefix(rest, `"`) {
+			value, rest, _ = strings.Cut(rest[1:], `"`)
+		} else {
+			value, rest, _ = strings.Cut(rest, ",")
+		}
+		params[strings.ToLower(strings.TrimSpace(key))] = value
+	}
+	return strings.ToLower(scheme), params
+}
+
+// ParseDockerConfig returns the credentials of a .dockerconfigjson document,
+// as stored in kubernetes.io/dockerconfigjson Secrets, by registry.
+func ParseDockerConfig(data []byte) (map[string]Credentials, error) {
+	var cfg struct {
+		Auths map[string]struct {
+			Auth     string `json:"auth"`
+			Username string `json:"username"`
+			Password string `json:"password"`
+		} `json:"auths"`
+	}
+	if err := json.Unmarshal(data, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid docker config: %w", err)
+	}
+	credentials := make(map[string]Credentials, len(cfg.Auths))
+	for server, auth := range cfg.Auths {
+		creds := Credentials{Username: auth.Username, Password: auth.Password}
+		if auth.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("invalid auth of %s: %w", server, err)
+			}
+			creds.Username, creds.Password, _ = strings.Cut(string(decoded), ":")
+		}
+		credentials[registryHost(server)] = creds
+	}
+	return credentials, nil
+}
+
+// registryHost returns the registry a docker config server entry is for,
+// e.g. docker.io for https://index.docker.io/v1/.
+func registryHost(server string) string {
+	if u, err := url.Parse(server); err == nil && u.Host != "" {
+		server = u.Host
+	}
+	server = strings.TrimSuffix(server, "/")
+	switch server {
+	case "index.docker.io", "registry-1.docker.io":
+		return DockerHub
+	}
+	return server
+}
@@ -0,0 +1,146 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint
+
+import "strings"
+
+// The directives of systemd.unit(5), systemd.exec(5), systemd.kill(5),
+// systemd.resource-control(5) and of the unit types, as of systemd 256.
+const (
+	unitDirectives = `Description Documentation Wants Requires Requisite BindsTo PartOf Upholds Conflicts Before After
+OnFailure OnSuccess PropagatesReloadTo ReloadPropagatedFrom PropagatesStopTo StopPropagatedFrom JoinsNamespaceOf
+RequiresMountsFor WantsMountsFor OnFailureJobMode OnFailureIsolate IgnoreOnIsolate StopWhenUnneeded
+RefuseManualStart RefuseManualStop AllowIsolate DefaultDependencies SurviveFinalKillSignal CollectMode
+FailureAction SuccessAction FailureActionExitStatus SuccessActionExitStatus JobTimeoutSec JobRunningTimeoutSec
+JobTimeoutAction JobTimeoutRebootArgument StartLimitIntervalSec StartLimitInterval StartLimitBurst
+StartLimitAction RebootArgument SourcePath ConditionArchitecture ConditionFirmware ConditionVirtualization
+ConditionHost ConditionKernelCommandLine ConditionKernelVersion ConditionCredential ConditionEnvironment
+ConditionSecurity ConditionCapability ConditionACPower ConditionNeedsUpdate ConditionFirstBoot
+ConditionPathExists ConditionPathExistsGlob ConditionPathIsDirectory ConditionPathIsSymbolicLink
+ConditionPathIsMountPoint ConditionPathIsReadWrite ConditionPathIsEncrypted ConditionDirectoryNotEmpty
+ConditionFileNotEmpty ConditionFileIsExecutable ConditionUser ConditionGroup ConditionControlGroupController
+ConditionMemory ConditionCPUs ConditionCPUFeature ConditionOSRelease ConditionMemoryPressure
+ConditionCPUPressure ConditionIOPressure AssertArchitecture AssertFirmware AssertVirtualization AssertHost
+AssertKernelCommandLine AssertKernelVersion AssertCredential AssertEnvironment AssertSecurity AssertCapability
+AssertACPower AssertNeedsUpdate AssertFirstBoot AssertPathExists AssertPathExistsGlob AssertPathIsDirectory
+AssertPathIsSymbolicLink AssertPathIsMountPoint AssertPathIsReadWrite AssertPathIsEncrypted
+AssertDirectoryNotEmpty AssertFileNotEmpty AssertFileIsExecutable AssertUser AssertGroup
+AssertControlGroupController AssertMemory AssertCPUs AssertCPUFeature AssertOSRelease AssertMemoryPressure
+AssertCPUPressure AssertIOPressure`
+
+	installDirectives = `Alias WantedBy RequiredBy UpheldBy Also DefaultInstance`
+
+	execDirectives = `ExecSearchPath WorkingDirectory RootDirectory RootImage RootImageOptions RootEphemeral RootHash
+RootHashSignature RootVerity RootImagePolicy MountImagePolicy ExtensionImagePolicy MountAPIVFS
+ProtectProc ProcSubset BindPaths BindReadOnlyPaths MountImages ExtensionImages ExtensionDirectories User Group
+DynamicUser SupplementaryGroups SetLoginEnvironment PAMName CapabilityBoundingSet AmbientCapabilities
+NoNewPrivileges SecureBits SELinuxContext AppArmorProfile SmackProcessLabel LimitCPU LimitFSIZE LimitDATA
+LimitSTACK LimitCORE LimitRSS LimitNOFILE LimitAS LimitNPROC LimitMEMLOCK LimitLOCKS LimitSIGPENDING
+LimitMSGQUEUE LimitNICE LimitRTPRIO LimitRTTIME UMask CoredumpFilter KeyringMode OOMScoreAdjust TimerSlackNSec
+Personality IgnoreSIGPIPE Nice CPUSchedulingPolicy CPUSchedulingPriority CPUSchedulingResetOnFork
+CPUAffinity NUMAPolicy NUMAMask IOSchedulingClass IOSchedulingPriority ProtectSystem ProtectHome
+RuntimeDirectory StateDirectory CacheDirectory LogsDirectory ConfigurationDirectory RuntimeDirectoryMode
+StateDirectoryMode CacheDirectoryMode LogsDirectoryMode ConfigurationDirectoryMode RuntimeDirectoryPreserve
+TimeoutCleanSec ReadWritePaths ReadOnlyPaths InaccessiblePaths ExecPaths NoExecPaths TemporaryFileSystem
+PrivateTmp PrivateDevices PrivateNetwork NetworkNamespacePath PrivateIPC IPCNamespacePath MemoryKSM
+PrivateUsers ProtectHostname ProtectClock ProtectKernelTunables ProtectKernelModules ProtectKernelLogs
+ProtectControlGroups RestrictAddressFamilies RestrictFileSystems RestrictNamespaces LockPersonality
+MemoryDenyWriteExecute RestrictRealtime RestrictSUIDSGID RemoveIPC PrivateMounts MountFlags
+SystemCallFilter SystemCallErrorNumber SystemCallArchitectures SystemCallLog Environment EnvironmentFile
+PassEnvironment UnsetEnvironment StandardInput StandardOutput StandardError StandardInputText
+StandardInputData LogLevelMax LogExtraFields LogRateLimitIntervalSec LogRateLimitBurst LogFilterPatterns
+LogNamespace SyslogIdentifier SyslogFacility SyslogLevel SyslogLevelPrefix TTYPath TTYReset
+TTYVHangup TTYRows TTYColumns TTYVTDisallocate LoadCredential LoadCredentialEncrypted ImportCredential
+SetCredential SetCredentialEncrypted UtmpIdentifier UtmpMode`
+
+	killDirectives = `KillMode KillSignal RestartKillSignal SendSIGHUP SendSIGKILL FinalKillSignal WatchdogSignal`
+
+	resourceControlDirectives = `CPUAccounting CPUWeight StartupCPUWeight CPUQuota CPUQuotaPeriodSec AllowedCPUs
+StartupAllowedCPUs MemoryAccounting MemoryMin MemoryLow StartupMemoryLow DefaultStartupMemoryLow MemoryHigh
+StartupMemoryHigh MemoryMax StartupMemoryMax MemorySwapMax StartupMemorySwapMax MemoryZSwapMax
+StartupMemoryZSwapMax MemoryZSwapWriteback AllowedMemoryNodes StartupAllowedMemoryNodes TasksAccounting
+TasksMax IOAccounting IOWeight StartupIOWeight IODeviceWeight IOReadBandwidthMax IOWriteBandwidthMax
+IOReadIOPSMax IOWriteIOPSMax IODeviceLatencyTargetSec IPAccounting IPAddressAllow IPAddressDeny
+SocketBindAllow SocketBindDeny RestrictNetworkInterfaces NFTSet IPIngressFilterPath IPEgressFilterPath
+BPFProgram DeviceAllow DevicePolicy Slice Delegate DelegateSubgroup DisableControllers ManagedOOMSwap
+ManagedOOMMemoryPressure ManagedOOMMemoryPressureLimit ManagedOOMPreference MemoryPressureWatch
+MemoryPressureThresholdSec CoredumpReceive CPUShares StartupCPUShares MemoryLimit BlockIOAccounting
+BlockIOWeight StartupBlockIOWeight BlockIODeviceWeight BlockIOReadBandwidth BlockIOWriteBandwidth`
+
+	serviceDirectives = `Type ExitType RemainAfterExit GuessMainPID PIDFile BusName ExecStart ExecStartPre
+ExecStartPost ExecCondition ExecReload ExecStop ExecStopPost RestartSec RestartSteps RestartMaxDelaySec
+TimeoutStartSec TimeoutStopSec TimeoutAbortSec TimeoutSec TimeoutStartFailureMode TimeoutStopFailureMode
+RuntimeMaxSec RuntimeRandomizedExtraSec WatchdogSec Restart RestartMode SuccessExitStatus
+RestartPreventExitStatus RestartForceExitStatus RootDirectoryStartOnly NonBlocking NotifyAccess Sockets
+FileDescriptorStoreMax FileDescriptorStorePreserve USBFunctionDescriptors USBFunctionStrings OOMPolicy
+OpenFile ReloadSignal PermissionsStartOnly`
+
+	socketDirectives = `ListenStream ListenDatagram ListenSequentialPacket ListenFIFO ListenSpecial ListenNetlink
+ListenMessageQueue ListenUSBFunction SocketProtocol BindIPv6Only Backlog BindToDevice SocketUser SocketGroup
+DirectoryMode SocketMode Accept Writable FlushPending MaxConnections MaxConnectionsPerSource KeepAlive
+KeepAliveTimeSec KeepAliveIntervalSec KeepAliveProbes NoDelay Priority DeferAcceptSec ReceiveBuffer
+SendBuffer IPTOS IPTTL Mark ReusePort SmackLabel SmackLabelIPIn SmackLabelIPOut SELinuxContextFromNet
+PipeSize MessageQueueMaxMessages MessageQueueMessageSize FreeBind Transparent Broadcast PassCredentials
+PassSecurity PassPacketInfo Timestamping TCPCongestion ExecStartPre ExecStartPost ExecStopPre ExecStopPost
+TimeoutSec Service RemoveOnStop Symlinks FileDescriptorName TriggerLimitIntervalSec TriggerLimitBurst
+PollLimitIntervalSec PollLimitBurst`
+
+	timerDirectives = `OnActiveSec OnBootSec OnStartupSec OnUnitActiveSec OnUnitInactiveSec OnCalendar AccuracySec
+RandomizedDelaySec FixedRandomDelay OnClockChange OnTimezoneChange Unit Persistent WakeSystem
+RemainAfterElapse`
+
+	pathDirectives = `PathExists PathExistsGlob PathChanged PathModified DirectoryNotEmpty Unit MakeDirectory
+DirectoryMode TriggerLimitIntervalSec TriggerLimitBurst`
+
+	mountDirectives = `What Where Type Options SloppyOptions LazyUnmount ReadWriteOnly ForceUnmount DirectoryMode
+TimeoutSec`
+
+	automountDirectives = `Where ExtraOptions DirectoryMode TimeoutIdleSec`
+
+	swapDirectives = `What Priority Options TimeoutSec`
+)
+
+// sections maps the unit types to the sections, besides [Unit] and
+// [Install], their units may have, and the sections to their directives.
+var sections = map[string]map[string]map[string]bool{
+	"service":   {"Service": directives(serviceDirectives, execDirectives, killDirectives, resourceControlDirectives)},
+	"socket":    {"Socket": directives(socketDirectives, execDirectives, killDirectives, resourceControlDirectives)},
+	"mount":     {"Mount": directives(mountDirectives, execDirectives, killDirectives, resourceControlDirectives)},
+	"swap":      {"Swap": directives(swapDirectives, execDirectives, killDirectives, resourceControlDirectives)},
+	"slice":     {"Slice": directives(resourceControlDirectives)},
+	"scope":     {"Scope": directives(killDirectives, resourceControlDirectives, "RuntimeMaxSec RuntimeRandomizedExtraSec OOMPolicy")},
+	"timer":     {"Timer": directives(timerDirectives)},
+	"path":      {"Path": directives(pathDirectives)},
+	"automount": {"Automount": directives(automountDirectives)},
+	"target":    {},
+	"device":    {},
+}
+
+var (
+	unitSection    = directives(unitDirectives)
+	installSection = directives(installDirectives)
+)
+
+func directives(lists ...string) map[string]bool {
+	set := map[string]bool{}
+	for _, list := range lists {
+		for _, name := range strings.Fields(list) {
+			set[name] = true
+		}
+	}
+	return set
+}
@@ -0,0 +1,264 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+)
+
+// existingFiles are files the supported distributions ship, which Ignition
+// does not replace unless the file sets overwrite.
+var existingFiles = strings.Fields(`/etc/hosts /etc/passwd /etc/group /etc/shadow /etc/gshadow /etc/fstab
+/etc/sysctl.conf /etc/ssh/sshd_config /etc/chrony.conf /etc/containers/registries.conf /etc/containers/policy.json
+/etc/containers/storage.conf /etc/locale.conf /etc/vconsole.conf /etc/sudoers /etc/profile /etc/bashrc
+/etc/systemd/system.conf /etc/systemd/journald.conf /etc/systemd/logind.conf /etc/systemd/resolved.conf
+/etc/selinux/config /etc/NetworkManager/NetworkManager.conf`)
+
+type node struct {
+	Path      string `json:"path"`
+	Overwrite *bool  `json:"overwrite"`
+	Mode      *int   `json:"mode"`
+}
+
+type ignitionStorage struct {
+	Disks []struct {
+		Device     string `json:"device"`
+		Partitions []struct {
+			Label *string `json:"label"`
+		} `json:"partitions"`
+	} `json:"disks"`
+	Raid []struct {
+		Name    string   `json:"name"`
+		Devices []string `json:"devices"`
+	} `json:"raid"`
+	Luks []struct {
+		Name   string  `json:"name"`
+		Device *string `json:"device"`
+	} `json:"luks"`
+	Filesystems []struct {
+		Device string  `json:"device"`
+		Path   *string `json:"path"`
+	} `json:"filesystems"`
+	Files []struct {
+		node
+		Contents struct {
+			Source *string `json:"source"`
+		} `json:"contents"`
+	} `json:"files"`
+	Directories []node `json:"directories"`
+	Links       []struct {
+		node
+		Target *string `json:"target"`
+		Hard   *bool   `json:"hard"`
+	} `json:"links"`
+}
+
+// Ignition lints the storage of an Ignition config: files, directories and
+// links under a file or sharing a path, world-writable, setuid and setgid
+// files, directories that cannot be entered or are world-writable without the
+// sticky bit, files of the distributions replaced without overwrite, hard
+// links to another filesystem, and disks, RAID arrays and LUKS devices that
+// no filesystem, array or LUKS device uses.
+func Ignition(ignition []byte) ([]Finding, error) {
+	var cfg struct {
+		Storage ignitionStorage `json:"storage"`
+	}
+	if err := json.Unmarshal(ignition, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid Ignition config: %w", err)
+	}
+	s := cfg.Storage
+	var findings []Finding
+	add := func(rule Rule, location, format string, args ...any) {
+		findings = append(findings, Finding{Rule: rule, Location: location, Message: fmt.Sprintf(format, args...)})
+	}
+
+	// Paths, by the kind of the entry they belong to
+	kinds := map[string]string{}
+	var entries [][2]string
+	record := func(kind, p string) {
+		p = path.Clean(p)
+		if other, ok := kinds[p]; ok {
+			add(RulePathConflict, kind+" "+p, "the path is also a %s", other)
+			return
+		}
+		kinds[p] = kind
+		entries = append(entries, [2]string{kind, p})
+	}
+	for _, f := range s.Files {
+		record("file", f.Path)
+	}
+	for _, d := range s.Directories {
+		record("directory", d.Path)
+	}
+	for _, l := range s.Links {
+		record("link", l.Path)
+	}
+	for _, entry := range entries {
+		for parent := path.Dir(entry[1]); parent != "/" && parent != "."; parent = path.Dir(parent) {
+			if kinds[parent] == "file" {
+				add(RulePathConflict, entry[0]+" "+entry[1], "the path is under file %s", parent)
+				break
+			}
+		}
+	}
+
+	for _, f := range s.Files {
+		location := "file " + f.Path
+		if f.Mode != nil {
+			mode := *f.Mode
+			if mode&0o002 != 0 {
+				add(RuleSuspiciousMode, location, "the file is world-writable (mode %#o)", mode)
+			}
+			if mode&0o4000 != 0 {
+				add(RuleSuspiciousMode, location, "the file is setuid (mode %#o)", mode)
+			}
+			if mode&0o2000 != 0 {
+				add(RuleSuspiciousMode, location, "the file is setgid (mode %#o)", mode)
+			}
+		}
+		overwrite := f.Overwrite != nil && *f.Overwrite
+		if f.Contents.Source != nil && !overwrite && slices.Contains(existingFiles, path.Clean(f.Path)) {
+			add(RuleOverwrite, location, "the file ships with the distributions; without overwrite: true, Ignition fails when its contents differ")
+		}
+	}
+	for _, d := range s.Directories {
+		if d.Mode == nil {
+			continue
+		}
+		mode := *d.Mode
+		if mode&0o111 == 0 {
+			add(RuleSuspiciousMode, "directory "+d.Path, "the directory mode %#o has no execute bit, so the directory cannot be entered", mode)
+		}
+		if mode&0o002 != 0 && mode&0o1000 == 0 {
+			add(RuleSuspiciousMode, "directory "+d.Path, "the directory is world-writable without the sticky bit (mode %#o)", mode)
+		}
+	}
+
+	// Ignition mounts the filesystems with a path under the root filesystem
+	mounts := []string{"/"}
+	for _, fs := range s.Filesystems {
+		if fs.Path != nil {
+			mounts = append(mounts, path.Clean(*fs.Path))
+		}
+	}
+	for _, l := range s.Links {
+		if l.Hard == nil || !*l.Hard || l.Target == nil || !path.IsAbs(*l.Target) {
+			continue
+		}
+		if from, to := mountOf(l.Path, mounts), mountOf(*l.Target, mounts); from != to {
+			add(RuleLinkOutsideFilesystem, "link "+l.Path, "the hard link targets %s, on the filesystem mounted at %s instead of %s", *l.Target, to, from)
+		}
+	}
+
+	var used []string
+	for _, fs := range s.Filesystems {
+		used = append(used, fs.Device)
+	}
+	for _, raid := range s.Raid {
+		used = append(used, raid.Devices...)
+	}
+	for _, luks := range s.Luks {
+		if luks.Device != nil {
+			used = append(used, *luks.Device)
+		}
+	}
+	// Partitions are named after their disk, e.g. /dev/vdb1 or /dev/disk/by-id/x-part1
+	isUsed := func(devices ...string) bool {
+		for _, device := range used {
+			for _, d := range devices {
+				if strings.HasPrefix(device, d) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	for _, disk := range s.Disks {
+		// The boot disk is partitioned to resize or add to the root filesystem
+		if strings.Contains(disk.Device, "coreos-boot-disk") {
+			continue
+		}
+		devices := []string{disk.Device}
+		for _, p := range disk.Partitions {
+			if p.Label != nil {
+				devices = append(devices, "/dev/disk/by-partlabel/"+*p.Label)
+			}
+		}
+		if !isUsed(devices...) {
+			add(RuleUnusedDevice, "disk "+disk.Device, "no filesystem, RAID array or LUKS device uses the disk or its partitions")
+		}
+	}
+	for _, raid := range s.Raid {
+		if !isUsed("/dev/md/" + raid.Name) {
+			add(RuleUnusedDevice, "raid "+raid.Name, "no filesystem or LUKS device uses /dev/md/%s", raid.Name)
+		}
+	}
+	for _, luks := range s.Luks {
+		if !isUsed("/dev/mapper/"+luks.Name, "/dev/disk/by-id/dm-name-"+luks.Name) {
+			add(RuleUnusedDevice, "luks "+luks.Name, "no filesystem or RAID array uses /dev/mapper/%s", luks.Name)
+		}
+	}
+	return findings, nil
+}
+
+// Conflicts returns the files, directories and links config sets that were
+// already set by the configs it is merged over, named by owners, a map of the
+// paths to the config that set them, which Conflicts adds the paths of config
+// to under name.
+func Conflicts(config []byte, name string, owners map[string]string) ([]Finding, error) {
+	var cfg struct {
+		Storage ignitionStorage `json:"storage"`
+	}
+	if err := json.Unmarshal(config, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid Ignition config: %w", err)
+	}
+	var findings []Finding
+	check := func(kind, p string) {
+		p = path.Clean(p)
+		if owner, ok := owners[p]; ok && owner != name {
+			findings = append(findings, Finding{Rule: RulePathConflict, Location: kind + " " + p,
+				Message: fmt.Sprintf("set by both %s and %s, which overrides it", owner, name)})
+		}
+		owners[p] = name
+	}
+	for _, f := range cfg.Storage.Files {
+		check("file", f.Path)
+	}
+	for _, d := range cfg.Storage.Directories {
+		check("directory", d.Path)
+	}
+	for _, l := range cfg.Storage.Links {
+		check("link", l.Path)
+	}
+	return findings, nil
+}
+
+// mountOf returns the mount path of the filesystem p is on.
+func mountOf(p string, mounts []string) string {
+	p = path.Clean(p)
+	best := "/"
+	for _, m := range mounts {
+		if (p == m || strings.HasPrefix(p, strings.TrimSuffix(m, "/")+"/")) && len(m) > len(best) {
+			best = m
+		}
+	}
+	return best
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint
+
+import (
+	"slices"
+	"testing"
+)
+
+func findingStrings(findings []Finding) []string {
+	var s []string
+	for _, f := range findings {
+		s = append(s, string(f.Rule)+" "+f.String())
+	}
+	return s
+}
+
+func TestIgnition(t *testing.T) {
+	ignition := []byte(`{
+		"ignition": {"version": "3.4.0"},
+		"storage": {
+			"disks": [
+				{"device": "/dev/disk/by-id/coreos-boot-disk", "partitions": [{"label": "root", "number": 4, "resize": true}]},
+				{"device": "/dev/vdb", "partitions": [{"label": "data"}]},
+				{"device": "/dev/vdc", "partitions": [{"number": 1}]},
+				{"device": "/dev/vdd", "wipeTable": true}
+			],
+			"raid": [{"name": "mirror", "level": "raid1", "devices": ["/dev/vdc1", "/dev/vde"]}],
+			"luks": [{"name": "secret", "device": "/dev/md/mirror"}, {"name": "spare", "device": "/dev/vdf"}],
+			"filesystems": [
+				{"device": "/dev/disk/by-partlabel/data", "path": "/var/data", "format": "xfs"},
+				{"device": "/dev/mapper/secret", "path": "/var/secret", "format": "xfs"}
+			],
+			"files": [
+				{"path": "/etc/hosts", "contents": {"source": "data:,127.0.0.1%20localhost"}},
+				{"path": "/etc/sysctl.conf", "overwrite": true, "contents": {"source": "data:,"}},
+				{"path": "/etc/fstab", "append": [{"source": "data:,"}]},
+				{"path": "/usr/local/bin/tool", "mode": 2541},
+				{"path": "/var/shared/drop", "mode": 438},
+				{"path": "/opt/app", "contents": {"source": "data:,"}},
+				{"path": "/opt/app/config", "contents": {"source": "data:,"}}
+			],
+			"directories": [
+				{"path": "/var/lib/app", "mode": 420},
+				{"path": "/var/shared", "mode": 511},
+				{"path": "/tmp/cache", "mode": 1023}
+			],
+			"links": [
+				{"path": "/var/data/current", "target": "/var/data/v1", "hard": true},
+				{"path": "/var/secret/key", "target": "/etc/key", "hard": true},
+				{"path": "/etc/localtime", "target": "/usr/share/zoneinfo/UTC"}
+			]
+		}
+	}`)
+	findings, err := Ignition(ignition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"PathConflict file /opt/app/config: the path is under file /opt/app",
+		"Overwrite file /etc/hosts: the file ships with the distributions; without overwrite: true, Ignition fails when its contents differ",
+		"SuspiciousMode file /usr/local/bin/tool: the file is setuid (mode 04755)",
+		"SuspiciousMode file /var/shared/drop: the file is world-writable (mode 0666)",
+		"SuspiciousMode directory /var/lib/app: the directory mode 0644 has no execute bit, so the directory cannot be entered",
+		"SuspiciousMode directory /var/shared: the directory is world-writable without the sticky bit (mode 0777)",
+		"LinkOutsideFilesystem link /var/secret/key: the hard link targets /etc/key, on the filesystem mounted at / instead of /var/secret",
+		"UnusedDevice disk /dev/vdd: no filesystem, RAID array or LUKS device uses the disk or its partitions",
+		"UnusedDevice luks spare: no filesystem or RAID array uses /dev/mapper/spare",
+	}
+	if got := findingStrings(findings); !slices.Equal(got, want) {
+		t.Errorf("Ignition() =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestConflicts(t *testing.T) {
+	owners := map[string]string{}
+	base := []byte(`{"storage": {"files": [{"path": "/etc/motd"}, {"path": "/etc/issue"}]}}`)
+	config := []byte(`{"storage": {"files": [{"path": "/etc/motd"}], "links": [{"path": "/etc/issue/"}]}}`)
+	if findings, err := Conflicts(base, "ClusterButaneConfig baseline", owners); err != nil || len(findings) != 0 {
+		t.Fatalf("Conflicts() of the first config = %v, %v", findings, err)
+	}
+	findings, err := Conflicts(config, "the ButaneConfig", owners)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"PathConflict file /etc/motd: set by both ClusterButaneConfig baseline and the ButaneConfig, which overrides it",
+		"PathConflict link /etc/issue: set by both ClusterButaneConfig baseline and the ButaneConfig, which overrides it",
+	}
+	if got := findingStrings(findings); !slices.Equal(got, want) {
+		t.Errorf("Conflicts() =\n%q\nwant\n%q", got, want)
+	}
+}
@@ -0,0 +1,73 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package lint finds mistakes in Ignition configs that Butane and Ignition
+// accept, but that only show when a machine boots with them.
+package lint
+
+// Rule names a check of the linter.
+type Rule string
+
+const (
+	// RuleInvalidUnit flags unit contents systemd cannot parse.
+	RuleInvalidUnit Rule = "InvalidUnit"
+	// RuleUnknownSection flags unit sections the unit type does not have.
+	RuleUnknownSection Rule = "UnknownSection"
+	// RuleUnknownDirective flags directives systemd does not know.
+	RuleUnknownDirective Rule = "UnknownDirective"
+	// RuleMissingInstall flags enabled units without an [Install] section.
+	RuleMissingInstall Rule = "MissingInstall"
+	// RuleMissingDependency flags Requires=, Requisite= and BindsTo= on
+	// units neither the config nor the distribution define.
+	RuleMissingDependency Rule = "MissingDependency"
+	// RuleOrphanDropin flags drop-ins of units neither the config nor the
+	// distribution define.
+	RuleOrphanDropin Rule = "OrphanDropin"
+	// RulePathConflict flags files, directories and links sharing a path, in
+	// a config or across the configs merged together, or under a file.
+	RulePathConflict Rule = "PathConflict"
+	// RuleSuspiciousMode flags world-writable, setuid and setgid files, and
+	// directories without execute bits or world-writable without the sticky
+	// bit.
+	RuleSuspiciousMode Rule = "SuspiciousMode"
+	// RuleOverwrite flags files of the distributions replaced without
+	// overwrite.
+	RuleOverwrite Rule = "Overwrite"
+	// RuleLinkOutsideFilesystem flags hard links to another filesystem.
+	RuleLinkOutsideFilesystem Rule = "LinkOutsideFilesystem"
+	// RuleUnusedDevice flags disks, RAID arrays and LUKS devices that no
+	// filesystem, array or LUKS device uses.
+	RuleUnusedDevice Rule = "UnusedDevice"
+)
+
+// Finding is a problem the linter found.
+type Finding struct {
+	Rule Rule
+	// Location is where the problem is, e.g. unit app.service.
+	Location string
+	Message  string
+}
+
+// String returns the location and message of the finding.
+func (f Finding) String() string {
+	return f.Location + ": " + f.Message
+}
+
+// CrossConfig reports whether the finding may be fixed by the configs a
+// config is merged with, e.g. a dependency on a unit they define.
+func (f Finding) CrossConfig() bool {
+	return f.Rule == RuleMissingDependency || f.Rule == RuleOrphanDropin
+}
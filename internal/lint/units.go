@@ -0,0 +1,198 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/coreos/go-systemd/v22/unit"
+)
+
+// systemUnits are units the supported distributions ship, which configs
+// depend on and add drop-ins to without defining them.
+var systemUnits = strings.Fields(`docker.service docker.socket containerd.service podman.service podman.socket
+podman-restart.service crio.service sshd.service sshd.socket chronyd.service NetworkManager.service
+NetworkManager-wait-online.service dbus.service dbus.socket polkit.service auditd.service zincati.service
+rpm-ostreed.service update-engine.service locksmithd.service iscsid.service multipathd.service rpcbind.service
+getty@.service serial-getty@.service`)
+
+// systemUnitPrefixes are the prefixes of the names of the units of systemd,
+// Ignition and the distributions.
+var systemUnitPrefixes = []string{"systemd-", "ignition-", "coreos-", "afterburn", "flatcar-", "ostree-"}
+
+// generatedTypes are the unit types systemd provides standard units of or
+// generates units of, e.g. from fstab, which configs refer to freely.
+var generatedTypes = []string{"target", "device", "mount", "swap", "slice", "scope", "automount"}
+
+// dependencyDirectives are the [Unit] directives failing the unit when the
+// units they name do not exist.
+var dependencyDirectives = []string{"Requires", "Requisite", "BindsTo"}
+
+type ignitionUnit struct {
+	Name     string  `json:"name"`
+	Enabled  *bool   `json:"enabled"`
+	Mask     *bool   `json:"mask"`
+	Contents *string `json:"contents"`
+	Dropins  []struct {
+		Name     string  `json:"name"`
+		Contents *string `json:"contents"`
+	} `json:"dropins"`
+}
+
+// Units lints the systemd units of an Ignition config: contents systemd
+// cannot parse, unknown sections and directives, enabled units without an
+// [Install] section, dependencies on units that are neither in the config nor
+// shipped by the distribution, and drop-ins of such units.
+func Units(ignition []byte) ([]Finding, error) {
+	var cfg struct {
+		Systemd struct {
+			Units []ignitionUnit `json:"units"`
+		} `json:"systemd"`
+	}
+	if err := json.Unmarshal(ignition, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid Ignition config: %w", err)
+	}
+	defined := map[string]bool{}
+	for _, u := range cfg.Systemd.Units {
+		if u.Contents != nil || (u.Mask != nil && *u.Mask) {
+			defined[u.Name] = true
+		}
+	}
+
+	var findings []Finding
+	for _, u := range cfg.Systemd.Units {
+		location := "unit " + u.Name
+		hasInstall := false
+		var requires []string
+		check := func(location string, contents *string) {
+			if contents == nil {
+				return
+			}
+			sections, deps, err := lintUnit(u.Name, location, *contents, &findings)
+			if err != nil {
+				findings = append(findings, Finding{Rule: RuleInvalidUnit, Location: location, Message: err.Error()})
+				return
+			}
+			hasInstall = hasInstall || slices.Contains(sections, "Install")
+			requires = append(requires, deps...)
+		}
+		check(location, u.Contents)
+		for _, d := range u.Dropins {
+			check(location+" drop-in "+d.Name, d.Contents)
+		}
+
+		if u.Enabled != nil && *u.Enabled && u.Contents != nil && !hasInstall {
+			findings = append(findings, Finding{Rule: RuleMissingInstall, Location: location,
+				Message: "the unit is enabled but has no [Install] section, so enabling it does nothing"})
+		}
+		for _, dep := range requires {
+			if !provided(dep, defined) {
+				findings = append(findings, Finding{Rule: RuleMissingDependency, Location: location,
+					Message: fmt.Sprintf("requires %s, which the config does not define", dep)})
+			}
+		}
+		if len(u.Dropins) > 0 && !provided(u.Name, defined) {
+			findings = append(findings, Finding{Rule: RuleOrphanDropin, Location: location,
+				Message: "has drop-ins but the config does not define the unit"})
+		}
+	}
+	return findings, nil
+}
+
+// lintUnit parses unit contents, adding the findings about their sections and
+// directives. It returns the sections and the units the contents depend on.
+func lintUnit(name, location, contents string, findings *[]Finding) ([]string, []string, error) {
+	parsed, err := unit.DeserializeSections(strings.NewReader(contents))
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid unit contents: %w", err)
+	}
+	// The parser skips what precedes the first section, as systemd does
+	for _, line := range strings.Split(contents, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] != '[' {
+			return nil, nil, fmt.Errorf("%q is outside of any section and ignored", line)
+		}
+		break
+	}
+	known, typed := sections[strings.TrimPrefix(path.Ext(name), ".")]
+
+	var names, requires []string
+	for _, section := range parsed {
+		names = append(names, section.Section)
+		var directives map[string]bool
+		switch section.Section {
+		case "Unit":
+			directives = unitSection
+		case "Install":
+			directives = installSection
+		default:
+			if strings.HasPrefix(section.Section, "X-") || !typed {
+				continue
+			}
+			if directives = known[section.Section]; directives == nil {
+				*findings = append(*findings, Finding{Rule: RuleUnknownSection, Location: location,
+					Message: fmt.Sprintf("unknown section [%s]", section.Section)})
+				continue
+			}
+		}
+		for _, entry := range section.Entries {
+			if !directives[entry.Name] && !strings.HasPrefix(entry.Name, "X-") {
+				*findings = append(*findings, Finding{Rule: RuleUnknownDirective, Location: location,
+					Message: fmt.Sprintf("unknown directive %s in [%s]", entry.Name, section.Section)})
+			}
+			if section.Section == "Unit" && slices.Contains(dependencyDirectives, entry.Name) {
+				for _, dep := range strings.Fields(entry.Value) {
+					// Specifiers are only expanded by systemd
+					if !strings.Contains(dep, "%") {
+						requires = append(requires, dep)
+					}
+				}
+			}
+		}
+	}
+	return names, requires, nil
+}
+
+// provided reports whether the unit is defined by the config, as a unit or
+// the template of an instance, or shipped by the distribution.
+func provided(name string, defined map[string]bool) bool {
+	if defined[name] || slices.Contains(systemUnits, name) {
+		return true
+	}
+	if prefix, rest, ok := strings.Cut(name, "@"); ok {
+		template := prefix + "@" + path.Ext(rest)
+		if defined[template] || slices.Contains(systemUnits, template) {
+			return true
+		}
+	}
+	if slices.Contains(generatedTypes, strings.TrimPrefix(path.Ext(name), ".")) {
+		return true
+	}
+	for _, prefix := range systemUnitPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package lint
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func ignitionWithUnits(t *testing.T, units ...map[string]any) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]any{
+		"ignition": map[string]string{"version": "3.4.0"},
+		"systemd":  map[string]any{"units": units},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestUnits(t *testing.T) {
+	ignition := ignitionWithUnits(t,
+		map[string]any{
+			"name":    "app.service",
+			"enabled": true,
+			"contents": "[Unit]\nDescription=App\nRequires=docker.service db.service worker@%i.service\nAfter=db.service\n\n" +
+				"[Service]\nExecStart=/usr/bin/app\nRestartSecs=5\nX-Custom=1\n\n[Timer]\nOnCalendar=daily\n",
+			"dropins": []map[string]any{{"name": "env.conf", "contents": "[Service]\nEnvironment=A=B\n"}},
+		},
+		map[string]any{
+			"name":     "backup.timer",
+			"enabled":  true,
+			"contents": "[Timer]\nOnCalendar=daily\n\n[Install]\nWantedBy=timers.target\n",
+		},
+		map[string]any{
+			"name":     "web@.service",
+			"contents": "[Unit]\nBindsTo=web-data@%i.mount\n\n[Service]\nExecStart=/usr/bin/web %i\n",
+		},
+		map[string]any{
+			"name":     "proxy.service",
+			"contents": "[Unit]\nRequires=web@1.service\n[Service]\nExecStart=/usr/bin/proxy\n",
+		},
+		map[string]any{
+			"name":    "zincati.service",
+			"dropins": []map[string]any{{"name": "off.conf", "contents": "[Unit]\nConditionPathExists=/nonexistent\n"}},
+		},
+		map[string]any{
+			"name":    "missing.service",
+			"dropins": []map[string]any{{"name": "broken.conf", "contents": "ExecStart=/bin/true\n"}},
+		},
+	)
+	findings, err := Units(ignition)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, f := range findings {
+		got = append(got, string(f.Rule)+" "+f.String())
+	}
+	want := []string{
+		"UnknownDirective unit app.service: unknown directive RestartSecs in [Service]",
+		"UnknownSection unit app.service: unknown section [Timer]",
+		"MissingInstall unit app.service: the unit is enabled but has no [Install] section, so enabling it does nothing",
+		"MissingDependency unit app.service: requires db.service, which the config does not define",
+		"InvalidUnit unit missing.service drop-in broken.conf: \"ExecStart=/bin/true\" is outside of any section and ignored",
+		"OrphanDropin unit missing.service: has drop-ins but the config does not define the unit",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("Units() =\n%q\nwant\n%q", got, want)
+	}
+	if !findings[3].CrossConfig() || findings[0].CrossConfig() {
+		t.Error("only missing units should be fixable by other configs")
+	}
+}
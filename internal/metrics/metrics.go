@@ -0,0 +1,194 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package metrics defines the Prometheus metrics exported by the operator.
+// All collectors are registered with the controller-runtime registry so they
+// are served by the manager's metrics endpoint alongside the default ones.
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/coreos/vcontext/report"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	ctrlmetrics "sigs.k8s.io/controller-runtime/pkg/metrics"
+
+	butanev1beta1 "github.com/naval-group/butane-operator/api/v1beta1"
+)
+
+const namespace = "butane"
+
+// FailureKindOther labels translation failures that did not produce any report entry,
+// e.g. unparsable YAML or an unknown variant/version.
+const FailureKindOther = "other"
+
+var (
+	// TranslationDuration observes the time spent translating Butane to Ignition.
+	TranslationDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "translation_duration_seconds",
+		Help:      "Time spent translating Butane configs to Ignition.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 12),
+	})
+
+	// TranslationFailures counts failed translations by the most severe report entry kind.
+	TranslationFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "translation_failures_total",
+		Help:      "Number of failed Butane translations, by report entry kind.",
+	}, []string{"kind"})
+
+	// IgnitionOutputBytes observes the size of the rendered Ignition configs.
+	IgnitionOutputBytes = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "ignition_output_bytes",
+		Help:      "Size in bytes of the rendered Ignition configs.",
+		Buckets:   prometheus.ExponentialBuckets(1024, 4, 8),
+	})
+
+	// SecretWrites counts writes of the generated Ignition secrets by operation.
+	SecretWrites = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "secret_writes_total",
+		Help:      "Number of Ignition secret writes, by operation.",
+	}, []string{"operation"})
+)
+
+func init() {
+	ctrlmetrics.Registry.MustRegister(
+		TranslationDuration,
+		TranslationFailures,
+		IgnitionOutputBytes,
+		SecretWrites,
+	)
+}
+
+// ObserveTranslation records the outcome of a single Butane translation.
+func ObserveTranslation(start time.Time, ignition []byte, rpt report.Report, err error) {
+	TranslationDuration.Observe(time.Since(start).Seconds())
+	if err != nil || len(rpt.Entries) > 0 {
+		TranslationFailures.WithLabelValues(FailureKind(rpt)).Inc()
+		return
+	}
+	IgnitionOutputBytes.Observe(float64(len(ignition)))
+}
+
+// FailureKind returns the most severe entry kind of the report, or
+// FailureKindOther when the report is empty.
+func FailureKind(rpt report.Report) string {
+	kind := FailureKindOther
+	for _, e := range rpt.Entries {
+		if e.Kind.IsFatal() {
+			return e.Kind.String()
+		}
+		if kind == FailureKindOther || e.Kind == report.Warn {
+			kind = e.Kind.String()
+		}
+	}
+	return kind
+}
+
+// ReadyCollector reports the number of ButaneConfigs per Ready condition status.
+// It lists objects at scrape time, so it should be given a cached reader.
+type ReadyCollector struct {
+	reader client.Reader
+	desc   *prometheus.Desc
+}
+
+// NewReadyCollector returns a collector counting ButaneConfigs per Ready state.
+func NewReadyCollector(reader client.Reader) *ReadyCollector {
+	return &ReadyCollector{
+		reader: reader,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "butaneconfigs"),
+			"Number of ButaneConfigs, by Ready condition status.",
+			[]string{"ready"}, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *ReadyCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector.
+func (c *ReadyCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var list butanev1beta1.ButaneConfigList
+	if err := c.reader.List(ctx, &list); err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+
+	counts := map[metav1.ConditionStatus]int{
+		metav1.ConditionTrue:    0,
+		metav1.ConditionFalse:   0,
+		metav1.ConditionUnknown: 0,
+	}
+	for i := range list.Items {
+		status := metav1.ConditionUnknown
+		if cond := meta.FindStatusCondition(list.Items[i].Status.Conditions, butanev1beta1.ConditionReady); cond != nil {
+			status = cond.Status
+		}
+		counts[status]++
+	}
+	for status, n := range counts {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(n), string(status))
+	}
+}
+
+// CertExpiryCollector reports when the webhook serving certificate expires.
+// It reads the certificate at scrape time, so that it follows the rotations
+// of the certificate.
+type CertExpiryCollector struct {
+	expiry func() (time.Time, error)
+	desc   *prometheus.Desc
+}
+
+// NewCertExpiryCollector returns a collector reporting the expiry time that
+// expiry reads from the webhook serving certificate.
+func NewCertExpiryCollector(expiry func() (time.Time, error)) *CertExpiryCollector {
+	return &CertExpiryCollector{
+		expiry: expiry,
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "webhook_cert_expiry_timestamp_seconds"),
+			"Expiry time of the webhook serving certificate in seconds since the Unix epoch.",
+			nil, nil,
+		),
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (c *CertExpiryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+// Collect implements prometheus.Collector.
+func (c *CertExpiryCollector) Collect(ch chan<- prometheus.Metric) {
+	notAfter, err := c.expiry()
+	if err != nil {
+		ch <- prometheus.NewInvalidMetric(c.desc, err)
+		return
+	}
+	ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(notAfter.Unix()))
+}
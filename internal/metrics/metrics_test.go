@@ -0,0 +1,109 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package metrics
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/coreos/vcontext/report"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	butanev1beta1 "github.com/naval-group/butane-operator/api/v1beta1"
+)
+
+func TestFailureKind(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []report.Entry
+		want    string
+	}{
+		{"empty", nil, FailureKindOther},
+		{"info only", []report.Entry{{Kind: report.Info}}, "info"},
+		{"warning over info", []report.Entry{{Kind: report.Info}, {Kind: report.Warn}}, "warning"},
+		{"error wins", []report.Entry{{Kind: report.Warn}, {Kind: report.Error}}, "error"},
+	}
+	for _, tt := range tests {
+		if got := FailureKind(report.Report{Entries: tt.entries}); got != tt.want {
+			t.Errorf("%s: FailureKind() = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestReadyCollector(t *testing.T) {
+	scheme := runtime.NewScheme()
+	if err := butanev1beta1.AddToScheme(scheme); err != nil {
+		t.Fatalf("AddToScheme() error = %v", err)
+	}
+
+	withReady := func(name string, status metav1.ConditionStatus) *butanev1beta1.ButaneConfig {
+		bc := &butanev1beta1.ButaneConfig{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"}}
+		if status != "" {
+			bc.Status.Conditions = []metav1.Condition{{Type: butanev1beta1.ConditionReady, Status: status}}
+		}
+		return bc
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(
+		withReady("a", metav1.ConditionTrue),
+		withReady("b", metav1.ConditionTrue),
+		withReady("c", metav1.ConditionFalse),
+		withReady("d", ""),
+	).Build()
+
+	expected := `
+# HELP butane_butaneconfigs Number of ButaneConfigs, by Ready condition status.
+# TYPE butane_butaneconfigs gauge
+butane_butaneconfigs{ready="False"} 1
+butane_butaneconfigs{ready="True"} 2
+butane_butaneconfigs{ready="Unknown"} 1
+`
+	if err := testutil.CollectAndCompare(NewReadyCollector(c), strings.NewReader(expected)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCertExpiryCollector(t *testing.T) {
+	notAfter := time.Unix(1714564800, 0)
+	var readErr error
+	c := NewCertExpiryCollector(func() (time.Time, error) { return notAfter, readErr })
+
+	expected := `
+# HELP butane_webhook_cert_expiry_timestamp_seconds Expiry time of the webhook serving certificate in seconds since the Unix epoch.
+# TYPE butane_webhook_cert_expiry_timestamp_seconds gauge
+butane_webhook_cert_expiry_timestamp_seconds %s
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(fmt.Sprintf(expected, "1.7145648e+09"))); err != nil {
+		t.Error(err)
+	}
+
+	// A rotated certificate is reported on the next scrape
+	notAfter = notAfter.Add(90 * 24 * time.Hour)
+	if err := testutil.CollectAndCompare(c, strings.NewReader(fmt.Sprintf(expected, "1.7223408e+09"))); err != nil {
+		t.Error(err)
+	}
+
+	readErr = errors.New("reading tls.crt: no such file or directory")
+	if err := testutil.CollectAndCompare(c, strings.NewReader("")); err == nil {
+		t.Error("a certificate that cannot be read should fail the collection")
+	}
+}
@@ -0,0 +1,138 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package migration moves stored custom resources to the storage version of
+// their CustomResourceDefinition.
+package migration
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/util/retry"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	butanev1beta1 "github.com/naval-group/butane-operator/api/v1beta1"
+)
+
+// StorageVersionMigrator rewrites every ButaneConfig so that it is stored in
+// the storage version, then drops the older versions from the CRD
+// status.storedVersions. Once no object is stored in v1alpha1 anymore, the
+// version can be removed from the CRD.
+type StorageVersionMigrator struct {
+	// Client writes the objects, Reader reads them bypassing the cache.
+	Client client.Client
+	Reader client.Reader
+	// CRDName is the name of the ButaneConfig CustomResourceDefinition.
+	CRDName string
+	// Namespaces restricts the migration to the namespaces the operator
+	// watches. Empty migrates all namespaces.
+	Namespaces []string
+	Log        logr.Logger
+}
+
+// NeedLeaderElection makes only the leader migrate objects.
+func (m *StorageVersionMigrator) NeedLeaderElection() bool {
+	return true
+}
+
+// Start runs the migration once. Failures are logged rather than returned so
+// that they do not stop the manager; the migration is retried on the next start.
+func (m *StorageVersionMigrator) Start(ctx context.Context) error {
+	if err := m.Migrate(ctx); err != nil {
+		m.Log.Error(err, "Storage version migration failed", "crd", m.CRDName)
+	}
+	return nil
+}
+
+// Migrate rewrites the stored objects when the CRD records more than the
+// storage version in status.storedVersions.
+func (m *StorageVersionMigrator) Migrate(ctx context.Context) error {
+	var crd apiextensionsv1.CustomResourceDefinition
+	if err := m.Reader.Get(ctx, client.ObjectKey{Name: m.CRDName}, &crd); err != nil {
+		return fmt.Errorf("failed to get CustomResourceDefinition %s: %w", m.CRDName, err)
+	}
+	storage := ""
+	for _, v := range crd.Spec.Versions {
+		if v.Storage {
+			storage = v.Name
+		}
+	}
+	if storage == "" {
+		return fmt.Errorf("CustomResourceDefinition %s has no storage version", m.CRDName)
+	}
+	if len(crd.Status.StoredVersions) == 1 && crd.Status.StoredVersions[0] == storage {
+		return nil
+	}
+
+	list, err := m.list(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range list {
+		key := client.ObjectKeyFromObject(&list[i])
+		err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+			var bc butanev1beta1.ButaneConfig
+			if err := m.Reader.Get(ctx, key, &bc); err != nil {
+				return err
+			}
+			// An unchanged update makes the API server store the object again,
+			// encoded in the storage version.
+			return m.Client.Update(ctx, &bc)
+		})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to migrate ButaneConfig %s: %w", key, err)
+		}
+	}
+	m.Log.Info("Migrated ButaneConfigs to the storage version", "version", storage, "count", len(list))
+
+	// Objects in other namespaces may still be stored in an older version.
+	if len(m.Namespaces) > 0 {
+		m.Log.Info("Not updating the stored versions of the CRD since only some namespaces were migrated", "crd", m.CRDName)
+		return nil
+	}
+
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if err := m.Reader.Get(ctx, client.ObjectKey{Name: m.CRDName}, &crd); err != nil {
+			return err
+		}
+		crd.Status.StoredVersions = []string{storage}
+		return m.Client.Status().Update(ctx, &crd)
+	})
+}
+
+// list returns the ButaneConfigs of the namespaces to migrate.
+func (m *StorageVersionMigrator) list(ctx context.Context) ([]butanev1beta1.ButaneConfig, error) {
+	if len(m.Namespaces) == 0 {
+		var list butanev1beta1.ButaneConfigList
+		if err := m.Reader.List(ctx, &list); err != nil {
+			return nil, fmt.Errorf("failed to list ButaneConfigs: %w", err)
+		}
+		return list.Items, nil
+	}
+	var items []butanev1beta1.ButaneConfig
+	for _, ns := range m.Namespaces {
+		var list butanev1beta1.ButaneConfigList
+		if err := m.Reader.List(ctx, &list, client.InNamespace(ns)); err != nil {
+			return nil, fmt.Errorf("failed to list ButaneConfigs in namespace %s: %w", ns, err)
+		}
+		items = append(items, list.Items...)
+	}
+	return items, nil
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package migration
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/go-logr/logr"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	butanev1beta1 "github.com/naval-group/butane-operator/api/v1beta1"
+)
+
+const crdName = "butaneconfigs.butane.operators.naval-group.com"
+
+func TestMigrate(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
+	utilruntime.Must(butanev1beta1.AddToScheme(scheme))
+
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: crdName},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1alpha1", Served: true},
+				{Name: "v1beta1", Served: true, Storage: true},
+			},
+		},
+		Status: apiextensionsv1.CustomResourceDefinitionStatus{StoredVersions: []string{"v1alpha1", "v1beta1"}},
+	}
+	bc := &butanev1beta1.ButaneConfig{ObjectMeta: metav1.ObjectMeta{Name: "motd", Namespace: "default"}}
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(crd, bc).
+		WithStatusSubresource(crd).
+		Build()
+
+	var before butanev1beta1.ButaneConfig
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(bc), &before); err != nil {
+		t.Fatal(err)
+	}
+
+	m := &StorageVersionMigrator{Client: c, Reader: c, CRDName: crdName, Log: logr.Discard()}
+	if err := m.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var after butanev1beta1.ButaneConfig
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(bc), &after); err != nil {
+		t.Fatal(err)
+	}
+	if after.ResourceVersion == before.ResourceVersion {
+		t.Error("ButaneConfig should have been written again")
+	}
+	var migrated apiextensionsv1.CustomResourceDefinition
+	if err := c.Get(context.Background(), client.ObjectKey{Name: crdName}, &migrated); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(migrated.Status.StoredVersions, []string{"v1beta1"}) {
+		t.Errorf("storedVersions = %v, want [v1beta1]", migrated.Status.StoredVersions)
+	}
+
+	// Once migrated, nothing is written anymore.
+	if err := m.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	var again butanev1beta1.ButaneConfig
+	if err := c.Get(context.Background(), client.ObjectKeyFromObject(bc), &again); err != nil {
+		t.Fatal(err)
+	}
+	if again.ResourceVersion != after.ResourceVersion {
+		t.Error("an already migrated CRD should not rewrite objects")
+	}
+}
+
+func TestMigrateNamespaces(t *testing.T) {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
+	utilruntime.Must(butanev1beta1.AddToScheme(scheme))
+
+	crd := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: crdName},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Versions: []apiextensionsv1.CustomResourceDefinitionVersion{
+				{Name: "v1alpha1", Served: true},
+				{Name: "v1beta1", Served: true, Storage: true},
+			},
+		},
+		Status: apiextensionsv1.CustomResourceDefinitionStatus{StoredVersions: []string{"v1alpha1", "v1beta1"}},
+	}
+	watched := &butanev1beta1.ButaneConfig{ObjectMeta: metav1.ObjectMeta{Name: "motd", Namespace: "tenant-a"}}
+	other := &butanev1beta1.ButaneConfig{ObjectMeta: metav1.ObjectMeta{Name: "motd", Namespace: "tenant-b"}}
+	c := fake.NewClientBuilder().
+		WithScheme(scheme).
+		WithObjects(crd, watched, other).
+		WithStatusSubresource(crd).
+		Build()
+
+	resourceVersion := func(obj client.Object) string {
+		var bc butanev1beta1.ButaneConfig
+		if err := c.Get(context.Background(), client.ObjectKeyFromObject(obj), &bc); err != nil {
+			t.Fatal(err)
+		}
+		return bc.ResourceVersion
+	}
+	watchedBefore, otherBefore := resourceVersion(watched), resourceVersion(other)
+
+	m := &StorageVersionMigrator{Client: c, Reader: c, CRDName: crdName, Namespaces: []string{"tenant-a"}, Log: logr.Discard()}
+	if err := m.Migrate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if resourceVersion(watched) == watchedBefore {
+		t.Error("ButaneConfig in a watched namespace should have been written again")
+	}
+	if resourceVersion(other) != otherBefore {
+		t.Error("ButaneConfig in another namespace should not have been written")
+	}
+	var migrated apiextensionsv1.CustomResourceDefinition
+	if err := c.Get(context.Background(), client.ObjectKey{Name: crdName}, &migrated); err != nil {
+		t.Fatal(err)
+	}
+	if len(migrated.Status.StoredVersions) != 2 {
+		t.Errorf("storedVersions = %v, should be kept until every namespace is migrated", migrated.Status.StoredVersions)
+	}
+}
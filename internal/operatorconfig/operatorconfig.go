@@ -0,0 +1,431 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package operatorconfig reads the versioned configuration file of the
+// operator. The manager, webhook, certs, users and images sections are read
+// on startup; the defaults and policy sections are reloaded when the file
+// changes.
+package operatorconfig
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation/field"
+	"sigs.k8s.io/yaml"
+
+	"github.com/naval-group/butane-operator/internal/lint"
+	"github.com/naval-group/butane-operator/internal/schema"
+)
+
+const (
+	// APIVersion is the version of the configuration file format.
+	APIVersion = "config.butane.operators.naval-group.com/v1alpha1"
+	// Kind is the kind of the configuration file.
+	Kind = "OperatorConfig"
+)
+
+// OperatorConfig is the configuration file of the operator.
+type OperatorConfig struct {
+	metav1.TypeMeta `json:",inline"`
+
+	// Manager configures the controller manager. Read on startup.
+	Manager ManagerConfig `json:"manager,omitempty"`
+	// Webhook configures the webhook server. Read on startup.
+	Webhook WebhookConfig `json:"webhook,omitempty"`
+	// Certs configures the self-signed webhook serving certificate. Read on
+	// startup.
+	Certs CertsConfig `json:"certs,omitempty"`
+	// Users configures the user directory spec.users reads SSH authorized
+	// keys from. Read on startup.
+	Users UsersConfig `json:"users,omitempty"`
+	// Images configures the registries spec.images.pin resolves digests
+	// against. Read on startup.
+	Images ImagesConfig `json:"images,omitempty"`
+	// Defaults apply to ButaneConfigs that leave a setting unset. Reloaded
+	// when the file changes.
+	Defaults DefaultsConfig `json:"defaults,omitempty"`
+	// Policy restricts the ButaneConfigs the webhook admits and the
+	// controller renders. Reloaded when the file changes.
+	Policy PolicyConfig `json:"policy,omitempty"`
+}
+
+// ManagerConfig configures the controller manager.
+type ManagerConfig struct {
+	MetricsBindAddress     string `json:"metricsBindAddress,omitempty"`
+	SecureMetrics          bool   `json:"secureMetrics,omitempty"`
+	HealthProbeBindAddress string `json:"healthProbeBindAddress,omitempty"`
+	LeaderElection         bool   `json:"leaderElection,omitempty"`
+	// MaxConcurrentReconciles is the number of ButaneConfigs reconciled in
+	// parallel.
+	MaxConcurrentReconciles int               `json:"maxConcurrentReconciles,omitempty"`
+	RateLimiter             RateLimiterConfig `json:"rateLimiter,omitempty"`
+	// WatchNamespaces and the namespaces matching WatchNamespaceSelector are
+	// the namespaces watched. When both are empty, all namespaces are.
+	WatchNamespaces        []string `json:"watchNamespaces,omitempty"`
+	WatchNamespaceSelector string   `json:"watchNamespaceSelector,omitempty"`
+	// CRDNames are the CustomResourceDefinitions served by the conversion
+	// webhook. The first one is migrated to its storage version.
+	CRDNames []string `json:"crdNames,omitempty"`
+}
+
+// RateLimiterConfig paces the retries of failed reconciliations.
+type RateLimiterConfig struct {
+	BaseDelay metav1.Duration `json:"baseDelay,omitempty"`
+	MaxDelay  metav1.Duration `json:"maxDelay,omitempty"`
+	QPS       float64         `json:"qps,omitempty"`
+	Burst     int             `json:"burst,omitempty"`
+}
+
+// WebhookConfig configures the webhook server.
+type WebhookConfig struct {
+	// Enabled serves the admission and conversion webhooks.
+	Enabled     *bool  `json:"enabled,omitempty"`
+	EnableHTTP2 bool   `json:"enableHTTP2,omitempty"`
+	CertDir     string `json:"certDir,omitempty"`
+	// ServiceName and Namespace locate the Service in front of the webhook
+	// server, which the serving certificate is issued for.
+	ServiceName string `json:"serviceName,omitempty"`
+	Namespace   string `json:"namespace,omitempty"`
+	SecretName  string `json:"secretName,omitempty"`
+	// ConfigName is the name of the ValidatingWebhookConfiguration; the
+	// MutatingWebhookConfiguration name is derived from it.
+	ConfigName string `json:"configName,omitempty"`
+}
+
+// IsEnabled reports whether the webhooks are served.
+func (w WebhookConfig) IsEnabled() bool {
+	return w.Enabled == nil || *w.Enabled
+}
+
+// CertsConfig configures the self-signed webhook serving certificate.
+type CertsConfig struct {
+	Validity metav1.Duration `json:"validity,omitempty"`
+	// RenewalThreshold is how long before expiry the certificate is renewed.
+	RenewalThreshold metav1.Duration `json:"renewalThreshold,omitempty"`
+}
+
+// UsersConfig configures the user directory.
+type UsersConfig struct {
+	// DirectoryFile is the user directory file, listing the SSH authorized
+	// keys of each user. It is checked for changes every DirectoryInterval.
+	// Empty disables the directory.
+	DirectoryFile     string          `json:"directoryFile,omitempty"`
+	DirectoryInterval metav1.Duration `json:"directoryInterval,omitempty"`
+}
+
+// ImagesConfig configures the registries container images are resolved
+// against, and the Ignition of spec.output.oci is pushed to.
+type ImagesConfig struct {
+	// Mirrors maps registries, e.g. docker.io, to the registry their images
+	// are resolved against instead, e.g. an in-cluster mirror.
+	Mirrors map[string]string `json:"mirrors,omitempty"`
+	// PlainHTTPRegistries lists the registries reached over HTTP instead of
+	// HTTPS.
+	PlainHTTPRegistries []string `json:"plainHTTPRegistries,omitempty"`
+}
+
+// DefaultsConfig holds the values used when a ButaneConfig leaves a setting
+// unset.
+type DefaultsConfig struct {
+	// SizeLimit replaces the default of spec.output.size.limit.
+	SizeLimit *resource.Quantity `json:"sizeLimit,omitempty"`
+	// SpillThreshold replaces the default of spec.output.size.spill.threshold.
+	SpillThreshold *resource.Quantity `json:"spillThreshold,omitempty"`
+}
+
+// PolicyConfig restricts the ButaneConfigs the webhook admits and the
+// controller renders.
+type PolicyConfig struct {
+	// AllowedVariants are the Butane variants accepted. Empty accepts all.
+	AllowedVariants []string `json:"allowedVariants,omitempty"`
+	// RequireEncryption rejects ButaneConfigs without spec.output.encryption.
+	RequireEncryption bool `json:"requireEncryption,omitempty"`
+	// UnitLint is what is done with the problems the linter finds in the
+	// systemd units of ButaneConfigs: Ignore, Warn, the default, or Reject.
+	UnitLint LintAction `json:"unitLint,omitempty"`
+	// IgnitionLint is what is done with the problems the linter finds in the
+	// storage of the Ignition configs, e.g. conflicting paths or setuid
+	// files: Ignore, Warn, the default, or Reject.
+	IgnitionLint LintAction `json:"ignitionLint,omitempty"`
+}
+
+// LintAction is what is done with the findings of a linter.
+type LintAction string
+
+const (
+	// LintIgnore drops the findings.
+	LintIgnore LintAction = "Ignore"
+	// LintWarn reports the findings as admission warnings and events.
+	LintWarn LintAction = "Warn"
+	// LintReject rejects the ButaneConfigs with findings.
+	LintReject LintAction = "Reject"
+)
+
+// Apply returns the findings of the linter of what as warnings, or as an
+// error when the action rejects them. The empty action warns.
+func (a LintAction) Apply(what string, findings []lint.Finding) ([]string, error) {
+	if len(findings) == 0 || a == LintIgnore {
+		return nil, nil
+	}
+	messages := make([]string, 0, len(findings))
+	for _, f := range findings {
+		messages = append(messages, f.String())
+	}
+	if a == LintReject {
+		return nil, fmt.Errorf("the operator policy rejects the problems found in %s: %s", what, strings.Join(messages, "; "))
+	}
+	for i, message := range messages {
+		messages[i] = what + ": " + message
+	}
+	return messages, nil
+}
+
+// CheckVariant returns an error when the policy does not allow the variant.
+func (p PolicyConfig) CheckVariant(variant string) error {
+	if len(p.AllowedVariants) == 0 || slices.Contains(p.AllowedVariants, variant) {
+		return nil
+	}
+	return fmt.Errorf("variant %q is not allowed by the operator policy, must be one of %s", variant, strings.Join(p.AllowedVariants, ", "))
+}
+
+// CheckEncryption returns an error when the policy requires encryption and
+// the output is not encrypted.
+func (p PolicyConfig) CheckEncryption(encrypted bool) error {
+	if p.RequireEncryption && !encrypted {
+		return fmt.Errorf("the operator policy requires spec.output.encryption")
+	}
+	return nil
+}
+
+// Default returns the configuration used when no file is given.
+func Default() *OperatorConfig {
+	return &OperatorConfig{
+		TypeMeta: metav1.TypeMeta{APIVersion: APIVersion, Kind: Kind},
+		Manager: ManagerConfig{
+			MetricsBindAddress:      ":8080",
+			HealthProbeBindAddress:  ":8081",
+			MaxConcurrentReconciles: 1,
+			RateLimiter: RateLimiterConfig{
+				BaseDelay: metav1.Duration{Duration: 5 * time.Millisecond},
+				MaxDelay:  metav1.Duration{Duration: 5 * time.Minute},
+				QPS:       10,
+				Burst:     100,
+			},
+			CRDNames: []string{"butaneconfigs.butane.operators.naval-group.com"},
+		},
+		Webhook: WebhookConfig{
+			CertDir:     "/tmp/k8s-webhook-server/serving-certs",
+			ServiceName: "butane-operator-webhook-service",
+			Namespace:   "butane-operator-system",
+			SecretName:  "webhook-server-cert",
+			ConfigName:  "butane-operator-validating-webhook-configuration",
+		},
+		Certs: CertsConfig{
+			Validity:         metav1.Duration{Duration: 365 * 24 * time.Hour},
+			RenewalThreshold: metav1.Duration{Duration: 30 * 24 * time.Hour},
+		},
+	}
+}
+
+// Load reads the configuration file at path over base, so that the settings
+// the file leaves out keep their value in base, and validates the result.
+func Load(path string, base *OperatorConfig) (*OperatorConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the operator config: %w", err)
+	}
+	return Parse(data, base)
+}
+
+// Parse decodes a configuration file over base and validates the result.
+// Unknown fields are rejected, so that misspelled settings are not ignored.
+func Parse(data []byte, base *OperatorConfig) (*OperatorConfig, error) {
+	var header metav1.TypeMeta
+	if err := yaml.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("invalid operator config: %w", err)
+	}
+	if header.APIVersion != APIVersion || header.Kind != Kind {
+		return nil, fmt.Errorf("unsupported operator config %s %s, must be %s %s", header.APIVersion, header.Kind, APIVersion, Kind)
+	}
+
+	cfg := base.DeepCopy()
+	if err := yaml.UnmarshalStrict(data, cfg); err != nil {
+		return nil, fmt.Errorf("invalid operator config: %w", err)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Validate checks the settings.
+func (c *OperatorConfig) Validate() error {
+	var errs field.ErrorList
+
+	manager := field.NewPath("manager")
+	if c.Manager.MaxConcurrentReconciles < 1 {
+		errs = append(errs, field.Invalid(manager.Child("maxConcurrentReconciles"), c.Manager.MaxConcurrentReconciles, "must be at least 1"))
+	}
+	rl, rlPath := c.Manager.RateLimiter, manager.Child("rateLimiter")
+	if rl.BaseDelay.Duration <= 0 {
+		errs = append(errs, field.Invalid(rlPath.Child("baseDelay"), rl.BaseDelay.String(), "must be positive"))
+	}
+	if rl.MaxDelay.Duration < rl.BaseDelay.Duration {
+		errs = append(errs, field.Invalid(rlPath.Child("maxDelay"), rl.MaxDelay.String(), "must not be shorter than baseDelay"))
+	}
+	if rl.QPS <= 0 {
+		errs = append(errs, field.Invalid(rlPath.Child("qps"), rl.QPS, "must be positive"))
+	}
+	if rl.Burst < 1 {
+		errs = append(errs, field.Invalid(rlPath.Child("burst"), rl.Burst, "must be at least 1"))
+	}
+	if c.Manager.WatchNamespaceSelector != "" {
+		if _, err := labels.Parse(c.Manager.WatchNamespaceSelector); err != nil {
+			errs = append(errs, field.Invalid(manager.Child("watchNamespaceSelector"), c.Manager.WatchNamespaceSelector, err.Error()))
+		}
+	}
+	if len(c.Manager.CRDNames) == 0 {
+		errs = append(errs, field.Required(manager.Child("crdNames"), ""))
+	}
+
+	if c.Webhook.IsEnabled() {
+		webhook := field.NewPath("webhook")
+		for name, value := range map[string]string{
+			"certDir":     c.Webhook.CertDir,
+			"serviceName": c.Webhook.ServiceName,
+			"namespace":   c.Webhook.Namespace,
+			"secretName":  c.Webhook.SecretName,
+			"configName":  c.Webhook.ConfigName,
+		} {
+			if value == "" {
+				errs = append(errs, field.Required(webhook.Child(name), "required when the webhooks are enabled"))
+			}
+		}
+
+		certs := field.NewPath("certs")
+		if c.Certs.RenewalThreshold.Duration <= 0 {
+			errs = append(errs, field.Invalid(certs.Child("renewalThreshold"), c.Certs.RenewalThreshold.String(), "must be positive"))
+		}
+		if c.Certs.Validity.Duration <= c.Certs.RenewalThreshold.Duration {
+			errs = append(errs, field.Invalid(certs.Child("validity"), c.Certs.Validity.String(), "must be longer than renewalThreshold"))
+		}
+	}
+
+	users := field.NewPath("users")
+	if f := c.Users.DirectoryFile; f != "" && !filepath.IsAbs(f) {
+		errs = append(errs, field.Invalid(users.Child("directoryFile"), f, "must be an absolute path"))
+	}
+	if c.Users.DirectoryInterval.Duration < 0 {
+		errs = append(errs, field.Invalid(users.Child("directoryInterval"), c.Users.DirectoryInterval.String(), "must not be negative"))
+	}
+
+	images := field.NewPath("images")
+	for _, registry := range slices.Sorted(maps.Keys(c.Images.Mirrors)) {
+		if !isRegistryHost(registry) {
+			errs = append(errs, field.Invalid(images.Child("mirrors"), registry, "must be a registry host, e.g. docker.io"))
+		}
+		if mirror := c.Images.Mirrors[registry]; !isRegistryHost(mirror) {
+			errs = append(errs, field.Invalid(images.Child("mirrors").Key(registry), mirror, "must be a registry host, e.g. mirror.local:5000"))
+		}
+	}
+	for i, registry := range c.Images.PlainHTTPRegistries {
+		if !isRegistryHost(registry) {
+			errs = append(errs, field.Invalid(images.Child("plainHTTPRegistries").Index(i), registry, "must be a registry host, e.g. mirror.local:5000"))
+		}
+	}
+
+	defaults := field.NewPath("defaults")
+	if q := c.Defaults.SizeLimit; q != nil && q.Sign() <= 0 {
+		errs = append(errs, field.Invalid(defaults.Child("sizeLimit"), q.String(), "must be positive"))
+	}
+	if q := c.Defaults.SpillThreshold; q != nil && q.Sign() < 0 {
+		errs = append(errs, field.Invalid(defaults.Child("spillThreshold"), q.String(), "must not be negative"))
+	}
+
+	for i, variant := range c.Policy.AllowedVariants {
+		if schema.Latest(variant) == "" {
+			errs = append(errs, field.NotSupported(field.NewPath("policy", "allowedVariants").Index(i), variant, variants()))
+		}
+	}
+
+	for _, setting := range []struct {
+		name   string
+		action LintAction
+	}{{"unitLint", c.Policy.UnitLint}, {"ignitionLint", c.Policy.IgnitionLint}} {
+		switch setting.action {
+		case "", LintIgnore, LintWarn, LintReject:
+		default:
+			errs = append(errs, field.NotSupported(field.NewPath("policy", setting.name), setting.action,
+				[]LintAction{LintIgnore, LintWarn, LintReject}))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid operator config: %w", errs.ToAggregate())
+	}
+	return nil
+}
+
+// variants returns the Butane variants the schema knows, in order.
+func variants() []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, s := range schema.Specs {
+		if !seen[s.Variant] {
+			seen[s.Variant] = true
+			out = append(out, s.Variant)
+		}
+	}
+	return out
+}
+
+// DeepCopy returns a copy of the configuration that shares nothing with it.
+func (c *OperatorConfig) DeepCopy() *OperatorConfig {
+	out := *c
+	out.Manager.WatchNamespaces = append([]string(nil), c.Manager.WatchNamespaces...)
+	out.Manager.CRDNames = append([]string(nil), c.Manager.CRDNames...)
+	if c.Webhook.Enabled != nil {
+		enabled := *c.Webhook.Enabled
+		out.Webhook.Enabled = &enabled
+	}
+	if c.Defaults.SizeLimit != nil {
+		q := c.Defaults.SizeLimit.DeepCopy()
+		out.Defaults.SizeLimit = &q
+	}
+	if c.Defaults.SpillThreshold != nil {
+		q := c.Defaults.SpillThreshold.DeepCopy()
+		out.Defaults.SpillThreshold = &q
+	}
+	out.Images.Mirrors = maps.Clone(c.Images.Mirrors)
+	out.Images.PlainHTTPRegistries = append([]string(nil), c.Images.PlainHTTPRegistries...)
+	out.Policy.AllowedVariants = append([]string(nil), c.Policy.AllowedVariants...)
+	return &out
+}
+
+// isRegistryHost reports whether s is the host, and port, of a registry,
+// without a scheme or path.
+func isRegistryHost(s string) bool {
+	return s != "" && !strings.ContainsAny(s, "/ ")
+}
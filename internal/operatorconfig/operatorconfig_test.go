@@ -0,0 +1,176 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operatorconfig
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/naval-group/butane-operator/internal/lint"
+)
+
+func TestParse(t *testing.T) {
+	cfg, err := Parse([]byte(`apiVersion: config.butane.operators.naval-group.com/v1alpha1
+kind: OperatorConfig
+manager:
+  maxConcurrentReconciles: 4
+  rateLimiter:
+    maxDelay: 1m
+  watchNamespaces: [tenant-a]
+defaults:
+  sizeLimit: 512Ki
+policy:
+  allowedVariants: [fcos, flatcar]
+`), Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Manager.MaxConcurrentReconciles != 4 {
+		t.Errorf("maxConcurrentReconciles = %d, want 4", cfg.Manager.MaxConcurrentReconciles)
+	}
+	if cfg.Manager.RateLimiter.MaxDelay.Duration != time.Minute {
+		t.Errorf("maxDelay = %s, want 1m", cfg.Manager.RateLimiter.MaxDelay.Duration)
+	}
+	// Settings left out keep their default.
+	if cfg.Manager.RateLimiter.Burst != 100 || cfg.Webhook.CertDir != Default().Webhook.CertDir {
+		t.Errorf("unset settings should keep their default, got %+v", cfg)
+	}
+	if got := cfg.Defaults.SizeLimit.Value(); got != 512*1024 {
+		t.Errorf("sizeLimit = %d, want %d", got, 512*1024)
+	}
+	if err := cfg.Policy.CheckVariant("flatcar"); err != nil {
+		t.Error(err)
+	}
+	if err := cfg.Policy.CheckVariant("openshift"); err == nil {
+		t.Error("openshift should not be allowed")
+	}
+}
+
+func TestDeployedConfig(t *testing.T) {
+	cfg, err := Load("../../config/manager/operator_config.yaml", Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Manager.MaxConcurrentReconciles != Default().Manager.MaxConcurrentReconciles {
+		t.Errorf("the deployed config should match the defaults, got %+v", cfg.Manager)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []string
+	}{
+		{
+			name: "wrong kind",
+			data: "apiVersion: v1\nkind: ConfigMap\n",
+			want: []string{"unsupported operator config"},
+		},
+		{
+			name: "unknown field",
+			data: "apiVersion: " + APIVersion + "\nkind: " + Kind + "\nmanager:\n  maxConcurentReconciles: 2\n",
+			want: []string{"maxConcurentReconciles"},
+		},
+		{
+			name: "invalid settings",
+			data: "apiVersion: " + APIVersion + "\nkind: " + Kind + `
+manager:
+  maxConcurrentReconciles: 0
+  rateLimiter:
+    baseDelay: 1m
+    maxDelay: 1s
+certs:
+  validity: 24h
+  renewalThreshold: 48h
+users:
+  directoryFile: users.yaml
+images:
+  mirrors:
+    docker.io: https://mirror.local
+defaults:
+  sizeLimit: "0"
+policy:
+  allowedVariants: [coreos]
+  unitLint: Error
+  ignitionLint: warn
+`,
+			want: []string{
+				"manager.maxConcurrentReconciles",
+				"manager.rateLimiter.maxDelay",
+				"certs.validity",
+				"users.directoryFile",
+				"images.mirrors[docker.io]",
+				"defaults.sizeLimit",
+				`policy.allowedVariants[0]: Unsupported value: "coreos"`,
+				`policy.unitLint: Unsupported value: "Error"`,
+				`policy.ignitionLint: Unsupported value: "warn"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse([]byte(tt.data), Default())
+			if err == nil {
+				t.Fatal("Parse() should fail")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestDisabledWebhookSkipsCertSettings(t *testing.T) {
+	cfg, err := Parse([]byte("apiVersion: "+APIVersion+"\nkind: "+Kind+"\nwebhook:\n  enabled: false\n  certDir: \"\"\n"), Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Webhook.IsEnabled() {
+		t.Error("webhooks should be disabled")
+	}
+}
+
+func TestCheckEncryption(t *testing.T) {
+	policy := PolicyConfig{RequireEncryption: true}
+	if err := policy.CheckEncryption(false); err == nil {
+		t.Error("an unencrypted output should be rejected")
+	}
+	if err := policy.CheckEncryption(true); err != nil {
+		t.Error(err)
+	}
+	if err := (PolicyConfig{}).CheckEncryption(false); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestLintAction(t *testing.T) {
+	findings := []lint.Finding{{Rule: lint.RuleMissingInstall, Location: "unit app.service", Message: "no [Install] section"}}
+	warnings, err := LintAction("").Apply("systemd units", findings)
+	if err != nil || len(warnings) != 1 || warnings[0] != "systemd units: unit app.service: no [Install] section" {
+		t.Errorf("Apply() = %q, %v, want a warning", warnings, err)
+	}
+	if warnings, err := LintIgnore.Apply("systemd units", findings); err != nil || warnings != nil {
+		t.Errorf("Apply() = %q, %v, want nothing", warnings, err)
+	}
+	if _, err := LintReject.Apply("systemd units", findings); err == nil || !strings.Contains(err.Error(), "unit app.service: no [Install] section") {
+		t.Errorf("Apply() = %v, want the finding rejected", err)
+	}
+}
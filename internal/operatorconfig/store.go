@@ -0,0 +1,131 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operatorconfig
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+)
+
+// Store holds the current configuration, shared by the controller and the
+// webhook. A nil Store holds the default configuration.
+type Store struct {
+	current atomic.Pointer[OperatorConfig]
+}
+
+// NewStore returns a Store holding cfg.
+func NewStore(cfg *OperatorConfig) *Store {
+	s := &Store{}
+	s.current.Store(cfg)
+	return s
+}
+
+// Get returns the current configuration. It must not be modified.
+func (s *Store) Get() *OperatorConfig {
+	if s == nil {
+		return Default()
+	}
+	return s.current.Load()
+}
+
+// Watcher reloads the defaults and policy sections of the configuration file
+// into a Store when the file changes. Changes to the other sections are
+// logged and only take effect on restart.
+type Watcher struct {
+	// Path is the configuration file, usually mounted from a ConfigMap.
+	Path  string
+	Store *Store
+	// Interval is how often the file is checked. Defaults to 10 seconds.
+	Interval time.Duration
+	Log      logr.Logger
+
+	data   []byte
+	loaded *OperatorConfig
+}
+
+// NeedLeaderElection makes every replica reload, since all of them serve the
+// webhook.
+func (w *Watcher) NeedLeaderElection() bool {
+	return false
+}
+
+// Start checks the file until the context is done.
+func (w *Watcher) Start(ctx context.Context) error {
+	interval := w.Interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			if err := w.Reload(); err != nil {
+				w.Log.Error(err, "Keeping the previous operator config", "path", w.Path)
+			}
+		}
+	}
+}
+
+// Reload reads the file and, when it changed and is valid, updates the
+// reloadable sections of the Store. An invalid file leaves the Store as is.
+func (w *Watcher) Reload() error {
+	data, err := os.ReadFile(w.Path)
+	if err != nil {
+		return err
+	}
+	if w.data != nil && bytes.Equal(data, w.data) {
+		return nil
+	}
+
+	// Settings removed from the reloadable sections go back to their default.
+	current := w.Store.Get()
+	cfg, err := Parse(data, startupSections(current))
+	if err != nil {
+		return err
+	}
+	if w.loaded == nil {
+		// The first read is the file the manager was started with.
+		w.loaded = cfg
+	} else if !reflect.DeepEqual(startupSections(cfg), startupSections(w.loaded)) {
+		w.Log.Info("The manager, webhook, certs, users and images settings changed; restart the manager to apply them", "path", w.Path)
+	}
+	w.data = data
+
+	next := current.DeepCopy()
+	next.Defaults = cfg.Defaults
+	next.Policy = cfg.Policy
+	w.Store.current.Store(next)
+	w.Log.Info("Reloaded the operator config", "path", w.Path)
+	return nil
+}
+
+// startupSections returns the configuration without its reloadable sections.
+func startupSections(cfg *OperatorConfig) *OperatorConfig {
+	out := cfg.DeepCopy()
+	out.Defaults = DefaultsConfig{}
+	out.Policy = PolicyConfig{}
+	return out
+}
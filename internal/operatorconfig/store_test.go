@@ -0,0 +1,80 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package operatorconfig
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+const header = "apiVersion: " + APIVersion + "\nkind: " + Kind + "\n"
+
+func TestWatcherReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(header+data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("manager:\n  maxConcurrentReconciles: 2\npolicy:\n  allowedVariants: [fcos]\n")
+	cfg, err := Load(path, Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := NewStore(cfg)
+	w := &Watcher{Path: path, Store: store, Log: logr.Discard()}
+	if err := w.Reload(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The policy is reloaded, the manager settings only on restart.
+	write("manager:\n  maxConcurrentReconciles: 8\npolicy:\n  requireEncryption: true\n")
+	if err := w.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	got := store.Get()
+	if !got.Policy.RequireEncryption {
+		t.Error("requireEncryption should have been reloaded")
+	}
+	if len(got.Policy.AllowedVariants) != 0 {
+		t.Errorf("allowedVariants removed from the file should be reset, got %v", got.Policy.AllowedVariants)
+	}
+	if got.Manager.MaxConcurrentReconciles != 2 {
+		t.Errorf("maxConcurrentReconciles = %d, should only change on restart", got.Manager.MaxConcurrentReconciles)
+	}
+
+	// An invalid file keeps the previous config.
+	write("defaults:\n  sizeLimit: -1\n")
+	if err := w.Reload(); err == nil {
+		t.Error("Reload() should reject an invalid config")
+	}
+	if !store.Get().Policy.RequireEncryption {
+		t.Error("an invalid config should not be applied")
+	}
+}
+
+func TestNilStore(t *testing.T) {
+	var store *Store
+	if store.Get().Manager.MaxConcurrentReconciles != 1 {
+		t.Error("a nil Store should hold the defaults")
+	}
+}
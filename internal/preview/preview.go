@@ -0,0 +1,305 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package preview serves the render endpoint of the webhook server, which
+// translates a proposed ButaneConfig to Ignition without creating any object.
+// Callers authenticate with a bearer token, checked with a TokenReview, and
+// must be allowed to create the ButaneConfig, checked with a
+// SubjectAccessReview.
+package preview
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/coreos/vcontext/report"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	logf "sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/yaml"
+
+	butanev1beta1 "github.com/naval-group/butane-operator/api/v1beta1"
+	"github.com/naval-group/butane-operator/internal/operatorconfig"
+	"github.com/naval-group/butane-operator/internal/render"
+)
+
+// Path is where the handler is registered on the webhook server.
+const Path = "/render"
+
+// maxBodySize bounds the request body, above the size of the largest object
+// the API server stores.
+const maxBodySize = 3 << 20
+
+var log = logf.Log.WithName("preview")
+
+//+kubebuilder:rbac:groups=authentication.k8s.io,resources=tokenreviews,verbs=create
+//+kubebuilder:rbac:groups=authorization.k8s.io,resources=subjectaccessreviews,verbs=create
+
+// Handler renders the ButaneConfig posted to it, in YAML or JSON, the way the
+// admission webhook validates it and the controller translates it.
+type Handler struct {
+	// Client creates the TokenReviews and SubjectAccessReviews, and lists the
+	// ButaneInjectionPolicies.
+	Client client.Client
+	// Config holds the operator policy. Nil allows everything.
+	Config *operatorconfig.Store
+}
+
+// Response is the body the handler replies with.
+type Response struct {
+	// Ignition is the Ignition config, unset when the config is rejected.
+	Ignition json.RawMessage `json:"ignition,omitempty"`
+	// Report lists the entries of the Butane translation report.
+	Report []ReportEntry `json:"report,omitempty"`
+	// Warnings are the admission warnings of the config.
+	Warnings []string `json:"warnings,omitempty"`
+	// Error tells why the request failed.
+	Error string `json:"error,omitempty"`
+}
+
+// ReportEntry is an entry of the Butane translation report.
+type ReportEntry struct {
+	// Kind is error, warning or info.
+	Kind    string `json:"kind"`
+	Message string `json:"message"`
+	// Path is the location of the entry in the config, e.g. $.storage.files.0.
+	Path   string `json:"path,omitempty"`
+	Line   int    `json:"line,omitempty"`
+	Column int    `json:"column,omitempty"`
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		reply(w, http.StatusMethodNotAllowed, Response{Error: "only POST is supported"})
+		return
+	}
+	ctx := req.Context()
+
+	token, ok := strings.CutPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		reply(w, http.StatusUnauthorized, Response{Error: "a bearer token is required"})
+		return
+	}
+	review := &authenticationv1.TokenReview{Spec: authenticationv1.TokenReviewSpec{Token: token}}
+	if err := h.Client.Create(ctx, review); err != nil {
+		log.Error(err, "failed to review the token of a render request")
+		reply(w, http.StatusInternalServerError, Response{Error: "failed to authenticate the request"})
+		return
+	}
+	if !review.Status.Authenticated {
+		reply(w, http.StatusUnauthorized, Response{Error: "the bearer token is not valid"})
+		return
+	}
+	user := review.Status.User
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxBodySize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			reply(w, http.StatusRequestEntityTooLarge, Response{Error: fmt.Sprintf("the body exceeds %d bytes", tooLarge.Limit)})
+			return
+		}
+		reply(w, http.StatusBadRequest, Response{Error: fmt.Sprintf("failed to read the body: %v", err)})
+		return
+	}
+	bc := &butanev1beta1.ButaneConfig{}
+	if err := yaml.UnmarshalStrict(body, bc); err != nil {
+		reply(w, http.StatusBadRequest, Response{Error: fmt.Sprintf("failed to decode the ButaneConfig: %v", err)})
+		return
+	}
+	if gvk := bc.GroupVersionKind(); !gvk.Empty() && gvk != butanev1beta1.GroupVersion.WithKind("ButaneConfig") {
+		reply(w, http.StatusBadRequest, Response{Error: fmt.Sprintf("expected a %s ButaneConfig, got %s %s",
+			butanev1beta1.GroupVersion, gvk.GroupVersion(), gvk.Kind)})
+		return
+	}
+	if bc.Namespace == "" {
+		reply(w, http.StatusBadRequest, Response{Error: "metadata.namespace is required"})
+		return
+	}
+
+	extra := make(map[string]authorizationv1.ExtraValue, len(user.Extra))
+	for k, v := range user.Extra {
+		extra[k] = authorizationv1.ExtraValue(v)
+	}
+	access := &authorizationv1.SubjectAccessReview{Spec: authorizationv1.SubjectAccessReviewSpec{
+		ResourceAttributes: &authorizationv1.ResourceAttributes{
+			Namespace: bc.Namespace,
+			Verb:      "create",
+			Group:     butanev1beta1.GroupVersion.Group,
+			Version:   butanev1beta1.GroupVersion.Version,
+			Resource:  "butaneconfigs",
+			Name:      bc.Name,
+		},
+		User:   user.Username,
+		Groups: user.Groups,
+		UID:    user.UID,
+		Extra:  extra,
+	}}
+	if err := h.Client.Create(ctx, access); err != nil {
+		log.Error(err, "failed to review the access of a render request", "user", user.Username)
+		reply(w, http.StatusInternalServerError, Response{Error: "failed to authorize the request"})
+		return
+	}
+	if !access.Status.Allowed {
+		reply(w, http.StatusForbidden, Response{Error: fmt.Sprintf("%s cannot create ButaneConfigs in namespace %s",
+			user.Username, bc.Namespace)})
+		return
+	}
+
+	status, resp := h.render(ctx, bc)
+	reply(w, status, resp)
+}
+
+// render validates and translates bc, replying with the status code and body
+// of the result.
+func (h *Handler) render(ctx context.Context, bc *butanev1beta1.ButaneConfig) (int, Response) {
+	if bc.Spec.ButaneFrom != nil {
+		return http.StatusUnprocessableEntity, Response{Error: "spec.butaneFrom is resolved by the controller; send the Butane config inline"}
+	}
+	if err := (&butanev1beta1.ButaneConfigCustomDefaulter{}).Default(ctx, bc); err != nil {
+		return http.StatusUnprocessableEntity, Response{Error: err.Error()}
+	}
+	warnings, err := (&butanev1beta1.ButaneConfigCustomValidator{Config: h.Config}).ValidateCreate(ctx, bc)
+	if err != nil {
+		return http.StatusUnprocessableEntity, Response{Report: reportEntries(err), Warnings: warnings, Error: err.Error()}
+	}
+
+	opts := bc.Spec.Translation.RenderOptions()
+	ignition, rpt, err := render.Translate(bc.Spec.Source(), opts)
+	if err != nil {
+		return http.StatusUnprocessableEntity, Response{Report: reportEntries(err), Warnings: warnings, Error: err.Error()}
+	}
+	if version := bc.Spec.Output.IgnitionVersion; version != "" {
+		if ignition, err = render.ConvertVersion(ignition, version, opts); err != nil {
+			return http.StatusUnprocessableEntity, Response{Warnings: warnings, Error: err.Error()}
+		}
+	}
+
+	// Compress the inline contents and enforce the size limit as the
+	// controller does
+	if !opts.NoResourceAutoCompression {
+		if ignition, _, err = render.Compress(ignition, opts); err != nil {
+			return http.StatusUnprocessableEntity, Response{Warnings: warnings, Error: err.Error()}
+		}
+	}
+	if bc.Spec.Output.Size != nil && bc.Spec.Output.Size.Spill != nil {
+		warnings = append(warnings, "spec.output.size.spill is not applied to the preview")
+	} else if size, limit := int64(len(ignition)), h.sizeLimit(&bc.Spec.Output); size > limit {
+		return http.StatusUnprocessableEntity, Response{Warnings: warnings, Error: fmt.Sprintf(
+			"Ignition is %d bytes, over the limit of %d bytes; spill large files with spec.output.size.spill", size, limit)}
+	}
+
+	// These settings need objects only the controller reads
+	policies, err := h.injectionPolicies(ctx, bc)
+	if err != nil {
+		log.Error(err, "failed to list the injection policies of a render request")
+		return http.StatusInternalServerError, Response{Error: "failed to list the injection policies"}
+	}
+	for _, name := range policies {
+		warnings = append(warnings, fmt.Sprintf("ButaneInjectionPolicy %s is not applied to the preview", name))
+	}
+	if len(bc.Spec.MergeFrom) > 0 {
+		warnings = append(warnings, "spec.mergeFrom is not applied to the preview")
+	}
+	if len(bc.Spec.Users) > 0 {
+		warnings = append(warnings, "spec.users is not applied to the preview")
+	}
+	if bc.Spec.Images.Pin {
+		warnings = append(warnings, "spec.images.pin is not applied to the preview")
+	}
+	return http.StatusOK, Response{Ignition: ignition, Report: toEntries(rpt), Warnings: warnings}
+}
+
+// sizeLimit returns the size limit of the output, in bytes, taking the default
+// from the operator config.
+func (h *Handler) sizeLimit(output *butanev1beta1.OutputSpec) int64 {
+	if output.Size == nil || output.Size.Limit == nil {
+		if limit := h.Config.Get().Defaults.SizeLimit; limit != nil {
+			return limit.Value()
+		}
+	}
+	return output.SizeLimit()
+}
+
+// injectionPolicies returns the names of the ButaneInjectionPolicies selecting
+// bc, sorted.
+func (h *Handler) injectionPolicies(ctx context.Context, bc *butanev1beta1.ButaneConfig) ([]string, error) {
+	var list butanev1beta1.ButaneInjectionPolicyList
+	if err := h.Client.List(ctx, &list); err != nil {
+		return nil, err
+	}
+	if len(list.Items) == 0 {
+		return nil, nil
+	}
+	var ns corev1.Namespace
+	if err := h.Client.Get(ctx, client.ObjectKey{Name: bc.Namespace}, &ns); err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+
+	var names []string
+	for _, policy := range list.Items {
+		// Invalid selectors are reported by the controller
+		if ok, err := policy.Spec.Selects(ns.Labels, bc.Labels); err == nil && ok {
+			names = append(names, policy.Name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// reportEntries returns the entries of the translation report err wraps, if
+// any.
+func reportEntries(err error) []ReportEntry {
+	var reportErr *render.ReportError
+	if !errors.As(err, &reportErr) {
+		return nil
+	}
+	return toEntries(reportErr.Report)
+}
+
+func toEntries(rpt report.Report) []ReportEntry {
+	var entries []ReportEntry
+	for _, e := range rpt.Entries {
+		entry := ReportEntry{Kind: e.Kind.String(), Message: e.Message}
+		if e.Context.Len() != 0 {
+			entry.Path = e.Context.String()
+		}
+		if e.Marker.StartP != nil {
+			entry.Line = int(e.Marker.StartP.Line)
+			entry.Column = int(e.Marker.StartP.Column)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+func reply(w http.ResponseWriter, status int, resp Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Error(err, "failed to write the render response")
+	}
+}
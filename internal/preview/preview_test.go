@@ -0,0 +1,245 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package preview
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	authenticationv1 "k8s.io/api/authentication/v1"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+	"sigs.k8s.io/controller-runtime/pkg/client/interceptor"
+
+	butanev1beta1 "github.com/naval-group/butane-operator/api/v1beta1"
+)
+
+// newHandler returns a handler whose API server knows the token "alice",
+// allowed to create ButaneConfigs in namespace team-a only, and stores objs.
+func newHandler(objs ...client.Object) *Handler {
+	scheme := runtime.NewScheme()
+	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(butanev1beta1.AddToScheme(scheme))
+	c := fake.NewClientBuilder().WithScheme(scheme).WithObjects(objs...).WithInterceptorFuncs(interceptor.Funcs{
+		Create: func(_ context.Context, _ client.WithWatch, obj client.Object, _ ...client.CreateOption) error {
+			switch review := obj.(type) {
+			case *authenticationv1.TokenReview:
+				if review.Spec.Token == "alice" {
+					review.Status.Authenticated = true
+					review.Status.User = authenticationv1.UserInfo{Username: "alice", Groups: []string{"portal-users"}}
+				}
+			case *authorizationv1.SubjectAccessReview:
+				attrs := review.Spec.ResourceAttributes
+				review.Status.Allowed = review.Spec.User == "alice" && slices.Contains(review.Spec.Groups, "portal-users") &&
+					attrs.Namespace == "team-a" && attrs.Verb == "create" && attrs.Resource == "butaneconfigs" &&
+					attrs.Group == "butane.operators.naval-group.com"
+			}
+			return nil
+		},
+	}).Build()
+	return &Handler{Client: c}
+}
+
+func TestHandler(t *testing.T) {
+	const valid = `apiVersion: butane.operators.naval-group.com/v1beta1
+kind: ButaneConfig
+metadata:
+  name: web
+  namespace: team-a
+spec:
+  butane: |
+    variant: fcos
+    version: 1.5.0
+    storage:
+      files:
+        - path: /etc/motd
+          contents:
+            inline: hello
+`
+	tests := []struct {
+		name     string
+		method   string
+		token    string
+		body     string
+		status   int
+		ignition string
+		report   string
+		warning  string
+		error    string
+	}{
+		{
+			name:     "renders the config",
+			token:    "alice",
+			body:     valid,
+			status:   http.StatusOK,
+			ignition: `"path":"/etc/motd"`,
+		},
+		{
+			name:   "rejects other methods",
+			method: http.MethodGet,
+			token:  "alice",
+			status: http.StatusMethodNotAllowed,
+			error:  "only POST",
+		},
+		{
+			name:   "requires a token",
+			body:   valid,
+			status: http.StatusUnauthorized,
+			error:  "a bearer token is required",
+		},
+		{
+			name:   "rejects unknown tokens",
+			token:  "mallory",
+			body:   valid,
+			status: http.StatusUnauthorized,
+			error:  "not valid",
+		},
+		{
+			name:   "checks access to the namespace",
+			token:  "alice",
+			body:   strings.Replace(valid, "team-a", "team-b", 1),
+			status: http.StatusForbidden,
+			error:  "alice cannot create ButaneConfigs in namespace team-b",
+		},
+		{
+			name:   "requires a namespace",
+			token:  "alice",
+			body:   strings.Replace(valid, "  namespace: team-a\n", "", 1),
+			status: http.StatusBadRequest,
+			error:  "metadata.namespace is required",
+		},
+		{
+			name:   "rejects other kinds",
+			token:  "alice",
+			body:   strings.Replace(valid, "kind: ButaneConfig", "kind: ClusterButaneConfig", 1),
+			status: http.StatusBadRequest,
+			error:  "expected a butane.operators.naval-group.com/v1beta1 ButaneConfig",
+		},
+		{
+			name:   "reports translation errors",
+			token:  "alice",
+			body:   strings.Replace(valid, "inline: hello", "inline: hello\n            local: motd", 1),
+			status: http.StatusUnprocessableEntity,
+			report: "error",
+			error:  "failed to translate spec.butane",
+		},
+		{
+			name:     "notes what only the controller applies",
+			token:    "alice",
+			body:     valid + "  images:\n    pin: true\n",
+			status:   http.StatusOK,
+			ignition: `"version":"3.`,
+			warning:  "spec.images.pin is not applied to the preview",
+		},
+		{
+			name:     "compresses the data URLs written as is",
+			token:    "alice",
+			body:     strings.Replace(valid, "inline: hello", "source: data:,"+strings.Repeat("hello%20", 1000), 1),
+			status:   http.StatusOK,
+			ignition: `"compression":"gzip"`,
+		},
+		{
+			name:  "enforces the size limit",
+			token: "alice",
+			body: strings.Replace(valid, "inline: hello", "inline: "+strings.Repeat("hello ", 1000), 1) +
+				"  translation:\n    noResourceAutoCompression: true\n  output:\n    size:\n      limit: 1Ki\n",
+			status: http.StatusUnprocessableEntity,
+			error:  "over the limit of 1024 bytes",
+		},
+		{
+			name:     "notes that files are not spilled",
+			token:    "alice",
+			body:     valid + "  output:\n    size:\n      spill:\n        url: https://files.example.com/ignition\n",
+			status:   http.StatusOK,
+			ignition: `"path":"/etc/motd"`,
+			warning:  "spec.output.size.spill is not applied to the preview",
+		},
+		{
+			name:     "notes the injection policies selecting the config",
+			token:    "alice",
+			body:     valid,
+			status:   http.StatusOK,
+			ignition: `"path":"/etc/motd"`,
+			warning:  "ButaneInjectionPolicy hardening is not applied to the preview",
+		},
+	}
+	objs := []client.Object{
+		&corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: "team-a", Labels: map[string]string{"security-tier": "high"}}},
+		&butanev1beta1.ButaneInjectionPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "hardening"},
+			Spec: butanev1beta1.ButaneInjectionPolicySpec{
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"security-tier": "high"}},
+				MergeFrom:         []butanev1beta1.ClusterButaneConfigReference{{Name: "hardening"}},
+			},
+		},
+		&butanev1beta1.ButaneInjectionPolicy{
+			ObjectMeta: metav1.ObjectMeta{Name: "low-security"},
+			Spec: butanev1beta1.ButaneInjectionPolicySpec{
+				NamespaceSelector: &metav1.LabelSelector{MatchLabels: map[string]string{"security-tier": "low"}},
+				MergeFrom:         []butanev1beta1.ClusterButaneConfigReference{{Name: "relaxed"}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			method := tt.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			req := httptest.NewRequest(method, Path, strings.NewReader(tt.body))
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			newHandler(objs...).ServeHTTP(rec, req)
+
+			if rec.Code != tt.status {
+				t.Fatalf("got status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+			var resp Response
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(resp.Ignition), tt.ignition) || (tt.ignition == "") != (resp.Ignition == nil) {
+				t.Errorf("got Ignition %s, want it to contain %q", resp.Ignition, tt.ignition)
+			}
+			if tt.report != "" && (len(resp.Report) == 0 || resp.Report[0].Kind != tt.report || resp.Report[0].Path == "") {
+				t.Errorf("got report %+v, want a located %s: %s", resp.Report, tt.report, resp.Error)
+			}
+			if tt.warning != "" && !slices.Contains(resp.Warnings, tt.warning) {
+				t.Errorf("got warnings %q, want %q", resp.Warnings, tt.warning)
+			}
+			if slices.ContainsFunc(resp.Warnings, func(w string) bool { return strings.Contains(w, "low-security") }) {
+				t.Errorf("got warnings %q, want none about policies not selecting the config", resp.Warnings)
+			}
+			if !strings.Contains(resp.Error, tt.error) || (tt.error == "") != (resp.Error == "") {
+				t.Errorf("got error %q, want it to contain %q", resp.Error, tt.error)
+			}
+		})
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/vincent-petithory/dataurl"
+)
+
+// Compress gzips the inline contents of files that are stored uncompressed,
+// when that makes them smaller. Butane already does so for the contents it
+// encodes; this catches data URLs written as is in the config. It reports
+// whether anything changed.
+func Compress(ignition []byte, opts Options) ([]byte, bool, error) {
+	cfg, err := decodeIgnition(ignition)
+	if err != nil {
+		return nil, false, err
+	}
+	changed := false
+	for _, file := range ignitionFiles(cfg) {
+		for _, resource := range fileResources(file) {
+			ok, err := compressResource(resource)
+			if err != nil {
+				return nil, false, fmt.Errorf("file %s: %w", file["path"], err)
+			}
+			changed = changed || ok
+		}
+	}
+	if !changed {
+		return ignition, false, nil
+	}
+	out, err := encodeIgnition(cfg, opts)
+	return out, true, err
+}
+
+// LargeFiles returns the paths of the files whose inline contents, as stored
+// in the config, take more than threshold bytes.
+func LargeFiles(ignition []byte, threshold int64) ([]string, error) {
+	cfg, err := decodeIgnition(ignition)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	for _, file := range ignitionFiles(cfg) {
+		var size int64
+		for _, resource := range fileResources(file) {
+			source, _ := resource["source"].(string)
+			if !strings.HasPrefix(source, "data:") {
+				continue
+			}
+			decoded, err := dataurl.DecodeString(source)
+			if err != nil {
+				return nil, fmt.Errorf("file %s: invalid data URL: %w", file["path"], err)
+			}
+			size += int64(len(decoded.Data))
+		}
+		if size > threshold {
+			path, _ := file["path"].(string)
+			paths = append(paths, path)
+		}
+	}
+	return paths, nil
+}
+
+// compressResource gzips an uncompressed inline resource and reports whether
+// it did.
+func compressResource(resource map[string]interface{}) (bool, error) {
+	source, _ := resource["source"].(string)
+	if !strings.HasPrefix(source, "data:") {
+		return false, nil
+	}
+	if compression, _ := resource["compression"].(string); compression != "" {
+		return false, nil
+	}
+	decoded, err := dataurl.DecodeString(source)
+	if err != nil {
+		return false, fmt.Errorf("invalid data URL: %w", err)
+	}
+
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return false, err
+	}
+	if _, err := zw.Write(decoded.Data); err != nil {
+		return false, err
+	}
+	if err := zw.Close(); err != nil {
+		return false, err
+	}
+	compressed := "data:;base64," + base64.StdEncoding.EncodeToString(buf.Bytes())
+	if len(compressed) >= len(source) {
+		return false, nil
+	}
+	// Ignition verifies the decompressed contents, so a verification hash
+	// stays valid.
+	resource["source"] = compressed
+	resource["compression"] = "gzip"
+	return true, nil
+}
+
+func decodeIgnition(ignition []byte) (map[string]interface{}, error) {
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(ignition, &cfg); err != nil {
+		return nil, fmt.Errorf("invalid Ignition config: %w", err)
+	}
+	return cfg, nil
+}
+
+func encodeIgnition(cfg map[string]interface{}, opts Options) ([]byte, error) {
+	if opts.Pretty {
+		return json.MarshalIndent(cfg, "", "  ")
+	}
+	return json.Marshal(cfg)
+}
+
+// ignitionFiles returns the storage.files entries of an Ignition config.
+func ignitionFiles(cfg map[string]interface{}) []map[string]interface{} {
+	storage, _ := cfg["storage"].(map[string]interface{})
+	entries, _ := storage["files"].([]interface{})
+	files := make([]map[string]interface{}, 0, len(entries))
+	for _, e := range entries {
+		if file, ok := e.(map[string]interface{}); ok {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// fileResources returns the contents and append resources of a file.
+func fileResources(file map[string]interface{}) []map[string]interface{} {
+	var resources []map[string]interface{}
+	if contents, ok := file["contents"].(map[string]interface{}); ok {
+		resources = append(resources, contents)
+	}
+	appends, _ := file["append"].([]interface{})
+	for _, a := range appends {
+		if resource, ok := a.(map[string]interface{}); ok {
+			resources = append(resources, resource)
+		}
+	}
+	return resources
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"encoding/base64"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompress(t *testing.T) {
+	large := base64.StdEncoding.EncodeToString([]byte(strings.Repeat("compressible ", 1000)))
+	source := `variant: fcos
+version: 1.5.0
+storage:
+  files:
+    - path: /opt/large
+      contents:
+        source: data:;base64,` + large + `
+    - path: /etc/small
+      contents:
+        source: data:,hi
+`
+	ignition := translated(t, source)
+	out, changed, err := Compress(ignition, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed || len(out) >= len(ignition) {
+		t.Fatalf("Compress() should shrink the config: %d -> %d bytes", len(ignition), len(out))
+	}
+	if strings.Count(string(out), `"compression":"gzip"`) != 1 {
+		t.Errorf("only the large file should be compressed:\n%s", out)
+	}
+	if _, err := ConvertVersion(out, "3.4.0", Options{}); err != nil {
+		t.Errorf("compressed config should stay valid: %v", err)
+	}
+
+	again, changed, err := Compress(out, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed || string(again) != string(out) {
+		t.Error("compressed contents should not be compressed again")
+	}
+}
+
+func TestLargeFiles(t *testing.T) {
+	source := `variant: fcos
+version: 1.5.0
+storage:
+  files:
+    - path: /opt/large
+      contents:
+        inline: ` + strings.Repeat("x", 2048) + `
+    - path: /etc/small
+      contents:
+        inline: hi
+    - path: /etc/remote
+      contents:
+        source: https://example.com/remote
+`
+	ignition, _, err := Translate([]byte(source), Options{NoResourceAutoCompression: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	paths, err := LargeFiles(ignition, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(paths, []string{"/opt/large"}) {
+		t.Errorf("LargeFiles() = %v, want [/opt/large]", paths)
+	}
+}
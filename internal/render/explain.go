@@ -0,0 +1,290 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/coreos/butane/config/common"
+	fcos1_0 "github.com/coreos/butane/config/fcos/v1_0"
+	fcos1_1 "github.com/coreos/butane/config/fcos/v1_1"
+	fcos1_2 "github.com/coreos/butane/config/fcos/v1_2"
+	fcos1_3 "github.com/coreos/butane/config/fcos/v1_3"
+	fcos1_4 "github.com/coreos/butane/config/fcos/v1_4"
+	fcos1_5 "github.com/coreos/butane/config/fcos/v1_5"
+	fcos1_6 "github.com/coreos/butane/config/fcos/v1_6"
+	fcos1_7 "github.com/coreos/butane/config/fcos/v1_7"
+	fcos1_8_exp "github.com/coreos/butane/config/fcos/v1_8_exp"
+	fiot1_0 "github.com/coreos/butane/config/fiot/v1_0"
+	fiot1_1_exp "github.com/coreos/butane/config/fiot/v1_1_exp"
+	flatcar1_0 "github.com/coreos/butane/config/flatcar/v1_0"
+	flatcar1_1 "github.com/coreos/butane/config/flatcar/v1_1"
+	flatcar1_2_exp "github.com/coreos/butane/config/flatcar/v1_2_exp"
+	openshift4_10 "github.com/coreos/butane/config/openshift/v4_10"
+	openshift4_11 "github.com/coreos/butane/config/openshift/v4_11"
+	openshift4_12 "github.com/coreos/butane/config/openshift/v4_12"
+	openshift4_13 "github.com/coreos/butane/config/openshift/v4_13"
+	openshift4_14 "github.com/coreos/butane/config/openshift/v4_14"
+	openshift4_15 "github.com/coreos/butane/config/openshift/v4_15"
+	openshift4_16 "github.com/coreos/butane/config/openshift/v4_16"
+	openshift4_17 "github.com/coreos/butane/config/openshift/v4_17"
+	openshift4_18 "github.com/coreos/butane/config/openshift/v4_18"
+	openshift4_19 "github.com/coreos/butane/config/openshift/v4_19"
+	openshift4_20 "github.com/coreos/butane/config/openshift/v4_20"
+	openshift4_21 "github.com/coreos/butane/config/openshift/v4_21"
+	openshift4_22_exp "github.com/coreos/butane/config/openshift/v4_22_exp"
+	openshift4_8 "github.com/coreos/butane/config/openshift/v4_8"
+	openshift4_9 "github.com/coreos/butane/config/openshift/v4_9"
+	r4e1_0 "github.com/coreos/butane/config/r4e/v1_0"
+	r4e1_1 "github.com/coreos/butane/config/r4e/v1_1"
+	r4e1_2_exp "github.com/coreos/butane/config/r4e/v1_2_exp"
+	"github.com/coreos/butane/translate"
+	"github.com/coreos/vcontext/path"
+	"github.com/coreos/vcontext/tree"
+	vyaml "github.com/coreos/vcontext/yaml"
+	"gopkg.in/yaml.v3"
+)
+
+// specs maps "variant+version" to a constructor of the matching Butane schema,
+// mirroring the translator registry of github.com/coreos/butane/config.
+var specs = map[string]func() interface{}{
+	"fcos+1.0.0":                    func() interface{} { return &fcos1_0.Config{} },
+	"fcos+1.1.0":                    func() interface{} { return &fcos1_1.Config{} },
+	"fcos+1.2.0":                    func() interface{} { return &fcos1_2.Config{} },
+	"fcos+1.3.0":                    func() interface{} { return &fcos1_3.Config{} },
+	"fcos+1.4.0":                    func() interface{} { return &fcos1_4.Config{} },
+	"fcos+1.5.0":                    func() interface{} { return &fcos1_5.Config{} },
+	"fcos+1.6.0":                    func() interface{} { return &fcos1_6.Config{} },
+	"fcos+1.7.0":                    func() interface{} { return &fcos1_7.Config{} },
+	"fcos+1.8.0-experimental":       func() interface{} { return &fcos1_8_exp.Config{} },
+	"flatcar+1.0.0":                 func() interface{} { return &flatcar1_0.Config{} },
+	"flatcar+1.1.0":                 func() interface{} { return &flatcar1_1.Config{} },
+	"flatcar+1.2.0-experimental":    func() interface{} { return &flatcar1_2_exp.Config{} },
+	"openshift+4.8.0":               func() interface{} { return &openshift4_8.Config{} },
+	"openshift+4.9.0":               func() interface{} { return &openshift4_9.Config{} },
+	"openshift+4.10.0":              func() interface{} { return &openshift4_10.Config{} },
+	"openshift+4.11.0":              func() interface{} { return &openshift4_11.Config{} },
+	"openshift+4.12.0":              func() interface{} { return &openshift4_12.Config{} },
+	"openshift+4.13.0":              func() interface{} { return &openshift4_13.Config{} },
+	"openshift+4.14.0":              func() interface{} { return &openshift4_14.Config{} },
+	"openshift+4.15.0":              func() interface{} { return &openshift4_15.Config{} },
+	"openshift+4.16.0":              func() interface{} { return &openshift4_16.Config{} },
+	"openshift+4.17.0":              func() interface{} { return &openshift4_17.Config{} },
+	"openshift+4.18.0":              func() interface{} { return &openshift4_18.Config{} },
+	"openshift+4.19.0":              func() interface{} { return &openshift4_19.Config{} },
+	"openshift+4.20.0":              func() interface{} { return &openshift4_20.Config{} },
+	"openshift+4.21.0":              func() interface{} { return &openshift4_21.Config{} },
+	"openshift+4.22.0-experimental": func() interface{} { return &openshift4_22_exp.Config{} },
+	"r4e+1.0.0":                     func() interface{} { return &r4e1_0.Config{} },
+	"r4e+1.1.0":                     func() interface{} { return &r4e1_1.Config{} },
+	"r4e+1.2.0-experimental":        func() interface{} { return &r4e1_2_exp.Config{} },
+	"fiot+1.0.0":                    func() interface{} { return &fiot1_0.Config{} },
+	"fiot+1.1.0-experimental":       func() interface{} { return &fiot1_1_exp.Config{} },
+}
+
+var toIgnUnvalidated = regexp.MustCompile(`^ToIgn3_\d+Unvalidated$`)
+
+// Origin maps one Ignition entry back to the Butane source that produced it.
+type Origin struct {
+	// IgnitionPath is the location of the entry in the Ignition config, e.g. $.storage.files.0.
+	IgnitionPath string `json:"ignitionPath"`
+	// Kind is the kind of entry: file, directory, link, unit, dropin, user, group, ...
+	Kind string `json:"kind"`
+	// Name is the path, unit name or user name of the entry.
+	Name string `json:"name"`
+	// ButanePath is the location in the Butane source, e.g. $.storage.trees.0.
+	ButanePath string `json:"butanePath,omitempty"`
+	// Line and Column locate ButanePath in the source text, starting at 1.
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+}
+
+// entryKinds lists the Ignition arrays whose elements are reported by Explain.
+var entryKinds = []struct {
+	path []interface{}
+	kind string
+	name string
+}{
+	{[]interface{}{"storage", "disks"}, "disk", "device"},
+	{[]interface{}{"storage", "raid"}, "raid", "name"},
+	{[]interface{}{"storage", "luks"}, "luks", "name"},
+	{[]interface{}{"storage", "filesystems"}, "filesystem", "path"},
+	{[]interface{}{"storage", "directories"}, "directory", "path"},
+	{[]interface{}{"storage", "files"}, "file", "path"},
+	{[]interface{}{"storage", "links"}, "link", "path"},
+	{[]interface{}{"systemd", "units"}, "unit", "name"},
+	{[]interface{}{"passwd", "users"}, "user", "name"},
+	{[]interface{}{"passwd", "groups"}, "group", "name"},
+}
+
+// Explain translates a Butane config and reports, for every file, directory,
+// link, unit, dropin, user, group and storage device in the resulting Ignition
+// config, where in the Butane source it came from.
+func Explain(raw []byte) ([]Origin, error) {
+	variant, version, err := ParseVariant(raw)
+	if err != nil {
+		return nil, err
+	}
+	newSpec, ok := specs[variant+"+"+version]
+	if !ok {
+		return nil, fmt.Errorf("unsupported Butane variant %q version %q", variant, version)
+	}
+
+	spec := newSpec()
+	if err := yaml.NewDecoder(bytes.NewReader(raw)).Decode(spec); err != nil {
+		return nil, fmt.Errorf("parsing Butane config: %w", err)
+	}
+	source, err := vyaml.UnmarshalToContext(raw)
+	if err != nil {
+		return nil, fmt.Errorf("parsing Butane config: %w", err)
+	}
+
+	var method reflect.Value
+	specType := reflect.TypeOf(spec)
+	for i := 0; i < specType.NumMethod(); i++ {
+		if toIgnUnvalidated.MatchString(specType.Method(i).Name) {
+			method = reflect.ValueOf(spec).Method(i)
+			break
+		}
+	}
+	if !method.IsValid() {
+		return nil, fmt.Errorf("butane variant %q version %q has no Ignition translation", variant, version)
+	}
+	ret := method.Call([]reflect.Value{reflect.ValueOf(common.TranslateOptions{})})
+	translations := ret[1].Interface().(translate.TranslationSet)
+
+	// Work on the generic JSON form so every Ignition spec version is handled alike.
+	ignJSON, err := json.Marshal(ret[0].Interface())
+	if err != nil {
+		return nil, err
+	}
+	var ign map[string]interface{}
+	if err := json.Unmarshal(ignJSON, &ign); err != nil {
+		return nil, err
+	}
+
+	var origins []Origin
+	for _, ek := range entryKinds {
+		items, _ := lookup(ign, ek.path).([]interface{})
+		for i, item := range items {
+			entry, _ := item.(map[string]interface{})
+			p := path.New("json", append(append([]interface{}{}, ek.path...), i)...)
+			name, _ := entry[ek.name].(string)
+			origins = append(origins, origin(p, ek.kind, name, translations, source))
+
+			if ek.kind != "unit" {
+				continue
+			}
+			dropins, _ := entry["dropins"].([]interface{})
+			for j, d := range dropins {
+				dropin, _ := d.(map[string]interface{})
+				dname, _ := dropin["name"].(string)
+				origins = append(origins, origin(p.Append("dropins", j), "dropin", name+"/"+dname, translations, source))
+			}
+		}
+	}
+	return origins, nil
+}
+
+// ParseVariant returns the variant and version declared by a Butane config.
+func ParseVariant(raw []byte) (variant, version string, err error) {
+	var fields struct {
+		Variant string `yaml:"variant"`
+		Version string `yaml:"version"`
+	}
+	if err := yaml.Unmarshal(raw, &fields); err != nil {
+		return "", "", fmt.Errorf("parsing Butane config: %w", err)
+	}
+	if fields.Variant == "" {
+		return "", "", common.ErrNoVariant
+	}
+	return fields.Variant, fields.Version, nil
+}
+
+func origin(p path.ContextPath, kind, name string, ts translate.TranslationSet, source tree.Node) Origin {
+	o := Origin{IgnitionPath: p.String(), Kind: kind, Name: name}
+
+	from, ok := sourceOf(p, ts)
+	if !ok {
+		return o
+	}
+	o.ButanePath = from.String()
+	for n := from; ; n = n.Pop() {
+		node, err := source.Get(n)
+		if err == nil {
+			if m := node.GetMarker(); m.StartP != nil {
+				o.Line = int(m.StartP.Line)
+				o.Column = int(m.StartP.Column)
+			}
+			break
+		}
+		if n.Len() == 0 {
+			break
+		}
+	}
+	return o
+}
+
+// sourceOf returns the Butane path that produced the Ignition path p. When
+// there is no translation for p itself, the longest common prefix of the
+// sources of its fields is used.
+func sourceOf(p path.ContextPath, ts translate.TranslationSet) (path.ContextPath, bool) {
+	if t, ok := ts.Set[p.String()]; ok {
+		return t.From, true
+	}
+
+	prefix := p.String() + "."
+	keys := make([]string, 0)
+	for k := range ts.Set {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+	if len(keys) == 0 {
+		return path.ContextPath{}, false
+	}
+	sort.Strings(keys)
+
+	shared := ts.Set[keys[0]].From.Copy()
+	for _, k := range keys[1:] {
+		from := ts.Set[k].From
+		n := 0
+		for n < shared.Len() && n < from.Len() && shared.Path[n] == from.Path[n] {
+			n++
+		}
+		shared.Path = shared.Path[:n]
+	}
+	return shared, true
+}
+
+func lookup(m map[string]interface{}, p []interface{}) interface{} {
+	var cur interface{} = m
+	for _, part := range p {
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		cur = obj[part.(string)]
+	}
+	return cur
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/coreos/butane/config/common"
+)
+
+const explainSource = `variant: fcos
+version: 1.5.0
+storage:
+  files:
+    - path: /etc/motd
+      contents:
+        inline: hello
+  links:
+    - path: /etc/localtime
+      target: ../usr/share/zoneinfo/UTC
+systemd:
+  units:
+    - name: motd.service
+      enabled: true
+      dropins:
+        - name: 10-env.conf
+passwd:
+  users:
+    - name: core
+`
+
+func TestExplain(t *testing.T) {
+	origins, err := Explain([]byte(explainSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]Origin{
+		"$.storage.files.0": {Kind: "file", Name: "/etc/motd", ButanePath: "$.storage.files.0", Line: 5, Column: 7},
+		"$.storage.links.0": {Kind: "link", Name: "/etc/localtime", ButanePath: "$.storage.links.0", Line: 9, Column: 7},
+		"$.systemd.units.0": {Kind: "unit", Name: "motd.service", ButanePath: "$.systemd.units.0", Line: 13, Column: 7},
+		"$.systemd.units.0.dropins.0": {Kind: "dropin", Name: "motd.service/10-env.conf",
+			ButanePath: "$.systemd.units.0.dropins.0", Line: 16, Column: 11},
+		"$.passwd.users.0": {Kind: "user", Name: "core", ButanePath: "$.passwd.users.0", Line: 19, Column: 7},
+	}
+	for _, o := range origins {
+		w, ok := want[o.IgnitionPath]
+		if !ok {
+			continue
+		}
+		w.IgnitionPath = o.IgnitionPath
+		if o != w {
+			t.Errorf("origin of %s = %+v, want %+v", o.IgnitionPath, o, w)
+		}
+		delete(want, o.IgnitionPath)
+	}
+	for p := range want {
+		t.Errorf("no origin reported for %s", p)
+	}
+}
+
+func TestExplainErrors(t *testing.T) {
+	if _, err := Explain([]byte("version: 1.5.0\n")); !errors.Is(err, common.ErrNoVariant) {
+		t.Errorf("missing variant: err = %v", err)
+	}
+	if _, err := Explain([]byte("variant: fcos\nversion: 9.9.9\n")); err == nil {
+		t.Error("unknown version should fail")
+	}
+}
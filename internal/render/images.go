@@ -0,0 +1,284 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/vincent-petithory/dataurl"
+
+	"github.com/naval-group/butane-operator/internal/images"
+)
+
+var (
+	quadletImage  = regexp.MustCompile(`^(\s*Image\s*=\s*)(\S+)(.*)$`)
+	composeImage  = regexp.MustCompile(`^(\s*(?:-\s+)?image:\s*)(["']?)([^"'\s#]+)(["']?)(.*)$`)
+	composeFile   = regexp.MustCompile(`(^|[-.])compose(\.[^/]*)?\.ya?ml$`)
+	quadletSuffix = []string{".container", ".image", ".volume"}
+)
+
+// valuedFlags are the options of podman and docker run, create and pull that
+// take a value as their next argument, so that it is not taken for the image.
+var valuedFlags = map[string]bool{
+	"-a": true, "--attach": true, "--add-host": true, "--annotation": true, "--arch": true, "--authfile": true,
+	"--blkio-weight": true, "--cap-add": true, "--cap-drop": true, "--cgroup-parent": true, "--cgroupns": true,
+	"--cgroups": true, "--cidfile": true, "--conmon-pidfile": true, "-c": true, "--cpu-period": true,
+	"--cpu-quota": true, "--cpu-shares": true, "--cpus": true, "--cpuset-cpus": true, "--cpuset-mems": true,
+	"--creds": true, "--device": true, "--dns": true, "--dns-option": true, "--dns-search": true,
+	"--entrypoint": true, "-e": true, "--env": true, "--env-file": true, "--expose": true, "--gidmap": true,
+	"--group-add": true, "--health-cmd": true, "--health-interval": true, "--health-retries": true,
+	"--health-start-period": true, "--health-timeout": true, "-h": true, "--hostname": true, "--init-path": true,
+	"--ip": true, "--ip6": true, "--ipc": true, "-l": true, "--label": true, "--label-file": true,
+	"--log-driver": true, "--log-opt": true, "--mac-address": true, "-m": true, "--memory": true,
+	"--memory-reservation": true, "--memory-swap": true, "--mount": true, "--name": true, "--net": true,
+	"--network": true, "--network-alias": true, "--os": true, "-p": true, "--pid": true, "--pidfile": true,
+	"--platform": true, "--pod": true, "--publish": true, "--pull": true, "--restart": true, "--retry": true,
+	"--retry-delay": true, "--sdnotify": true, "--secret": true, "--security-opt": true, "--shm-size": true,
+	"--stop-signal": true, "--stop-timeout": true, "--sysctl": true, "--timeout": true, "--tmpfs": true,
+	"-u": true, "--uidmap": true, "--ulimit": true, "--umask": true, "--user": true, "--userns": true,
+	"--uts": true, "-v": true, "--variant": true, "--volume": true, "--volumes-from": true, "-w": true,
+	"--workdir": true,
+}
+
+// ImageReference is a container image reference found in an Ignition config.
+type ImageReference struct {
+	// Image is the reference as written, e.g. nginx:alpine.
+	Image string
+	// Location is where it was found, e.g. unit app.service.
+	Location string
+}
+
+// FindImages returns the container image references of an Ignition config
+// that are not pinned to a digest: the images run or pulled by podman and
+// docker in the commands of systemd units and their drop-ins, and the images
+// of Podman quadlet files and compose files. References holding variables or
+// systemd specifiers are left out, as are files with a verification hash,
+// whose contents cannot change.
+func FindImages(ignition []byte) ([]ImageReference, error) {
+	var refs []ImageReference
+	_, _, err := rewriteImages(ignition, Options{}, func(location, image string) string {
+		refs = append(refs, ImageReference{Image: image, Location: location})
+		return image
+	})
+	return refs, err
+}
+
+// PinImages rewrites the references FindImages returns to the digests of
+// digests, keyed by reference, keeping their tag, e.g. nginx:alpine to
+// nginx:alpine@sha256:... References without a digest are left as is.
+func PinImages(ignition []byte, digests map[string]string, opts Options) ([]byte, error) {
+	out, changed, err := rewriteImages(ignition, opts, func(_, image string) string {
+		if digest, ok := digests[image]; ok {
+			return image + "@" + digest
+		}
+		return image
+	})
+	if err != nil || !changed {
+		return ignition, err
+	}
+	return out, nil
+}
+
+// rewriteImages calls rewrite for every unpinned image reference and replaces
+// the reference with its result. It reports whether anything changed.
+func rewriteImages(ignition []byte, opts Options, rewrite func(location, image string) string) ([]byte, bool, error) {
+	cfg, err := decodeIgnition(ignition)
+	if err != nil {
+		return nil, false, err
+	}
+	changed := false
+
+	systemd, _ := cfg["systemd"].(map[string]interface{})
+	units, _ := systemd["units"].([]interface{})
+	for _, u := range units {
+		unit, _ := u.(map[string]interface{})
+		name, _ := unit["name"].(string)
+		if contents, ok := unit["contents"].(string); ok {
+			if text, ok := rewriteLines(contents, "unit "+name, execImage, rewrite); ok {
+				unit["contents"], changed = text, true
+			}
+		}
+		dropins, _ := unit["dropins"].([]interface{})
+		for _, d := range dropins {
+			dropin, _ := d.(map[string]interface{})
+			dropinName, _ := dropin["name"].(string)
+			if contents, ok := dropin["contents"].(string); ok {
+				if text, ok := rewriteLines(contents, "unit "+name+" drop-in "+dropinName, execImage, rewrite); ok {
+					dropin["contents"], changed = text, true
+				}
+			}
+		}
+	}
+
+	for _, file := range ignitionFiles(cfg) {
+		filePath, _ := file["path"].(string)
+		find := fileImageFinder(filePath)
+		contents, _ := file["contents"].(map[string]interface{})
+		if find == nil || contents == nil {
+			continue
+		}
+		if verification, _ := contents["verification"].(map[string]interface{}); verification["hash"] != nil {
+			continue
+		}
+		source, _ := contents["source"].(string)
+		if !strings.HasPrefix(source, "data:") {
+			continue
+		}
+		data, err := decodeResource(contents)
+		if err != nil {
+			return nil, false, fmt.Errorf("file %s: %w", filePath, err)
+		}
+		if text, ok := rewriteLines(string(data), "file "+filePath, find, rewrite); ok {
+			contents["source"] = "data:;base64," + base64.StdEncoding.EncodeToString([]byte(text))
+			delete(contents, "compression")
+			changed = true
+		}
+	}
+
+	if !changed {
+		return ignition, false, nil
+	}
+	out, err := encodeIgnition(cfg, opts)
+	return out, true, err
+}
+
+// imageFinder returns the byte offsets of the image reference of a line, or
+// nil when the line has none.
+type imageFinder func(line string) []int
+
+// fileImageFinder returns the finder of the files whose images are pinned, by
+// path, or nil for other files.
+func fileImageFinder(filePath string) imageFinder {
+	base := path.Base(filePath)
+	for _, suffix := range quadletSuffix {
+		if strings.HasSuffix(base, suffix) {
+			return func(line string) []int {
+				if m := quadletImage.FindStringSubmatchIndex(line); m != nil {
+					return m[4:6]
+				}
+				return nil
+			}
+		}
+	}
+	if composeFile.MatchString(base) {
+		return func(line string) []int {
+			if m := composeImage.FindStringSubmatchIndex(line); m != nil {
+				return m[6:8]
+			}
+			return nil
+		}
+	}
+	return nil
+}
+
+var execLine = regexp.MustCompile(`^\s*Exec[A-Za-z]*\s*=`)
+var word = regexp.MustCompile(`\S+`)
+
+// execImage finds the image of a podman or docker run, create or pull command
+// in a unit Exec line: the first argument of the subcommand that is not an
+// option or the value of one.
+func execImage(line string) []int {
+	if !execLine.MatchString(line) {
+		return nil
+	}
+	words := word.FindAllStringIndex(line, -1)
+	i := 0
+	for ; i < len(words); i++ {
+		w := line[words[i][0]:words[i][1]]
+		if _, cmd, ok := strings.Cut(w, "="); ok && execLine.MatchString(w) {
+			w = cmd
+		}
+		bin := path.Base(strings.TrimLeft(w, "-@+!:|"))
+		if bin == "podman" || bin == "docker" {
+			break
+		}
+	}
+	i++
+	// Global options of podman and docker come before the subcommand.
+	for ; i < len(words) && strings.HasPrefix(line[words[i][0]:words[i][1]], "-"); i++ {
+	}
+	if i < len(words) && line[words[i][0]:words[i][1]] == "container" {
+		i++
+	}
+	if i >= len(words) {
+		return nil
+	}
+	switch line[words[i][0]:words[i][1]] {
+	case "run", "create", "pull":
+	default:
+		return nil
+	}
+	for i++; i < len(words); i++ {
+		w := line[words[i][0]:words[i][1]]
+		if !strings.HasPrefix(w, "-") {
+			return words[i]
+		}
+		if !strings.Contains(w, "=") && valuedFlags[w] {
+			i++
+		}
+	}
+	return nil
+}
+
+// rewriteLines rewrites the image references find locates in text, and
+// reports whether any changed.
+func rewriteLines(text, location string, find imageFinder, rewrite func(location, image string) string) (string, bool) {
+	lines := strings.Split(text, "\n")
+	changed := false
+	for n, line := range lines {
+		loc := find(line)
+		if loc == nil {
+			continue
+		}
+		image := line[loc[0]:loc[1]]
+		if strings.ContainsAny(image, "$%{") {
+			continue
+		}
+		if ref, err := images.ParseReference(image); err != nil || ref.Digest != "" {
+			continue
+		}
+		if pinned := rewrite(location, image); pinned != image {
+			lines[n] = line[:loc[0]] + pinned + line[loc[1]:]
+			changed = true
+		}
+	}
+	return strings.Join(lines, "\n"), changed
+}
+
+// decodeResource returns the contents of an inline resource, decompressed.
+func decodeResource(resource map[string]interface{}) ([]byte, error) {
+	source, _ := resource["source"].(string)
+	decoded, err := dataurl.DecodeString(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid data URL: %w", err)
+	}
+	if compression, _ := resource["compression"].(string); compression == "gzip" {
+		zr, err := gzip.NewReader(bytes.NewReader(decoded.Data))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(zr)
+	}
+	return decoded.Data, nil
+}
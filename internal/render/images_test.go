@@ -0,0 +1,138 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/vincent-petithory/dataurl"
+)
+
+const imagesSource = `variant: fcos
+version: 1.5.0
+systemd:
+  units:
+    - name: web.service
+      contents: |
+        [Service]
+        ExecStartPre=-/usr/bin/podman pull quay.io/team/web:v1
+        ExecStart=/usr/bin/podman run --rm --name web -p 8080:80 -v /srv:/srv:z --env=A=B nginx:alpine nginx -g 'daemon off;'
+        ExecStop=/usr/bin/podman stop web
+    - name: pinned.service
+      contents: |
+        [Service]
+        ExecStart=/usr/bin/docker run --rm quay.io/team/app@sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef
+      dropins:
+        - name: image.conf
+          contents: |
+            [Service]
+            ExecStart=
+            ExecStart=/usr/bin/docker --log-level warn container run -d ${IMAGE}
+storage:
+  files:
+    - path: /etc/containers/systemd/db.container
+      contents:
+        inline: |
+          [Container]
+          Image=docker.io/library/postgres:16
+    - path: /opt/app/docker-compose.yml
+      contents:
+        inline: |
+          services:
+            cache:
+              image: "redis:7" # cache
+            proxy:
+              image: traefik
+    - path: /opt/app/notes.yml
+      contents:
+        inline: |
+          image: ignored:1
+`
+
+func TestFindImages(t *testing.T) {
+	refs, err := FindImages(translated(t, imagesSource))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, ref := range refs {
+		got = append(got, ref.Location+": "+ref.Image)
+	}
+	want := []string{
+		"unit web.service: quay.io/team/web:v1",
+		"unit web.service: nginx:alpine",
+		"file /etc/containers/systemd/db.container: docker.io/library/postgres:16",
+		"file /opt/app/docker-compose.yml: redis:7",
+		"file /opt/app/docker-compose.yml: traefik",
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("FindImages() = %q, want %q", got, want)
+	}
+}
+
+func TestPinImages(t *testing.T) {
+	const digest = "sha256:fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+	ignition := translated(t, imagesSource)
+	out, err := PinImages(ignition, map[string]string{"nginx:alpine": digest, "redis:7": digest}, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var cfg struct {
+		Systemd struct {
+			Units []struct {
+				Contents string `json:"contents"`
+			} `json:"units"`
+		} `json:"systemd"`
+		Storage struct {
+			Files []struct {
+				Path     string `json:"path"`
+				Contents struct {
+					Compression *string `json:"compression"`
+					Source      string  `json:"source"`
+				} `json:"contents"`
+			} `json:"files"`
+		} `json:"storage"`
+	}
+	if err := json.Unmarshal(out, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if unit := cfg.Systemd.Units[0].Contents; !strings.Contains(unit, "--env=A=B nginx:alpine@"+digest+" nginx -g") ||
+		!strings.Contains(unit, "pull quay.io/team/web:v1\n") {
+		t.Errorf("only nginx:alpine should be pinned in the unit:\n%s", unit)
+	}
+	compose := cfg.Storage.Files[1].Contents
+	if compose.Compression != nil && *compose.Compression != "" {
+		t.Errorf("the rewritten compose file should not be compressed, got %q", *compose.Compression)
+	}
+	decoded, err := dataurl.DecodeString(compose.Source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if text := string(decoded.Data); !strings.Contains(text, `image: "redis:7@`+digest+`" # cache`) ||
+		!strings.Contains(text, "image: traefik\n") {
+		t.Errorf("only redis:7 should be pinned in the compose file:\n%s", text)
+	}
+
+	// Pinning nothing leaves the config untouched.
+	if same, err := PinImages(ignition, nil, Options{}); err != nil || string(same) != string(ignition) {
+		t.Errorf("PinImages() without digests = %v, want the config unchanged", err)
+	}
+}
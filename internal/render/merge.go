@@ -0,0 +1,87 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/coreos/ignition/v2/config/merge"
+)
+
+// Merge merges the child Ignition config over the parent one, the way Ignition
+// merges the configs listed in ignition.config.merge: lists are combined, and
+// entries with the same key, e.g. files with the same path, as well as single
+// values are taken from the child. Both configs are converted to the newer of
+// their specification versions first.
+func Merge(parent, child []byte, opts Options) ([]byte, error) {
+	version, err := newerVersion(parent, child)
+	if err != nil {
+		return nil, err
+	}
+	spec, ok := ignitionSpecs[version]
+	if !ok {
+		return nil, fmt.Errorf("unsupported Ignition version %q", version)
+	}
+
+	var configs [2]interface{}
+	for i, ignition := range [][]byte{parent, child} {
+		converted, err := ConvertVersion(ignition, version, Options{})
+		if err != nil {
+			return nil, err
+		}
+		cfg, rpt, err := spec.parse(converted)
+		if err != nil {
+			if len(rpt.Entries) > 0 {
+				return nil, &ReportError{Report: rpt}
+			}
+			return nil, fmt.Errorf("failed to read the Ignition config: %w", err)
+		}
+		configs[i] = cfg
+	}
+
+	merged, _ := merge.MergeStructTranscribe(configs[0], configs[1])
+	if opts.Pretty {
+		return json.MarshalIndent(merged, "", "  ")
+	}
+	return json.Marshal(merged)
+}
+
+// newerVersion returns the newer specification version of two Ignition configs.
+func newerVersion(a, b []byte) (string, error) {
+	va, err := IgnitionVersion(a)
+	if err != nil {
+		return "", err
+	}
+	vb, err := IgnitionVersion(b)
+	if err != nil {
+		return "", err
+	}
+	sa, err := semver.NewVersion(va)
+	if err != nil {
+		return "", fmt.Errorf("invalid Ignition version %q: %w", va, err)
+	}
+	sb, err := semver.NewVersion(vb)
+	if err != nil {
+		return "", fmt.Errorf("invalid Ignition version %q: %w", vb, err)
+	}
+	if sa.LessThan(*sb) {
+		return vb, nil
+	}
+	return va, nil
+}
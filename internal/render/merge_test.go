@@ -0,0 +1,65 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	// The parent is an older specification, with a file the child overrides
+	parent := translated(t, `variant: fcos
+version: 1.3.0
+storage:
+  files:
+    - path: /etc/motd
+      contents:
+        inline: baseline
+    - path: /etc/chrony.conf
+      contents:
+        inline: server ntp.example.com
+`)
+	child := translated(t, motdSource)
+
+	out, err := Merge(parent, child, Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := IgnitionVersion(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := IgnitionVersion(child); version != want {
+		t.Errorf("IgnitionVersion() = %q, want the newer %q", version, want)
+	}
+	got := string(out)
+	for _, want := range []string{`"path":"/etc/chrony.conf"`, `"source":"data:,hello"`} {
+		if !strings.Contains(got, want) {
+			t.Errorf("merged config should contain %s:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "baseline") || strings.Count(got, `"path":"/etc/motd"`) != 1 {
+		t.Errorf("the child should override /etc/motd:\n%s", got)
+	}
+}
+
+func TestMergeInvalid(t *testing.T) {
+	if _, err := Merge([]byte("not json"), translated(t, motdSource), Options{}); err == nil {
+		t.Fatal("Merge() should reject an invalid parent")
+	}
+}
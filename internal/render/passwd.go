@@ -0,0 +1,84 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/GehirnInc/crypt/sha512_crypt"
+)
+
+// desHash matches a traditional DES crypt(3) hash, the only format that does
+// not start with $.
+var desHash = regexp.MustCompile(`^[./0-9A-Za-z]{13}$`)
+
+// cryptAlphabet is the base64 alphabet of crypt(3) salts.
+const cryptAlphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// CheckPasswordHashes returns an error when the password hash of a user of an
+// Ignition config is not a crypt(3) hash, which means a plaintext password was
+// pasted into password_hash. Empty hashes and hashes locked with ! or * are
+// accepted.
+func CheckPasswordHashes(ignition []byte) error {
+	var cfg struct {
+		Passwd struct {
+			Users []struct {
+				Name         string  `json:"name"`
+				PasswordHash *string `json:"passwordHash"`
+			} `json:"users"`
+		} `json:"passwd"`
+	}
+	if err := json.Unmarshal(ignition, &cfg); err != nil {
+		return fmt.Errorf("failed to read the Ignition config: %w", err)
+	}
+	var plaintext []string
+	for _, user := range cfg.Passwd.Users {
+		if user.PasswordHash != nil && !isCryptHash(*user.PasswordHash) {
+			plaintext = append(plaintext, user.Name)
+		}
+	}
+	if len(plaintext) > 0 {
+		return fmt.Errorf("password_hash of user %s is not a crypt(3) hash; set the plaintext password in a Secret selected by spec.users[].passwordFrom instead",
+			strings.Join(plaintext, ", "))
+	}
+	return nil
+}
+
+func isCryptHash(hash string) bool {
+	hash = strings.TrimLeft(hash, "!*")
+	return hash == "" || strings.HasPrefix(hash, "$") || desHash.MatchString(hash)
+}
+
+// HashPassword returns the SHA-512 crypt hash of a password. The salt is
+// derived from the password and seed, e.g. the UID of the Secret holding it,
+// so that the hash, and the Ignition config holding it, only change when the
+// password does.
+func HashPassword(password, seed string) (string, error) {
+	mac := hmac.New(sha256.New, []byte(seed))
+	mac.Write([]byte(password))
+	sum := mac.Sum(nil)
+	salt := make([]byte, 16)
+	for i := range salt {
+		salt[i] = cryptAlphabet[int(sum[i])%len(cryptAlphabet)]
+	}
+	return sha512_crypt.New().Generate([]byte(password), []byte("$6$"+string(salt)))
+}
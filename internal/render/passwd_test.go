@@ -0,0 +1,70 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GehirnInc/crypt/sha512_crypt"
+)
+
+func TestCheckPasswordHashes(t *testing.T) {
+	for _, hash := range []string{
+		"$6$5AdGXGE2wxGpGGYL$JCQYgYnMFszztKsX5/EnWJSSePOOjAIavYQIa42Njg8s5F8iWHs7p1xAAunyoqoQtGxkYBwrbeZQ6EJcB411t.",
+		"$y$j9T$F5Jx5fExrKuPp53xLKQ..1$X3DX6M94c7o.9agCG9G317fhZg9SqC.5i5rd.RhAtQ7",
+		"abJnggxhB/yWI",
+		"!",
+		"*",
+		"",
+	} {
+		ignition := translated(t, "variant: fcos\nversion: 1.5.0\npasswd:\n  users:\n    - name: core\n      password_hash: '"+hash+"'\n")
+		if err := CheckPasswordHashes(ignition); err != nil {
+			t.Errorf("CheckPasswordHashes(%q) = %v, want nil", hash, err)
+		}
+	}
+
+	ignition := translated(t, "variant: fcos\nversion: 1.5.0\npasswd:\n  users:\n    - name: core\n    - name: admin\n      password_hash: hunter2\n")
+	err := CheckPasswordHashes(ignition)
+	if err == nil || !strings.Contains(err.Error(), "password_hash of user admin is not a crypt(3) hash") {
+		t.Errorf("CheckPasswordHashes() = %v, want the plaintext password of admin reported", err)
+	}
+}
+
+func TestHashPassword(t *testing.T) {
+	hash, err := HashPassword("hunter2", "uid")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(hash, "$6$") {
+		t.Errorf("HashPassword() = %q, want a SHA-512 crypt hash", hash)
+	}
+	if err := sha512_crypt.New().Verify(hash, []byte("hunter2")); err != nil {
+		t.Errorf("the hash should verify the password: %v", err)
+	}
+	if strings.Contains(hash, "hunter2") {
+		t.Error("the hash should not contain the password")
+	}
+
+	// The hash is stable for a password and seed, so the output only changes
+	// when the password does.
+	again, _ := HashPassword("hunter2", "uid")
+	other, _ := HashPassword("hunter2", "other-uid")
+	if again != hash || other == hash {
+		t.Errorf("HashPassword() should depend on the password and seed only, got %q, %q and %q", hash, again, other)
+	}
+}
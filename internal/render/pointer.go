@@ -0,0 +1,59 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"bytes"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// PointerConfig returns an Ignition config of the given specification version
+// that replaces itself with the config served at source, verified to be
+// content, so that hosts can be given a small config fetching the real one.
+func PointerConfig(version, source string, content []byte) ([]byte, error) {
+	spec, ok := ignitionSpecs[version]
+	if !ok {
+		return nil, fmt.Errorf("unsupported Ignition version %q", version)
+	}
+	digest := sha512.Sum512(content)
+	// Keep the query of pre-signed URLs readable
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	err := enc.Encode(map[string]interface{}{
+		"ignition": map[string]interface{}{
+			"version": version,
+			"config": map[string]interface{}{
+				"replace": map[string]interface{}{
+					"source":       source,
+					"verification": map[string]interface{}{"hash": "sha512-" + hex.EncodeToString(digest[:])},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	pointer := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	if _, rpt, err := spec.parse(pointer); err != nil {
+		return nil, fmt.Errorf("invalid pointer config: %w: %s", err, rpt)
+	}
+	return pointer, nil
+}
@@ -0,0 +1,48 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPointerConfig(t *testing.T) {
+	ignition := translated(t, motdSource)
+	const source = "https://s3.example.com/ignition/web.ign?X-Amz-Signature=abc&X-Amz-Expires=3600"
+	for _, version := range IgnitionVersions() {
+		t.Run(version, func(t *testing.T) {
+			pointer, err := PointerConfig(version, source, ignition)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := IgnitionVersion(pointer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != version {
+				t.Errorf("IgnitionVersion() = %q, want %q", got, version)
+			}
+			if !strings.Contains(string(pointer), `"hash":"sha512-`) || !strings.Contains(string(pointer), `X-Amz-Signature=abc&`) {
+				t.Errorf("pointer config lacks the source or its hash:\n%s", pointer)
+			}
+		})
+	}
+	if _, err := PointerConfig("3.7.0-experimental", source, ignition); err == nil {
+		t.Error("expected an unsupported version to be rejected")
+	}
+}
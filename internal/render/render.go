@@ -0,0 +1,145 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package render holds the Butane to Ignition translation shared by the
+// controller, the admission webhook and the offline CLI, so that all of them
+// accept and reject exactly the same configs.
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/coreos/butane/config"
+	"github.com/coreos/butane/config/common"
+	"github.com/coreos/vcontext/report"
+	"sigs.k8s.io/yaml"
+)
+
+// ReportError is returned by Translate when Butane reported an error, or any
+// entry unless warnings are allowed. By default the operator treats warnings as
+// failures so that a config never silently loses content on its way to Ignition.
+type ReportError struct {
+	Report report.Report
+}
+
+func (e *ReportError) Error() string {
+	return strings.TrimSpace(e.Report.String())
+}
+
+// Options tunes a translation. The zero value is what the operator does by
+// default.
+type Options struct {
+	// AllowWarnings only fails the translation on errors; warnings are
+	// returned in the report.
+	AllowWarnings bool
+	// Pretty indents the generated Ignition JSON.
+	Pretty bool
+	// NoResourceAutoCompression stops Butane from compressing inline contents.
+	NoResourceAutoCompression bool
+	// FilesDir is the directory the local contents and trees of the config
+	// are read from, as with butane --files-dir. Empty rejects them, as in
+	// the cluster.
+	FilesDir string
+}
+
+const (
+	// VariantFlatcar is the Butane variant of Flatcar Container Linux.
+	VariantFlatcar = "flatcar"
+	// VariantOpenShift is the Butane variant of OpenShift nodes. Its configs
+	// translate to a MachineConfig wrapping the Ignition config.
+	VariantOpenShift = "openshift"
+)
+
+// Header is the part of a Butane config that selects its specification.
+type Header struct {
+	Variant string `json:"variant"`
+	Version string `json:"version"`
+}
+
+// ReadHeader returns the variant and version of a Butane config in YAML or JSON.
+func ReadHeader(raw []byte) (Header, error) {
+	var h Header
+	if err := yaml.Unmarshal(raw, &h); err != nil {
+		return Header{}, fmt.Errorf("failed to read the Butane variant and version: %w", err)
+	}
+	return h, nil
+}
+
+// Translate converts a Butane config to Ignition. The returned report is
+// always populated when Butane produced one, even if an error is returned.
+// Configs of every variant translate to a bare Ignition config; see
+// MachineConfig for the OpenShift wrapper.
+func Translate(raw []byte, opts Options) ([]byte, report.Report, error) {
+	return translateBytes(raw, opts, true)
+}
+
+// MachineConfig converts a Butane config of the openshift variant to a
+// MachineConfig manifest in YAML, as applied to an OpenShift cluster.
+func MachineConfig(raw []byte, opts Options) ([]byte, report.Report, error) {
+	return translateBytes(raw, opts, false)
+}
+
+// EmbedIgnition replaces the Ignition config wrapped by a MachineConfig
+// manifest, e.g. with one converted to another specification version.
+func EmbedIgnition(machineConfig, ignition []byte) ([]byte, error) {
+	var mc map[string]interface{}
+	if err := yaml.Unmarshal(machineConfig, &mc); err != nil {
+		return nil, fmt.Errorf("failed to read the MachineConfig: %w", err)
+	}
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(ignition, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to read the Ignition config: %w", err)
+	}
+	spec, _ := mc["spec"].(map[string]interface{})
+	if spec == nil {
+		return nil, fmt.Errorf("the MachineConfig has no spec")
+	}
+	spec["config"] = cfg
+	return yaml.Marshal(mc)
+}
+
+// IgnitionVersion returns the specification version of an Ignition config.
+func IgnitionVersion(ignition []byte) (string, error) {
+	var cfg struct {
+		Ignition struct {
+			Version string `json:"version"`
+		} `json:"ignition"`
+	}
+	if err := json.Unmarshal(ignition, &cfg); err != nil {
+		return "", fmt.Errorf("failed to read the Ignition version: %w", err)
+	}
+	return cfg.Ignition.Version, nil
+}
+
+func translateBytes(raw []byte, opts Options, bare bool) ([]byte, report.Report, error) {
+	ignition, rpt, err := config.TranslateBytes(raw, common.TranslateBytesOptions{
+		TranslateOptions: common.TranslateOptions{
+			NoResourceAutoCompression: opts.NoResourceAutoCompression,
+			FilesDir:                  opts.FilesDir,
+		},
+		Pretty: opts.Pretty,
+		Raw:    bare,
+	})
+	if rpt.IsFatal() || (!opts.AllowWarnings && len(rpt.Entries) > 0) {
+		return nil, rpt, &ReportError{Report: rpt}
+	}
+	if err != nil {
+		return nil, rpt, err
+	}
+	return ignition, rpt, nil
+}
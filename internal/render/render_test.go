@@ -0,0 +1,118 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"strings"
+	"testing"
+)
+
+const openshiftSource = `variant: openshift
+version: 4.21.0
+metadata:
+  name: 99-worker-motd
+  labels:
+    machineconfiguration.openshift.io/role: worker
+storage:
+  files:
+    - path: /etc/motd
+      contents:
+        inline: hello
+`
+
+func TestTranslateVariants(t *testing.T) {
+	tests := []struct {
+		source  string
+		header  Header
+		version string
+	}{
+		{"variant: fcos\nversion: 1.5.0\n", Header{"fcos", "1.5.0"}, "3.4.0"},
+		{"variant: fiot\nversion: 1.0.0\n", Header{"fiot", "1.0.0"}, "3.4.0"},
+		{"variant: flatcar\nversion: 1.1.0\n", Header{"flatcar", "1.1.0"}, "3.4.0"},
+		{"variant: r4e\nversion: 1.1.0\n", Header{"r4e", "1.1.0"}, "3.4.0"},
+		{openshiftSource, Header{"openshift", "4.21.0"}, "3.5.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.header.Variant, func(t *testing.T) {
+			header, err := ReadHeader([]byte(tt.source))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if header != tt.header {
+				t.Errorf("ReadHeader() = %+v, want %+v", header, tt.header)
+			}
+
+			ignition, _, err := Translate([]byte(tt.source), Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			version, err := IgnitionVersion(ignition)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if version != tt.version {
+				t.Errorf("IgnitionVersion() = %q, want %q", version, tt.version)
+			}
+		})
+	}
+}
+
+func TestMachineConfig(t *testing.T) {
+	mc, _, err := MachineConfig([]byte(openshiftSource), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"kind: MachineConfig", "name: 99-worker-motd", "machineconfiguration.openshift.io/role: worker"} {
+		if !strings.Contains(string(mc), want) {
+			t.Errorf("MachineConfig() does not contain %q:\n%s", want, mc)
+		}
+	}
+}
+
+func TestEmbedIgnition(t *testing.T) {
+	mc, _, err := MachineConfig([]byte(openshiftSource), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ignition, _, err := Translate([]byte(openshiftSource), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	converted, err := ConvertVersion(ignition, "3.2.0", Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := EmbedIgnition(mc, converted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"kind: MachineConfig", "version: 3.2.0", "path: /etc/motd"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("EmbedIgnition() does not contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestReadHeaderJSON(t *testing.T) {
+	header, err := ReadHeader([]byte(`{"variant":"flatcar","version":"1.0.0","storage":{}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header != (Header{Variant: "flatcar", Version: "1.0.0"}) {
+		t.Errorf("ReadHeader() = %+v", header)
+	}
+}
@@ -0,0 +1,150 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/coreos/go-semver/semver"
+	v3_0 "github.com/coreos/ignition/v2/config/v3_0"
+	v3_1 "github.com/coreos/ignition/v2/config/v3_1"
+	v3_2 "github.com/coreos/ignition/v2/config/v3_2"
+	v3_3 "github.com/coreos/ignition/v2/config/v3_3"
+	v3_4 "github.com/coreos/ignition/v2/config/v3_4"
+	v3_5 "github.com/coreos/ignition/v2/config/v3_5"
+	v3_6 "github.com/coreos/ignition/v2/config/v3_6"
+	"github.com/coreos/vcontext/report"
+)
+
+// ignitionSpec parses Ignition configs of one specification version.
+type ignitionSpec struct {
+	// parse accepts configs of exactly this version.
+	parse func([]byte) (interface{}, report.Report, error)
+	// parseCompatible accepts configs of this version or older, and
+	// translates them up to it.
+	parseCompatible func([]byte) (interface{}, report.Report, error)
+}
+
+func newIgnitionSpec[T any](parse, parseCompatible func([]byte) (T, report.Report, error)) ignitionSpec {
+	wrap := func(fn func([]byte) (T, report.Report, error)) func([]byte) (interface{}, report.Report, error) {
+		return func(raw []byte) (interface{}, report.Report, error) {
+			return fn(raw)
+		}
+	}
+	return ignitionSpec{parse: wrap(parse), parseCompatible: wrap(parseCompatible)}
+}
+
+// ignitionSpecs lists the stable Ignition specifications a config can be
+// converted to.
+var ignitionSpecs = map[string]ignitionSpec{
+	"3.0.0": newIgnitionSpec(v3_0.Parse, v3_0.ParseCompatibleVersion),
+	"3.1.0": newIgnitionSpec(v3_1.Parse, v3_1.ParseCompatibleVersion),
+	"3.2.0": newIgnitionSpec(v3_2.Parse, v3_2.ParseCompatibleVersion),
+	"3.3.0": newIgnitionSpec(v3_3.Parse, v3_3.ParseCompatibleVersion),
+	"3.4.0": newIgnitionSpec(v3_4.Parse, v3_4.ParseCompatibleVersion),
+	"3.5.0": newIgnitionSpec(v3_5.Parse, v3_5.ParseCompatibleVersion),
+	"3.6.0": newIgnitionSpec(v3_6.Parse, v3_6.ParseCompatibleVersion),
+}
+
+// IgnitionVersions returns the Ignition specification versions ConvertVersion
+// accepts, oldest first.
+func IgnitionVersions() []string {
+	versions := make([]string, 0, len(ignitionSpecs))
+	for v := range ignitionSpecs {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return semver.New(versions[i]).LessThan(*semver.New(versions[j]))
+	})
+	return versions
+}
+
+// VersionError is returned by ConvertVersion when the config uses features
+// the requested Ignition specification cannot represent.
+type VersionError struct {
+	Version string
+	Report  report.Report
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("the config cannot be represented in Ignition spec %s:\n%s", e.Version, strings.TrimSpace(e.Report.String()))
+}
+
+// ConvertVersion converts an Ignition config to the specification version.
+// Newer versions are reached with Ignition's own translations. Older ones are
+// reached by relabelling the config and parsing it with the older
+// specification, which reports every field it does not know; any such field,
+// or any other finding, fails the conversion rather than silently dropping
+// content.
+func ConvertVersion(ignition []byte, version string, opts Options) ([]byte, error) {
+	spec, ok := ignitionSpecs[version]
+	if !ok {
+		return nil, fmt.Errorf("unsupported Ignition version %q, must be one of %s", version, strings.Join(IgnitionVersions(), ", "))
+	}
+	current, err := IgnitionVersion(ignition)
+	if err != nil {
+		return nil, err
+	}
+	if current == version {
+		return ignition, nil
+	}
+	from, err := semver.NewVersion(current)
+	if err != nil {
+		return nil, fmt.Errorf("invalid Ignition version %q: %w", current, err)
+	}
+
+	var cfg interface{}
+	var rpt report.Report
+	if from.LessThan(*semver.New(version)) {
+		cfg, rpt, err = spec.parseCompatible(ignition)
+	} else {
+		relabelled, rerr := relabel(ignition, version)
+		if rerr != nil {
+			return nil, rerr
+		}
+		cfg, rpt, err = spec.parse(relabelled)
+	}
+	if err != nil && len(rpt.Entries) == 0 {
+		return nil, fmt.Errorf("failed to convert the config to Ignition spec %s: %w", version, err)
+	}
+	if err != nil || len(rpt.Entries) > 0 {
+		return nil, &VersionError{Version: version, Report: rpt}
+	}
+
+	if opts.Pretty {
+		return json.MarshalIndent(cfg, "", "  ")
+	}
+	return json.Marshal(cfg)
+}
+
+// relabel sets ignition.version of an Ignition config, keeping everything else.
+func relabel(ignition []byte, version string) ([]byte, error) {
+	var cfg map[string]interface{}
+	if err := json.Unmarshal(ignition, &cfg); err != nil {
+		return nil, fmt.Errorf("failed to read the Ignition config: %w", err)
+	}
+	meta, _ := cfg["ignition"].(map[string]interface{})
+	if meta == nil {
+		meta = map[string]interface{}{}
+	}
+	meta["version"] = version
+	cfg["ignition"] = meta
+	return json.Marshal(cfg)
+}
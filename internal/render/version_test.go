@@ -0,0 +1,87 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package render
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const motdSource = `variant: fcos
+version: 1.6.0
+storage:
+  files:
+    - path: /etc/motd
+      mode: 0644
+      contents:
+        inline: hello
+`
+
+func translated(t *testing.T, source string) []byte {
+	t.Helper()
+	ignition, _, err := Translate([]byte(source), Options{NoResourceAutoCompression: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ignition
+}
+
+func TestConvertVersion(t *testing.T) {
+	ignition := translated(t, motdSource)
+	for _, version := range []string{"3.0.0", "3.2.0", "3.5.0", "3.6.0"} {
+		t.Run(version, func(t *testing.T) {
+			out, err := ConvertVersion(ignition, version, Options{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := IgnitionVersion(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != version {
+				t.Errorf("IgnitionVersion() = %q, want %q", got, version)
+			}
+			if !strings.Contains(string(out), `"path":"/etc/motd"`) {
+				t.Errorf("converted config lost the file:\n%s", out)
+			}
+		})
+	}
+}
+
+func TestConvertVersionUnrepresentable(t *testing.T) {
+	// kernel_arguments only exist since Ignition spec 3.3
+	ignition := translated(t, "variant: fcos\nversion: 1.6.0\nkernel_arguments:\n  should_exist:\n    - quiet\n")
+	if _, err := ConvertVersion(ignition, "3.3.0", Options{}); err != nil {
+		t.Fatalf("3.3.0 should represent kernel arguments: %v", err)
+	}
+
+	_, err := ConvertVersion(ignition, "3.2.0", Options{})
+	var versionErr *VersionError
+	if !errors.As(err, &versionErr) {
+		t.Fatalf("ConvertVersion() error = %v, want a VersionError", err)
+	}
+	if !strings.Contains(err.Error(), "kernelArguments") {
+		t.Errorf("error should name the unrepresentable field: %v", err)
+	}
+}
+
+func TestConvertVersionUnsupported(t *testing.T) {
+	if _, err := ConvertVersion(translated(t, motdSource), "2.3.0", Options{}); err == nil {
+		t.Fatal("Ignition spec 2 should not be supported")
+	}
+}
@@ -0,0 +1,317 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package s3 uploads, deletes and pre-signs objects with the S3 API, signing
+// requests with AWS Signature Version 4, so that any S3 compatible object
+// storage can serve the generated Ignition.
+package s3
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultRegion signs the requests of clients that set no region.
+	DefaultRegion = "us-east-1"
+	// MaxPresignExpiry is the longest validity of a pre-signed URL.
+	MaxPresignExpiry = 7 * 24 * time.Hour
+
+	algorithm       = "AWS4-HMAC-SHA256"
+	timeFormat      = "20060102T150405Z"
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+)
+
+// Credentials are the credentials of an S3 account.
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is set for temporary credentials.
+	SessionToken string
+}
+
+// Client sends requests to an S3 endpoint, addressing buckets by path, e.g.
+// https://s3.example.com/bucket/key, which S3 compatible storages support.
+type Client struct {
+	// HTTPClient sends the requests. Nil uses a client with a 30 second
+	// timeout.
+	HTTPClient *http.Client
+	// Endpoint is the URL of the S3 API, e.g. https://s3.eu-west-3.amazonaws.com.
+	Endpoint string
+	// Region signs the requests. Empty uses DefaultRegion.
+	Region      string
+	Credentials Credentials
+	// Now returns the signing time. Nil uses time.Now.
+	Now func() time.Time
+}
+
+// PutObject uploads data as the object key of bucket.
+func (c *Client) PutObject(ctx context.Context, bucket, key string, data []byte, contentType string) error {
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	resp, err := c.do(ctx, http.MethodPut, bucket, key, header, data)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to upload s3://%s/%s: %s", bucket, key, responseError(resp))
+	}
+	return nil
+}
+
+// DeleteObject deletes the object key of bucket. Deleting an object that does
+// not exist succeeds.
+func (c *Client) DeleteObject(ctx context.Context, bucket, key string) error {
+	resp, err := c.do(ctx, http.MethodDelete, bucket, key, http.Header{}, nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return fmt.Errorf("failed to delete s3://%s/%s: %s", bucket, key, responseError(resp))
+	}
+	return nil
+}
+
+// PresignGetObject returns a URL that downloads the object key of bucket
+// without credentials until expires has passed.
+func (c *Client) PresignGetObject(bucket, key string, expires time.Duration) (string, error) {
+	if expires <= 0 || expires > MaxPresignExpiry {
+		return "", fmt.Errorf("pre-signed URLs expire after a second to %s, got %s", MaxPresignExpiry, expires)
+	}
+	u, err := c.objectURL(bucket, key)
+	if err != nil {
+		return "", err
+	}
+	now := c.now()
+	query := u.Query()
+	query.Set("X-Amz-Algorithm", algorithm)
+	query.Set("X-Amz-Credential", c.Credentials.AccessKeyID+"/"+c.scope(now))
+	query.Set("X-Amz-Date", now.Format(timeFormat))
+	query.Set("X-Amz-Expires", strconv.Itoa(int(expires.Seconds())))
+	query.Set("X-Amz-SignedHeaders", "host")
+	if c.Credentials.SessionToken != "" {
+		query.Set("X-Amz-Security-Token", c.Credentials.SessionToken)
+	}
+	u.RawQuery = canonicalQuery(query)
+	signature := c.signature(http.MethodGet, u, http.Header{}, unsignedPayload, now)
+	u.RawQuery += "&X-Amz-Signature=" + signature
+	return u.String(), nil
+}
+
+// do sends a signed request for the object key of bucket. The body of the
+// response is kept for errors only.
+func (c *Client) do(ctx context.Context, method, bucket, key string, header http.Header, body []byte) (*http.Response, error) {
+	u, err := c.objectURL(bucket, key)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	c.sign(req, body)
+	resp, err := c.httpClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(data))
+	return resp, nil
+}
+
+// sign adds the Signature Version 4 Authorization header to req, covering
+// its host, its headers and body.
+func (c *Client) sign(req *http.Request, body []byte) {
+	now := c.now()
+	sum := sha256.Sum256(body)
+	payloadHash := hex.EncodeToString(sum[:])
+	req.Header.Set("X-Amz-Date", now.Format(timeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if c.Credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", c.Credentials.SessionToken)
+	}
+	names := signedHeaders(headersWithHost(req.Header, req.URL))
+	signature := c.signature(req.Method, req.URL, req.Header, payloadHash, now)
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		algorithm, c.Credentials.AccessKeyID, c.scope(now), strings.Join(names, ";"), signature))
+}
+
+// signature returns the Signature Version 4 signature of a request to u with
+// the headers of header, along with the host of u.
+func (c *Client) signature(method string, u *url.URL, header http.Header, payloadHash string, now time.Time) string {
+	headers := headersWithHost(header, u)
+	names := signedHeaders(headers)
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name + ":" + strings.Join(headers[name], ",") + "\n")
+	}
+	canonicalRequest := strings.Join([]string{
+		method,
+		u.EscapedPath(),
+		u.RawQuery,
+		canonical.String(),
+		strings.Join(names, ";"),
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{algorithm, now.Format(timeFormat), c.scope(now), hex.EncodeToString(requestHash[:])}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+c.Credentials.SecretAccessKey), now.Format("20060102"))
+	for _, part := range []string{c.region(), "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+// headersWithHost returns the headers of header with lowercase names and
+// trimmed values, along with the host of u.
+func headersWithHost(header http.Header, u *url.URL) map[string][]string {
+	headers := map[string][]string{"host": {u.Host}}
+	for name, values := range header {
+		name = strings.ToLower(name)
+		for _, value := range values {
+			headers[name] = append(headers[name], strings.Join(strings.Fields(value), " "))
+		}
+	}
+	return headers
+}
+
+// signedHeaders returns the sorted names of headers.
+func signedHeaders(headers map[string][]string) []string {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// canonicalQuery encodes query sorted by name, escaping the way Signature
+// Version 4 does.
+func canonicalQuery(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		values := append([]string(nil), query[name]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, escape(name, true)+"="+escape(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// escape percent-encodes all but the unreserved characters of s, and slashes
+// unless encodeSlash is set.
+func escape(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for _, c := range []byte(s) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// objectURL returns the path-style URL of the object key of bucket.
+func (c *Client) objectURL(bucket, key string) (*url.URL, error) {
+	if bucket == "" || key == "" {
+		return nil, fmt.Errorf("a bucket and a key are required")
+	}
+	u, err := url.Parse(strings.TrimSuffix(c.Endpoint, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid endpoint %q: %w", c.Endpoint, err)
+	}
+	if (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %q: an http or https URL is required", c.Endpoint)
+	}
+	path := u.Path + "/" + bucket + "/" + key
+	u.Path = path
+	u.RawPath = escape(path, false)
+	return u, nil
+}
+
+func (c *Client) scope(now time.Time) string {
+	return now.Format("20060102") + "/" + c.region() + "/s3/aws4_request"
+}
+
+func (c *Client) region() string {
+	if c.Region == "" {
+		return DefaultRegion
+	}
+	return c.Region
+}
+
+func (c *Client) now() time.Time {
+	if c.Now == nil {
+		return time.Now().UTC()
+	}
+	return c.Now().UTC()
+}
+
+func (c *Client) httpClient() *http.Client {
+	if c.HTTPClient == nil {
+		return &http.Client{Timeout: 30 * time.Second}
+	}
+	return c.HTTPClient
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// responseError returns the status of resp, with the code and message of the
+// S3 error it carries, if any.
+func responseError(resp *http.Response) string {
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	data, _ := io.ReadAll(resp.Body)
+	if xml.Unmarshal(data, &body) == nil && body.Code != "" {
+		return fmt.Sprintf("%s: %s: %s", resp.Status, body.Code, body.Message)
+	}
+	return resp.Status
+}
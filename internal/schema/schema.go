@@ -0,0 +1,260 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package schema generates the OpenAPI schema of spec.config from the Butane
+// specification structs, so that the API server validates Butane configs
+// structurally and kubectl explain documents them.
+package schema
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	fcos1_0 "github.com/coreos/butane/config/fcos/v1_0"
+	fcos1_1 "github.com/coreos/butane/config/fcos/v1_1"
+	fcos1_2 "github.com/coreos/butane/config/fcos/v1_2"
+	fcos1_3 "github.com/coreos/butane/config/fcos/v1_3"
+	fcos1_4 "github.com/coreos/butane/config/fcos/v1_4"
+	fcos1_5 "github.com/coreos/butane/config/fcos/v1_5"
+	fcos1_6 "github.com/coreos/butane/config/fcos/v1_6"
+	fcos1_7 "github.com/coreos/butane/config/fcos/v1_7"
+	fiot1_0 "github.com/coreos/butane/config/fiot/v1_0"
+	flatcar1_0 "github.com/coreos/butane/config/flatcar/v1_0"
+	flatcar1_1 "github.com/coreos/butane/config/flatcar/v1_1"
+	openshift4_10 "github.com/coreos/butane/config/openshift/v4_10"
+	openshift4_11 "github.com/coreos/butane/config/openshift/v4_11"
+	openshift4_12 "github.com/coreos/butane/config/openshift/v4_12"
+	openshift4_13 "github.com/coreos/butane/config/openshift/v4_13"
+	openshift4_14 "github.com/coreos/butane/config/openshift/v4_14"
+	openshift4_15 "github.com/coreos/butane/config/openshift/v4_15"
+	openshift4_16 "github.com/coreos/butane/config/openshift/v4_16"
+	openshift4_17 "github.com/coreos/butane/config/openshift/v4_17"
+	openshift4_18 "github.com/coreos/butane/config/openshift/v4_18"
+	openshift4_19 "github.com/coreos/butane/config/openshift/v4_19"
+	openshift4_20 "github.com/coreos/butane/config/openshift/v4_20"
+	openshift4_21 "github.com/coreos/butane/config/openshift/v4_21"
+	openshift4_8 "github.com/coreos/butane/config/openshift/v4_8"
+	openshift4_9 "github.com/coreos/butane/config/openshift/v4_9"
+	r4e1_0 "github.com/coreos/butane/config/r4e/v1_0"
+	r4e1_1 "github.com/coreos/butane/config/r4e/v1_1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+)
+
+// Spec is a Butane specification covered by the generated schema.
+type Spec struct {
+	Variant string
+	Version string
+	config  interface{}
+}
+
+// Specs lists the stable Butane specifications the schema is generated from.
+// Experimental versions are left out: they change without notice and are
+// accepted through spec.rawConfig instead.
+var Specs = []Spec{
+	{"fcos", "1.0.0", fcos1_0.Config{}},
+	{"fcos", "1.1.0", fcos1_1.Config{}},
+	{"fcos", "1.2.0", fcos1_2.Config{}},
+	{"fcos", "1.3.0", fcos1_3.Config{}},
+	{"fcos", "1.4.0", fcos1_4.Config{}},
+	{"fcos", "1.5.0", fcos1_5.Config{}},
+	{"fcos", "1.6.0", fcos1_6.Config{}},
+	{"fcos", "1.7.0", fcos1_7.Config{}},
+	{"fiot", "1.0.0", fiot1_0.Config{}},
+	{"flatcar", "1.0.0", flatcar1_0.Config{}},
+	{"flatcar", "1.1.0", flatcar1_1.Config{}},
+	{"openshift", "4.8.0", openshift4_8.Config{}},
+	{"openshift", "4.9.0", openshift4_9.Config{}},
+	{"openshift", "4.10.0", openshift4_10.Config{}},
+	{"openshift", "4.11.0", openshift4_11.Config{}},
+	{"openshift", "4.12.0", openshift4_12.Config{}},
+	{"openshift", "4.13.0", openshift4_13.Config{}},
+	{"openshift", "4.14.0", openshift4_14.Config{}},
+	{"openshift", "4.15.0", openshift4_15.Config{}},
+	{"openshift", "4.16.0", openshift4_16.Config{}},
+	{"openshift", "4.17.0", openshift4_17.Config{}},
+	{"openshift", "4.18.0", openshift4_18.Config{}},
+	{"openshift", "4.19.0", openshift4_19.Config{}},
+	{"openshift", "4.20.0", openshift4_20.Config{}},
+	{"openshift", "4.21.0", openshift4_21.Config{}},
+	{"r4e", "1.0.0", r4e1_0.Config{}},
+	{"r4e", "1.1.0", r4e1_1.Config{}},
+}
+
+// Covers reports whether the schema describes configs of variant and version.
+func Covers(variant, version string) bool {
+	for _, s := range Specs {
+		if s.Variant == variant && s.Version == version {
+			return true
+		}
+	}
+	return false
+}
+
+// Latest returns the newest stable version of variant, or "" when the variant
+// has none.
+func Latest(variant string) string {
+	latest := ""
+	for _, s := range Specs {
+		if s.Variant == variant {
+			latest = s.Version
+		}
+	}
+	return latest
+}
+
+// Config returns the schema of spec.config: the union of the fields of every
+// specification in Specs, with variant and version restricted to them.
+func Config() (apiextensionsv1.JSONSchemaProps, error) {
+	var out *apiextensionsv1.JSONSchemaProps
+	variants := map[string]bool{}
+	versions := map[string]bool{}
+	for _, s := range Specs {
+		props, err := schemaFor(reflect.TypeOf(s.config), s.Variant+"/"+s.Version)
+		if err != nil {
+			return apiextensionsv1.JSONSchemaProps{}, err
+		}
+		if out == nil {
+			out = &props
+		} else if err := merge(out, &props, "config"); err != nil {
+			return apiextensionsv1.JSONSchemaProps{}, err
+		}
+		variants[s.Variant] = true
+		versions[s.Version] = true
+	}
+
+	out.Description = "Config is the Butane config to translate. The schema covers the stable " +
+		"specifications of the " + strings.Join(sortedKeys(variants), ", ") + " variants; use " +
+		"rawConfig for other versions. More info: https://coreos.github.io/butane/specs/"
+	out.Required = []string{"variant", "version"}
+	variant := out.Properties["variant"]
+	variant.Description = "Variant is the Butane variant the config targets."
+	variant.Enum = enum(sortedKeys(variants))
+	out.Properties["variant"] = variant
+	version := out.Properties["version"]
+	version.Description = "Version is the version of the Butane specification of the variant."
+	version.Enum = enum(sortedKeys(versions))
+	out.Properties["version"] = version
+	return *out, nil
+}
+
+// schemaFor maps a Butane struct field type, as decoded by yaml.v3, to its schema.
+func schemaFor(t reflect.Type, path string) (apiextensionsv1.JSONSchemaProps, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return apiextensionsv1.JSONSchemaProps{Type: "string"}, nil
+	case reflect.Bool:
+		return apiextensionsv1.JSONSchemaProps{Type: "boolean"}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return apiextensionsv1.JSONSchemaProps{Type: "integer"}, nil
+	case reflect.Slice:
+		items, err := schemaFor(t.Elem(), path+"[]")
+		if err != nil {
+			return apiextensionsv1.JSONSchemaProps{}, err
+		}
+		return apiextensionsv1.JSONSchemaProps{
+			Type:  "array",
+			Items: &apiextensionsv1.JSONSchemaPropsOrArray{Schema: &items},
+		}, nil
+	case reflect.Map:
+		if t.Key().Kind() != reflect.String {
+			return apiextensionsv1.JSONSchemaProps{}, fmt.Errorf("%s: unsupported map key type %s", path, t.Key())
+		}
+		values, err := schemaFor(t.Elem(), path+"{}")
+		if err != nil {
+			return apiextensionsv1.JSONSchemaProps{}, err
+		}
+		return apiextensionsv1.JSONSchemaProps{
+			Type:                 "object",
+			AdditionalProperties: &apiextensionsv1.JSONSchemaPropsOrBool{Allows: true, Schema: &values},
+		}, nil
+	case reflect.Struct:
+		out := apiextensionsv1.JSONSchemaProps{Type: "object", Properties: map[string]apiextensionsv1.JSONSchemaProps{}}
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			name, opts, _ := strings.Cut(f.Tag.Get("yaml"), ",")
+			if name == "-" || (!f.IsExported() && !f.Anonymous) {
+				continue
+			}
+			props, err := schemaFor(f.Type, path+"."+name)
+			if err != nil {
+				return apiextensionsv1.JSONSchemaProps{}, err
+			}
+			if strings.Contains(opts, "inline") {
+				if err := merge(&out, &props, path); err != nil {
+					return apiextensionsv1.JSONSchemaProps{}, err
+				}
+				continue
+			}
+			if name == "" {
+				name = strings.ToLower(f.Name)
+			}
+			out.Properties[name] = props
+		}
+		return out, nil
+	default:
+		return apiextensionsv1.JSONSchemaProps{}, fmt.Errorf("%s: unsupported type %s", path, t)
+	}
+}
+
+// merge adds the fields of src to dst. Butane only adds fields between
+// specification versions, so a field with two different types is a bug.
+func merge(dst, src *apiextensionsv1.JSONSchemaProps, path string) error {
+	if dst.Type != src.Type {
+		return fmt.Errorf("%s: conflicting types %s and %s", path, dst.Type, src.Type)
+	}
+	switch {
+	case src.Properties != nil:
+		for name, props := range src.Properties {
+			existing, ok := dst.Properties[name]
+			if !ok {
+				dst.Properties[name] = props
+				continue
+			}
+			if err := merge(&existing, &props, path+"."+name); err != nil {
+				return err
+			}
+			dst.Properties[name] = existing
+		}
+	case src.Items != nil:
+		return merge(dst.Items.Schema, src.Items.Schema, path+"[]")
+	case src.AdditionalProperties != nil:
+		return merge(dst.AdditionalProperties.Schema, src.AdditionalProperties.Schema, path+"{}")
+	}
+	return nil
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func enum(values []string) []apiextensionsv1.JSON {
+	out := make([]apiextensionsv1.JSON, 0, len(values))
+	for _, v := range values {
+		out = append(out, apiextensionsv1.JSON{Raw: []byte(fmt.Sprintf("%q", v))})
+	}
+	return out
+}
@@ -0,0 +1,144 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package schema
+
+import (
+	"reflect"
+	"testing"
+
+	"k8s.io/apiextensions-apiserver/pkg/apis/apiextensions"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	structuralschema "k8s.io/apiextensions-apiserver/pkg/apiserver/schema"
+	"k8s.io/apiextensions-apiserver/pkg/apiserver/schema/pruning"
+	"sigs.k8s.io/yaml"
+)
+
+func internalSchema(t *testing.T) *apiextensions.JSONSchemaProps {
+	t.Helper()
+	config, err := Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out apiextensions.JSONSchemaProps
+	if err := apiextensionsv1.Convert_v1_JSONSchemaProps_To_apiextensions_JSONSchemaProps(&config, &out, nil); err != nil {
+		t.Fatal(err)
+	}
+	return &out
+}
+
+func decode(t *testing.T, config string) map[string]interface{} {
+	t.Helper()
+	var obj map[string]interface{}
+	if err := yaml.Unmarshal([]byte(config), &obj); err != nil {
+		t.Fatal(err)
+	}
+	return obj
+}
+
+func TestConfigIsStructural(t *testing.T) {
+	// spec.config is not the root of the resource, where metadata is reserved.
+	root := &apiextensions.JSONSchemaProps{
+		Type: "object",
+		Properties: map[string]apiextensions.JSONSchemaProps{
+			"spec": {Type: "object", Properties: map[string]apiextensions.JSONSchemaProps{"config": *internalSchema(t)}},
+		},
+	}
+	s, err := structuralschema.NewStructural(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if errs := structuralschema.ValidateStructural(nil, s); len(errs) > 0 {
+		t.Fatalf("schema is not structural: %v", errs.ToAggregate())
+	}
+}
+
+func TestConfigPrunesUnknownFields(t *testing.T) {
+	s, err := structuralschema.NewStructural(internalSchema(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, tt := range map[string]struct {
+		config string
+		want   []string
+	}{
+		"fcos": {config: `
+variant: fcos
+version: 1.7.0
+boot_device:
+  mirror:
+    devices: [/dev/sda, /dev/sdb]
+storage:
+  files:
+    - path: /etc/motd
+      mode: 0644
+      contents:
+        inline: hello
+`},
+		"openshift": {config: `
+variant: openshift
+version: 4.21.0
+metadata:
+  name: worker-motd
+  labels:
+    machineconfiguration.openshift.io/role: worker
+openshift:
+  kernel_arguments: [loglevel=7]
+`},
+		"typos": {config: `
+variant: fcos
+version: 1.5.0
+storage:
+  files:
+    - path: /etc/motd
+      contnets:
+        inline: hello
+sytemd: {}
+`, want: []string{"storage.files[0].contnets", "sytemd"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			got := pruning.PruneWithOptions(decode(t, tt.config), s, false, structuralschema.UnknownFieldPathOptions{TrackUnknownFieldPaths: true})
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("pruned fields = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCovers(t *testing.T) {
+	if !Covers("fcos", "1.5.0") || !Covers("openshift", "4.21.0") {
+		t.Error("stable versions should be covered")
+	}
+	if Covers("fcos", "1.8.0-experimental") || Covers("rhcos", "0.1.0") {
+		t.Error("experimental and unsupported versions should not be covered")
+	}
+}
+
+func TestLatest(t *testing.T) {
+	tests := map[string]string{
+		"fcos":      "1.7.0",
+		"fiot":      "1.0.0",
+		"flatcar":   "1.1.0",
+		"openshift": "4.21.0",
+		"r4e":       "1.1.0",
+		"rhcos":     "",
+	}
+	for variant, want := range tests {
+		if got := Latest(variant); got != want {
+			t.Errorf("Latest(%q) = %q, want %q", variant, got, want)
+		}
+	}
+}
@@ -0,0 +1,278 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package signing signs generated Ignition configs and their provenance, and
+// verifies them offline.
+package signing
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Keys of the Ignition Secret that hold the signing artifacts, next to userdata.
+const (
+	// SignatureKey holds the base64 encoded detached signature of userdata.
+	SignatureKey = "userdata.sig"
+	// ProvenanceKey holds the provenance document of userdata.
+	ProvenanceKey = "provenance.json"
+	// ProvenanceSignatureKey holds the base64 encoded detached signature of the provenance document.
+	ProvenanceSignatureKey = "provenance.json.sig"
+)
+
+// ProvenanceKind identifies provenance documents.
+const ProvenanceKind = "IgnitionProvenance"
+
+// Provenance records where a signed Ignition config comes from.
+type Provenance struct {
+	Kind string `json:"kind"`
+	// Subject is the ButaneConfig the Ignition config was rendered from.
+	Subject Subject `json:"subject"`
+	// Digest of the signed userdata, by algorithm.
+	Digest map[string]string `json:"digest"`
+	// KeyID is the SHA-256 of the DER encoded public key that signed the config.
+	KeyID string `json:"keyID"`
+	// Timestamp is when the config was signed.
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Subject identifies a ButaneConfig.
+type Subject struct {
+	Namespace  string `json:"namespace"`
+	Name       string `json:"name"`
+	UID        string `json:"uid"`
+	Generation int64  `json:"generation"`
+}
+
+// Digest returns the digest recorded in provenance documents for userdata.
+func Digest(userdata []byte) map[string]string {
+	sum := sha256.Sum256(userdata)
+	return map[string]string{"sha256": hex.EncodeToString(sum[:])}
+}
+
+// ParsePrivateKey parses a PEM encoded Ed25519 or ECDSA private key, in
+// PKCS#8 or, for ECDSA, SEC 1 form.
+func ParsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	var key interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		return k, nil
+	case *ecdsa.PrivateKey:
+		return k, nil
+	default:
+		return nil, fmt.Errorf("unsupported private key type %T, only Ed25519 and ECDSA are supported", key)
+	}
+}
+
+// ParsePublicKey parses a PEM encoded Ed25519 or ECDSA public key. A private
+// key is accepted too, and its public key is returned.
+func ParsePublicKey(data []byte) (crypto.PublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if block.Type != "PUBLIC KEY" {
+		signer, err := ParsePrivateKey(data)
+		if err != nil {
+			return nil, err
+		}
+		return signer.Public(), nil
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	switch key.(type) {
+	case ed25519.PublicKey, *ecdsa.PublicKey:
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported public key type %T, only Ed25519 and ECDSA are supported", key)
+	}
+}
+
+// KeyID identifies a public key in provenance documents.
+func KeyID(pub crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return "sha256:" + hex.EncodeToString(sum[:]), nil
+}
+
+// Sign returns the base64 encoded signature of msg. ECDSA keys sign the
+// SHA-2 digest matching their curve size.
+func Sign(signer crypto.Signer, msg []byte) ([]byte, error) {
+	var sig []byte
+	var err error
+	switch k := signer.(type) {
+	case ed25519.PrivateKey:
+		sig = ed25519.Sign(k, msg)
+	case *ecdsa.PrivateKey:
+		sig, err = ecdsa.SignASN1(rand.Reader, k, ecdsaDigest(k.Curve, msg))
+	default:
+		err = fmt.Errorf("unsupported key type %T", signer)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte(base64.StdEncoding.EncodeToString(sig)), nil
+}
+
+// Verify checks a signature produced by Sign.
+func Verify(pub crypto.PublicKey, msg, signature []byte) error {
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("signature is not base64: %w", err)
+	}
+	valid := false
+	switch k := pub.(type) {
+	case ed25519.PublicKey:
+		valid = ed25519.Verify(k, msg, sig)
+	case *ecdsa.PublicKey:
+		valid = ecdsa.VerifyASN1(k, ecdsaDigest(k.Curve, msg), sig)
+	default:
+		return fmt.Errorf("unsupported key type %T", pub)
+	}
+	if !valid {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+func ecdsaDigest(curve elliptic.Curve, msg []byte) []byte {
+	switch curve.Params().BitSize {
+	case 384:
+		sum := sha512.Sum384(msg)
+		return sum[:]
+	case 521:
+		sum := sha512.Sum512(msg)
+		return sum[:]
+	default:
+		sum := sha256.Sum256(msg)
+		return sum[:]
+	}
+}
+
+// Artifacts are the signing artifacts stored next to userdata.
+type Artifacts struct {
+	Signature           []byte
+	Provenance          []byte
+	ProvenanceSignature []byte
+}
+
+// Data returns the artifacts keyed as in the Ignition Secret.
+func (a Artifacts) Data() map[string][]byte {
+	return map[string][]byte{
+		SignatureKey:           a.Signature,
+		ProvenanceKey:          a.Provenance,
+		ProvenanceSignatureKey: a.ProvenanceSignature,
+	}
+}
+
+// SignOutput signs userdata and a provenance document for subject.
+func SignOutput(signer crypto.Signer, userdata []byte, subject Subject, now time.Time) (Artifacts, error) {
+	keyID, err := KeyID(signer.Public())
+	if err != nil {
+		return Artifacts{}, err
+	}
+	provenance, err := json.Marshal(Provenance{
+		Kind:      ProvenanceKind,
+		Subject:   subject,
+		Digest:    Digest(userdata),
+		KeyID:     keyID,
+		Timestamp: now.UTC().Truncate(time.Second),
+	})
+	if err != nil {
+		return Artifacts{}, err
+	}
+
+	a := Artifacts{Provenance: provenance}
+	if a.Signature, err = Sign(signer, userdata); err != nil {
+		return Artifacts{}, err
+	}
+	if a.ProvenanceSignature, err = Sign(signer, provenance); err != nil {
+		return Artifacts{}, err
+	}
+	return a, nil
+}
+
+// VerifyOutput checks both signatures and that the provenance describes
+// userdata and was signed by pub. It returns the verified provenance.
+func VerifyOutput(pub crypto.PublicKey, userdata []byte, a Artifacts) (*Provenance, error) {
+	if err := Verify(pub, userdata, a.Signature); err != nil {
+		return nil, fmt.Errorf("userdata: %w", err)
+	}
+	if err := Verify(pub, a.Provenance, a.ProvenanceSignature); err != nil {
+		return nil, fmt.Errorf("provenance: %w", err)
+	}
+
+	var p Provenance
+	if err := json.Unmarshal(a.Provenance, &p); err != nil {
+		return nil, fmt.Errorf("provenance: %w", err)
+	}
+	if p.Kind != ProvenanceKind {
+		return nil, fmt.Errorf("provenance: unexpected kind %q", p.Kind)
+	}
+	keyID, err := KeyID(pub)
+	if err != nil {
+		return nil, err
+	}
+	if p.KeyID != keyID {
+		return nil, fmt.Errorf("provenance: key ID %s does not match the verification key %s", p.KeyID, keyID)
+	}
+	if want := Digest(userdata)["sha256"]; p.Digest["sha256"] != want {
+		return nil, fmt.Errorf("provenance: digest sha256:%s does not match userdata sha256:%s", p.Digest["sha256"], want)
+	}
+	return &p, nil
+}
+
+// Current reports whether previously produced artifacts still describe
+// userdata for subject with the given key, so they can be kept as is.
+func Current(a Artifacts, pub crypto.PublicKey, userdata []byte, subject Subject) bool {
+	p, err := VerifyOutput(pub, userdata, a)
+	return err == nil && p.Subject == subject
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package signing
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"testing"
+	"time"
+)
+
+func pemKey(t *testing.T, typ string, der []byte, err error) []byte {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+}
+
+func testKeys(t *testing.T) map[string][]byte {
+	t.Helper()
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ed, err := x509.MarshalPKCS8PrivateKey(edKey)
+	keys := map[string][]byte{"ed25519": pemKey(t, "PRIVATE KEY", ed, err)}
+	ec256, err := x509.MarshalPKCS8PrivateKey(p256)
+	keys["p256-pkcs8"] = pemKey(t, "PRIVATE KEY", ec256, err)
+	ec384, err := x509.MarshalECPrivateKey(p384)
+	keys["p384-sec1"] = pemKey(t, "EC PRIVATE KEY", ec384, err)
+	return keys
+}
+
+func TestSignAndVerifyOutput(t *testing.T) {
+	userdata := []byte(`{"ignition":{"version":"3.4.0"}}`)
+	subject := Subject{Namespace: "default", Name: "motd", UID: "1234", Generation: 3}
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	for name, keyPEM := range testKeys(t) {
+		t.Run(name, func(t *testing.T) {
+			signer, err := ParsePrivateKey(keyPEM)
+			if err != nil {
+				t.Fatal(err)
+			}
+			artifacts, err := SignOutput(signer, userdata, subject, now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			pubDER, err := x509.MarshalPKIXPublicKey(signer.Public())
+			pub, err := ParsePublicKey(pemKey(t, "PUBLIC KEY", pubDER, err))
+			if err != nil {
+				t.Fatal(err)
+			}
+			p, err := VerifyOutput(pub, userdata, artifacts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Subject != subject || !p.Timestamp.Equal(now) || p.Digest["sha256"] != Digest(userdata)["sha256"] {
+				t.Errorf("unexpected provenance %+v", p)
+			}
+			if !Current(artifacts, pub, userdata, subject) {
+				t.Error("artifacts should be current")
+			}
+
+			if _, err := VerifyOutput(pub, []byte(`{"ignition":{"version":"3.3.0"}}`), artifacts); err == nil {
+				t.Error("tampered userdata should fail verification")
+			}
+			bumped := subject
+			bumped.Generation++
+			if Current(artifacts, pub, userdata, bumped) {
+				t.Error("artifacts of an older generation should not be current")
+			}
+		})
+	}
+}
+
+func TestVerifyWrongKey(t *testing.T) {
+	keys := testKeys(t)
+	signer, err := ParsePrivateKey(keys["ed25519"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := ParsePublicKey(keys["p256-pkcs8"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	userdata := []byte("{}")
+	artifacts, err := SignOutput(signer, userdata, Subject{Name: "motd"}, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyOutput(other, userdata, artifacts); err == nil {
+		t.Error("verification with another key should fail")
+	}
+}
+
+func TestParsePrivateKeyRejectsRSA(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if _, err := ParsePrivateKey(pemKey(t, "PRIVATE KEY", der, err)); err == nil {
+		t.Error("RSA keys should be rejected")
+	}
+	if _, err := ParsePrivateKey([]byte("not a key")); err == nil {
+		t.Error("non-PEM input should be rejected")
+	}
+}
@@ -0,0 +1,218 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package userdir reads SSH authorized keys: from authorized_keys texts, as
+// stored in Secrets and ConfigMaps, and from the user directory file, a local
+// stand-in for an LDAP directory listing the keys of each user.
+package userdir
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/yaml"
+)
+
+// ErrNotConfigured is returned by the Keys of a nil Directory.
+var ErrNotConfigured = errors.New("no user directory file is configured")
+
+// File is the format of the user directory file.
+type File struct {
+	Users []User `json:"users"`
+}
+
+// User lists the SSH authorized keys of a user.
+type User struct {
+	Name              string   `json:"name"`
+	SSHAuthorizedKeys []string `json:"sshAuthorizedKeys,omitempty"`
+}
+
+// ParseAuthorizedKeys returns the keys of an authorized_keys text, skipping
+// blank lines and comments.
+func ParseAuthorizedKeys(text string) []string {
+	var keys []string
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		keys = append(keys, line)
+	}
+	return keys
+}
+
+// AppendKeys appends the keys missing from keys, keeping their order.
+func AppendKeys(keys []string, more ...string) []string {
+	for _, key := range more {
+		if !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// Parse decodes a user directory file into the keys of each user. Unknown
+// fields and users listed twice are rejected.
+func Parse(data []byte) (map[string][]string, error) {
+	var file File
+	if err := yaml.UnmarshalStrict(data, &file); err != nil {
+		return nil, fmt.Errorf("invalid user directory: %w", err)
+	}
+	users := make(map[string][]string, len(file.Users))
+	for i, user := range file.Users {
+		if user.Name == "" {
+			return nil, fmt.Errorf("invalid user directory: users[%d] has no name", i)
+		}
+		if _, ok := users[user.Name]; ok {
+			return nil, fmt.Errorf("invalid user directory: user %s is listed twice", user.Name)
+		}
+		var keys []string
+		for _, key := range user.SSHAuthorizedKeys {
+			keys = AppendKeys(keys, ParseAuthorizedKeys(key)...)
+		}
+		users[user.Name] = keys
+	}
+	return users, nil
+}
+
+// Directory serves the keys of the user directory file, and, once started,
+// checks the file for changes and sends the name of every user whose keys
+// changed on its events channel. A nil Directory has no users.
+type Directory struct {
+	// Path is the user directory file, usually mounted from a ConfigMap or
+	// synchronized from a directory service.
+	Path string
+	// Interval is how often the file is checked. Defaults to 10 seconds.
+	Interval time.Duration
+	Log      logr.Logger
+
+	mu     sync.Mutex
+	data   []byte
+	users  map[string][]string
+	events chan event.TypedGenericEvent[string]
+}
+
+// NewDirectory returns a Directory reading the file at path.
+func NewDirectory(path string, log logr.Logger) *Directory {
+	return &Directory{Path: path, Log: log, events: make(chan event.TypedGenericEvent[string])}
+}
+
+// Keys returns the keys of the user, reading the file on first use. A user
+// the file does not list has no keys.
+func (d *Directory) Keys(user string) ([]string, error) {
+	if d == nil {
+		return nil, ErrNotConfigured
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.users == nil {
+		if _, err := d.reload(); err != nil {
+			return nil, err
+		}
+	}
+	return d.users[user], nil
+}
+
+// Events returns the channel the names of the users whose keys changed are
+// sent on.
+func (d *Directory) Events() <-chan event.TypedGenericEvent[string] {
+	return d.events
+}
+
+// Start checks the file until the context is done. It runs on the leader
+// only, alongside the controller receiving the events.
+func (d *Directory) Start(ctx context.Context) error {
+	interval := d.Interval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	// The controller renders every ButaneConfig on start, so the keys read
+	// first are not sent.
+	if _, err := d.Reload(); err != nil {
+		d.Log.Error(err, "Failed to read the user directory", "path", d.Path)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+			changed, err := d.Reload()
+			if err != nil {
+				d.Log.Error(err, "Keeping the previous user directory", "path", d.Path)
+				continue
+			}
+			for _, user := range changed {
+				select {
+				case d.events <- event.TypedGenericEvent[string]{Object: user}:
+				case <-ctx.Done():
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// Reload reads the file and returns the users whose keys changed, sorted. An
+// invalid file leaves the keys as they are.
+func (d *Directory) Reload() ([]string, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.reload()
+}
+
+func (d *Directory) reload() ([]string, error) {
+	data, err := os.ReadFile(d.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the user directory: %w", err)
+	}
+	if d.users != nil && bytes.Equal(data, d.data) {
+		return nil, nil
+	}
+	users, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	var changed []string
+	for name, keys := range users {
+		if old, ok := d.users[name]; !ok || !slices.Equal(old, keys) {
+			changed = append(changed, name)
+		}
+	}
+	for name := range d.users {
+		if _, ok := users[name]; !ok {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	if d.users != nil && len(changed) > 0 {
+		d.Log.Info("Reloaded the user directory", "path", d.Path, "changed", changed)
+	}
+	d.data, d.users = data, users
+	return changed, nil
+}
@@ -0,0 +1,110 @@
+/*
+Copyright 2024.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package userdir
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/go-logr/logr"
+)
+
+func TestParseAuthorizedKeys(t *testing.T) {
+	text := "# admins\nssh-ed25519 AAAA alice@laptop\n\n  ssh-rsa BBBB bob  \n"
+	want := []string{"ssh-ed25519 AAAA alice@laptop", "ssh-rsa BBBB bob"}
+	if got := ParseAuthorizedKeys(text); !slices.Equal(got, want) {
+		t.Errorf("ParseAuthorizedKeys() = %q, want %q", got, want)
+	}
+}
+
+func TestParse(t *testing.T) {
+	users, err := Parse([]byte("users:\n- name: alice\n  sshAuthorizedKeys: [ssh-ed25519 AAAA, ssh-ed25519 AAAA]\n- name: bob\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := users["alice"]; !slices.Equal(got, []string{"ssh-ed25519 AAAA"}) {
+		t.Errorf("keys of alice = %q, want the key once", got)
+	}
+	if _, ok := users["bob"]; !ok {
+		t.Error("bob should be listed without keys")
+	}
+
+	for name, data := range map[string]string{
+		"unknown field": "users:\n- name: alice\n  keys: [ssh-ed25519 AAAA]\n",
+		"no name":       "users:\n- sshAuthorizedKeys: [ssh-ed25519 AAAA]\n",
+		"listed twice":  "users:\n- name: alice\n- name: alice\n",
+	} {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("%s: Parse() should fail", name)
+		}
+	}
+}
+
+func TestDirectoryReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.yaml")
+	write := func(data string) {
+		t.Helper()
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("users:\n- name: alice\n  sshAuthorizedKeys: [ssh-ed25519 AAAA]\n- name: bob\n  sshAuthorizedKeys: [ssh-ed25519 BBBB]\n")
+	d := NewDirectory(path, logr.Discard())
+	keys, err := d.Keys("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(keys, []string{"ssh-ed25519 AAAA"}) {
+		t.Errorf("Keys(alice) = %q", keys)
+	}
+	if keys, _ := d.Keys("carol"); keys != nil {
+		t.Errorf("Keys(carol) = %q, an unlisted user should have no keys", keys)
+	}
+
+	// Revoking the key of alice and removing bob changes both.
+	write("users:\n- name: alice\n  sshAuthorizedKeys: [ssh-ed25519 CCCC]\n")
+	changed, err := d.Reload()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(changed, []string{"alice", "bob"}) {
+		t.Errorf("Reload() = %q, want alice and bob", changed)
+	}
+	if changed, _ := d.Reload(); changed != nil {
+		t.Errorf("Reload() of an unchanged file = %q", changed)
+	}
+
+	// An invalid file keeps the previous keys.
+	write("users: {}\n")
+	if _, err := d.Reload(); err == nil {
+		t.Error("Reload() should reject an invalid file")
+	}
+	if keys, _ := d.Keys("alice"); !slices.Equal(keys, []string{"ssh-ed25519 CCCC"}) {
+		t.Errorf("Keys(alice) = %q after an invalid file", keys)
+	}
+}
+
+func TestNilDirectory(t *testing.T) {
+	var d *Directory
+	if _, err := d.Keys("alice"); !errors.Is(err, ErrNotConfigured) {
+		t.Errorf("Keys() = %v, want ErrNotConfigured", err)
+	}
+}
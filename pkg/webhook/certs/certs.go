@@ -32,6 +32,8 @@ import (
 	"github.com/go-logr/logr"
 	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsclientset "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
@@ -45,12 +47,17 @@ type Config struct {
 	CertDir           string
 	CertValidity      time.Duration
 	RenewalThreshold  time.Duration
+	// CRDNames lists the CustomResourceDefinitions whose conversion webhook
+	// is served with these certificates.
+	CRDNames []string
 }
 
 // Ensure provisions TLS certificates for the webhook server. It checks for an
 // existing Secret, regenerates certs if missing or near expiry, writes them to
-// disk, and patches the ValidatingWebhookConfiguration caBundle.
-func Ensure(ctx context.Context, client kubernetes.Interface, cfg Config, log logr.Logger) error {
+// disk, and patches the caBundle of the ValidatingWebhookConfiguration and of
+// the conversion webhook of cfg.CRDNames. crdClient may be nil when no CRD uses
+// a conversion webhook.
+func Ensure(ctx context.Context, client kubernetes.Interface, crdClient apiextensionsclientset.Interface, cfg Config, log logr.Logger) error {
 	dnsNames := dnsNamesForService(cfg.ServiceName, cfg.Namespace)
 
 	// Check for existing secret
@@ -61,7 +68,7 @@ func Ensure(ctx context.Context, client kubernetes.Interface, cfg Config, log lo
 			if err := writeCertsToDisk(cfg.CertDir, existing.Data["tls.crt"], existing.Data["tls.key"]); err != nil {
 				return fmt.Errorf("writing existing certs to disk: %w", err)
 			}
-			return patchWebhookConfig(ctx, client, cfg.WebhookConfigName, existing.Data["ca.crt"], log)
+			return patchWebhookConfig(ctx, client, crdClient, cfg, existing.Data["ca.crt"], log)
 		}
 		log.Info("existing webhook certs need renewal")
 	} else if !apierrors.IsNotFound(err) {
@@ -115,8 +122,8 @@ func Ensure(ctx context.Context, client kubernetes.Interface, cfg Config, log lo
 	}
 	log.Info("wrote webhook certs to disk", "dir", cfg.CertDir)
 
-	// Patch the ValidatingWebhookConfiguration with the CA bundle
-	return patchWebhookConfig(ctx, client, cfg.WebhookConfigName, caPEM, log)
+	// Patch the webhook configurations with the CA bundle
+	return patchWebhookConfig(ctx, client, crdClient, cfg, caPEM, log)
 }
 
 func dnsNamesForService(serviceName, namespace string) []string {
@@ -208,18 +215,35 @@ func needsRenewal(secret *corev1.Secret, threshold time.Duration) bool {
 		return true
 	}
 
+	notAfter, err := certNotAfter(certPEM)
+	if err != nil {
+		return true
+	}
+
+	remaining := time.Until(notAfter)
+	return remaining < threshold
+}
+
+// ReadExpiry returns the expiry time of the serving certificate written to certDir.
+func ReadExpiry(certDir string) (time.Time, error) {
+	certPEM, err := os.ReadFile(filepath.Join(certDir, "tls.crt"))
+	if err != nil {
+		return time.Time{}, fmt.Errorf("reading tls.crt: %w", err)
+	}
+	return certNotAfter(certPEM)
+}
+
+func certNotAfter(certPEM []byte) (time.Time, error) {
 	block, _ := pem.Decode(certPEM)
 	if block == nil {
-		return true
+		return time.Time{}, fmt.Errorf("no PEM block found in certificate")
 	}
 
 	cert, err := x509.ParseCertificate(block.Bytes)
 	if err != nil {
-		return true
+		return time.Time{}, fmt.Errorf("parsing certificate: %w", err)
 	}
-
-	remaining := time.Until(cert.NotAfter)
-	return remaining < threshold
+	return cert.NotAfter, nil
 }
 
 func writeCertsToDisk(certDir string, certPEM, keyPEM []byte) error {
@@ -235,7 +259,8 @@ func writeCertsToDisk(certDir string, certPEM, keyPEM []byte) error {
 	return nil
 }
 
-func patchWebhookConfig(ctx context.Context, client kubernetes.Interface, name string, caBundle []byte, log logr.Logger) error {
+func patchWebhookConfig(ctx context.Context, client kubernetes.Interface, crdClient apiextensionsclientset.Interface, cfg Config, caBundle []byte, log logr.Logger) error {
+	name := cfg.WebhookConfigName
 	vwc, err := client.AdmissionregistrationV1().ValidatingWebhookConfigurations().Get(ctx, name, metav1.GetOptions{})
 	if err != nil {
 		return fmt.Errorf("getting ValidatingWebhookConfiguration %s: %w", name, err)
@@ -269,6 +294,27 @@ func patchWebhookConfig(ctx context.Context, client kubernetes.Interface, name s
 		return fmt.Errorf("getting MutatingWebhookConfiguration %s: %w", mwcName, err)
 	}
 
+	// Patch the conversion webhook of the CRDs
+	if crdClient == nil {
+		return nil
+	}
+	for _, crdName := range cfg.CRDNames {
+		crd, err := crdClient.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, crdName, metav1.GetOptions{})
+		if err != nil {
+			return fmt.Errorf("getting CustomResourceDefinition %s: %w", crdName, err)
+		}
+		conv := crd.Spec.Conversion
+		if conv == nil || conv.Strategy != apiextensionsv1.WebhookConverter || conv.Webhook == nil || conv.Webhook.ClientConfig == nil {
+			log.Info("CustomResourceDefinition has no conversion webhook, skipping", "name", crdName)
+			continue
+		}
+		conv.Webhook.ClientConfig.CABundle = caBundle
+		if _, err := crdClient.ApiextensionsV1().CustomResourceDefinitions().Update(ctx, crd, metav1.UpdateOptions{}); err != nil {
+			return fmt.Errorf("updating CustomResourceDefinition %s: %w", crdName, err)
+		}
+		log.Info("patched CustomResourceDefinition conversion webhook with CA bundle", "name", crdName)
+	}
+
 	return nil
 }
 
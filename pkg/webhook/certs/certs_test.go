@@ -28,6 +28,8 @@ import (
 	"github.com/go-logr/logr"
 	admissionregistrationv1 "k8s.io/api/admissionregistration/v1"
 	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apiextensionsfake "k8s.io/apiextensions-apiserver/pkg/client/clientset/clientset/fake"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes/fake"
 )
@@ -126,6 +128,28 @@ func TestNeedsRenewal(t *testing.T) {
 	}
 }
 
+func TestReadExpiry(t *testing.T) {
+	caCert, caKey, _, _ := generateCA(365 * 24 * time.Hour)
+	certPEM, keyPEM, _ := generateServerCert(caCert, caKey, []string{"test.svc"}, 24*time.Hour)
+
+	dir := t.TempDir()
+	if err := writeCertsToDisk(dir, certPEM, keyPEM); err != nil {
+		t.Fatalf("writeCertsToDisk() error = %v", err)
+	}
+
+	notAfter, err := ReadExpiry(dir)
+	if err != nil {
+		t.Fatalf("ReadExpiry() error = %v", err)
+	}
+	if remaining := time.Until(notAfter); remaining <= 23*time.Hour || remaining > 24*time.Hour {
+		t.Errorf("unexpected expiry %v", notAfter)
+	}
+
+	if _, err := ReadExpiry(t.TempDir()); err == nil {
+		t.Error("expected error for missing tls.crt")
+	}
+}
+
 func TestWriteCertsToDisk(t *testing.T) {
 	dir := t.TempDir()
 	certDir := filepath.Join(dir, "certs")
@@ -215,7 +239,7 @@ func TestEnsure_CreatesNewCerts(t *testing.T) {
 		RenewalThreshold:  30 * 24 * time.Hour,
 	}
 
-	if err := Ensure(ctx, client, cfg, logr.Discard()); err != nil {
+	if err := Ensure(ctx, client, nil, cfg, logr.Discard()); err != nil {
 		t.Fatalf("Ensure() error = %v", err)
 	}
 
@@ -298,7 +322,7 @@ func TestEnsure_SkipsValidCerts(t *testing.T) {
 		RenewalThreshold:  30 * 24 * time.Hour,
 	}
 
-	if err := Ensure(ctx, client, cfg, logr.Discard()); err != nil {
+	if err := Ensure(ctx, client, nil, cfg, logr.Discard()); err != nil {
 		t.Fatalf("Ensure() error = %v", err)
 	}
 
@@ -307,3 +331,82 @@ func TestEnsure_SkipsValidCerts(t *testing.T) {
 		t.Error("tls.crt not written to disk")
 	}
 }
+
+func TestEnsure_PatchesConversionWebhook(t *testing.T) {
+	ctx := context.Background()
+
+	sideEffects := admissionregistrationv1.SideEffectClassNone
+	vwc := &admissionregistrationv1.ValidatingWebhookConfiguration{
+		ObjectMeta: metav1.ObjectMeta{Name: "test-vwc"},
+		Webhooks: []admissionregistrationv1.ValidatingWebhook{
+			{
+				Name:                    "test.webhook.io",
+				SideEffects:             &sideEffects,
+				AdmissionReviewVersions: []string{"v1"},
+			},
+		},
+	}
+	client := fake.NewClientset(vwc)
+
+	path := "/convert"
+	converted := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "butaneconfigs.example.com"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Conversion: &apiextensionsv1.CustomResourceConversion{
+				Strategy: apiextensionsv1.WebhookConverter,
+				Webhook: &apiextensionsv1.WebhookConversion{
+					ClientConfig: &apiextensionsv1.WebhookClientConfig{
+						Service: &apiextensionsv1.ServiceReference{Namespace: "test-ns", Name: "webhook-service", Path: &path},
+					},
+					ConversionReviewVersions: []string{"v1"},
+				},
+			},
+		},
+	}
+	unconverted := &apiextensionsv1.CustomResourceDefinition{
+		ObjectMeta: metav1.ObjectMeta{Name: "others.example.com"},
+		Spec: apiextensionsv1.CustomResourceDefinitionSpec{
+			Conversion: &apiextensionsv1.CustomResourceConversion{Strategy: apiextensionsv1.NoneConverter},
+		},
+	}
+	// NewClientset lacks the managed fields schema of CRDs and fails on updates.
+	crdClient := apiextensionsfake.NewSimpleClientset(converted, unconverted) //nolint:staticcheck
+
+	cfg := Config{
+		ServiceName:       "webhook-service",
+		Namespace:         "test-ns",
+		SecretName:        "webhook-server-cert",
+		WebhookConfigName: "test-vwc",
+		CertDir:           filepath.Join(t.TempDir(), "certs"),
+		CertValidity:      365 * 24 * time.Hour,
+		RenewalThreshold:  30 * 24 * time.Hour,
+		CRDNames:          []string{"butaneconfigs.example.com", "others.example.com"},
+	}
+	if err := Ensure(ctx, client, crdClient, cfg, logr.Discard()); err != nil {
+		t.Fatalf("Ensure() error = %v", err)
+	}
+
+	secret, err := client.CoreV1().Secrets("test-ns").Get(ctx, "webhook-server-cert", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("secret not created: %v", err)
+	}
+	crd, err := crdClient.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, "butaneconfigs.example.com", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting CRD: %v", err)
+	}
+	if string(crd.Spec.Conversion.Webhook.ClientConfig.CABundle) != string(secret.Data["ca.crt"]) {
+		t.Error("CRD conversion webhook caBundle not patched")
+	}
+	other, err := crdClient.ApiextensionsV1().CustomResourceDefinitions().Get(ctx, "others.example.com", metav1.GetOptions{})
+	if err != nil {
+		t.Fatalf("getting CRD: %v", err)
+	}
+	if other.Spec.Conversion.Webhook != nil {
+		t.Error("CRD without a conversion webhook should be left alone")
+	}
+
+	cfg.CRDNames = []string{"missing.example.com"}
+	if err := Ensure(ctx, client, crdClient, cfg, logr.Discard()); err == nil {
+		t.Error("Ensure() should fail when a CRD is missing")
+	}
+}